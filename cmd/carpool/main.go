@@ -3,18 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/controllers"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/docs"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/ratelimit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/recorder"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/webhooks"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/utils"
 )
 
@@ -30,17 +41,261 @@ func main() {
 		"storage_type": storageType,
 	})
 
-	transactionFactory := storage.NewTransactionFactory(storageType)
+	storageConfig := storage.Config{
+		Type:        storageType,
+		KVPath:      utils.GetEnv("KV_PATH", "carpool.db"),
+		RedisURL:    utils.GetEnv("REDIS_URL", "redis://localhost:6379/0"),
+		RedisPrefix: utils.GetEnv("REDIS_PREFIX", "carpool:"),
+		Faults:      utils.GetEnv("STORAGE_FAULTS", ""),
+	}
+	transactionFactory, err := storage.NewTransactionFactory(storageConfig)
+	if err != nil {
+		appLogger.Error("Failed to initialize storage", map[string]interface{}{
+			"storage_type": storageType,
+			"error":        err.Error(),
+		})
+		os.Exit(1)
+	}
+	if faults := utils.GetEnv("STORAGE_FAULTS", ""); faults != "" {
+		appLogger.Warn("Storage faults are injected on purpose, don't run this in production", map[string]interface{}{
+			"faults": faults,
+		})
+	}
+	if closer, ok := transactionFactory.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	txnTimeout, err := time.ParseDuration(utils.GetEnv("TXN_TIMEOUT", "5s"))
+	if err != nil {
+		appLogger.Error("Invalid transaction timeout", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	maxPending, err := strconv.Atoi(utils.GetEnv("MAX_PENDING_PER_CLIENT", "0"))
+	if err != nil || maxPending < 0 {
+		appLogger.Error("Invalid pending journeys per client limit", map[string]interface{}{
+			"value": utils.GetEnv("MAX_PENDING_PER_CLIENT", "0"),
+		})
+		os.Exit(1)
+	}
+
+	scheduleLeadTime, err := time.ParseDuration(utils.GetEnv("SCHEDULE_LEAD_TIME", "5m"))
+	if err != nil || scheduleLeadTime < 0 {
+		appLogger.Error("Invalid schedule lead time", map[string]interface{}{
+			"value": utils.GetEnv("SCHEDULE_LEAD_TIME", "5m"),
+		})
+		os.Exit(1)
+	}
+
+	maxReservation, err := time.ParseDuration(utils.GetEnv("RESERVATION_MAX_TTL", services.DefaultMaxReservation.String()))
+	if err != nil || maxReservation < 0 {
+		appLogger.Error("Invalid reservation max TTL", map[string]interface{}{
+			"value": utils.GetEnv("RESERVATION_MAX_TTL", services.DefaultMaxReservation.String()),
+		})
+		os.Exit(1)
+	}
+
+	agingStep, err := time.ParseDuration(utils.GetEnv("PRIORITY_AGING", services.DefaultAgingStep.String()))
+	if err != nil || agingStep < 0 {
+		appLogger.Error("Invalid priority aging step", map[string]interface{}{
+			"value": utils.GetEnv("PRIORITY_AGING", services.DefaultAgingStep.String()),
+		})
+		os.Exit(1)
+	}
+
+	unservablePolicy, err := services.ParseUnservablePolicy(utils.GetEnv("UNSERVABLE_JOURNEYS", string(services.UnservableFlag)))
+	if err != nil {
+		appLogger.Error("Invalid unservable journeys policy", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	registry := metrics.NewRegistry()
+	// tenants share these, the event log below is for the default fleet only
+	tenantOptions := []services.Option{
+		services.WithMetrics(registry),
+		services.WithTxnTimeout(txnTimeout),
+		services.WithMaxPendingPerOwner(maxPending),
+		services.WithScheduleLeadTime(scheduleLeadTime),
+		services.WithMaxReservation(maxReservation),
+		services.WithAging(agingStep),
+		services.WithUnservablePolicy(unservablePolicy),
+	}
+	serviceOptions := append([]services.Option{}, tenantOptions...)
+	var eventStore events.Store
+	if path := utils.GetEnv("EVENT_STORE_FILE", ""); path != "" {
+		fileStore, err := events.OpenFileStore(path)
+		if err != nil {
+			appLogger.Error("Failed to open event store", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer fileStore.Close()
 
-	carPoolService := services.NewCarPool(transactionFactory)
+		// The event log is the source of truth, rebuild the projections from it
+		history, err := fileStore.Load(1)
+		if err == nil {
+			err = events.Rebuild(context.Background(), transactionFactory, history)
+		}
+		if err != nil {
+			appLogger.Error("Failed to rebuild state from event store", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		appLogger.Info("State rebuilt from event store", map[string]interface{}{
+			"path":   path,
+			"events": len(history),
+		})
+
+		eventStore = fileStore
+		serviceOptions = append(serviceOptions, services.WithEventStore(eventStore))
+	}
+
+	carPoolService := services.NewCarPool(transactionFactory, serviceOptions...)
+
+	webhookStore, err := webhooks.NewStore(utils.GetEnv("WEBHOOKS_STATE_FILE", ""))
+	if err != nil {
+		appLogger.Error("Failed to load webhooks state", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	dispatcher := webhooks.NewDispatcher(webhookStore, webhooks.DefaultConfig())
+
+	tenantRegistry, err := tenants.New(carPoolService, func(id string) (models.TransactionFactory, error) {
+		return storage.NewTransactionFactory(storageConfig.ForTenant(id))
+	}, tenants.WithStateFile(utils.GetEnv("TENANTS_FILE", "")), tenants.WithServiceOptions(tenantOptions...),
+		tenants.WithEventHandler(webhookHandler(dispatcher)))
+	if err != nil {
+		appLogger.Error("Failed to load tenants", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer tenantRegistry.Close()
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go dispatcher.Run(workersCtx)
+
+	consistencyInterval, err := time.ParseDuration(utils.GetEnv("CONSISTENCY_CHECK_INTERVAL", "0"))
+	if err != nil {
+		appLogger.Error("Invalid consistency check interval", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if consistencyInterval > 0 {
+		go tenantRegistry.WatchConsistency(workersCtx, consistencyInterval, utils.GetEnv("CONSISTENCY_REPAIR", "false") == "true")
+	}
+
+	scheduleInterval, err := time.ParseDuration(utils.GetEnv("SCHEDULE_INTERVAL", "10s"))
+	if err != nil || scheduleInterval <= 0 {
+		appLogger.Error("Invalid schedule interval", map[string]interface{}{
+			"value": utils.GetEnv("SCHEDULE_INTERVAL", "10s"),
+		})
+		os.Exit(1)
+	}
+	go tenantRegistry.WatchSchedules(workersCtx, scheduleInterval)
+
+	reservationInterval, err := time.ParseDuration(utils.GetEnv("RESERVATION_INTERVAL", "5s"))
+	if err != nil || reservationInterval <= 0 {
+		appLogger.Error("Invalid reservation interval", map[string]interface{}{
+			"value": utils.GetEnv("RESERVATION_INTERVAL", "5s"),
+		})
+		os.Exit(1)
+	}
+	go tenantRegistry.WatchReservations(workersCtx, reservationInterval)
 
 	engine := gin.New()
 	engine.Use(logger.GinMiddleware(appLogger))
 	engine.Use(gin.Recovery())
 
+	if path := utils.GetEnv("RECORD_FILE", ""); path != "" {
+		recordFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			appLogger.Error("Failed to open request record file", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer recordFile.Close()
+		engine.Use(recorder.Middleware(recordFile))
+	}
+
+	authn, err := newAuthenticator()
+	if err != nil {
+		appLogger.Error("Failed to load API credentials", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if !authn.Enabled() {
+		appLogger.Warn("No API keys nor JWT secret configured, every client may call every route", nil)
+	}
+	engine.Use(authn.Middleware())
+
+	limits, err := ratelimit.ParseLimits(utils.GetEnv("RATE_LIMITS", ""))
+	if err != nil {
+		appLogger.Error("Invalid rate limits", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	limiter := ratelimit.New(limits, ratelimit.WithMetrics(registry))
+
+	var auditStore audit.Store = audit.NewMemoryStore()
+	if path := utils.GetEnv("AUDIT_LOG_FILE", ""); path != "" {
+		fileStore, err := audit.OpenFileStore(path)
+		if err != nil {
+			appLogger.Error("Failed to open audit log", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		defer fileStore.Close()
+		auditStore = fileStore
+	}
+	auditor := audit.New(auditStore, audit.WithTenant(func(ctx context.Context) string {
+		if fleet := tenants.FleetFrom(ctx); fleet != nil {
+			return fleet.Tenant.ID
+		}
+		return ""
+	}))
+
 	carPoolController := controllers.NewCarPool(carPoolService)
+	webhooksController := controllers.NewWebhooks(dispatcher)
+	adminController := controllers.NewAdmin(carPoolService)
+	tenantsController := controllers.NewTenants(tenantRegistry)
 
-	wire(engine, carPoolController)
+	auditController := controllers.NewAudit(auditStore)
+
+	var eventsController *controllers.Events
+	if eventStore != nil {
+		eventsController = controllers.NewEvents(eventStore)
+	}
+	controllers.Wire(engine, controllers.Routes{
+		Auth:        authn,
+		Limiter:     limiter,
+		Auditor:     auditor,
+		Tenants:     tenantRegistry,
+		Metrics:     registry,
+		CarPool:     carPoolController,
+		Webhooks:    webhooksController,
+		Admin:       adminController,
+		TenantAdmin: tenantsController,
+		Audit:       auditController,
+		Events:      eventsController,
+	})
 
 	// Serve OpenAPI and docs
 	engine.GET("/openapi.yaml", func(ctx *gin.Context) {
@@ -78,6 +333,7 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -87,10 +343,35 @@ func main() {
 	}
 }
 
-func wire(e *gin.Engine, c *controllers.CarPool) {
-	e.GET("/status", c.GetStatus)
-	e.Any("/cars", c.PutCars)
-	e.Any("/journey", c.PostJourney)
-	e.Any("/dropoff", c.PostDropoff)
-	e.Any("/locate", c.PostLocate)
+// newAuthenticator accepts the API keys in API_KEYS_FILE and API_KEYS, and
+// tokens signed with JWT_SECRET
+func newAuthenticator() (*auth.Authenticator, error) {
+	var opts []auth.Option
+	if path := utils.GetEnv("API_KEYS_FILE", ""); path != "" {
+		keys, err := auth.LoadKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithKeys(keys))
+	}
+	keys, err := auth.ParseKeys(utils.GetEnv("API_KEYS", ""))
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, auth.WithKeys(keys))
+	if secret := utils.GetEnv("JWT_SECRET", ""); secret != "" {
+		opts = append(opts, auth.WithJWTSecret([]byte(secret)))
+	}
+	return auth.New(opts...), nil
+}
+
+// webhookHandler notifies the events of every fleet to webhooks, naming the
+// tenant but for the default one
+func webhookHandler(d *webhooks.Dispatcher) func(tenantID string) events.Handler {
+	return func(tenantID string) events.Handler {
+		if tenantID == tenants.DefaultID {
+			return d.HandleEvent
+		}
+		return d.TenantHandler(tenantID)
+	}
 }
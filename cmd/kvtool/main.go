@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/kv"
+)
+
+// kvtool maintains the database file of the kv storage backend. The server
+// holds a lock on the file, so stop it first.
+//
+//	kvtool backup -db carpool.db -out carpool.backup.db
+//	kvtool compact -db carpool.db -out carpool.compact.db
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var run func(src, dst string) error
+	switch os.Args[1] {
+	case "backup":
+		run = kv.Backup
+	case "compact":
+		run = kv.Compact
+	default:
+		usage()
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	db := flags.String("db", "carpool.db", "database file of the kv backend")
+	out := flags.String("out", "", "file to write, it must not exist")
+	flags.Parse(os.Args[2:])
+
+	if *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if _, err := os.Stat(*out); err == nil {
+		fmt.Fprintf(os.Stderr, "%s already exists\n", *out)
+		os.Exit(2)
+	}
+
+	if err := run(*db, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", os.Args[1], *db, err)
+		os.Exit(1)
+	}
+
+	before, after := size(*db), size(*out)
+	fmt.Printf("wrote %s, %d bytes (%s is %d bytes)\n", *out, after, *db, before)
+}
+
+func size(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: kvtool backup|compact -db <file> -out <file>")
+	os.Exit(2)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/loadtest"
+)
+
+// loadtest drives a running carpool server over HTTP with a configurable mix of
+// operations, validating response codes and reporting latency histograms.
+//
+//	loadtest -target http://localhost:8080 -rps 500 -workers 32 -duration 1m -mix journey=4,dropoff=3,locate=3
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the carpool server")
+	rps := flag.Float64("rps", 100, "target requests per second, 0 for as fast as possible")
+	workers := flag.Int("workers", 16, "concurrent workers")
+	duration := flag.Duration("duration", 30*time.Second, "length of the run")
+	mix := flag.String("mix", "journey=4,dropoff=3,locate=3,cars=0", "relative weight of each operation")
+	cars := flag.Int("cars", 1000, "fleet size loaded with PUT /cars")
+	unknown := flag.Float64("unknown", 0.05, "share of dropoff/locate calls for ids that don't exist")
+	timeout := flag.Duration("timeout", 5*time.Second, "per request timeout")
+	seed := flag.Int64("seed", 1, "random seed")
+	apiKey := flag.String("api-key", "", "API key of a fleet-admin, for servers that require one")
+	flag.Parse()
+
+	opMix, err := loadtest.ParseMix(*mix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mix: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	stats, elapsed, err := loadtest.Run(ctx, loadtest.Config{
+		BaseURL:      *target,
+		RPS:          *rps,
+		Workers:      *workers,
+		Duration:     *duration,
+		Mix:          opMix,
+		Cars:         *cars,
+		UnknownRatio: *unknown,
+		Timeout:      *timeout,
+		Seed:         *seed,
+		APIKey:       *apiKey,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	stats.Print(os.Stdout, elapsed)
+	if stats.Failures() > 0 {
+		os.Exit(1)
+	}
+}
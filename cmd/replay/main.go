@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/ratelimit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/recorder"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/replay"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/utils"
+)
+
+// replay feeds a request log captured with RECORD_FILE to a fresh service and
+// reports every response that differs from the recorded one.
+//
+//	replay -file calls.jsonl                          # in-process, fresh in-memory server
+//	replay -file calls.jsonl -target http://host:8080 # against a running server
+func main() {
+	file := flag.String("file", "", "JSONL request log to replay")
+	target := flag.String("target", "", "base URL of a running server, replays in-process when empty")
+	ignoreBodies := flag.Bool("ignore-bodies", false, "only compare status codes")
+	stopOnDiff := flag.Bool("stop-on-diff", false, "stop at the first mismatch")
+	timeout := flag.Duration("timeout", 10*time.Second, "per request timeout against a running server")
+	apiKey := flag.String("api-key", "", "API key sent to a running server with the calls that authenticated, the log keeps no credentials")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open %s: %v\n", *file, err)
+		os.Exit(2)
+	}
+	records, err := recorder.Load(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read %s: %v\n", *file, err)
+		os.Exit(2)
+	}
+
+	var t replay.Target
+	if *target == "" {
+		config, err := inProcessConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		if t, err = replay.NewInProcessTarget(config); err != nil {
+			fmt.Fprintf(os.Stderr, "start in-process server: %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		t = &replay.HTTPTarget{BaseURL: *target, Client: &http.Client{Timeout: *timeout}, APIKey: *apiKey}
+	}
+
+	diffs := replay.Run(records, t, replay.Options{IgnoreBodies: *ignoreBodies, StopOnDiff: *stopOnDiff})
+	for _, d := range diffs {
+		fmt.Println(d.String())
+	}
+	fmt.Printf("%d recorded requests, %d mismatches\n", len(records), len(diffs))
+
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// inProcessConfig reads API_KEYS, API_KEYS_FILE, JWT_SECRET and RATE_LIMITS
+// as the server does, so the recorded callers and limits get the same
+// answers they got in production
+func inProcessConfig() (replay.Config, error) {
+	var config replay.Config
+	if path := utils.GetEnv("API_KEYS_FILE", ""); path != "" {
+		keys, err := auth.LoadKeys(path)
+		if err != nil {
+			return config, fmt.Errorf("read API_KEYS_FILE: %v", err)
+		}
+		config.Keys = append(config.Keys, keys...)
+	}
+	keys, err := auth.ParseKeys(utils.GetEnv("API_KEYS", ""))
+	if err != nil {
+		return config, fmt.Errorf("invalid API_KEYS: %v", err)
+	}
+	config.Keys = append(config.Keys, keys...)
+	config.JWTSecret = []byte(utils.GetEnv("JWT_SECRET", ""))
+	if config.Limits, err = ratelimit.ParseLimits(utils.GetEnv("RATE_LIMITS", "")); err != nil {
+		return config, fmt.Errorf("invalid RATE_LIMITS: %v", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/simulation"
+)
+
+// simulate runs a discrete-event simulation of the car pool to size fleets
+// and compare assignment changes before deploying them.
+//
+//	simulate -cars 200 -arrival-rate 30 -trip exp:20m -patience 30m -duration 8h -format csv
+func main() {
+	cars := flag.Int("cars", 100, "number of cars in the fleet")
+	seats := flag.String("seats", "4:1,5:1,6:1", "seats per car distribution as value:weight pairs")
+	arrivalRate := flag.Float64("arrival-rate", 10, "mean groups requesting a journey per minute")
+	groupSizes := flag.String("group-sizes", "1:3,2:4,3:2,4:2,5:1,6:1", "group size distribution as value:weight pairs")
+	trip := flag.String("trip", "exp:15m", "trip duration distribution: fixed:<d>, exp:<mean> or uniform:<min>-<max>")
+	patience := flag.Duration("patience", 30*time.Minute, "wait before a group abandons, 0 waits forever")
+	duration := flag.Duration("duration", 8*time.Hour, "simulated period")
+	sampleInterval := flag.Duration("sample", 5*time.Minute, "interval between time series samples")
+	seed := flag.Int64("seed", 1, "random seed")
+	format := flag.String("format", "json", "output format: json (summary and samples) or csv (samples)")
+	out := flag.String("out", "-", "output file, - for stdout")
+	flag.Parse()
+
+	seatsDist, err := simulation.ParseWeighted(*seats)
+	exitOnError("seats", err)
+	groupDist, err := simulation.ParseWeighted(*groupSizes)
+	exitOnError("group-sizes", err)
+	tripDist, err := simulation.ParseDuration(*trip)
+	exitOnError("trip", err)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := simulation.New(simulation.Config{
+		Cars:           *cars,
+		Seats:          seatsDist,
+		ArrivalRate:    *arrivalRate,
+		GroupSizes:     groupDist,
+		Trip:           tripDist,
+		Patience:       *patience,
+		Duration:       *duration,
+		SampleInterval: *sampleInterval,
+		Seed:           *seed,
+	}).Run(ctx)
+	exitOnError("simulation", err)
+
+	w := os.Stdout
+	if *out != "-" {
+		w, err = os.Create(*out)
+		exitOnError("out", err)
+		defer w.Close()
+	}
+
+	switch *format {
+	case "json":
+		err = report.WriteJSON(w)
+	case "csv":
+		err = report.WriteCSV(w)
+		s := report.Summary
+		fmt.Fprintf(os.Stderr, "journeys=%d served=%d abandoned=%d (%.1f%%) wait p50=%.0fs p90=%.0fs p99=%.0fs utilization=%.1f%%\n",
+			s.Journeys, s.Served, s.Abandoned, s.AbandonmentRate*100, s.WaitP50, s.WaitP90, s.WaitP99, s.SeatUtilization*100)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	exitOnError("output", err)
+}
+
+func exitOnError(what string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", what, err)
+		os.Exit(1)
+	}
+}
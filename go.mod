@@ -3,8 +3,11 @@ module gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/gin-gonic/gin v1.7.7
+	github.com/go-redis/redis/v8 v8.11.4
 	github.com/golang/mock v1.6.0
 	github.com/google/uuid v1.6.0
 	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
 )
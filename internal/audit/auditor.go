@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+)
+
+// Auditor appends an entry to the log for every call it's put in front of
+type Auditor struct {
+	store  Store
+	tenant func(ctx context.Context) string
+	clock  clock.Clock
+	logger *logger.Logger
+}
+
+// Option customizes an Auditor on creation
+type Option func(*Auditor)
+
+// WithTenant tells the tenant of a call from its request context, once the
+// call is answered
+func WithTenant(tenant func(ctx context.Context) string) Option {
+	return func(a *Auditor) {
+		a.tenant = tenant
+	}
+}
+
+// WithClock timestamps entries with the given clock instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(a *Auditor) {
+		a.clock = c
+	}
+}
+
+func New(store Store, opts ...Option) *Auditor {
+	a := &Auditor{
+		store:  store,
+		clock:  clock.Real{},
+		logger: logger.New("audit"),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Store returns the log the entries go to
+func (a *Auditor) Store() Store {
+	return a.store
+}
+
+// Middleware audits the calls that may change something, whether they
+// succeed or not, once they are answered. Reads go through unaudited.
+func (a *Auditor) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		requestCtx, n := withNote(ctx.Request.Context())
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+		ctx.Next()
+
+		entry := &Entry{
+			Time:      a.clock.Now(),
+			Actor:     auth.ClientID(ctx),
+			RequestID: logger.GetRequestID(requestCtx),
+			Operation: ctx.Request.Method + " " + ctx.Request.URL.RequestURI(),
+			Status:    ctx.Writer.Status(),
+			Summary:   n.read(),
+		}
+		if a.tenant != nil {
+			entry.Tenant = a.tenant(ctx.Request.Context())
+		}
+		if p := auth.PrincipalFrom(ctx.Request.Context()); p != nil {
+			entry.Role = string(p.Role)
+		}
+		if err := a.store.Append(entry); err != nil {
+			a.logger.Error("Failed to append audit entry", map[string]interface{}{
+				"actor":      entry.Actor,
+				"operation":  entry.Operation,
+				"status":     entry.Status,
+				"error":      err.Error(),
+				"request_id": entry.RequestID,
+			})
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware_RecordsMutatingCalls(t *testing.T) {
+	store := NewMemoryStore()
+	a := New(store)
+	e := gin.New()
+	e.Any("/cars", a.Middleware(), func(ctx *gin.Context) {
+		if ctx.Request.Method == http.MethodPut {
+			Describe(ctx.Request.Context(), &Summary{CarsAdded: []uint{1}})
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req, _ := http.NewRequest(method, "/cars?x=1", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entries, _ := store.Load(1)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the PUT to be audited, got %d entries", len(entries))
+	}
+	got := entries[0]
+	if got.Seq != 1 || got.Actor != "ip:10.0.0.1" || got.Operation != "PUT /cars?x=1" || got.Status != http.StatusOK {
+		t.Fatalf("unexpected entry %+v", got)
+	}
+	if got.Summary == nil || len(got.Summary.CarsAdded) != 1 || got.Summary.CarsAdded[0] != 1 {
+		t.Fatalf("expected the summary the handler described, got %+v", got.Summary)
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore returned error: %v", err)
+	}
+	for _, op := range []string{"PUT /cars", "POST /webhooks"} {
+		if err := store.Append(&Entry{Actor: "ops", Operation: op, Status: 200}); err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+	}
+	store.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore returned error: %v", err)
+	}
+	defer store.Close()
+	if err := store.Append(&Entry{Actor: "ops", Operation: "DELETE /webhooks/1", Status: 204}); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	entries, _ := store.Load(2)
+	if len(entries) != 2 || entries[0].Operation != "POST /webhooks" || entries[1].Seq != 3 {
+		t.Fatalf("unexpected entries after reopening: %+v", entries)
+	}
+}
@@ -0,0 +1,71 @@
+// Package audit keeps an append-only log of the calls changing a fleet, who
+// made them and what they changed
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Entry is one audited call
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Actor is the name of the API key or token subject, or the client IP
+	// address prefixed with ip: when the call didn't authenticate
+	Actor     string   `json:"actor"`
+	Role      string   `json:"role,omitempty"`
+	RequestID string   `json:"requestId,omitempty"`
+	Tenant    string   `json:"tenant,omitempty"`
+	Operation string   `json:"operation"`
+	Status    int      `json:"status"`
+	Summary   *Summary `json:"summary,omitempty"`
+}
+
+// Summary is what a call changed, as told by the service handling it
+type Summary struct {
+	CarsAdded          []uint `json:"carsAdded,omitempty"`
+	CarsRemoved        []uint `json:"carsRemoved,omitempty"`
+	CarsChanged        []uint `json:"carsChanged,omitempty"`
+	JourneysDropped    []uint `json:"journeysDropped,omitempty"`
+	ViolationsRepaired int    `json:"violationsRepaired,omitempty"`
+}
+
+// note is where the service handling an audited call leaves its summary
+type note struct {
+	mu      sync.Mutex
+	summary *Summary
+}
+
+type noteKey struct{}
+
+func withNote(ctx context.Context) (context.Context, *note) {
+	n := &note{}
+	return context.WithValue(ctx, noteKey{}, n), n
+}
+
+// Wanted tells whether the call ctx belongs to is audited, so that services
+// only gather what a summary needs when someone reads it
+func Wanted(ctx context.Context) bool {
+	_, ok := ctx.Value(noteKey{}).(*note)
+	return ok
+}
+
+// Describe sets the summary of the audited call ctx belongs to, replacing
+// the one of an earlier attempt
+func Describe(ctx context.Context, s *Summary) {
+	n, ok := ctx.Value(noteKey{}).(*note)
+	if !ok {
+		return
+	}
+	n.mu.Lock()
+	n.summary = s
+	n.mu.Unlock()
+}
+
+func (n *note) read() *Summary {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.summary
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Store is an append-only audit log
+type Store interface {
+	// Append assigns the entry the next sequence number and persists it
+	Append(e *Entry) error
+	// Load returns the entries with Seq greater than or equal to fromSeq, in order
+	Load(fromSeq uint64) ([]Entry, error)
+}
+
+// MemoryStore keeps the log in process memory, it's gone on restart
+type MemoryStore struct {
+	entries []Entry
+	mu      sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make([]Entry, 0),
+	}
+}
+
+func (s *MemoryStore) Append(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Seq = uint64(len(s.entries)) + 1
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+func (s *MemoryStore) Load(fromSeq uint64) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return since(s.entries, fromSeq), nil
+}
+
+// FileStore keeps the log as a JSON lines file, one entry per line
+type FileStore struct {
+	file    *os.File
+	entries []Entry
+	mu      sync.RWMutex
+}
+
+// OpenFileStore opens or creates the log at path, loading existing entries
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{file: file, entries: make([]Entry, 0)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.entries = append(s.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Append(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.Seq = uint64(len(s.entries)) + 1
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+func (s *FileStore) Load(fromSeq uint64) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return since(s.entries, fromSeq), nil
+}
+
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
+
+func since(entries []Entry, fromSeq uint64) []Entry {
+	if fromSeq < 1 {
+		fromSeq = 1
+	}
+	if fromSeq > uint64(len(entries)) {
+		return []Entry{}
+	}
+	out := make([]Entry, len(entries)-int(fromSeq-1))
+	copy(out, entries[fromSeq-1:])
+	return out
+}
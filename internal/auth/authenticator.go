@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// APIKeyHeader carries an API key, tokens go in Authorization as Bearer
+const APIKeyHeader = "X-API-Key"
+
+var (
+	errUnknownKey = errors.New("unknown API key")
+	errAuthScheme = errors.New("only Bearer tokens go in the Authorization header")
+	errNoTokens   = errors.New("bearer tokens aren't accepted, use an API key")
+)
+
+// Authenticator checks the credentials of every request against the API
+// keys and the token secret it was given. Without either, authentication is
+// off and every request may call every route.
+type Authenticator struct {
+	// keys are looked up by hash, so the lookup time says nothing about how
+	// close a wrong key was to a real one
+	keys      map[[sha256.Size]byte]Principal
+	jwtSecret []byte
+	clock     clock.Clock
+	logger    *logger.Logger
+}
+
+// Option customizes an Authenticator on creation
+type Option func(*Authenticator)
+
+// WithKeys accepts the given API keys
+func WithKeys(keys []Key) Option {
+	return func(a *Authenticator) {
+		for _, k := range keys {
+			a.keys[sha256.Sum256([]byte(k.Key))] = Principal{Name: k.Name, Role: k.Role}
+		}
+	}
+}
+
+// WithJWTSecret accepts bearer tokens signed with HS256 and the given secret
+func WithJWTSecret(secret []byte) Option {
+	return func(a *Authenticator) {
+		a.jwtSecret = secret
+	}
+}
+
+// WithClock checks token expiry against the given clock instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(a *Authenticator) {
+		a.clock = c
+	}
+}
+
+func New(opts ...Option) *Authenticator {
+	a := &Authenticator{
+		keys:   make(map[[sha256.Size]byte]Principal),
+		clock:  clock.Real{},
+		logger: logger.New("auth"),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Enabled tells whether requests must authenticate
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// Middleware authenticates the requests bringing credentials and puts who
+// they are in the request context. Wrong credentials are refused right away,
+// requests without any are left for Require to refuse.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !a.Enabled() {
+			return
+		}
+		p, err := a.authenticate(ctx.Request)
+		if err != nil {
+			a.logger.Warn("Authentication failed", map[string]interface{}{
+				"error":      err.Error(),
+				"path":       ctx.Request.URL.Path,
+				"remote_ip":  ctx.ClientIP(),
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+			abort(ctx, models.NewAPIError(http.StatusUnauthorized, models.ErrUnauthorized.Message, err.Error()))
+			return
+		}
+		if p != nil {
+			ctx.Request = ctx.Request.WithContext(WithPrincipal(ctx.Request.Context(), p))
+		}
+	}
+}
+
+// Require refuses requests unless they authenticated with a role allowing
+// the given one, with 401 Unauthorized when they didn't authenticate and 403
+// Forbidden when their role falls short
+func (a *Authenticator) Require(role Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !a.Enabled() {
+			return
+		}
+		p := PrincipalFrom(ctx.Request.Context())
+		if p == nil {
+			abort(ctx, models.ErrUnauthorized)
+			return
+		}
+		if !p.Role.Allows(role) {
+			a.logger.Warn("Role not allowed", map[string]interface{}{
+				"principal":  p.Name,
+				"role":       p.Role,
+				"required":   role,
+				"path":       ctx.Request.URL.Path,
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+			abort(ctx, models.ErrForbidden)
+			return
+		}
+	}
+}
+
+// ClientID names who made a request, for the limits applied per client: the
+// principal it authenticated as, or its IP address when it didn't
+func ClientID(ctx *gin.Context) string {
+	if p := PrincipalFrom(ctx.Request.Context()); p != nil {
+		return p.Name
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// authenticate returns nil without error for requests without credentials
+func (a *Authenticator) authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		p, ok := a.keys[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, errUnknownKey
+		}
+		return &p, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header {
+		return nil, errAuthScheme
+	}
+	if len(a.jwtSecret) == 0 {
+		return nil, errNoTokens
+	}
+	return verifyToken(a.jwtSecret, token, a.clock.Now())
+}
+
+func abort(ctx *gin.Context, err *models.APIError) {
+	if err.Code == http.StatusUnauthorized {
+		ctx.Header("WWW-Authenticate", `Bearer realm="carpool"`)
+	}
+	ctx.AbortWithStatusJSON(err.HTTPStatus(), err)
+}
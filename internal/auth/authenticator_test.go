@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+var (
+	secret = []byte("test-secret")
+	now    = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func newTestEngine(a *Authenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(a.Middleware())
+	ok := func(ctx *gin.Context) {
+		name := ""
+		if p := PrincipalFrom(ctx.Request.Context()); p != nil {
+			name = p.Name
+		}
+		ctx.String(http.StatusOK, name)
+	}
+	e.PUT("/cars", a.Require(RoleFleetAdmin), ok)
+	e.POST("/journey", a.Require(RoleDispatcher), ok)
+	e.POST("/locate", a.Require(RoleReader), ok)
+	return e
+}
+
+func call(e *gin.Engine, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func apiError(t *testing.T, w *httptest.ResponseRecorder) models.APIError {
+	t.Helper()
+	var body models.APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	return body
+}
+
+func TestRolesPerRoute(t *testing.T) {
+	e := newTestEngine(New(WithKeys([]Key{
+		{Name: "ops", Role: RoleFleetAdmin, Key: "admin-key"},
+		{Name: "app", Role: RoleDispatcher, Key: "dispatch-key"},
+		{Name: "dashboard", Role: RoleReader, Key: "read-key"},
+	})))
+
+	for _, tc := range []struct {
+		key    string
+		method string
+		path   string
+		status int
+	}{
+		{"admin-key", "PUT", "/cars", http.StatusOK},
+		{"admin-key", "POST", "/locate", http.StatusOK},
+		{"dispatch-key", "PUT", "/cars", http.StatusForbidden},
+		{"dispatch-key", "POST", "/journey", http.StatusOK},
+		{"dispatch-key", "POST", "/locate", http.StatusOK},
+		{"read-key", "POST", "/journey", http.StatusForbidden},
+		{"read-key", "POST", "/locate", http.StatusOK},
+	} {
+		w := call(e, tc.method, tc.path, map[string]string{APIKeyHeader: tc.key})
+		assert.Equal(t, tc.status, w.Code, "%s %s with %s", tc.method, tc.path, tc.key)
+		if tc.status == http.StatusForbidden {
+			assert.Equal(t, models.ErrForbidden.Message, apiError(t, w).Message)
+		}
+	}
+
+	w := call(e, "POST", "/locate", map[string]string{APIKeyHeader: "read-key"})
+	assert.Equal(t, "dashboard", w.Body.String(), "the handler sees who called")
+}
+
+func TestMayActAs(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, MayActAs(ctx, RoleSupervisor), "without authentication every request may")
+	assert.False(t, MayActAs(WithPrincipal(ctx, &Principal{Name: "app", Role: RoleDispatcher}), RoleSupervisor))
+	assert.True(t, MayActAs(WithPrincipal(ctx, &Principal{Name: "desk", Role: RoleSupervisor}), RoleSupervisor))
+	assert.True(t, MayActAs(WithPrincipal(ctx, &Principal{Name: "ops", Role: RoleFleetAdmin}), RoleSupervisor))
+}
+
+func TestUnauthenticated(t *testing.T) {
+	e := newTestEngine(New(WithKeys([]Key{{Name: "ops", Role: RoleFleetAdmin, Key: "admin-key"}})))
+
+	w := call(e, "PUT", "/cars", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, models.ErrUnauthorized.Message, apiError(t, w).Message)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	w = call(e, "POST", "/locate", map[string]string{APIKeyHeader: "admin-kex"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "unknown API key", apiError(t, w).Details)
+
+	w = call(e, "POST", "/locate", map[string]string{"Authorization": "Bearer whatever"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "tokens aren't accepted without a secret")
+}
+
+func TestTokens(t *testing.T) {
+	e := newTestEngine(New(WithJWTSecret(secret), WithClock(clock.NewFake(now))))
+	bearer := func(token string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	dispatcher := IssueToken(secret, Principal{Name: "app", Role: RoleDispatcher}, now, now.Add(time.Hour))
+	w := call(e, "POST", "/journey", bearer(dispatcher))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "app", w.Body.String())
+	assert.Equal(t, http.StatusForbidden, call(e, "PUT", "/cars", bearer(dispatcher)).Code)
+
+	expired := IssueToken(secret, Principal{Name: "app", Role: RoleDispatcher}, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, call(e, "POST", "/journey", bearer(expired)).Code)
+
+	forged := IssueToken([]byte("other-secret"), Principal{Name: "app", Role: RoleFleetAdmin}, now, now.Add(time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, call(e, "PUT", "/cars", bearer(forged)).Code)
+
+	// an unsigned token claiming to need no signature
+	parts := strings.Split(IssueToken(secret, Principal{Name: "app", Role: RoleFleetAdmin}, now, now.Add(time.Hour)), ".")
+	unsigned := tokenEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	assert.Equal(t, http.StatusUnauthorized, call(e, "PUT", "/cars", bearer(unsigned)).Code)
+}
+
+func TestDisabledLetsEveryoneIn(t *testing.T) {
+	a := New()
+	assert.False(t, a.Enabled())
+	assert.Equal(t, http.StatusOK, call(newTestEngine(a), "PUT", "/cars", nil).Code)
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("ops:fleet-admin:a:b, app:dispatcher:c")
+	require.NoError(t, err)
+	assert.Equal(t, []Key{
+		{Name: "ops", Role: RoleFleetAdmin, Key: "a:b"},
+		{Name: "app", Role: RoleDispatcher, Key: "c"},
+	}, keys)
+
+	for _, spec := range []string{"ops:fleet-admin", "ops:root:key", ":reader:key", "ops:reader:"} {
+		_, err := ParseKeys(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"name":"ops","role":"fleet-admin","key":"k"}]`), 0o600))
+	keys, err := LoadKeys(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Key{{Name: "ops", Role: RoleFleetAdmin, Key: "k"}}, keys)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"name":"ops","role":"admin","key":"k"}]`), 0o600))
+	_, err = LoadKeys(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Key is an API key and who it authenticates
+type Key struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	Key  string `json:"key"`
+}
+
+func (k Key) validate() error {
+	if k.Name == "" || k.Key == "" {
+		return fmt.Errorf("API key needs a name and a key")
+	}
+	if _, err := ParseRole(string(k.Role)); err != nil {
+		return fmt.Errorf("API key %s: %w", k.Name, err)
+	}
+	return nil
+}
+
+// LoadKeys reads a JSON array of keys, as in
+// [{"name": "ops", "role": "fleet-admin", "key": "..."}]
+func LoadKeys(path string) ([]Key, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("reading API keys %s: %w", path, err)
+	}
+	for _, k := range keys {
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// ParseKeys reads keys written as in API_KEYS, name:role:key separated by
+// commas. The key goes last so it may hold colons.
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("API key entry %q is not name:role:key", parts[0])
+		}
+		k := Key{Name: parts[0], Role: Role(parts[1]), Key: parts[2]}
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
@@ -0,0 +1,68 @@
+// Package auth tells who calls the API, from an API key or a signed token,
+// and whether their role lets them call a route
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+type Role string
+
+// Each role may do everything the roles before it may
+const (
+	// RoleReader locates journeys and reads listings
+	RoleReader Role = "reader"
+	// RoleDispatcher requests journeys and drops them off
+	RoleDispatcher Role = "dispatcher"
+	// RoleSupervisor also requests journeys of a priority class above standard
+	RoleSupervisor Role = "supervisor"
+	// RoleFleetAdmin loads the fleet and runs the admin endpoints
+	RoleFleetAdmin Role = "fleet-admin"
+)
+
+var ranks = map[Role]int{
+	RoleReader:     1,
+	RoleDispatcher: 2,
+	RoleSupervisor: 3,
+	RoleFleetAdmin: 4,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if ranks[role] == 0 {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return role, nil
+}
+
+// Allows tells whether the role may call a route requiring the given one
+func (r Role) Allows(required Role) bool {
+	return ranks[r] > 0 && ranks[r] >= ranks[required]
+}
+
+// Principal is who a request was authenticated as
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// MayActAs tells whether the request may do what the given role may: it
+// authenticated with a role allowing it, or authentication is off
+func MayActAs(ctx context.Context, role Role) bool {
+	p := PrincipalFrom(ctx)
+	return p == nil || p.Role.Allows(role)
+}
+
+// PrincipalFrom returns who the request was authenticated as, nil when
+// authentication is off
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
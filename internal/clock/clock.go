@@ -0,0 +1,47 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time, so that time dependent logic can run on a simulated
+// or fixed clock in simulations and tests
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the wall clock
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a manually driven clock, safe for concurrent use
+type Fake struct {
+	now time.Time
+	mu  sync.RWMutex
+}
+
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.now
+}
+
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	f.now = t
+	f.mu.Unlock()
+}
+
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
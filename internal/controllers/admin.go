@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+)
+
+type Admin struct {
+	service *services.CarPool
+	logger  *logger.Logger
+}
+
+func NewAdmin(service *services.CarPool) *Admin {
+	return &Admin{
+		service: service,
+		logger:  logger.New("admin-controller"),
+	}
+}
+
+// GetConsistency checks the invariants between cars, journeys and the
+// pending queue without changing anything.
+//
+// GET /admin/consistency
+// Responses:
+// - 200 OK with the report, its violations empty when the fleet is consistent
+// - 503 Service Unavailable when the check timed out
+func (c *Admin) GetConsistency(ctx *gin.Context) {
+	c.checkConsistency(ctx, false)
+}
+
+// PostConsistencyRepair checks the invariants and fixes the violations it
+// can, taking the journeys as the truth.
+//
+// POST /admin/consistency/repair
+// Responses:
+// - 200 OK with the report, each violation telling whether it was repaired
+// - 409 Conflict when concurrent updates kept the repair from committing
+// - 503 Service Unavailable when the repair timed out
+func (c *Admin) PostConsistencyRepair(ctx *gin.Context) {
+	c.checkConsistency(ctx, true)
+}
+
+func (c *Admin) checkConsistency(ctx *gin.Context, repair bool) {
+	report, err := serviceFor(ctx, c.service).CheckConsistency(ctx.Request.Context(), repair)
+	if err != nil {
+		c.logger.Error("Consistency check failed", map[string]interface{}{
+			"repair":     repair,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type Audit struct {
+	store  audit.Store
+	logger *logger.Logger
+}
+
+func NewAudit(store audit.Store) *Audit {
+	return &Audit{
+		store:  store,
+		logger: logger.New("audit-controller"),
+	}
+}
+
+// GetAudit returns the audit log, oldest first.
+//
+// GET /admin/audit?from=<seq>&actor=<actor>&tenant=<tenant>&since=<RFC3339>
+// Responses:
+// - 200 OK with the list of entries
+// - 400 Bad Request on malformed query parameters
+func (c *Audit) GetAudit(ctx *gin.Context) {
+	entries, ok := c.query(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// GetAuditExport returns the audit log as JSON lines, one entry per line,
+// taking the same filters as GetAudit.
+//
+// GET /admin/audit/export
+// Responses:
+// - 200 OK with the entries as application/x-ndjson
+// - 400 Bad Request on malformed query parameters
+func (c *Audit) GetAuditExport(ctx *gin.Context) {
+	entries, ok := c.query(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+	encoder := json.NewEncoder(ctx.Writer)
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			c.logger.Error("Failed to write audit export", map[string]interface{}{
+				"error":      err.Error(),
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+			return
+		}
+	}
+}
+
+// query loads the entries matching the filters of the request, answering it
+// with an error when it can't
+func (c *Audit) query(ctx *gin.Context) ([]audit.Entry, bool) {
+	from, err := strconv.ParseUint(ctx.DefaultQuery("from", "1"), 10, 64)
+	if err != nil {
+		writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid from parameter", err.Error()))
+		return nil, false
+	}
+
+	var since time.Time
+	if raw := ctx.Query("since"); raw != "" {
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid since parameter", err.Error()))
+			return nil, false
+		}
+	}
+
+	entries, err := c.store.Load(from)
+	if err != nil {
+		c.logger.Error("Failed to load audit log", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, models.NewAPIError(http.StatusInternalServerError, "Failed to load audit log", err.Error()))
+		return nil, false
+	}
+
+	actor, tenant := ctx.Query("actor"), ctx.Query("tenant")
+	filtered := make([]audit.Entry, 0, len(entries))
+	for _, e := range entries {
+		if (actor != "" && e.Actor != actor) || (tenant != "" && e.Tenant != tenant) || e.Time.Before(since) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered, true
+}
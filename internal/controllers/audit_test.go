@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestAPI_AuditsFleetChanges(t *testing.T) {
+	c := NewCarPool(services.NewCarPool(inMemory.NewTransactionFactory()))
+	store := audit.NewMemoryStore()
+	a := NewAudit(store)
+	e := gin.New()
+	e.Any("/cars", audit.New(store).Middleware(), c.PutCars)
+	e.Any("/journey", c.PostJourney)
+	e.GET("/admin/audit", a.GetAudit)
+	e.GET("/admin/audit/export", a.GetAuditExport)
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 200, call("PUT", "/cars", `[{"id": 1, "seats": 4}, {"id": 2, "seats": 4}]`).Code)
+	assert.Equal(t, 200, call("POST", "/journey", `{"id": 7, "passengers": 2}`).Code)
+	assert.Equal(t, 200, call("PUT", "/cars", `[{"id": 2, "seats": 6}, {"id": 3, "seats": 5}]`).Code)
+	assert.Equal(t, 400, call("PUT", "/cars", `[{"id": 4, "seats": 9}]`).Code)
+
+	w := call("GET", "/admin/audit?from=2", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"operation":"PUT /cars","status":200,"summary":{"carsAdded":[3],"carsRemoved":[1],"carsChanged":[2],"journeysDropped":[7]}`)
+	assert.Contains(t, w.Body.String(), `"status":400}`)
+	assert.Equal(t, 400, call("GET", "/admin/audit?since=yesterday", "").Code)
+
+	w = call("GET", "/admin/audit/export", "")
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "\n"))
+}
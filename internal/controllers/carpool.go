@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 	model "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
 )
 
 type CarPool struct {
@@ -25,6 +29,15 @@ func NewCarPool(service *services.CarPool) *CarPool {
 	return c
 }
 
+// serviceFor returns the service of the fleet the request is for, the
+// given one when it names none
+func serviceFor(ctx *gin.Context, service *services.CarPool) *services.CarPool {
+	if fleet := tenants.FleetFrom(ctx.Request.Context()); fleet != nil {
+		return fleet.Service
+	}
+	return service
+}
+
 // GetStatus returns a basic health status for the API.
 //
 // GET /status
@@ -33,15 +46,17 @@ func (c *CarPool) GetStatus(ctx *gin.Context) {
 	ctx.String(http.StatusOK, `{"status":"ok"}`)
 }
 
-// PutCars resets the fleet with a new set of cars.
+// PutCars resets the fleet with a new set of cars, or merges them into it
+// keeping the journeys with mode=merge.
 //
-// PUT /cars
+// PUT /cars?mode=reset|merge&dryRun=true
 // Content-Type: application/json
-// Request body: array of Car { id: number, seats: number }
+// Request body: array of Car { id: number, seats: number, wheelchair?: bool, childSeats?: number, luggage?: number }
 // Sets availableSeats to seats for each car.
 // Responses:
-// - 200 OK on success
-// - 400 Bad Request when duplicated id or invalid payload
+// - 200 OK on success, with the merge plan when merging
+// - 400 Bad Request when duplicated id, invalid payload or query
+// - 422 Unprocessable Entity when merging leaves a car short of what its riders use
 // - 415/405 for wrong content type/method
 func (c *CarPool) PutCars(ctx *gin.Context) {
 	if ctx.Request.Method != "PUT" {
@@ -61,15 +76,41 @@ func (c *CarPool) PutCars(ctx *gin.Context) {
 		return
 	}
 
+	mode := ctx.DefaultQuery("mode", "reset")
+	if mode != "reset" && mode != "merge" {
+		writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid mode parameter", "expected reset or merge"))
+		return
+	}
+	dryRun := ctx.Query("dryRun") == "true"
+	if dryRun && mode != "merge" {
+		writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Dry runs are only for merges", ""))
+		return
+	}
+
 	var cars []*model.Car
 	if err := ctx.BindJSON(&cars); err != nil {
 		return
 	}
 	for _, car := range cars {
 		car.AvailableSeats = car.Seats
+		car.Draining = false
 	}
 
-	if err := c.service.ResetCars(ctx, cars); err != nil {
+	if mode == "merge" {
+		plan, err := serviceFor(ctx, c.service).MergeCars(ctx.Request.Context(), cars, dryRun)
+		if err != nil {
+			c.logger.Error("Failed to merge cars", map[string]interface{}{
+				"error":      err.Error(),
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+			writeError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, plan)
+		return
+	}
+
+	if err := serviceFor(ctx, c.service).ResetCars(ctx.Request.Context(), cars); err != nil {
 		c.logger.Error("Failed to reset cars", map[string]interface{}{
 			"error":      err.Error(),
 			"request_id": logger.GetRequestID(ctx.Request.Context()),
@@ -89,10 +130,14 @@ func (c *CarPool) PutCars(ctx *gin.Context) {
 //
 // POST /journey
 // Content-Type: application/json
-// Request body: Journey { id: number, passengers: number }
+// Request body: Journey { id: number, passengers: number, pickupAt?: RFC3339, class?: string, wheelchair?: bool, childSeats?: number, luggage?: number }
 // Responses:
 // - 200 OK on success
-// - 400 Bad Request on duplicated id
+// - 202 Accepted when scheduled for a later pickup
+// - 400 Bad Request on duplicated id or unknown priority class
+// - 403 Forbidden for a class above standard unless the role is supervisor or higher
+// - 422 Unprocessable Entity when no car in the fleet could carry the group, and unservable journeys are rejected
+// - 429 Too Many Requests when the client has too many groups waiting or scheduled
 // - 415/405 for wrong content type/method
 func (c *CarPool) PostJourney(ctx *gin.Context) {
 	if ctx.Request.Method != "POST" {
@@ -116,7 +161,14 @@ func (c *CarPool) PostJourney(ctx *gin.Context) {
 	if err := ctx.BindJSON(&journey); err != nil {
 		return
 	}
-	if err := c.service.NewJourney(ctx, &journey); err != nil {
+	// the car is for the service to pick, not the client
+	journey.CarID = nil
+	journey.Owner = auth.ClientID(ctx)
+	if !c.mayRequestClass(ctx, journey.Class) {
+		writeError(ctx, models.ErrClassForbidden)
+		return
+	}
+	if err := serviceFor(ctx, c.service).NewJourney(ctx.Request.Context(), &journey); err != nil {
 		c.logger.Error("Failed to create journey", map[string]interface{}{
 			"journey_id": journey.Id,
 			"error":      err.Error(),
@@ -130,6 +182,72 @@ func (c *CarPool) PostJourney(ctx *gin.Context) {
 		}
 		return
 	}
+	if journey.IsScheduled() {
+		ctx.Status(http.StatusAccepted)
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// mayRequestClass tells whether the caller may put a group in the given class,
+// only supervisors and above may have one jump the standard queue
+func (c *CarPool) mayRequestClass(ctx *gin.Context, class models.PriorityClass) bool {
+	if class.Rank() <= 0 || auth.MayActAs(ctx.Request.Context(), auth.RoleSupervisor) {
+		return true
+	}
+	c.logger.Warn("Priority class not allowed for the role", map[string]interface{}{
+		"class":      class,
+		"client":     auth.ClientID(ctx),
+		"request_id": logger.GetRequestID(ctx.Request.Context()),
+	})
+	return false
+}
+
+// PostReschedule moves the pickup of a scheduled journey not promoted yet.
+//
+// POST /reschedule
+// Content-Type: application/json
+// Request body: { id: number, pickupAt: RFC3339 }
+// Responses:
+// - 200 OK on success
+// - 400 Bad Request when the pickup time is gone
+// - 404 Not Found if no such journey is scheduled
+// - 415/405 for wrong content type/method
+func (c *CarPool) PostReschedule(ctx *gin.Context) {
+	if ctx.Request.Method != "POST" {
+		c.logger.Error("Invalid method for reschedule endpoint", map[string]interface{}{
+			"method":     ctx.Request.Method,
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		ctx.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+	if ctx.ContentType() != "application/json" {
+		c.logger.Error("Invalid content type for reschedule endpoint", map[string]interface{}{
+			"content_type": ctx.ContentType(),
+			"request_id":   logger.GetRequestID(ctx.Request.Context()),
+		})
+		ctx.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var reschedule struct {
+		Id       uint      `json:"id" binding:"required"`
+		PickupAt time.Time `json:"pickupAt" binding:"required"`
+	}
+	if err := ctx.BindJSON(&reschedule); err != nil {
+		return
+	}
+
+	if err := serviceFor(ctx, c.service).Reschedule(ctx.Request.Context(), reschedule.Id, reschedule.PickupAt); err != nil {
+		c.logger.Error("Failed to reschedule journey", map[string]interface{}{
+			"journey_id": reschedule.Id,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
 	ctx.Status(http.StatusOK)
 }
 
@@ -140,7 +258,7 @@ func (c *CarPool) PostJourney(ctx *gin.Context) {
 // Request body: ID=<journeyId>
 // Responses:
 // - 200 OK on success (and triggers reassignment asynchronously)
-// - 204 No Content if journey had no car assigned
+// - 204 No Content if journey had no car assigned, or was scheduled and is canceled
 // - 404 Not Found if journey doesn't exist
 // - 415/405 for wrong content type/method
 func (c *CarPool) PostDropoff(ctx *gin.Context) {
@@ -168,7 +286,8 @@ func (c *CarPool) PostDropoff(ctx *gin.Context) {
 		return
 	}
 
-	car, err := c.service.Dropoff(ctx, dropoff.Id)
+	service := serviceFor(ctx, c.service)
+	car, err := service.Dropoff(ctx.Request.Context(), dropoff.Id)
 	if err != nil {
 		c.logger.Error("Failed to process dropoff", map[string]interface{}{
 			"journey_id": dropoff.Id,
@@ -186,7 +305,9 @@ func (c *CarPool) PostDropoff(ctx *gin.Context) {
 		ctx.Status(http.StatusNoContent)
 		return
 	} else {
-		if err := c.service.Reassign(ctx, car); err != nil {
+		// the freed seats go to waiting groups even if the client is gone by now
+		requestCtx := logger.SetRequestID(context.Background(), logger.GetRequestID(ctx.Request.Context()))
+		if err := service.Reassign(requestCtx, car); err != nil {
 			c.logger.Error("Failed to reassign car after dropoff", map[string]interface{}{
 				"car_id":     car.ID,
 				"journey_id": dropoff.Id,
@@ -206,7 +327,7 @@ func (c *CarPool) PostDropoff(ctx *gin.Context) {
 // Request body: ID=<journeyId>
 // Responses:
 // - 200 OK with car JSON when assigned
-// - 204 No Content when not assigned
+// - 204 No Content when not assigned, scheduled ones included
 // - 404 Not Found if journey doesn't exist
 // - 415/405 for wrong content type/method
 func (c *CarPool) PostLocate(ctx *gin.Context) {
@@ -234,7 +355,7 @@ func (c *CarPool) PostLocate(ctx *gin.Context) {
 		return
 	}
 
-	car, err := c.service.Locate(ctx, locate.Id)
+	car, err := serviceFor(ctx, c.service).Locate(ctx.Request.Context(), locate.Id)
 	if err != nil {
 		c.logger.Error("Failed to locate journey", map[string]interface{}{
 			"journey_id": locate.Id,
@@ -254,3 +375,22 @@ func (c *CarPool) PostLocate(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, car)
 }
+
+// GetUnservableJourneys lists the waiting and scheduled journeys no car of
+// the fleet could ever carry, for operators to change the fleet or drop them.
+//
+// GET /journeys/unservable
+// Responses:
+// - 200 OK with the list of journeys, waiting ones first
+func (c *CarPool) GetUnservableJourneys(ctx *gin.Context) {
+	journeys, err := serviceFor(ctx, c.service).Unservable(ctx.Request.Context())
+	if err != nil {
+		c.logger.Error("Failed to list unservable journeys", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, journeys)
+}
@@ -1,13 +1,22 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
 )
@@ -67,6 +76,359 @@ func TestAPI(t *testing.T) {
 	assert.Equal(t, 200, w.Code)
 }
 
+func TestAPI_ConcurrentLoad(t *testing.T) {
+	ctx := context.Background()
+	inMemoryTransactionFactory := inMemory.NewTransactionFactory()
+
+	router := NewCarPool(services.NewCarPool(inMemoryTransactionFactory))
+
+	e := NewEngineForTests(router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/cars", strings.NewReader(`
+	[
+		{ "id": 1, "seats": 4 },
+		{ "id": 2, "seats": 5 },
+		{ "id": 3, "seats": 6 }
+	]`))
+	req.Header = map[string][]string{"Content-Type": {"application/json"}}
+	e.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	post := func(path, contentType, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header = map[string][]string{"Content-Type": {contentType}}
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// every worker books journeys, locates them and drops them off, so once
+	// all of them finish every seat must be free again
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				id := worker*100 + i + 1
+				assert.Equal(t, 200, post("/journey", "application/json", fmt.Sprintf(`{"id": %d, "passengers": %d}`, id, i%6+1)))
+				assert.Contains(t, []int{200, 204}, post("/locate", "application/x-www-form-urlencoded", fmt.Sprintf("ID=%d", id)))
+				assert.Contains(t, []int{200, 204}, post("/dropoff", "application/x-www-form-urlencoded", fmt.Sprintf("ID=%d", id)))
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	txn, err := inMemoryTransactionFactory.Begin(ctx)
+	assert.NoError(t, err)
+	defer txn.Rollback()
+	for _, car := range txn.CarsStorage().GetAllCars(ctx) {
+		assert.Equal(t, car.Seats, car.AvailableSeats, "car %d", car.ID)
+	}
+	assert.Empty(t, txn.PendingsStorage().GetAllPendings(ctx))
+}
+
+func TestAPI_PendingQuotaPerClient(t *testing.T) {
+	inMemoryTransactionFactory := inMemory.NewTransactionFactory()
+
+	router := NewCarPool(services.NewCarPool(inMemoryTransactionFactory, services.WithMaxPendingPerOwner(2)))
+
+	e := NewEngineForTests(router)
+
+	post := func(path, ip, contentType, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header = map[string][]string{"Content-Type": {contentType}}
+		req.RemoteAddr = ip + ":1234"
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// without cars every group waits
+	assert.Equal(t, 200, post("/journey", "10.0.0.1", "application/json", `{"id": 1, "passengers": 2}`))
+	assert.Equal(t, 200, post("/journey", "10.0.0.1", "application/json", `{"id": 2, "passengers": 2}`))
+	assert.Equal(t, 429, post("/journey", "10.0.0.1", "application/json", `{"id": 3, "passengers": 2}`))
+	assert.Equal(t, 200, post("/journey", "10.0.0.2", "application/json", `{"id": 3, "passengers": 2}`))
+
+	assert.Equal(t, 204, post("/dropoff", "10.0.0.1", "application/x-www-form-urlencoded", "ID=1"))
+	assert.Equal(t, 200, post("/journey", "10.0.0.1", "application/json", `{"id": 4, "passengers": 2}`))
+}
+
+func TestAPI_PendingQuotaCountsScheduled(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	service := services.NewCarPool(inMemory.NewTransactionFactory(), services.WithClock(clk),
+		services.WithScheduleLeadTime(5*time.Minute), services.WithMaxPendingPerOwner(2))
+	e := NewEngineForTests(NewCarPool(service))
+
+	post := func(ip, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/journey", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	scheduled := func(id int) string {
+		return fmt.Sprintf(`{"id": %d, "passengers": 2, "pickupAt": %q}`, id, now.Add(time.Hour).Format(time.RFC3339))
+	}
+
+	// a client at the limit can't book ahead either
+	assert.Equal(t, 200, post("10.0.0.1", `{"id": 1, "passengers": 2}`))
+	assert.Equal(t, 200, post("10.0.0.1", `{"id": 2, "passengers": 2}`))
+	assert.Equal(t, 429, post("10.0.0.1", scheduled(3)))
+
+	// scheduled journeys take their place under the limit from the start
+	assert.Equal(t, 202, post("10.0.0.2", scheduled(4)))
+	assert.Equal(t, 202, post("10.0.0.2", scheduled(5)))
+	assert.Equal(t, 429, post("10.0.0.2", `{"id": 6, "passengers": 2}`))
+	assert.Equal(t, 429, post("10.0.0.2", scheduled(6)))
+
+	// so promoting them keeps the client within it
+	clk.Advance(time.Hour)
+	_, err := service.PromoteDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 429, post("10.0.0.2", `{"id": 6, "passengers": 2}`))
+}
+
+func TestAPI_MergeCars(t *testing.T) {
+	e := NewEngineForTests(NewCarPool(services.NewCarPool(inMemory.NewTransactionFactory())))
+
+	call := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 200, call("PUT", "/cars", "application/json", `[{"id": 1, "seats": 4}, {"id": 2, "seats": 4}]`).Code)
+	assert.Equal(t, 200, call("POST", "/journey", "application/json", `{"id": 1, "passengers": 4}`).Code)
+	assert.Equal(t, 200, call("POST", "/journey", "application/json", `{"id": 2, "passengers": 4}`).Code)
+	assert.Equal(t, 200, call("POST", "/journey", "application/json", `{"id": 3, "passengers": 5}`).Code)
+
+	assert.Equal(t, 400, call("PUT", "/cars?mode=patch", "application/json", `[]`).Code)
+	assert.Equal(t, 400, call("PUT", "/cars?dryRun=true", "application/json", `[]`).Code)
+
+	// car 2 leaves carrying journey 2, car 3 joins and takes the waiting journey 3
+	fleet := `[{"id": 1, "seats": 4}, {"id": 3, "seats": 6}]`
+	w := call("PUT", "/cars?mode=merge&dryRun=true", "application/json", fleet)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"dryRun":true,"added":[3],"resized":[],"restored":[],"draining":[2],"removed":[],"assigned":[{"journeyId":3,"carId":3}],"unservable":[]}`, w.Body.String())
+	assert.Equal(t, 204, call("POST", "/locate", "application/x-www-form-urlencoded", "ID=3").Code)
+
+	w = call("PUT", "/cars?mode=merge", "application/json", fleet)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"dryRun":false`)
+	w = call("POST", "/locate", "application/x-www-form-urlencoded", "ID=3")
+	assert.Equal(t, `{"id":3,"seats":6,"availableSeats":1}`, w.Body.String())
+	w = call("POST", "/locate", "application/x-www-form-urlencoded", "ID=2")
+	assert.Equal(t, `{"id":2,"seats":4,"availableSeats":0,"draining":true}`, w.Body.String())
+
+	assert.Equal(t, 200, call("POST", "/dropoff", "application/x-www-form-urlencoded", "ID=2").Code)
+	assert.Equal(t, 404, call("POST", "/locate", "application/x-www-form-urlencoded", "ID=2").Code)
+}
+
+func TestAPI_ScheduledJourney(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	service := services.NewCarPool(inMemory.NewTransactionFactory(), services.WithClock(clk), services.WithScheduleLeadTime(5*time.Minute))
+	e := NewEngineForTests(NewCarPool(service))
+
+	call := func(path, contentType, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+	at := func(d time.Duration) string {
+		return now.Add(d).Format(time.RFC3339)
+	}
+
+	assert.Equal(t, 202, call("/journey", "application/json", fmt.Sprintf(`{"id": 1, "passengers": 2, "pickupAt": %q}`, at(time.Hour))))
+	assert.Equal(t, 202, call("/journey", "application/json", fmt.Sprintf(`{"id": 2, "passengers": 2, "pickupAt": %q}`, at(time.Hour))))
+	assert.Equal(t, 200, call("/journey", "application/json", fmt.Sprintf(`{"id": 3, "passengers": 2, "pickupAt": %q}`, at(time.Minute))))
+	assert.Equal(t, 400, call("/journey", "application/json", `{"id": 1, "passengers": 2}`))
+	assert.Equal(t, 204, call("/locate", "application/x-www-form-urlencoded", "ID=1"))
+
+	assert.Equal(t, 400, call("/reschedule", "application/json", `{"id": 1}`))
+	assert.Equal(t, 400, call("/reschedule", "application/json", fmt.Sprintf(`{"id": 1, "pickupAt": %q}`, at(-time.Hour))))
+	assert.Equal(t, 404, call("/reschedule", "application/json", fmt.Sprintf(`{"id": 3, "pickupAt": %q}`, at(time.Hour))))
+	assert.Equal(t, 415, call("/reschedule", "application/x-www-form-urlencoded", "ID=1"))
+	assert.Equal(t, 200, call("/reschedule", "application/json", fmt.Sprintf(`{"id": 1, "pickupAt": %q}`, at(2*time.Hour))))
+
+	// canceling a scheduled journey leaves no car to free
+	assert.Equal(t, 204, call("/dropoff", "application/x-www-form-urlencoded", "ID=2"))
+	assert.Equal(t, 404, call("/locate", "application/x-www-form-urlencoded", "ID=2"))
+}
+
+func TestAPI_PriorityClass(t *testing.T) {
+	service := services.NewCarPool(inMemory.NewTransactionFactory())
+	require.NoError(t, service.ResetCars(context.Background(), []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}))
+	e := NewEngineForTests(NewCarPool(service))
+
+	call := func(path, contentType, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, 200, call("/journey", "application/json", `{"id": 1, "passengers": 4}`))
+	assert.Equal(t, 200, call("/journey", "application/json", `{"id": 2, "passengers": 4, "class": "standard"}`))
+	assert.Equal(t, 200, call("/journey", "application/json", `{"id": 3, "passengers": 4, "class": "accessibility"}`))
+	assert.Equal(t, 400, call("/journey", "application/json", `{"id": 4, "passengers": 4, "class": "vip"}`))
+
+	// the freed car goes to the accessibility group though it asked later
+	assert.Equal(t, 200, call("/dropoff", "application/x-www-form-urlencoded", "ID=1"))
+	assert.Equal(t, 200, call("/locate", "application/x-www-form-urlencoded", "ID=3"))
+	assert.Equal(t, 204, call("/locate", "application/x-www-form-urlencoded", "ID=2"))
+}
+
+func TestAPI_PriorityClassNeedsSupervisor(t *testing.T) {
+	service := services.NewCarPool(inMemory.NewTransactionFactory())
+	require.NoError(t, service.ResetCars(context.Background(), []*models.Car{{ID: 1, Seats: 6, AvailableSeats: 6}}))
+	c := NewCarPool(service)
+	a := auth.New(auth.WithKeys([]auth.Key{
+		{Name: "app", Role: auth.RoleDispatcher, Key: "dispatch-key"},
+		{Name: "desk", Role: auth.RoleSupervisor, Key: "supervisor-key"},
+	}))
+	e := gin.New()
+	e.Use(a.Middleware())
+	e.POST("/journey", a.Require(auth.RoleDispatcher), c.PostJourney)
+	e.POST("/reservations", a.Require(auth.RoleDispatcher), c.PostReservation)
+
+	call := func(key, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.APIKeyHeader, key)
+		e.ServeHTTP(w, req)
+		return w
+	}
+	expiresAt := time.Now().Add(time.Minute).Format(time.RFC3339)
+
+	w := call("dispatch-key", "/journey", `{"id": 1, "passengers": 1, "class": "priority"}`)
+	assert.Equal(t, 403, w.Code)
+	assert.JSONEq(t, `{"code":403,"message":"Priority class not allowed for this role"}`, w.Body.String())
+	assert.Equal(t, 403, call("dispatch-key", "/reservations", fmt.Sprintf(`{"journeyId": 1, "passengers": 1, "class": "accessibility", "expiresAt": %q}`, expiresAt)).Code)
+	assert.Equal(t, 200, call("dispatch-key", "/journey", `{"id": 1, "passengers": 1, "class": "standard"}`).Code)
+	assert.Equal(t, 200, call("supervisor-key", "/journey", `{"id": 2, "passengers": 1, "class": "priority"}`).Code)
+	assert.Equal(t, 201, call("supervisor-key", "/reservations", fmt.Sprintf(`{"journeyId": 3, "passengers": 1, "class": "accessibility", "expiresAt": %q}`, expiresAt)).Code)
+}
+
+func TestAPI_Features(t *testing.T) {
+	e := NewEngineForTests(NewCarPool(services.NewCarPool(inMemory.NewTransactionFactory())))
+
+	call := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("PUT", "/cars", "application/json", `[{"id": 1, "seats": 4}, {"id": 2, "seats": 6, "wheelchair": true, "luggage": 2}]`)
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, 400, call("PUT", "/cars?mode=merge", "application/json", `[{"id": 1, "seats": 4, "childSeats": 5}]`).Code)
+
+	assert.Equal(t, 200, call("POST", "/journey", "application/json", `{"id": 1, "passengers": 2, "wheelchair": true}`).Code)
+	// no car has child seats, the group waits and is listed
+	assert.Equal(t, 200, call("POST", "/journey", "application/json", `{"id": 2, "passengers": 2, "childSeats": 1}`).Code)
+	assert.Equal(t, 204, call("POST", "/locate", "application/x-www-form-urlencoded", "ID=2").Code)
+	w = call("GET", "/journeys/unservable", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `[{"id":2,"passengers":2,"childSeats":1}]`, w.Body.String())
+
+	w = call("POST", "/locate", "application/x-www-form-urlencoded", "ID=1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"id":2,"seats":6,"availableSeats":4,"wheelchair":true,"luggage":2}`, w.Body.String())
+}
+
+func TestAPI_UnservableJourneys(t *testing.T) {
+	for _, policy := range []services.UnservablePolicy{services.UnservableFlag, services.UnservableReject} {
+		t.Run(string(policy), func(t *testing.T) {
+			service := services.NewCarPool(inMemory.NewTransactionFactory(), services.WithUnservablePolicy(policy))
+			e := NewEngineForTests(NewCarPool(service))
+
+			call := func(method, path, body string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(method, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				e.ServeHTTP(w, req)
+				return w
+			}
+
+			require.Equal(t, 200, call("PUT", "/cars", `[{"id": 1, "seats": 4}, {"id": 2, "seats": 6}]`).Code)
+			w := call("POST", "/journey", `{"id": 1, "passengers": 7}`)
+			if policy == services.UnservableReject {
+				assert.Equal(t, 422, w.Code)
+			} else {
+				assert.Equal(t, 200, w.Code)
+			}
+			assert.Equal(t, 200, call("POST", "/journey", `{"id": 2, "passengers": 6}`).Code)
+			assert.Equal(t, 200, call("POST", "/journey", `{"id": 3, "passengers": 5}`).Code)
+
+			w = call("PUT", "/cars?mode=merge", `[{"id": 1, "seats": 4}]`)
+			require.Equal(t, 200, w.Code)
+			w = call("GET", "/journeys/unservable", "")
+			assert.Equal(t, 200, w.Code)
+			if policy == services.UnservableReject {
+				assert.Equal(t, `[]`, w.Body.String())
+				return
+			}
+			assert.Equal(t, `[{"id":1,"passengers":7},{"id":3,"passengers":5}]`, w.Body.String())
+		})
+	}
+}
+
+func TestAPI_Reservations(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	service := services.NewCarPool(inMemory.NewTransactionFactory(), services.WithClock(clk))
+	require.NoError(t, service.ResetCars(context.Background(), []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}))
+	e := NewEngineForTests(NewCarPool(service))
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(w, req)
+		return w
+	}
+	reserve := func(id, passengers int, d time.Duration) *httptest.ResponseRecorder {
+		return call("POST", "/reservations", fmt.Sprintf(`{"journeyId": %d, "passengers": %d, "expiresAt": %q}`, id, passengers, now.Add(d).Format(time.RFC3339)))
+	}
+
+	w := reserve(1, 3, time.Minute)
+	assert.Equal(t, 201, w.Code)
+	assert.JSONEq(t, `{"journeyId": 1, "carId": 1, "passengers": 3, "expiresAt": "2030-01-01T12:01:00Z"}`, w.Body.String())
+	assert.Equal(t, 409, reserve(2, 2, time.Minute).Code)
+	assert.Equal(t, 400, reserve(2, 1, -time.Minute).Code)
+	assert.Equal(t, 400, call("POST", "/reservations", `{"journeyId": 2}`).Code)
+	assert.Equal(t, 201, reserve(2, 1, time.Hour).Code)
+
+	w = call("GET", "/reservations", "")
+	assert.Equal(t, 200, w.Code)
+	var held []models.Reservation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &held))
+	assert.Len(t, held, 2)
+
+	w = call("POST", "/reservations/2/confirm", "")
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"id": 1, "seats": 4, "availableSeats": 0}`, w.Body.String())
+	assert.Equal(t, 404, call("POST", "/reservations/2/confirm", "").Code)
+	assert.Equal(t, 400, call("POST", "/reservations/x/confirm", "").Code)
+
+	clk.Advance(time.Minute)
+	assert.Equal(t, 410, call("POST", "/reservations/1/confirm", "").Code)
+	assert.Equal(t, 204, call("DELETE", "/reservations/1", "").Code)
+	assert.Equal(t, 404, call("DELETE", "/reservations/1", "").Code)
+}
+
 func NewEngineForTests(c *CarPool) *gin.Engine {
 	engine := gin.New()
 
@@ -75,6 +437,12 @@ func NewEngineForTests(c *CarPool) *gin.Engine {
 	engine.Any("/journey", c.PostJourney)
 	engine.Any("/dropoff", c.PostDropoff)
 	engine.Any("/locate", c.PostLocate)
+	engine.Any("/reschedule", c.PostReschedule)
+	engine.GET("/journeys/unservable", c.GetUnservableJourneys)
+	engine.POST("/reservations", c.PostReservation)
+	engine.GET("/reservations", c.GetReservations)
+	engine.POST("/reservations/:id/confirm", c.PostReservationConfirm)
+	engine.DELETE("/reservations/:id", c.DeleteReservation)
 
 	return engine
 
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type Events struct {
+	store  events.Store
+	logger *logger.Logger
+}
+
+func NewEvents(store events.Store) *Events {
+	return &Events{
+		store:  store,
+		logger: logger.New("events-controller"),
+	}
+}
+
+// GetEvents returns the domain event log, oldest first.
+//
+// GET /events?from=<seq>&journey=<journeyId>
+// Responses:
+// - 200 OK with the list of events
+// - 400 Bad Request on malformed query parameters
+func (c *Events) GetEvents(ctx *gin.Context) {
+	from, err := strconv.ParseUint(ctx.DefaultQuery("from", "1"), 10, 64)
+	if err != nil {
+		writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid from parameter", err.Error()))
+		return
+	}
+
+	var journeyID *uint64
+	if raw := ctx.Query("journey"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid journey parameter", err.Error()))
+			return
+		}
+		journeyID = &id
+	}
+
+	evts, err := c.store.Load(from)
+	if err != nil {
+		c.logger.Error("Failed to load events", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, models.NewAPIError(http.StatusInternalServerError, "Failed to load events", err.Error()))
+		return
+	}
+
+	if journeyID != nil {
+		evts = filterByJourney(evts, uint(*journeyID))
+	}
+	ctx.JSON(http.StatusOK, evts)
+}
+
+func filterByJourney(evts []events.Event, journeyID uint) []events.Event {
+	filtered := make([]events.Event, 0)
+	for _, e := range evts {
+		var ref struct {
+			JourneyID *uint `json:"journeyId"`
+		}
+		if err := e.Decode(&ref); err != nil || ref.JourneyID == nil || *ref.JourneyID != journeyID {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
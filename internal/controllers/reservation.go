@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// PostReservation holds seats for a group on its way, on the given car or on
+// the one the fleet strategy picks.
+//
+// POST /reservations
+// Content-Type: application/json
+// Request body: { journeyId: number, passengers: number, carId?: number, expiresAt: RFC3339, class?: string, wheelchair?: bool, childSeats?: number, luggage?: number }
+// Responses:
+// - 201 Created with the reservation and the car it holds
+// - 400 Bad Request on invalid payload, unknown priority class, or an expiry already gone or too far ahead
+// - 403 Forbidden for a class above standard unless the role is supervisor or higher
+// - 404 Not Found if the given car doesn't exist
+// - 409 Conflict when no car has the seats to reserve
+func (c *CarPool) PostReservation(ctx *gin.Context) {
+	if ctx.ContentType() != "application/json" {
+		c.logger.Error("Invalid content type for reservation endpoint", map[string]interface{}{
+			"content_type": ctx.ContentType(),
+			"request_id":   logger.GetRequestID(ctx.Request.Context()),
+		})
+		ctx.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var request struct {
+		JourneyID  uint                 `json:"journeyId" binding:"required"`
+		Passengers uint                 `json:"passengers" binding:"required"`
+		CarID      uint                 `json:"carId"`
+		ExpiresAt  time.Time            `json:"expiresAt" binding:"required"`
+		Class      models.PriorityClass `json:"class"`
+		models.Features
+	}
+	if err := ctx.BindJSON(&request); err != nil {
+		return
+	}
+	if !c.mayRequestClass(ctx, request.Class) {
+		writeError(ctx, models.ErrClassForbidden)
+		return
+	}
+
+	reservation := &models.Reservation{
+		JourneyID:  request.JourneyID,
+		CarID:      request.CarID,
+		Passengers: request.Passengers,
+		ExpiresAt:  request.ExpiresAt,
+		Class:      request.Class,
+		Features:   request.Features,
+		Owner:      auth.ClientID(ctx),
+	}
+	if err := serviceFor(ctx, c.service).Reserve(ctx.Request.Context(), reservation); err != nil {
+		c.logger.Error("Failed to reserve seats", map[string]interface{}{
+			"journey_id": request.JourneyID,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, reservation)
+}
+
+// GetReservations lists the reservations held, earliest expiry first.
+//
+// GET /reservations
+// Responses:
+// - 200 OK with the list of reservations
+func (c *CarPool) GetReservations(ctx *gin.Context) {
+	reservations, err := serviceFor(ctx, c.service).Reservations(ctx.Request.Context())
+	if err != nil {
+		c.logger.Error("Failed to list reservations", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	if reservations == nil {
+		reservations = []*models.Reservation{}
+	}
+	ctx.JSON(http.StatusOK, reservations)
+}
+
+// PostReservationConfirm seats the group in the car its reservation holds.
+//
+// POST /reservations/:id/confirm
+// Responses:
+// - 200 OK with the car JSON
+// - 404 Not Found if no such reservation is held
+// - 410 Gone if the reservation expired
+func (c *CarPool) PostReservationConfirm(ctx *gin.Context) {
+	id, ok := reservationID(ctx)
+	if !ok {
+		return
+	}
+
+	car, err := serviceFor(ctx, c.service).ConfirmReservation(ctx.Request.Context(), id)
+	if err != nil {
+		c.logger.Error("Failed to confirm reservation", map[string]interface{}{
+			"journey_id": id,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, car)
+}
+
+// DeleteReservation gives the held seats back before the reservation expires.
+//
+// DELETE /reservations/:id
+// Responses:
+// - 204 No Content on success (and triggers reassignment of the car)
+// - 404 Not Found if no such reservation is held
+func (c *CarPool) DeleteReservation(ctx *gin.Context) {
+	id, ok := reservationID(ctx)
+	if !ok {
+		return
+	}
+
+	service := serviceFor(ctx, c.service)
+	car, err := service.CancelReservation(ctx.Request.Context(), id)
+	if err != nil {
+		c.logger.Error("Failed to cancel reservation", map[string]interface{}{
+			"journey_id": id,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	if car != nil {
+		requestCtx := logger.SetRequestID(context.Background(), logger.GetRequestID(ctx.Request.Context()))
+		if err := service.Reassign(requestCtx, car); err != nil {
+			c.logger.Error("Failed to reassign car after reservation cancel", map[string]interface{}{
+				"car_id":     car.ID,
+				"journey_id": id,
+				"error":      err.Error(),
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+		}
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func reservationID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(ctx, models.NewAPIError(http.StatusBadRequest, "Invalid reservation id", ctx.Param("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
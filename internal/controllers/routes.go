@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/ratelimit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
+)
+
+// Routes is everything the API is served with. Events is nil when there is no
+// event log, and /events isn't served then.
+type Routes struct {
+	Auth    *auth.Authenticator
+	Limiter *ratelimit.Limiter
+	Auditor *audit.Auditor
+	Tenants *tenants.Registry
+	Metrics *metrics.Registry
+
+	CarPool     *CarPool
+	Webhooks    *Webhooks
+	Admin       *Admin
+	TenantAdmin *Tenants
+	Audit       *Audit
+	Events      *Events
+}
+
+// Wire routes the API, /status is left unlimited for health checks. The
+// fleet routes serve the tenant in the X-Tenant header, or the one under
+// /tenants/:tenant, and the default fleet when the request names none. The
+// calls changing a fleet are audited before their role is checked, so that
+// denied attempts make it to the audit log too.
+func Wire(e *gin.Engine, r Routes) {
+	reader := r.Auth.Require(auth.RoleReader)
+	dispatcher := r.Auth.Require(auth.RoleDispatcher)
+	fleetAdmin := r.Auth.Require(auth.RoleFleetAdmin)
+	webhooksLimit := r.Limiter.Middleware("webhooks")
+	adminLimit := r.Limiter.Middleware("admin")
+	scope := r.Tenants.Middleware()
+	audited := r.Auditor.Middleware()
+	c, w, a, t, au := r.CarPool, r.Webhooks, r.Admin, r.TenantAdmin, r.Audit
+
+	e.GET("/status", c.GetStatus)
+	for _, prefix := range []string{"", "/tenants/:tenant"} {
+		e.Any(prefix+"/cars", audited, fleetAdmin, r.Limiter.Middleware("cars"), scope, c.PutCars)
+		e.Any(prefix+"/journey", dispatcher, r.Limiter.Middleware("journey"), scope, c.PostJourney)
+		e.Any(prefix+"/reschedule", dispatcher, r.Limiter.Middleware("journey"), scope, c.PostReschedule)
+		e.Any(prefix+"/dropoff", dispatcher, r.Limiter.Middleware("dropoff"), scope, c.PostDropoff)
+		e.Any(prefix+"/locate", reader, r.Limiter.Middleware("locate"), scope, c.PostLocate)
+		e.GET(prefix+"/journeys/unservable", reader, r.Limiter.Middleware("unservable"), scope, c.GetUnservableJourneys)
+		e.POST(prefix+"/reservations", dispatcher, r.Limiter.Middleware("reservations"), scope, c.PostReservation)
+		e.GET(prefix+"/reservations", reader, r.Limiter.Middleware("reservations"), scope, c.GetReservations)
+		e.POST(prefix+"/reservations/:id/confirm", dispatcher, r.Limiter.Middleware("reservations"), scope, c.PostReservationConfirm)
+		e.DELETE(prefix+"/reservations/:id", dispatcher, r.Limiter.Middleware("reservations"), scope, c.DeleteReservation)
+	}
+
+	e.POST("/webhooks", audited, fleetAdmin, webhooksLimit, w.PostWebhook)
+	e.GET("/webhooks", fleetAdmin, webhooksLimit, w.GetWebhooks)
+	e.GET("/webhooks/deliveries", fleetAdmin, webhooksLimit, w.GetDeliveries)
+	e.DELETE("/webhooks/:id", audited, fleetAdmin, webhooksLimit, w.DeleteWebhook)
+
+	e.GET("/admin/consistency", fleetAdmin, adminLimit, scope, a.GetConsistency)
+	e.POST("/admin/consistency/repair", audited, fleetAdmin, adminLimit, scope, a.PostConsistencyRepair)
+
+	e.GET("/admin/tenants", fleetAdmin, adminLimit, t.GetTenants)
+	e.POST("/admin/tenants", audited, fleetAdmin, adminLimit, t.PostTenant)
+	e.DELETE("/admin/tenants/:id", audited, fleetAdmin, adminLimit, t.DeleteTenant)
+
+	e.GET("/admin/audit", fleetAdmin, adminLimit, au.GetAudit)
+	e.GET("/admin/audit/export", fleetAdmin, adminLimit, au.GetAuditExport)
+
+	if r.Events != nil {
+		e.GET("/events", reader, r.Limiter.Middleware("events"), r.Events.GetEvents)
+	}
+	e.GET("/metrics", reader, r.Limiter.Middleware("metrics"), gin.WrapH(r.Metrics))
+}
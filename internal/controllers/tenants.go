@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
+)
+
+type Tenants struct {
+	registry *tenants.Registry
+	logger   *logger.Logger
+}
+
+func NewTenants(registry *tenants.Registry) *Tenants {
+	return &Tenants{
+		registry: registry,
+		logger:   logger.New("tenants-controller"),
+	}
+}
+
+// GetTenants lists the tenants, the default one first.
+//
+// GET /admin/tenants
+// Responses:
+// - 200 OK with the list of tenants
+func (c *Tenants) GetTenants(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.registry.Tenants())
+}
+
+// PostTenant creates a tenant with an empty fleet.
+//
+// POST /admin/tenants
+// Content-Type: application/json
+// Request body: { id: string, minSeats: number, maxSeats: number, strategy: string }
+// Responses:
+// - 201 Created with the tenant, its defaults filled in
+// - 400 Bad Request on an invalid id, seat limits or strategy
+// - 409 Conflict if the tenant exists
+func (c *Tenants) PostTenant(ctx *gin.Context) {
+	var tenant tenants.Tenant
+	if err := ctx.BindJSON(&tenant); err != nil {
+		return
+	}
+
+	if err := c.registry.Create(&tenant); err != nil {
+		c.logger.Error("Failed to create tenant", map[string]interface{}{
+			"tenant":     tenant.ID,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, tenant)
+}
+
+// DeleteTenant empties the fleet of a tenant and removes it.
+//
+// DELETE /admin/tenants/:id
+// Responses:
+// - 204 No Content on success
+// - 400 Bad Request for the default tenant
+// - 404 Not Found if the tenant doesn't exist
+func (c *Tenants) DeleteTenant(ctx *gin.Context) {
+	if err := c.registry.Delete(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		c.logger.Error("Failed to delete tenant", map[string]interface{}{
+			"tenant":     ctx.Param("id"),
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
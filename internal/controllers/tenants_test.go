@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
+)
+
+func TestAPI_TenantsAreIsolated(t *testing.T) {
+	service := services.NewCarPool(inMemory.NewTransactionFactory())
+	registry, err := tenants.New(service, func(string) (models.TransactionFactory, error) {
+		return inMemory.NewTransactionFactory(), nil
+	})
+	require.NoError(t, err)
+
+	c := NewCarPool(service)
+	admin := NewTenants(registry)
+	e := gin.New()
+	scope := registry.Middleware()
+	e.Any("/cars", scope, c.PutCars)
+	e.Any("/journey", scope, c.PostJourney)
+	e.Any("/locate", scope, c.PostLocate)
+	e.Any("/tenants/:tenant/cars", scope, c.PutCars)
+	e.Any("/tenants/:tenant/journey", scope, c.PostJourney)
+	e.Any("/tenants/:tenant/locate", scope, c.PostLocate)
+	e.GET("/admin/tenants", admin.GetTenants)
+	e.POST("/admin/tenants", admin.PostTenant)
+	e.DELETE("/admin/tenants/:id", admin.DeleteTenant)
+
+	call := func(method, path, tenant, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if tenant != "" {
+			req.Header.Set(tenants.TenantHeader, tenant)
+		}
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("POST", "/admin/tenants", "", "application/json", `{"id": "vans", "minSeats": 6, "maxSeats": 9}`)
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"strategy":"best-fit"`)
+	assert.Equal(t, 409, call("POST", "/admin/tenants", "", "application/json", `{"id": "vans"}`).Code)
+
+	// each fleet takes the cars its seat limits allow
+	assert.Equal(t, 400, call("PUT", "/cars", "", "application/json", `[{"id": 1, "seats": 9}]`).Code)
+	assert.Equal(t, 200, call("PUT", "/cars", "", "application/json", `[{"id": 1, "seats": 4}]`).Code)
+	assert.Equal(t, 400, call("PUT", "/tenants/vans/cars", "", "application/json", `[{"id": 1, "seats": 4}]`).Code)
+	assert.Equal(t, 200, call("PUT", "/tenants/vans/cars", "", "application/json", `[{"id": 1, "seats": 9}]`).Code)
+
+	// the same journey id rides a different car in each fleet
+	assert.Equal(t, 200, call("POST", "/journey", "", "application/json", `{"id": 1, "passengers": 2}`).Code)
+	assert.Equal(t, 200, call("POST", "/journey", "vans", "application/json", `{"id": 1, "passengers": 7}`).Code)
+	w = call("POST", "/locate", "", "application/x-www-form-urlencoded", "ID=1")
+	assert.Equal(t, `{"id":1,"seats":4,"availableSeats":2}`, w.Body.String())
+	w = call("POST", "/tenants/vans/locate", "", "application/x-www-form-urlencoded", "ID=1")
+	assert.Equal(t, `{"id":1,"seats":9,"availableSeats":2}`, w.Body.String())
+
+	assert.Equal(t, 404, call("POST", "/locate", "globex", "application/x-www-form-urlencoded", "ID=1").Code)
+	assert.Equal(t, 404, call("POST", "/tenants/globex/locate", "", "application/x-www-form-urlencoded", "ID=1").Code)
+
+	assert.Equal(t, 400, call("DELETE", "/admin/tenants/default", "", "", "").Code)
+	assert.Equal(t, 204, call("DELETE", "/admin/tenants/vans", "", "", "").Code)
+	assert.Equal(t, 404, call("POST", "/tenants/vans/locate", "", "application/x-www-form-urlencoded", "ID=1").Code)
+	w = call("GET", "/admin/tenants", "", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"default"`)
+	assert.NotContains(t, w.Body.String(), `"id":"vans"`)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/webhooks"
+)
+
+type Webhooks struct {
+	dispatcher *webhooks.Dispatcher
+	logger     *logger.Logger
+}
+
+func NewWebhooks(dispatcher *webhooks.Dispatcher) *Webhooks {
+	return &Webhooks{
+		dispatcher: dispatcher,
+		logger:     logger.New("webhooks-controller"),
+	}
+}
+
+// PostWebhook registers a subscription for journey lifecycle events.
+//
+// POST /webhooks
+// Content-Type: application/json
+// Request body: { url: string, events: [string], secret: string }
+// Responses:
+// - 201 Created with the subscription (without secret)
+// - 400 Bad Request on invalid url, unknown events or missing secret
+func (c *Webhooks) PostWebhook(ctx *gin.Context) {
+	var sub webhooks.Subscription
+	if err := ctx.BindJSON(&sub); err != nil {
+		return
+	}
+
+	if err := c.dispatcher.Subscribe(&sub); err != nil {
+		c.logger.Error("Failed to register webhook", map[string]interface{}{
+			"url":        sub.URL,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		writeError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, sub.Public())
+}
+
+// GetWebhooks lists the registered subscriptions.
+//
+// GET /webhooks
+// Responses:
+// - 200 OK with the list of subscriptions (without secrets)
+func (c *Webhooks) GetWebhooks(ctx *gin.Context) {
+	subs := c.dispatcher.Store().Subscriptions()
+	public := make([]webhooks.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		public = append(public, sub.Public())
+	}
+	ctx.JSON(http.StatusOK, public)
+}
+
+// DeleteWebhook removes a subscription, its queued deliveries are dead-lettered.
+//
+// DELETE /webhooks/:id
+// Responses:
+// - 204 No Content on success
+// - 404 Not Found if the subscription doesn't exist
+func (c *Webhooks) DeleteWebhook(ctx *gin.Context) {
+	if err := c.dispatcher.Unsubscribe(ctx.Param("id")); err != nil {
+		writeError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetDeliveries returns the delivery log, newest first.
+//
+// GET /webhooks/deliveries?status=<pending|delivered|dead>&subscription=<id>
+// Responses:
+// - 200 OK with the list of deliveries
+func (c *Webhooks) GetDeliveries(ctx *gin.Context) {
+	status := webhooks.DeliveryStatus(ctx.Query("status"))
+	ctx.JSON(http.StatusOK, c.dispatcher.Store().Deliveries(status, ctx.Query("subscription")))
+}
+
+func writeError(ctx *gin.Context, err error) {
+	if apiErr, ok := err.(*models.APIError); ok {
+		ctx.JSON(apiErr.HTTPStatus(), apiErr)
+		return
+	}
+	ctx.Status(http.StatusInternalServerError)
+}
@@ -0,0 +1,32 @@
+package events
+
+import "sync"
+
+type Handler func(Event)
+
+// Bus fans committed events out to in-process subscribers. Handlers run
+// synchronously on the publishing goroutine so they must not block.
+type Bus struct {
+	handlers []Handler
+	mu       sync.RWMutex
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, h)
+	b.mu.Unlock()
+}
+
+func (b *Bus) Publish(events ...Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, e := range events {
+		for _, h := range b.handlers {
+			h(e)
+		}
+	}
+}
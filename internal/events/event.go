@@ -0,0 +1,138 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type Type string
+
+// Domain events emitted by the car pool service. Every state change of cars,
+// journeys and the pending queue can be derived from these.
+const (
+	FleetReset        Type = "FleetReset"
+	FleetMerged       Type = "FleetMerged"
+	JourneyRequested  Type = "JourneyRequested"
+	JourneyAssigned   Type = "JourneyAssigned"
+	JourneyDroppedOff Type = "JourneyDroppedOff"
+	// scheduled journeys become a JourneyRequested when promoted
+	JourneyScheduled   Type = "JourneyScheduled"
+	JourneyRescheduled Type = "JourneyRescheduled"
+	JourneyCanceled    Type = "JourneyCanceled"
+	// reserved seats are taken from the car until confirmed or released
+	SeatsReserved        Type = "SeatsReserved"
+	ReservationConfirmed Type = "ReservationConfirmed"
+	ReservationReleased  Type = "ReservationReleased"
+)
+
+// Event is an entry of the append-only event log. Seq is assigned by the store.
+type Event struct {
+	Seq       uint64          `json:"seq"`
+	Type      Type            `json:"type"`
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"requestId,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Decode unmarshals the payload into one of the *Data structs below
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// FleetResetData replaces the whole fleet, dropping every journey
+type FleetResetData struct {
+	Cars []models.Car `json:"cars"`
+}
+
+// FleetMergedData reconciles the fleet with a new list of cars keeping the
+// journeys. Cars are the ones added or whose seats changed, draining ones
+// included, with the seats they have now. Draining cars left the list while
+// carrying groups and Removed ones left it empty.
+type FleetMergedData struct {
+	Cars     []models.Car `json:"cars,omitempty"`
+	Draining []uint       `json:"draining,omitempty"`
+	Removed  []uint       `json:"removed,omitempty"`
+}
+
+// JourneyRequestedData registers a group, which waits in the pending queue
+// until a JourneyAssigned event for it
+type JourneyRequestedData struct {
+	JourneyID  uint                 `json:"journeyId"`
+	Passengers uint                 `json:"passengers"`
+	Owner      string               `json:"owner,omitempty"`
+	Class      models.PriorityClass `json:"class,omitempty"`
+	// Features the group needs from its car
+	models.Features
+}
+
+// JourneyAssignedData seats a waiting group in a car. WaitMs is how long it
+// waited in the queue, 0 when it got a car on arrival.
+type JourneyAssignedData struct {
+	JourneyID  uint                 `json:"journeyId"`
+	CarID      uint                 `json:"carId"`
+	Passengers uint                 `json:"passengers"`
+	Class      models.PriorityClass `json:"class,omitempty"`
+	WaitMs     int64                `json:"waitMs,omitempty"`
+}
+
+// JourneyDroppedOffData removes a group, freeing its seats if it had a car
+type JourneyDroppedOffData struct {
+	JourneyID  uint  `json:"journeyId"`
+	Passengers uint  `json:"passengers"`
+	CarID      *uint `json:"carId,omitempty"`
+}
+
+// JourneyScheduledData books a group for a later pickup, it waits apart from
+// the queue until promoted with a JourneyRequested event
+type JourneyScheduledData struct {
+	JourneyID  uint                 `json:"journeyId"`
+	Passengers uint                 `json:"passengers"`
+	Owner      string               `json:"owner,omitempty"`
+	Class      models.PriorityClass `json:"class,omitempty"`
+	PickupAt   time.Time            `json:"pickupAt"`
+	models.Features
+}
+
+// JourneyRescheduledData moves the pickup of a scheduled group
+type JourneyRescheduledData struct {
+	JourneyID uint      `json:"journeyId"`
+	PickupAt  time.Time `json:"pickupAt"`
+}
+
+// JourneyCanceledData removes a scheduled group before it was promoted
+type JourneyCanceledData struct {
+	JourneyID uint `json:"journeyId"`
+}
+
+// SeatsReservedData holds seats, and the features the group needs, of a car
+// for a group on its way until ExpiresAt
+type SeatsReservedData struct {
+	JourneyID  uint                 `json:"journeyId"`
+	CarID      uint                 `json:"carId"`
+	Passengers uint                 `json:"passengers"`
+	Owner      string               `json:"owner,omitempty"`
+	ExpiresAt  time.Time            `json:"expiresAt"`
+	Class      models.PriorityClass `json:"class,omitempty"`
+	models.Features
+}
+
+// ReservationConfirmedData turns a reservation into a journey riding the car
+// it held, requested at the time of the event, the seats and features stay
+// taken
+type ReservationConfirmedData struct {
+	JourneyID  uint                 `json:"journeyId"`
+	CarID      uint                 `json:"carId"`
+	Passengers uint                 `json:"passengers"`
+	Class      models.PriorityClass `json:"class,omitempty"`
+}
+
+// ReservationReleasedData gives the held seats back, because the reservation
+// expired or was canceled
+type ReservationReleasedData struct {
+	JourneyID  uint `json:"journeyId"`
+	CarID      uint `json:"carId"`
+	Passengers uint `json:"passengers"`
+	Expired    bool `json:"expired,omitempty"`
+}
@@ -0,0 +1,312 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// Rebuild replaces the cars, journeys, pending, scheduled and reservation
+// projections held by the factory with the state obtained by replaying the
+// given events in order. Events are appended after their transaction commits,
+// so a log an append failed on rebuilds a state missing those changes.
+func Rebuild(ctx context.Context, factory models.TransactionFactory, events []Event) error {
+	txn, err := factory.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := reset(ctx, txn); err != nil {
+		txn.Rollback()
+		return err
+	}
+	for _, e := range events {
+		if err := Apply(ctx, txn, e); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("applying event %d (%s): %w", e.Seq, e.Type, err)
+		}
+	}
+	return txn.Commit(ctx)
+}
+
+// Apply projects a single event onto the storages of a transaction
+func Apply(ctx context.Context, txn models.Transaction, e Event) error {
+	switch e.Type {
+	case FleetReset:
+		var data FleetResetData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		if err := reset(ctx, txn); err != nil {
+			return err
+		}
+		for i := range data.Cars {
+			car := data.Cars[i]
+			if err := txn.CarsStorage().NewCar(ctx, &car); err != nil {
+				return err
+			}
+		}
+
+	case FleetMerged:
+		var data FleetMergedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		for i := range data.Cars {
+			car := data.Cars[i]
+			if err := putMergedCar(ctx, txn, &car); err != nil {
+				return err
+			}
+		}
+		for _, id := range data.Draining {
+			car, err := txn.CarsStorage().FindById(ctx, id)
+			if err != nil {
+				return err
+			}
+			if car.Draining {
+				continue
+			}
+			car.Draining = true
+			if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+				return err
+			}
+		}
+		for _, id := range data.Removed {
+			if err := txn.CarsStorage().DeleteById(ctx, id); err != nil {
+				return err
+			}
+		}
+
+	case JourneyRequested:
+		var data JourneyRequestedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		journey := &models.Journey{Id: data.JourneyID, Passengers: data.Passengers, Owner: data.Owner, Class: data.Class, Features: data.Features, RequestedAt: e.Time}
+		if err := txn.JourneysStorage().NewJourney(ctx, journey); err != nil {
+			return err
+		}
+		if err := txn.PendingsStorage().NewPending(ctx, journey); err != nil {
+			return err
+		}
+		// a promoted journey leaves the scheduled ones
+		if err := txn.ScheduledStorage().DeleteById(ctx, journey.Id); err != nil {
+			return err
+		}
+
+	case JourneyAssigned:
+		var data JourneyAssignedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		journey, err := txn.JourneysStorage().FindById(ctx, data.JourneyID)
+		if err != nil {
+			return err
+		}
+		car, err := txn.CarsStorage().FindById(ctx, data.CarID)
+		if err != nil {
+			return err
+		}
+		if err := car.TakeSeats(journey.Passengers); err != nil {
+			return err
+		}
+		if err := car.TakeFeatures(journey.Features); err != nil {
+			return err
+		}
+		if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+			return err
+		}
+		journey.AssignCar(car.ID)
+		if err := txn.JourneysStorage().UpdateJourney(ctx, journey.Id, journey, journey.Version); err != nil {
+			return err
+		}
+		if err := txn.PendingsStorage().DeleteById(ctx, journey.Id); err != nil {
+			return err
+		}
+
+	case JourneyDroppedOff:
+		var data JourneyDroppedOffData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		journey, err := txn.JourneysStorage().FindById(ctx, data.JourneyID)
+		if err != nil {
+			return err
+		}
+		if err := txn.JourneysStorage().DeleteById(ctx, journey.Id); err != nil {
+			return err
+		}
+		if !journey.IsAssigned() {
+			return txn.PendingsStorage().DeleteById(ctx, journey.Id)
+		}
+		return freeSeats(ctx, txn, *journey.CarID, journey.Passengers, journey.Features)
+
+	case JourneyScheduled:
+		var data JourneyScheduledData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return txn.ScheduledStorage().NewScheduled(ctx, &models.Journey{
+			Id:         data.JourneyID,
+			Passengers: data.Passengers,
+			Owner:      data.Owner,
+			Class:      data.Class,
+			Features:   data.Features,
+			PickupAt:   &data.PickupAt,
+		})
+
+	case JourneyRescheduled:
+		var data JourneyRescheduledData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		journey, err := txn.ScheduledStorage().FindById(ctx, data.JourneyID)
+		if err != nil {
+			return err
+		}
+		journey.PickupAt = &data.PickupAt
+		return txn.ScheduledStorage().UpdateScheduled(ctx, journey.Id, journey, journey.Version)
+
+	case JourneyCanceled:
+		var data JourneyCanceledData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		return txn.ScheduledStorage().DeleteById(ctx, data.JourneyID)
+
+	case SeatsReserved:
+		var data SeatsReservedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		car, err := txn.CarsStorage().FindById(ctx, data.CarID)
+		if err != nil {
+			return err
+		}
+		if err := car.TakeSeats(data.Passengers); err != nil {
+			return err
+		}
+		if err := car.TakeFeatures(data.Features); err != nil {
+			return err
+		}
+		if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+			return err
+		}
+		return txn.ReservationsStorage().NewReservation(ctx, &models.Reservation{
+			JourneyID:  data.JourneyID,
+			CarID:      data.CarID,
+			Passengers: data.Passengers,
+			ExpiresAt:  data.ExpiresAt,
+			Class:      data.Class,
+			Features:   data.Features,
+			Owner:      data.Owner,
+		})
+
+	case ReservationConfirmed:
+		var data ReservationConfirmedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		reservation, err := txn.ReservationsStorage().FindById(ctx, data.JourneyID)
+		if err != nil {
+			return err
+		}
+		if err := txn.ReservationsStorage().DeleteById(ctx, data.JourneyID); err != nil {
+			return err
+		}
+		// the seats stay taken, the service writes the car back as it was
+		car, err := txn.CarsStorage().FindById(ctx, data.CarID)
+		if err != nil {
+			return err
+		}
+		if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+			return err
+		}
+		journey := &models.Journey{
+			Id:          data.JourneyID,
+			Passengers:  data.Passengers,
+			Class:       reservation.Class,
+			Features:    reservation.Features,
+			RequestedAt: e.Time,
+			Owner:       reservation.Owner,
+		}
+		journey.AssignCar(data.CarID)
+		return txn.JourneysStorage().NewJourney(ctx, journey)
+
+	case ReservationReleased:
+		var data ReservationReleasedData
+		if err := e.Decode(&data); err != nil {
+			return err
+		}
+		reservation, err := txn.ReservationsStorage().FindById(ctx, data.JourneyID)
+		if err != nil {
+			return err
+		}
+		if err := txn.ReservationsStorage().DeleteById(ctx, data.JourneyID); err != nil {
+			return err
+		}
+		return freeSeats(ctx, txn, data.CarID, data.Passengers, reservation.Features)
+
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	return nil
+}
+
+// putMergedCar adds a car to the fleet, or gives an existing one its new seats
+// keeping the ones taken
+func putMergedCar(ctx context.Context, txn models.Transaction, car *models.Car) error {
+	old, err := txn.CarsStorage().FindById(ctx, car.ID)
+	if err == models.ErrNotFound {
+		car.AvailableSeats = car.Seats
+		return txn.CarsStorage().NewCar(ctx, car)
+	}
+	if err != nil {
+		return err
+	}
+	taken := old.Seats - old.AvailableSeats
+	if taken > car.Seats {
+		return models.ErrSeatsOutOfRange
+	}
+	if !car.Features.Covers(old.InUse) {
+		return models.ErrFeaturesOutOfRange
+	}
+	old.Seats, old.AvailableSeats, old.Draining, old.Features = car.Seats, car.Seats-taken, false, car.Features
+	return txn.CarsStorage().UpdateCar(ctx, old.ID, old, old.Version)
+}
+
+// freeSeats gives seats and features back to a car, removing it when it was
+// draining and is left empty
+func freeSeats(ctx context.Context, txn models.Transaction, carId uint, seats uint, features models.Features) error {
+	car, err := txn.CarsStorage().FindById(ctx, carId)
+	if err != nil {
+		return err
+	}
+	if err := car.FreeUpSeats(seats); err != nil {
+		return err
+	}
+	if err := car.FreeUpFeatures(features); err != nil {
+		return err
+	}
+	if car.Draining && car.AvailableSeats == car.Seats {
+		return txn.CarsStorage().DeleteById(ctx, car.ID)
+	}
+	return txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version)
+}
+
+func reset(ctx context.Context, txn models.Transaction) error {
+	if err := txn.CarsStorage().ResetMemory(ctx); err != nil {
+		return err
+	}
+	if err := txn.JourneysStorage().ResetMemory(ctx); err != nil {
+		return err
+	}
+	if err := txn.PendingsStorage().ResetMemory(ctx); err != nil {
+		return err
+	}
+	if err := txn.ScheduledStorage().ResetMemory(ctx); err != nil {
+		return err
+	}
+	return txn.ReservationsStorage().ResetMemory(ctx)
+}
@@ -0,0 +1,165 @@
+package events_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+type snapshot struct {
+	cars     []models.Car
+	journeys map[uint]*uint
+	pending  []uint
+	// pickup times of the scheduled journeys, in unix nanoseconds
+	scheduled map[uint]int64
+	// cars held by the reservations
+	reservations map[uint]uint
+}
+
+func takeSnapshot(t *testing.T, factory models.TransactionFactory, journeyIDs []uint) snapshot {
+	ctx := context.Background()
+	txn, err := factory.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+
+	s := snapshot{journeys: make(map[uint]*uint), scheduled: make(map[uint]int64), reservations: make(map[uint]uint)}
+	for _, c := range txn.CarsStorage().GetAllCars(ctx) {
+		s.cars = append(s.cars, *c)
+	}
+	sort.Slice(s.cars, func(i, j int) bool { return s.cars[i].ID < s.cars[j].ID })
+
+	for _, id := range journeyIDs {
+		j, err := txn.JourneysStorage().FindById(ctx, id)
+		if err != nil {
+			continue
+		}
+		s.journeys[id] = j.CarID
+	}
+	for _, p := range txn.PendingsStorage().GetAllPendings(ctx) {
+		s.pending = append(s.pending, p.Id)
+	}
+	for _, j := range txn.ScheduledStorage().GetAllScheduled(ctx) {
+		s.scheduled[j.Id] = j.PickupAt.UnixNano()
+	}
+	for _, r := range txn.ReservationsStorage().GetAllReservations(ctx) {
+		s.reservations[r.JourneyID] = r.CarID
+	}
+	return s
+}
+
+func TestRebuild_ReproducesServiceState(t *testing.T) {
+	ctx := context.Background()
+	store := events.NewMemoryStore()
+	factory := inMemory.NewTransactionFactory()
+	clk := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	svc := services.NewCarPool(factory, services.WithEventStore(store), services.WithClock(clk))
+
+	var published []events.Event
+	svc.Events().Subscribe(func(e events.Event) { published = append(published, e) })
+
+	require.NoError(t, svc.ResetCars(ctx, []*models.Car{
+		{ID: 1, Seats: 4, AvailableSeats: 4},
+		{ID: 2, Seats: 6, AvailableSeats: 6},
+	}))
+	for id, passengers := range []uint{4, 6, 3, 2, 5} {
+		require.NoError(t, svc.NewJourney(ctx, &models.Journey{Id: uint(id + 1), Passengers: passengers}))
+	}
+	car, err := svc.Dropoff(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, svc.Reassign(ctx, car))
+	_, err = svc.Dropoff(ctx, 5)
+	require.NoError(t, err)
+	// merging drains car 1 and seats the waiting groups in car 3
+	_, err = svc.MergeCars(ctx, []*models.Car{{ID: 2, Seats: 6}, {ID: 3, Seats: 6}}, false)
+	require.NoError(t, err)
+
+	// journeys booked ahead, one moved, one canceled and one promoted
+	for id := uint(6); id <= 9; id++ {
+		pickup := clk.Now().Add(time.Duration(id) * time.Hour)
+		require.NoError(t, svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: 2, PickupAt: &pickup}))
+	}
+	require.NoError(t, svc.Reschedule(ctx, 7, clk.Now().Add(30*time.Minute)))
+	_, err = svc.Dropoff(ctx, 8)
+	require.NoError(t, err)
+	clk.Advance(time.Hour)
+	promoted, err := svc.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, promoted)
+
+	// seats held on a new car, one reservation confirmed, one expired and one
+	// still held, the first and the last with luggage space
+	_, err = svc.MergeCars(ctx, []*models.Car{{ID: 2, Seats: 6}, {ID: 3, Seats: 6}, {ID: 4, Seats: 4, Features: models.Features{Luggage: 3}}}, false)
+	require.NoError(t, err)
+	for id, ttl := range []time.Duration{time.Hour, time.Hour, time.Minute} {
+		needs := models.Features{Luggage: uint(1 - id%2)}
+		require.NoError(t, svc.Reserve(ctx, &models.Reservation{JourneyID: uint(id + 10), Passengers: 1, ExpiresAt: clk.Now().Add(ttl), Features: needs}))
+	}
+	_, err = svc.ConfirmReservation(ctx, 10)
+	require.NoError(t, err)
+	clk.Advance(time.Minute)
+	released, err := svc.ReleaseExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	// a group needing luggage space rides the only car with some, and one
+	// riding it drops off
+	require.NoError(t, svc.NewJourney(ctx, &models.Journey{Id: 13, Passengers: 1, Features: models.Features{Luggage: 1}}))
+	require.NoError(t, svc.NewJourney(ctx, &models.Journey{Id: 14, Passengers: 1, Features: models.Features{Luggage: 1}}))
+	_, err = svc.Dropoff(ctx, 13)
+	require.NoError(t, err)
+	if car, err := svc.Locate(ctx, 14); assert.NoError(t, err) && assert.NotNil(t, car) {
+		assert.Equal(t, uint(4), car.ID)
+	}
+
+	// a failed reset must not leave events behind
+	assert.Error(t, svc.ResetCars(ctx, []*models.Car{{ID: 9, Seats: 9, AvailableSeats: 9}}))
+
+	logged, err := store.Load(1)
+	require.NoError(t, err)
+	assert.Equal(t, len(logged), len(published))
+	for i, e := range logged {
+		assert.Equal(t, uint64(i+1), e.Seq)
+	}
+
+	rebuilt := inMemory.NewTransactionFactory()
+	require.NoError(t, events.Rebuild(ctx, rebuilt, logged))
+
+	ids := []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	assert.Equal(t, takeSnapshot(t, factory, ids), takeSnapshot(t, rebuilt, ids))
+}
+
+func TestFileStore_ReloadsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	store, err := events.OpenFileStore(path)
+	require.NoError(t, err)
+	rec := events.NewRecorder(store, nil, "req-1", time.Now)
+	rec.Emit(events.JourneyRequested, events.JourneyRequestedData{JourneyID: 1, Passengers: 2})
+	rec.Emit(events.JourneyRequested, events.JourneyRequestedData{JourneyID: 2, Passengers: 3})
+	require.NoError(t, rec.Persist())
+	require.NoError(t, store.Close())
+
+	reopened, err := events.OpenFileStore(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	logged, err := reopened.Load(2)
+	require.NoError(t, err)
+	require.Len(t, logged, 1)
+	assert.Equal(t, uint64(2), logged[0].Seq)
+	assert.Equal(t, "req-1", logged[0].RequestID)
+
+	var data events.JourneyRequestedData
+	require.NoError(t, logged[0].Decode(&data))
+	assert.Equal(t, uint(2), data.JourneyID)
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Recorder buffers the events of a single transaction. They are persisted and
+// published only once the transaction has committed, so a rolled back or
+// conflicting one leaves no trace in the log nor reaches subscribers.
+type Recorder struct {
+	store     Store
+	bus       *Bus
+	requestID string
+	now       func() time.Time
+
+	events []*Event
+	err    error
+}
+
+func NewRecorder(store Store, bus *Bus, requestID string, now func() time.Time) *Recorder {
+	return &Recorder{
+		store:     store,
+		bus:       bus,
+		requestID: requestID,
+		now:       now,
+	}
+}
+
+// Emit buffers an event, encoding failures are reported by Err
+func (r *Recorder) Emit(t Type, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.events = append(r.events, &Event{
+		Type:      t,
+		Time:      r.now(),
+		RequestID: r.requestID,
+		Payload:   payload,
+	})
+}
+
+// Err reports an event that couldn't be encoded, to be checked before the
+// transaction commits
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+// Persist appends the buffered events to the store, if any
+func (r *Recorder) Persist() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.store == nil || len(r.events) == 0 {
+		return nil
+	}
+	return r.store.Append(r.events...)
+}
+
+// Publish hands the buffered events to the bus subscribers
+func (r *Recorder) Publish() {
+	if r.bus == nil {
+		return
+	}
+	for _, e := range r.events {
+		r.bus.Publish(*e)
+	}
+}
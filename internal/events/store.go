@@ -0,0 +1,128 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Store is an append-only event log
+type Store interface {
+	// Append assigns consecutive sequence numbers to the events and persists them
+	Append(events ...*Event) error
+	// Load returns the events with Seq greater than or equal to fromSeq, in order
+	Load(fromSeq uint64) ([]Event, error)
+}
+
+// MemoryStore keeps the log in process memory, mostly useful for tests and debugging
+type MemoryStore struct {
+	events []Event
+	mu     sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events: make([]Event, 0),
+	}
+}
+
+func (s *MemoryStore) Append(events ...*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		e.Seq = uint64(len(s.events)) + 1
+		s.events = append(s.events, *e)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Load(fromSeq uint64) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return since(s.events, fromSeq), nil
+}
+
+// FileStore keeps the log as a JSON lines file, one event per line
+type FileStore struct {
+	file   *os.File
+	events []Event
+	mu     sync.RWMutex
+}
+
+// OpenFileStore opens or creates the log at path, loading existing events
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{file: file, events: make([]Event, 0)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, err
+		}
+		s.events = append(s.events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Append(events ...*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := uint64(len(s.events)) + 1
+	var buf []byte
+	for i, e := range events {
+		e.Seq = next + uint64(i)
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	for _, e := range events {
+		s.events = append(s.events, *e)
+	}
+	return nil
+}
+
+func (s *FileStore) Load(fromSeq uint64) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return since(s.events, fromSeq), nil
+}
+
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
+
+func since(events []Event, fromSeq uint64) []Event {
+	if fromSeq < 1 {
+		fromSeq = 1
+	}
+	if fromSeq > uint64(len(events)) {
+		return []Event{}
+	}
+	out := make([]Event, len(events)-int(fromSeq-1))
+	copy(out, events[fromSeq-1:])
+	return out
+}
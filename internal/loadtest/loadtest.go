@@ -0,0 +1,311 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// Operation names, also used as keys of the mix
+const (
+	OpCars    = "PUT /cars"
+	OpJourney = "POST /journey"
+	OpDropoff = "POST /dropoff"
+	OpLocate  = "POST /locate"
+)
+
+var mixKeys = map[string]string{
+	"cars":    OpCars,
+	"journey": OpJourney,
+	"dropoff": OpDropoff,
+	"locate":  OpLocate,
+}
+
+// Mix is the relative weight of every operation
+type Mix map[string]float64
+
+// ParseMix reads "journey=5,dropoff=3,locate=2,cars=0"
+func ParseMix(s string) (Mix, error) {
+	mix := Mix{}
+	total := 0.0
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix entry %q, expected name=weight", part)
+		}
+		op, ok := mixKeys[kv[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %q", kv[0])
+		}
+		weight, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q", kv[1])
+		}
+		mix[op] = weight
+		total += weight
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("mix weights add up to zero")
+	}
+	return mix, nil
+}
+
+func (m Mix) pick(rng *rand.Rand) string {
+	total := 0.0
+	for _, w := range m {
+		total += w
+	}
+	r := rng.Float64() * total
+	// iterate in a fixed order so a seed reproduces the same sequence
+	for _, op := range []string{OpCars, OpJourney, OpDropoff, OpLocate} {
+		if r < m[op] {
+			return op
+		}
+		r -= m[op]
+	}
+	return OpJourney
+}
+
+type Config struct {
+	BaseURL string
+	// RPS is the target request rate, zero runs as fast as the workers can
+	RPS      float64
+	Workers  int
+	Duration time.Duration
+	Mix      Mix
+	// Cars is the size of the fleet loaded on start and on every PUT /cars
+	Cars int
+	// UnknownRatio is the share of dropoff and locate calls aimed at ids that
+	// don't exist, which must answer 404
+	UnknownRatio float64
+	Timeout      time.Duration
+	Seed         int64
+	// APIKey is sent with every request when set, it must allow PUT /cars
+	APIKey string
+}
+
+type runner struct {
+	config Config
+	client *http.Client
+	model  *model
+	stats  *Stats
+}
+
+// Run loads the fleet and then drives the configured mix against the server,
+// validating every response code against a local model of the expected state
+func Run(ctx context.Context, config Config) (*Stats, time.Duration, error) {
+	r := &runner{
+		config: config,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: &http.Transport{MaxIdleConnsPerHost: config.Workers},
+		},
+		model: newModel(),
+		stats: newStats(),
+	}
+
+	if status, err := r.putCars(ctx); err != nil || status != http.StatusOK {
+		return nil, 0, fmt.Errorf("loading the fleet failed: status %d, error %v", status, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	tokens := make(chan struct{}, config.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for {
+				if config.RPS > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				r.do(ctx, rng, config.Mix.pick(rng))
+			}
+		}(config.Seed + int64(i))
+	}
+
+	start := time.Now()
+	if config.RPS > 0 {
+		r.pace(ctx, tokens)
+	}
+	wg.Wait()
+
+	return r.stats, time.Since(start), nil
+}
+
+// pace hands out tokens at the target rate, dropping the ones no worker takes
+func (r *runner) pace(ctx context.Context, tokens chan<- struct{}) {
+	tick := time.Duration(float64(time.Second) / r.config.RPS)
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	sent := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			owed := int(now.Sub(start).Seconds()*r.config.RPS) - sent
+			for ; owed > 0; owed-- {
+				sent++
+				select {
+				case tokens <- struct{}{}:
+				default:
+					r.stats.drop()
+				}
+			}
+		}
+	}
+}
+
+func (r *runner) do(ctx context.Context, rng *rand.Rand, op string) {
+	switch op {
+	case OpCars:
+		r.model.fleet.Lock()
+		defer r.model.fleet.Unlock()
+		status, err := r.putCars(ctx)
+		if r.check(op, status, err, http.StatusOK) {
+			r.model.reset()
+		}
+
+	case OpJourney:
+		r.model.fleet.RLock()
+		defer r.model.fleet.RUnlock()
+		id := r.model.newID()
+		body, _ := json.Marshal(models.Journey{Id: id, Passengers: uint(rng.Intn(6) + 1)})
+		status, _, err := r.send(ctx, op, "/journey", "application/json", string(body))
+		if r.check(op, status, err, http.StatusOK, http.StatusAccepted) {
+			r.model.add(id)
+		}
+
+	case OpDropoff:
+		r.model.fleet.RLock()
+		defer r.model.fleet.RUnlock()
+		id, known := r.target(rng)
+		status, _, err := r.send(ctx, op, "/dropoff", "application/x-www-form-urlencoded", form(id))
+		if !known {
+			r.check(op, status, err, http.StatusNotFound)
+			return
+		}
+		r.check(op, status, err, http.StatusOK, http.StatusNoContent)
+
+	case OpLocate:
+		r.model.fleet.RLock()
+		defer r.model.fleet.RUnlock()
+		id, known := r.target(rng)
+		status, body, err := r.send(ctx, op, "/locate", "application/x-www-form-urlencoded", form(id))
+		if !known {
+			r.check(op, status, err, http.StatusNotFound)
+			return
+		}
+		if r.check(op, status, err, http.StatusOK, http.StatusNoContent) {
+			if status == http.StatusOK {
+				r.checkCar(op, body)
+			}
+			r.model.add(id)
+		}
+	}
+}
+
+// target claims a known journey, or returns an unknown id
+func (r *runner) target(rng *rand.Rand) (uint, bool) {
+	if rng.Float64() >= r.config.UnknownRatio {
+		if id, ok := r.model.claim(rng); ok {
+			return id, true
+		}
+	}
+	return r.model.unknownID(), false
+}
+
+func (r *runner) putCars(ctx context.Context) (int, error) {
+	cars := make([]models.Car, 0, r.config.Cars)
+	for i := 1; i <= r.config.Cars; i++ {
+		cars = append(cars, models.Car{ID: uint(i), Seats: uint(models.MIN_SEATS + i%(models.MAX_SEATS-models.MIN_SEATS+1))})
+	}
+	body, _ := json.Marshal(cars)
+	status, _, err := r.send(ctx, OpCars, "/cars", "application/json", string(body))
+	return status, err
+}
+
+func (r *runner) send(ctx context.Context, op, path, contentType, body string) (int, []byte, error) {
+	method := http.MethodPost
+	if op == OpCars {
+		method = http.MethodPut
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(r.config.BaseURL, "/")+path, strings.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if r.config.APIKey != "" {
+		req.Header.Set(auth.APIKeyHeader, r.config.APIKey)
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	r.stats.observe(op, resp.StatusCode, time.Since(start))
+	return resp.StatusCode, payload, err
+}
+
+// check records a failure unless the status is one of the expected ones.
+// Requests cut short by the end of the run are not counted.
+func (r *runner) check(op string, status int, err error, expected ...int) bool {
+	if err != nil {
+		if !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) && !strings.Contains(err.Error(), context.Canceled.Error()) {
+			r.stats.fail(op, err.Error())
+		}
+		return false
+	}
+	for _, e := range expected {
+		if status == e {
+			return true
+		}
+	}
+	r.stats.fail(op, fmt.Sprintf("expected %v got %d", expected, status))
+	return false
+}
+
+func (r *runner) checkCar(op string, body []byte) {
+	var car models.Car
+	if err := json.Unmarshal(body, &car); err != nil {
+		r.stats.fail(op, "invalid car payload")
+		return
+	}
+	if car.ID < 1 || int(car.ID) > r.config.Cars || car.AvailableSeats > car.Seats {
+		r.stats.fail(op, "car payload inconsistent with the fleet")
+	}
+}
+
+func form(id uint) string {
+	return url.Values{"ID": {strconv.FormatUint(uint64(id), 10)}}.Encode()
+}
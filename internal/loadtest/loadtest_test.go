@@ -0,0 +1,54 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/replay"
+)
+
+func TestRun_AgainstInProcessServer(t *testing.T) {
+	service, err := replay.NewServer(replay.Config{})
+	require.NoError(t, err)
+	server := httptest.NewServer(service.Engine)
+	defer server.Close()
+
+	mix, err := ParseMix("journey=4,dropoff=3,locate=3,cars=0.05")
+	require.NoError(t, err)
+
+	stats, elapsed, err := Run(context.Background(), Config{
+		BaseURL:      server.URL,
+		RPS:          400,
+		Workers:      8,
+		Duration:     500 * time.Millisecond,
+		Mix:          mix,
+		Cars:         20,
+		UnknownRatio: 0.1,
+		Timeout:      time.Second,
+		Seed:         7,
+	})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	stats.Print(&out, elapsed)
+	assert.Equal(t, 0, stats.Failures(), out.String())
+	assert.True(t, stats.Requests() > 50, out.String())
+	assert.Contains(t, out.String(), OpJourney)
+}
+
+func TestParseMix(t *testing.T) {
+	_, err := ParseMix("journey=1,teleport=2")
+	assert.Error(t, err)
+	_, err = ParseMix("journey=0")
+	assert.Error(t, err)
+
+	mix, err := ParseMix("locate=1")
+	require.NoError(t, err)
+	assert.Equal(t, OpLocate, mix.pick(rand.New(rand.NewSource(1))))
+}
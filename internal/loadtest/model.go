@@ -0,0 +1,74 @@
+package loadtest
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// model is the client side view of the journeys that should exist on the
+// server. Journeys are claimed while a request about them is in flight so
+// concurrent workers never race on the same id and expectations stay exact.
+type model struct {
+	mu     sync.Mutex
+	ids    []uint
+	index  map[uint]int
+	nextID uint
+
+	// fleet resets are exclusive with every other operation
+	fleet sync.RWMutex
+}
+
+func newModel() *model {
+	return &model{index: make(map[uint]int)}
+}
+
+func (m *model) newID() uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	return m.nextID
+}
+
+// unknownID returns an id that was never handed out
+func (m *model) unknownID() uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.nextID + 1_000_000
+}
+
+func (m *model) add(id uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index[id] = len(m.ids)
+	m.ids = append(m.ids, id)
+}
+
+// claim removes a random known journey from the model, ok is false if there are none
+func (m *model) claim(rng *rand.Rand) (id uint, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.ids) == 0 {
+		return 0, false
+	}
+	i := rng.Intn(len(m.ids))
+	id = m.ids[i]
+	last := len(m.ids) - 1
+	m.ids[i] = m.ids[last]
+	m.index[m.ids[i]] = i
+	m.ids = m.ids[:last]
+	delete(m.index, id)
+	return id, true
+}
+
+func (m *model) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids = nil
+	m.index = make(map[uint]int)
+}
+
+func (m *model) size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.ids)
+}
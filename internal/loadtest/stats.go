@@ -0,0 +1,171 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// histogram bucket upper bounds, the last bucket catches everything slower
+var bucketBounds = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type opStats struct {
+	latencies []time.Duration
+	statuses  map[int]int
+}
+
+// Stats collects latencies, status codes and failures per operation
+type Stats struct {
+	mu       sync.Mutex
+	ops      map[string]*opStats
+	failures map[string]int
+	dropped  int
+}
+
+func newStats() *Stats {
+	return &Stats{
+		ops:      make(map[string]*opStats),
+		failures: make(map[string]int),
+	}
+}
+
+func (s *Stats) observe(op string, status int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.ops[op]
+	if !ok {
+		st = &opStats{statuses: make(map[int]int)}
+		s.ops[op] = st
+	}
+	st.latencies = append(st.latencies, latency)
+	st.statuses[status]++
+}
+
+// fail records a transport error or a response not matching the model
+func (s *Stats) fail(op, reason string) {
+	s.mu.Lock()
+	s.failures[op+": "+reason]++
+	s.mu.Unlock()
+}
+
+// drop records a tick no worker was free to serve
+func (s *Stats) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+// Failures returns the number of failed requests
+func (s *Stats) Failures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.failures {
+		total += n
+	}
+	return total
+}
+
+// Requests returns the number of requests that got a response
+func (s *Stats) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, st := range s.ops {
+		total += len(st.latencies)
+	}
+	return total
+}
+
+// Print writes a human readable report with latency histograms per operation
+func (s *Stats) Print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, st := range s.ops {
+		total += len(st.latencies)
+	}
+	fmt.Fprintf(w, "%d requests in %s (%.1f req/s), %d ticks dropped\n\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds(), s.dropped)
+
+	names := make([]string, 0, len(s.ops))
+	for name := range s.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		st := s.ops[name]
+		sorted := append([]time.Duration(nil), st.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		fmt.Fprintf(w, "%s  n=%d  p50=%s  p90=%s  p99=%s  max=%s\n", name, len(sorted),
+			pct(sorted, 50), pct(sorted, 90), pct(sorted, 99), sorted[len(sorted)-1])
+
+		codes := make([]int, 0, len(st.statuses))
+		for code := range st.statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		parts := make([]string, 0, len(codes))
+		for _, code := range codes {
+			parts = append(parts, fmt.Sprintf("%d=%d", code, st.statuses[code]))
+		}
+		fmt.Fprintf(w, "  status: %s\n", strings.Join(parts, " "))
+
+		counts := make([]int, len(bucketBounds)+1)
+		for _, l := range sorted {
+			i := sort.Search(len(bucketBounds), func(i int) bool { return l <= bucketBounds[i] })
+			counts[i]++
+		}
+		for i, n := range counts {
+			if n == 0 {
+				continue
+			}
+			label := "> " + bucketBounds[len(bucketBounds)-1].String()
+			if i < len(bucketBounds) {
+				label = "<= " + bucketBounds[i].String()
+			}
+			bar := strings.Repeat("#", (n*40+len(sorted)-1)/len(sorted))
+			fmt.Fprintf(w, "  %10s %7d %s\n", label, n, bar)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(s.failures) == 0 {
+		fmt.Fprintln(w, "no errors")
+		return
+	}
+	reasons := make([]string, 0, len(s.failures))
+	for reason := range s.failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return s.failures[reasons[i]] > s.failures[reasons[j]] })
+	fmt.Fprintln(w, "errors:")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "  %7d %s\n", s.failures[reason], reason)
+	}
+}
+
+func pct(sorted []time.Duration, p int) time.Duration {
+	rank := (len(sorted)*p+99)/100 - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,258 @@
+// Package metrics keeps counters and histograms in memory and serves them in
+// the Prometheus text exposition format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds named metric families and serves them over HTTP
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*CounterVec
+	histograms map[string]*HistogramVec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{counters: make(map[string]*CounterVec), histograms: make(map[string]*HistogramVec)}
+}
+
+// Counter returns the counter family with the given name, creating it on first use
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, exists := r.counters[name]; exists {
+		return c
+	}
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*series)}
+	r.counters[name] = c
+	return c
+}
+
+// Histogram returns the histogram family with the given name, creating it on
+// first use with the given bucket upper bounds, in increasing order
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if h, exists := r.histograms[name]; exists {
+		return h
+	}
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramSeries)}
+	r.histograms[name] = h
+	return h
+}
+
+// WriteText writes every family, sorted by name, in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make(map[string]interface{ writeText(io.Writer) error }, len(r.counters)+len(r.histograms))
+	for name, c := range r.counters {
+		families[name] = c
+	}
+	for name, h := range r.histograms {
+		families[name] = h
+	}
+	r.mu.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := families[name].writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteText(w)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// CounterVec is a family of counters told apart by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+// Inc adds one to the counter with the given label values, in label order
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", c.name, len(c.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, exists := c.values[key]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.value += delta
+}
+
+// Value returns the counter with the given label values, 0 if never increased
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, exists := c.values[strings.Join(labelValues, "\xff")]; exists {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) writeText(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := c.values[key]
+		if _, err := fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, s.labelValues), s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogramSeries struct {
+	labelValues []string
+	// counts holds the observations of each bucket alone, they are added up
+	// when written
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a family of histograms told apart by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramSeries
+}
+
+// Observe adds v to the histogram with the given label values, in label order
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, exists := h.values[key]
+	if !exists {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Count returns how many values the histogram with the given label values
+// observed, and Sum their total
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, exists := h.values[strings.Join(labelValues, "\xff")]; exists {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) Sum(labelValues ...string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, exists := h.values[strings.Join(labelValues, "\xff")]; exists {
+		return s.sum
+	}
+	return 0
+}
+
+func (h *HistogramVec) writeText(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, key := range keys {
+		s := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			labels := formatLabels(names, append(append([]string(nil), s.labelValues...), fmt.Sprintf("%g", bound)))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, cumulative); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(names, append(append([]string(nil), s.labelValues...), "+Inf"))
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, s.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.sum, h.name, formatLabels(h.labels, s.labelValues), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
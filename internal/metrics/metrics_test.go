@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_ServesTextFormat(t *testing.T) {
+	r := NewRegistry()
+	conflicts := r.Counter("carpool_conflicts_total", "Conflicting attempts.", "operation")
+	conflicts.Inc("dropoff")
+	conflicts.Add(2, "new_journey")
+	r.Counter("carpool_attempts_total", "Attempts.")
+
+	// asking again returns the same family
+	r.Counter("carpool_conflicts_total", "Conflicting attempts.", "operation").Inc("dropoff")
+	assert.Equal(t, float64(2), conflicts.Value("dropoff"))
+	assert.Equal(t, float64(0), conflicts.Value("reassign"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP carpool_attempts_total Attempts.
+# TYPE carpool_attempts_total counter
+# HELP carpool_conflicts_total Conflicting attempts.
+# TYPE carpool_conflicts_total counter
+carpool_conflicts_total{operation="dropoff"} 2
+carpool_conflicts_total{operation="new_journey"} 2
+`, w.Body.String())
+}
+
+func TestHistogram_WritesCumulativeBuckets(t *testing.T) {
+	r := NewRegistry()
+	wait := r.Histogram("carpool_wait_seconds", "Time waited.", []float64{1, 10}, "class")
+	for _, v := range []float64{0.5, 3, 4, 60} {
+		wait.Observe(v, "standard")
+	}
+	assert.Equal(t, uint64(4), wait.Count("standard"))
+	assert.Equal(t, 67.5, wait.Sum("standard"))
+	assert.Equal(t, uint64(0), wait.Count("priority"))
+
+	var b strings.Builder
+	assert.NoError(t, r.WriteText(&b))
+	assert.Equal(t, `# HELP carpool_wait_seconds Time waited.
+# TYPE carpool_wait_seconds histogram
+carpool_wait_seconds_bucket{class="standard",le="1"} 1
+carpool_wait_seconds_bucket{class="standard",le="10"} 3
+carpool_wait_seconds_bucket{class="standard",le="+Inf"} 4
+carpool_wait_seconds_sum{class="standard"} 67.5
+carpool_wait_seconds_count{class="standard"} 4
+`, b.String())
+}
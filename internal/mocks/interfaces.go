@@ -5,7 +5,9 @@
 package mock_models
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
@@ -34,75 +36,133 @@ func (m *MockICarStorage) EXPECT() *MockICarStorageMockRecorder {
 	return m.recorder
 }
 
+// CarsWithAtLeast mocks base method.
+func (m *MockICarStorage) CarsWithAtLeast(ctx context.Context, seats uint) []*models.Car {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CarsWithAtLeast", ctx, seats)
+	ret0, _ := ret[0].([]*models.Car)
+	return ret0
+}
+
+// CarsWithAtLeast indicates an expected call of CarsWithAtLeast.
+func (mr *MockICarStorageMockRecorder) CarsWithAtLeast(ctx, seats interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CarsWithAtLeast", reflect.TypeOf((*MockICarStorage)(nil).CarsWithAtLeast), ctx, seats)
+}
+
+// DeleteById mocks base method.
+func (m *MockICarStorage) DeleteById(ctx context.Context, carId uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteById", ctx, carId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteById indicates an expected call of DeleteById.
+func (mr *MockICarStorageMockRecorder) DeleteById(ctx, carId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockICarStorage)(nil).DeleteById), ctx, carId)
+}
+
+// FindBestFit mocks base method.
+func (m *MockICarStorage) FindBestFit(ctx context.Context, seats uint) (*models.Car, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindBestFit", ctx, seats)
+	ret0, _ := ret[0].(*models.Car)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindBestFit indicates an expected call of FindBestFit.
+func (mr *MockICarStorageMockRecorder) FindBestFit(ctx, seats interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindBestFit", reflect.TypeOf((*MockICarStorage)(nil).FindBestFit), ctx, seats)
+}
+
 // FindById mocks base method.
-func (m *MockICarStorage) FindById(carId uint) (*models.Car, error) {
+func (m *MockICarStorage) FindById(ctx context.Context, carId uint) (*models.Car, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindById", carId)
+	ret := m.ctrl.Call(m, "FindById", ctx, carId)
 	ret0, _ := ret[0].(*models.Car)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindById indicates an expected call of FindById.
-func (mr *MockICarStorageMockRecorder) FindById(carId interface{}) *gomock.Call {
+func (mr *MockICarStorageMockRecorder) FindById(ctx, carId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockICarStorage)(nil).FindById), carId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockICarStorage)(nil).FindById), ctx, carId)
 }
 
 // GetAllCars mocks base method.
-func (m *MockICarStorage) GetAllCars() []*models.Car {
+func (m *MockICarStorage) GetAllCars(ctx context.Context) []*models.Car {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllCars")
+	ret := m.ctrl.Call(m, "GetAllCars", ctx)
 	ret0, _ := ret[0].([]*models.Car)
 	return ret0
 }
 
 // GetAllCars indicates an expected call of GetAllCars.
-func (mr *MockICarStorageMockRecorder) GetAllCars() *gomock.Call {
+func (mr *MockICarStorageMockRecorder) GetAllCars(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCars", reflect.TypeOf((*MockICarStorage)(nil).GetAllCars))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllCars", reflect.TypeOf((*MockICarStorage)(nil).GetAllCars), ctx)
 }
 
 // NewCar mocks base method.
-func (m *MockICarStorage) NewCar(car *models.Car) error {
+func (m *MockICarStorage) NewCar(ctx context.Context, car *models.Car) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewCar", car)
+	ret := m.ctrl.Call(m, "NewCar", ctx, car)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // NewCar indicates an expected call of NewCar.
-func (mr *MockICarStorageMockRecorder) NewCar(car interface{}) *gomock.Call {
+func (mr *MockICarStorageMockRecorder) NewCar(ctx, car interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewCar", reflect.TypeOf((*MockICarStorage)(nil).NewCar), car)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewCar", reflect.TypeOf((*MockICarStorage)(nil).NewCar), ctx, car)
 }
 
 // ResetMemory mocks base method.
-func (m *MockICarStorage) ResetMemory() error {
+func (m *MockICarStorage) ResetMemory(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ResetMemory")
+	ret := m.ctrl.Call(m, "ResetMemory", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ResetMemory indicates an expected call of ResetMemory.
-func (mr *MockICarStorageMockRecorder) ResetMemory() *gomock.Call {
+func (mr *MockICarStorageMockRecorder) ResetMemory(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockICarStorage)(nil).ResetMemory), ctx)
+}
+
+// Shapes mocks base method.
+func (m *MockICarStorage) Shapes(ctx context.Context) ([]models.CarShape, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shapes", ctx)
+	ret0, _ := ret[0].([]models.CarShape)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Shapes indicates an expected call of Shapes.
+func (mr *MockICarStorageMockRecorder) Shapes(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockICarStorage)(nil).ResetMemory))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shapes", reflect.TypeOf((*MockICarStorage)(nil).Shapes), ctx)
 }
 
 // UpdateCar mocks base method.
-func (m *MockICarStorage) UpdateCar(carId uint, newCar *models.Car) error {
+func (m *MockICarStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateCar", carId, newCar)
+	ret := m.ctrl.Call(m, "UpdateCar", ctx, carId, newCar, expectedVersion)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateCar indicates an expected call of UpdateCar.
-func (mr *MockICarStorageMockRecorder) UpdateCar(carId, newCar interface{}) *gomock.Call {
+func (mr *MockICarStorageMockRecorder) UpdateCar(ctx, carId, newCar, expectedVersion interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCar", reflect.TypeOf((*MockICarStorage)(nil).UpdateCar), carId, newCar)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCar", reflect.TypeOf((*MockICarStorage)(nil).UpdateCar), ctx, carId, newCar, expectedVersion)
 }
 
 // MockIJourneyStorage is a mock of IJourneyStorage interface.
@@ -129,74 +189,88 @@ func (m *MockIJourneyStorage) EXPECT() *MockIJourneyStorageMockRecorder {
 }
 
 // DeleteById mocks base method.
-func (m *MockIJourneyStorage) DeleteById(journeyId uint) error {
+func (m *MockIJourneyStorage) DeleteById(ctx context.Context, journeyId uint) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteById", journeyId)
+	ret := m.ctrl.Call(m, "DeleteById", ctx, journeyId)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteById indicates an expected call of DeleteById.
-func (mr *MockIJourneyStorageMockRecorder) DeleteById(journeyId interface{}) *gomock.Call {
+func (mr *MockIJourneyStorageMockRecorder) DeleteById(ctx, journeyId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIJourneyStorage)(nil).DeleteById), journeyId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIJourneyStorage)(nil).DeleteById), ctx, journeyId)
 }
 
 // FindById mocks base method.
-func (m *MockIJourneyStorage) FindById(journeyId uint) (*models.Journey, error) {
+func (m *MockIJourneyStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindById", journeyId)
+	ret := m.ctrl.Call(m, "FindById", ctx, journeyId)
 	ret0, _ := ret[0].(*models.Journey)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindById indicates an expected call of FindById.
-func (mr *MockIJourneyStorageMockRecorder) FindById(journeyId interface{}) *gomock.Call {
+func (mr *MockIJourneyStorageMockRecorder) FindById(ctx, journeyId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockIJourneyStorage)(nil).FindById), journeyId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockIJourneyStorage)(nil).FindById), ctx, journeyId)
+}
+
+// GetAllJourneys mocks base method.
+func (m *MockIJourneyStorage) GetAllJourneys(ctx context.Context) []*models.Journey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllJourneys", ctx)
+	ret0, _ := ret[0].([]*models.Journey)
+	return ret0
+}
+
+// GetAllJourneys indicates an expected call of GetAllJourneys.
+func (mr *MockIJourneyStorageMockRecorder) GetAllJourneys(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllJourneys", reflect.TypeOf((*MockIJourneyStorage)(nil).GetAllJourneys), ctx)
 }
 
 // NewJourney mocks base method.
-func (m *MockIJourneyStorage) NewJourney(journey *models.Journey) error {
+func (m *MockIJourneyStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewJourney", journey)
+	ret := m.ctrl.Call(m, "NewJourney", ctx, journey)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // NewJourney indicates an expected call of NewJourney.
-func (mr *MockIJourneyStorageMockRecorder) NewJourney(journey interface{}) *gomock.Call {
+func (mr *MockIJourneyStorageMockRecorder) NewJourney(ctx, journey interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewJourney", reflect.TypeOf((*MockIJourneyStorage)(nil).NewJourney), journey)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewJourney", reflect.TypeOf((*MockIJourneyStorage)(nil).NewJourney), ctx, journey)
 }
 
 // ResetMemory mocks base method.
-func (m *MockIJourneyStorage) ResetMemory() error {
+func (m *MockIJourneyStorage) ResetMemory(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ResetMemory")
+	ret := m.ctrl.Call(m, "ResetMemory", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ResetMemory indicates an expected call of ResetMemory.
-func (mr *MockIJourneyStorageMockRecorder) ResetMemory() *gomock.Call {
+func (mr *MockIJourneyStorageMockRecorder) ResetMemory(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIJourneyStorage)(nil).ResetMemory))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIJourneyStorage)(nil).ResetMemory), ctx)
 }
 
 // UpdateJourney mocks base method.
-func (m *MockIJourneyStorage) UpdateJourney(journeyId uint, newJourney *models.Journey) error {
+func (m *MockIJourneyStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateJourney", journeyId, newJourney)
+	ret := m.ctrl.Call(m, "UpdateJourney", ctx, journeyId, newJourney, expectedVersion)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateJourney indicates an expected call of UpdateJourney.
-func (mr *MockIJourneyStorageMockRecorder) UpdateJourney(journeyId, newJourney interface{}) *gomock.Call {
+func (mr *MockIJourneyStorageMockRecorder) UpdateJourney(ctx, journeyId, newJourney, expectedVersion interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateJourney", reflect.TypeOf((*MockIJourneyStorage)(nil).UpdateJourney), journeyId, newJourney)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateJourney", reflect.TypeOf((*MockIJourneyStorage)(nil).UpdateJourney), ctx, journeyId, newJourney, expectedVersion)
 }
 
 // MockIPenidngStorage is a mock of IPenidngStorage interface.
@@ -222,74 +296,364 @@ func (m *MockIPenidngStorage) EXPECT() *MockIPenidngStorageMockRecorder {
 	return m.recorder
 }
 
+// CountOwnedBy mocks base method.
+func (m *MockIPenidngStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountOwnedBy", ctx, owner)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountOwnedBy indicates an expected call of CountOwnedBy.
+func (mr *MockIPenidngStorageMockRecorder) CountOwnedBy(ctx, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountOwnedBy", reflect.TypeOf((*MockIPenidngStorage)(nil).CountOwnedBy), ctx, owner)
+}
+
 // DeleteById mocks base method.
-func (m *MockIPenidngStorage) DeleteById(journeyId uint) error {
+func (m *MockIPenidngStorage) DeleteById(ctx context.Context, journeyId uint) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteById", journeyId)
+	ret := m.ctrl.Call(m, "DeleteById", ctx, journeyId)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteById indicates an expected call of DeleteById.
-func (mr *MockIPenidngStorageMockRecorder) DeleteById(journeyId interface{}) *gomock.Call {
+func (mr *MockIPenidngStorageMockRecorder) DeleteById(ctx, journeyId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIPenidngStorage)(nil).DeleteById), journeyId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIPenidngStorage)(nil).DeleteById), ctx, journeyId)
 }
 
 // GetAllPendings mocks base method.
-func (m *MockIPenidngStorage) GetAllPendings() []*models.Journey {
+func (m *MockIPenidngStorage) GetAllPendings(ctx context.Context) []*models.Journey {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllPendings")
+	ret := m.ctrl.Call(m, "GetAllPendings", ctx)
 	ret0, _ := ret[0].([]*models.Journey)
 	return ret0
 }
 
 // GetAllPendings indicates an expected call of GetAllPendings.
-func (mr *MockIPenidngStorageMockRecorder) GetAllPendings() *gomock.Call {
+func (mr *MockIPenidngStorageMockRecorder) GetAllPendings(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllPendings", reflect.TypeOf((*MockIPenidngStorage)(nil).GetAllPendings))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllPendings", reflect.TypeOf((*MockIPenidngStorage)(nil).GetAllPendings), ctx)
 }
 
 // NewPending mocks base method.
-func (m *MockIPenidngStorage) NewPending(pending *models.Journey) error {
+func (m *MockIPenidngStorage) NewPending(ctx context.Context, pending *models.Journey) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewPending", pending)
+	ret := m.ctrl.Call(m, "NewPending", ctx, pending)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // NewPending indicates an expected call of NewPending.
-func (mr *MockIPenidngStorageMockRecorder) NewPending(pending interface{}) *gomock.Call {
+func (mr *MockIPenidngStorageMockRecorder) NewPending(ctx, pending interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPending", reflect.TypeOf((*MockIPenidngStorage)(nil).NewPending), pending)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPending", reflect.TypeOf((*MockIPenidngStorage)(nil).NewPending), ctx, pending)
+}
+
+// NextFitting mocks base method.
+func (m *MockIPenidngStorage) NextFitting(ctx context.Context, maxPassengers uint, free models.Features) (*models.Journey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextFitting", ctx, maxPassengers, free)
+	ret0, _ := ret[0].(*models.Journey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextFitting indicates an expected call of NextFitting.
+func (mr *MockIPenidngStorageMockRecorder) NextFitting(ctx, maxPassengers, free interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextFitting", reflect.TypeOf((*MockIPenidngStorage)(nil).NextFitting), ctx, maxPassengers, free)
+}
+
+// NextFittingOfClass mocks base method.
+func (m *MockIPenidngStorage) NextFittingOfClass(ctx context.Context, maxPassengers uint, free models.Features, class models.PriorityClass) (*models.Journey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextFittingOfClass", ctx, maxPassengers, free, class)
+	ret0, _ := ret[0].(*models.Journey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextFittingOfClass indicates an expected call of NextFittingOfClass.
+func (mr *MockIPenidngStorageMockRecorder) NextFittingOfClass(ctx, maxPassengers, free, class interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextFittingOfClass", reflect.TypeOf((*MockIPenidngStorage)(nil).NextFittingOfClass), ctx, maxPassengers, free, class)
 }
 
 // ResetMemory mocks base method.
-func (m *MockIPenidngStorage) ResetMemory() error {
+func (m *MockIPenidngStorage) ResetMemory(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ResetMemory")
+	ret := m.ctrl.Call(m, "ResetMemory", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ResetMemory indicates an expected call of ResetMemory.
-func (mr *MockIPenidngStorageMockRecorder) ResetMemory() *gomock.Call {
+func (mr *MockIPenidngStorageMockRecorder) ResetMemory(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIPenidngStorage)(nil).ResetMemory))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIPenidngStorage)(nil).ResetMemory), ctx)
 }
 
 // UpdatePending mocks base method.
-func (m *MockIPenidngStorage) UpdatePending(pendingId uint, newPending *models.Journey) error {
+func (m *MockIPenidngStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePending", pendingId, newPending)
+	ret := m.ctrl.Call(m, "UpdatePending", ctx, pendingId, newPending, expectedVersion)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdatePending indicates an expected call of UpdatePending.
-func (mr *MockIPenidngStorageMockRecorder) UpdatePending(pendingId, newPending interface{}) *gomock.Call {
+func (mr *MockIPenidngStorageMockRecorder) UpdatePending(ctx, pendingId, newPending, expectedVersion interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePending", reflect.TypeOf((*MockIPenidngStorage)(nil).UpdatePending), ctx, pendingId, newPending, expectedVersion)
+}
+
+// MockIScheduledStorage is a mock of IScheduledStorage interface.
+type MockIScheduledStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIScheduledStorageMockRecorder
+}
+
+// MockIScheduledStorageMockRecorder is the mock recorder for MockIScheduledStorage.
+type MockIScheduledStorageMockRecorder struct {
+	mock *MockIScheduledStorage
+}
+
+// NewMockIScheduledStorage creates a new mock instance.
+func NewMockIScheduledStorage(ctrl *gomock.Controller) *MockIScheduledStorage {
+	mock := &MockIScheduledStorage{ctrl: ctrl}
+	mock.recorder = &MockIScheduledStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIScheduledStorage) EXPECT() *MockIScheduledStorageMockRecorder {
+	return m.recorder
+}
+
+// CountOwnedBy mocks base method.
+func (m *MockIScheduledStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountOwnedBy", ctx, owner)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountOwnedBy indicates an expected call of CountOwnedBy.
+func (mr *MockIScheduledStorageMockRecorder) CountOwnedBy(ctx, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountOwnedBy", reflect.TypeOf((*MockIScheduledStorage)(nil).CountOwnedBy), ctx, owner)
+}
+
+// DeleteById mocks base method.
+func (m *MockIScheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteById", ctx, journeyId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteById indicates an expected call of DeleteById.
+func (mr *MockIScheduledStorageMockRecorder) DeleteById(ctx, journeyId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIScheduledStorage)(nil).DeleteById), ctx, journeyId)
+}
+
+// Due mocks base method.
+func (m *MockIScheduledStorage) Due(ctx context.Context, until time.Time) []*models.Journey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Due", ctx, until)
+	ret0, _ := ret[0].([]*models.Journey)
+	return ret0
+}
+
+// Due indicates an expected call of Due.
+func (mr *MockIScheduledStorageMockRecorder) Due(ctx, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Due", reflect.TypeOf((*MockIScheduledStorage)(nil).Due), ctx, until)
+}
+
+// FindById mocks base method.
+func (m *MockIScheduledStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, journeyId)
+	ret0, _ := ret[0].(*models.Journey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockIScheduledStorageMockRecorder) FindById(ctx, journeyId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockIScheduledStorage)(nil).FindById), ctx, journeyId)
+}
+
+// GetAllScheduled mocks base method.
+func (m *MockIScheduledStorage) GetAllScheduled(ctx context.Context) []*models.Journey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllScheduled", ctx)
+	ret0, _ := ret[0].([]*models.Journey)
+	return ret0
+}
+
+// GetAllScheduled indicates an expected call of GetAllScheduled.
+func (mr *MockIScheduledStorageMockRecorder) GetAllScheduled(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllScheduled", reflect.TypeOf((*MockIScheduledStorage)(nil).GetAllScheduled), ctx)
+}
+
+// NewScheduled mocks base method.
+func (m *MockIScheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewScheduled", ctx, journey)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NewScheduled indicates an expected call of NewScheduled.
+func (mr *MockIScheduledStorageMockRecorder) NewScheduled(ctx, journey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewScheduled", reflect.TypeOf((*MockIScheduledStorage)(nil).NewScheduled), ctx, journey)
+}
+
+// ResetMemory mocks base method.
+func (m *MockIScheduledStorage) ResetMemory(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetMemory", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetMemory indicates an expected call of ResetMemory.
+func (mr *MockIScheduledStorageMockRecorder) ResetMemory(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePending", reflect.TypeOf((*MockIPenidngStorage)(nil).UpdatePending), pendingId, newPending)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIScheduledStorage)(nil).ResetMemory), ctx)
+}
+
+// UpdateScheduled mocks base method.
+func (m *MockIScheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateScheduled", ctx, journeyId, newJourney, expectedVersion)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateScheduled indicates an expected call of UpdateScheduled.
+func (mr *MockIScheduledStorageMockRecorder) UpdateScheduled(ctx, journeyId, newJourney, expectedVersion interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateScheduled", reflect.TypeOf((*MockIScheduledStorage)(nil).UpdateScheduled), ctx, journeyId, newJourney, expectedVersion)
+}
+
+// MockIReservationStorage is a mock of IReservationStorage interface.
+type MockIReservationStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockIReservationStorageMockRecorder
+}
+
+// MockIReservationStorageMockRecorder is the mock recorder for MockIReservationStorage.
+type MockIReservationStorageMockRecorder struct {
+	mock *MockIReservationStorage
+}
+
+// NewMockIReservationStorage creates a new mock instance.
+func NewMockIReservationStorage(ctrl *gomock.Controller) *MockIReservationStorage {
+	mock := &MockIReservationStorage{ctrl: ctrl}
+	mock.recorder = &MockIReservationStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIReservationStorage) EXPECT() *MockIReservationStorageMockRecorder {
+	return m.recorder
+}
+
+// DeleteById mocks base method.
+func (m *MockIReservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteById", ctx, journeyId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteById indicates an expected call of DeleteById.
+func (mr *MockIReservationStorageMockRecorder) DeleteById(ctx, journeyId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteById", reflect.TypeOf((*MockIReservationStorage)(nil).DeleteById), ctx, journeyId)
+}
+
+// Expired mocks base method.
+func (m *MockIReservationStorage) Expired(ctx context.Context, until time.Time) []*models.Reservation {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expired", ctx, until)
+	ret0, _ := ret[0].([]*models.Reservation)
+	return ret0
+}
+
+// Expired indicates an expected call of Expired.
+func (mr *MockIReservationStorageMockRecorder) Expired(ctx, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expired", reflect.TypeOf((*MockIReservationStorage)(nil).Expired), ctx, until)
+}
+
+// FindById mocks base method.
+func (m *MockIReservationStorage) FindById(ctx context.Context, journeyId uint) (*models.Reservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, journeyId)
+	ret0, _ := ret[0].(*models.Reservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockIReservationStorageMockRecorder) FindById(ctx, journeyId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockIReservationStorage)(nil).FindById), ctx, journeyId)
+}
+
+// GetAllReservations mocks base method.
+func (m *MockIReservationStorage) GetAllReservations(ctx context.Context) []*models.Reservation {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllReservations", ctx)
+	ret0, _ := ret[0].([]*models.Reservation)
+	return ret0
+}
+
+// GetAllReservations indicates an expected call of GetAllReservations.
+func (mr *MockIReservationStorageMockRecorder) GetAllReservations(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllReservations", reflect.TypeOf((*MockIReservationStorage)(nil).GetAllReservations), ctx)
+}
+
+// NewReservation mocks base method.
+func (m *MockIReservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewReservation", ctx, reservation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NewReservation indicates an expected call of NewReservation.
+func (mr *MockIReservationStorageMockRecorder) NewReservation(ctx, reservation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewReservation", reflect.TypeOf((*MockIReservationStorage)(nil).NewReservation), ctx, reservation)
+}
+
+// ResetMemory mocks base method.
+func (m *MockIReservationStorage) ResetMemory(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetMemory", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetMemory indicates an expected call of ResetMemory.
+func (mr *MockIReservationStorageMockRecorder) ResetMemory(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetMemory", reflect.TypeOf((*MockIReservationStorage)(nil).ResetMemory), ctx)
 }
 
 // MockTransaction is a mock of Transaction interface.
@@ -330,17 +694,17 @@ func (mr *MockTransactionMockRecorder) CarsStorage() *gomock.Call {
 }
 
 // Commit mocks base method.
-func (m *MockTransaction) Commit() error {
+func (m *MockTransaction) Commit(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Commit")
+	ret := m.ctrl.Call(m, "Commit", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Commit indicates an expected call of Commit.
-func (mr *MockTransactionMockRecorder) Commit() *gomock.Call {
+func (mr *MockTransactionMockRecorder) Commit(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockTransaction)(nil).Commit))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockTransaction)(nil).Commit), ctx)
 }
 
 // HasCommited mocks base method.
@@ -385,6 +749,20 @@ func (mr *MockTransactionMockRecorder) PendingsStorage() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingsStorage", reflect.TypeOf((*MockTransaction)(nil).PendingsStorage))
 }
 
+// ReservationsStorage mocks base method.
+func (m *MockTransaction) ReservationsStorage() models.IReservationStorage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReservationsStorage")
+	ret0, _ := ret[0].(models.IReservationStorage)
+	return ret0
+}
+
+// ReservationsStorage indicates an expected call of ReservationsStorage.
+func (mr *MockTransactionMockRecorder) ReservationsStorage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReservationsStorage", reflect.TypeOf((*MockTransaction)(nil).ReservationsStorage))
+}
+
 // Rollback mocks base method.
 func (m *MockTransaction) Rollback() error {
 	m.ctrl.T.Helper()
@@ -399,6 +777,20 @@ func (mr *MockTransactionMockRecorder) Rollback() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockTransaction)(nil).Rollback))
 }
 
+// ScheduledStorage mocks base method.
+func (m *MockTransaction) ScheduledStorage() models.IScheduledStorage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScheduledStorage")
+	ret0, _ := ret[0].(models.IScheduledStorage)
+	return ret0
+}
+
+// ScheduledStorage indicates an expected call of ScheduledStorage.
+func (mr *MockTransactionMockRecorder) ScheduledStorage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScheduledStorage", reflect.TypeOf((*MockTransaction)(nil).ScheduledStorage))
+}
+
 // MockTransactionFactory is a mock of TransactionFactory interface.
 type MockTransactionFactory struct {
 	ctrl     *gomock.Controller
@@ -423,16 +815,16 @@ func (m *MockTransactionFactory) EXPECT() *MockTransactionFactoryMockRecorder {
 }
 
 // Begin mocks base method.
-func (m *MockTransactionFactory) Begin() (models.Transaction, error) {
+func (m *MockTransactionFactory) Begin(ctx context.Context) (models.Transaction, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Begin")
+	ret := m.ctrl.Call(m, "Begin", ctx)
 	ret0, _ := ret[0].(models.Transaction)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Begin indicates an expected call of Begin.
-func (mr *MockTransactionFactoryMockRecorder) Begin() *gomock.Call {
+func (mr *MockTransactionFactoryMockRecorder) Begin(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockTransactionFactory)(nil).Begin))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockTransactionFactory)(nil).Begin), ctx)
 }
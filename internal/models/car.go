@@ -7,16 +7,95 @@ type Car struct {
 	ID             uint `json:"id"`
 	Seats          uint `json:"seats"`
 	AvailableSeats uint `json:"availableSeats"`
+	// Draining cars were left out of a merged fleet while carrying groups,
+	// they take no new ones and are removed once the last one drops off
+	Draining bool `json:"draining,omitempty"`
+	// Features the car offers, they read as part of the car in the API
+	Features
+	// InUse are the features taken by the groups riding the car, kept by the
+	// storage as the seats are
+	InUse Features `json:"-"`
+	// Version is set by the storage and changes on every update, it isn't part of the API
+	Version uint64 `json:"-"`
 }
 
 func (c *Car) HasValidSeats() bool {
 	return c.Seats >= MIN_SEATS && c.Seats <= MAX_SEATS
 }
 
-func (c *Car) FreeUpSeats(amount uint) {
+// FreeUpSeats fails, leaving the car as it was, when the car would end up
+// with more free seats than it has
+func (c *Car) FreeUpSeats(amount uint) error {
+	if c.AvailableSeats > c.Seats || amount > c.Seats-c.AvailableSeats {
+		return ErrSeatsOutOfRange
+	}
 	c.AvailableSeats += amount
+	return nil
 }
 
-func (c *Car) TakeSeats(amount uint) {
+// TakeSeats fails, leaving the car as it was, when fewer seats are free
+func (c *Car) TakeSeats(amount uint) error {
+	if amount > c.AvailableSeats {
+		return ErrSeatsOutOfRange
+	}
 	c.AvailableSeats -= amount
+	return nil
+}
+
+// CanCarry tells whether the car takes a group of the given passengers and
+// needs when nobody else rides it
+func (c *Car) CanCarry(passengers uint, needs Features) bool {
+	return c.Shape().CanCarry(passengers, needs)
+}
+
+// Shape returns what the car could carry empty
+func (c *Car) Shape() CarShape {
+	return CarShape{Seats: c.Seats, Features: c.Features}
+}
+
+// CarShape is what a car could carry empty, its seats and features. Fleets
+// have few of them, however many cars they have.
+type CarShape struct {
+	Seats uint `json:"seats"`
+	Features
+}
+
+// CanCarry tells whether a car of the shape takes a group of the given
+// passengers and needs when nobody else rides it
+func (s CarShape) CanCarry(passengers uint, needs Features) bool {
+	return s.Seats >= passengers && s.Features.Covers(needs)
+}
+
+// FreeFeatures returns the features no group riding the car uses
+func (c *Car) FreeFeatures() Features {
+	free := Features{Wheelchair: c.Wheelchair && !c.InUse.Wheelchair}
+	if c.ChildSeats > c.InUse.ChildSeats {
+		free.ChildSeats = c.ChildSeats - c.InUse.ChildSeats
+	}
+	if c.Luggage > c.InUse.Luggage {
+		free.Luggage = c.Luggage - c.InUse.Luggage
+	}
+	return free
+}
+
+// TakeFeatures fails, leaving the car as it was, when they aren't free
+func (c *Car) TakeFeatures(needs Features) error {
+	if !c.FreeFeatures().Covers(needs) {
+		return ErrFeaturesOutOfRange
+	}
+	c.InUse.Wheelchair = c.InUse.Wheelchair || needs.Wheelchair
+	c.InUse.ChildSeats += needs.ChildSeats
+	c.InUse.Luggage += needs.Luggage
+	return nil
+}
+
+// FreeUpFeatures fails, leaving the car as it was, when they weren't in use
+func (c *Car) FreeUpFeatures(needs Features) error {
+	if !c.InUse.Covers(needs) {
+		return ErrFeaturesOutOfRange
+	}
+	c.InUse.Wheelchair = c.InUse.Wheelchair && !needs.Wheelchair
+	c.InUse.ChildSeats -= needs.ChildSeats
+	c.InUse.Luggage -= needs.Luggage
+	return nil
 }
@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestCar_SeatsStayInRange(t *testing.T) {
+	car := &Car{ID: 1, Seats: 4, AvailableSeats: 1}
+
+	if err := car.TakeSeats(2); err != ErrSeatsOutOfRange || car.AvailableSeats != 1 {
+		t.Fatalf("taking more seats than free: got %v with %d free", err, car.AvailableSeats)
+	}
+	if err := car.FreeUpSeats(4); err != ErrSeatsOutOfRange || car.AvailableSeats != 1 {
+		t.Fatalf("freeing more seats than taken: got %v with %d free", err, car.AvailableSeats)
+	}
+
+	if err := car.TakeSeats(1); err != nil || car.AvailableSeats != 0 {
+		t.Fatalf("taking the last seat: got %v with %d free", err, car.AvailableSeats)
+	}
+	if err := car.FreeUpSeats(4); err != nil || car.AvailableSeats != 4 {
+		t.Fatalf("freeing every seat: got %v with %d free", err, car.AvailableSeats)
+	}
+}
+
+func TestCar_FeaturesAreShared(t *testing.T) {
+	car := &Car{ID: 1, Seats: 6, AvailableSeats: 6, Features: Features{Wheelchair: true, ChildSeats: 2, Luggage: 3}}
+
+	if !car.CanCarry(6, Features{Wheelchair: true, ChildSeats: 2, Luggage: 3}) || car.CanCarry(4, Features{Luggage: 4}) {
+		t.Fatalf("expected the car to carry what it offers and nothing more")
+	}
+	if err := car.TakeFeatures(Features{Wheelchair: true, Luggage: 2}); err != nil {
+		t.Fatalf("taking free features: %v", err)
+	}
+	// the wheelchair space goes to one group, the luggage space is shared
+	if err := car.TakeFeatures(Features{Wheelchair: true}); err != ErrFeaturesOutOfRange {
+		t.Fatalf("taking the wheelchair space twice: got %v", err)
+	}
+	if err := car.TakeFeatures(Features{ChildSeats: 1, Luggage: 2}); err != ErrFeaturesOutOfRange || car.InUse != (Features{Wheelchair: true, Luggage: 2}) {
+		t.Fatalf("taking more luggage space than free: got %v with %+v in use", err, car.InUse)
+	}
+	if free := car.FreeFeatures(); free != (Features{ChildSeats: 2, Luggage: 1}) {
+		t.Fatalf("expected 2 child seats and 1 luggage free, got %+v", free)
+	}
+
+	if err := car.FreeUpFeatures(Features{ChildSeats: 1}); err != ErrFeaturesOutOfRange {
+		t.Fatalf("freeing child seats not in use: got %v", err)
+	}
+	if err := car.FreeUpFeatures(Features{Wheelchair: true, Luggage: 2}); err != nil || !car.InUse.IsZero() {
+		t.Fatalf("freeing what was taken: got %v with %+v in use", err, car.InUse)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Kinds of broken invariants between cars, journeys and the pending queue
+const (
+	// ViolationSeats is a car whose taken seats don't add up to the
+	// passengers riding it, or with more free seats than it has
+	ViolationSeats = "seats_mismatch"
+	// ViolationFeatures is a car whose features in use don't add up to what
+	// the groups riding it need
+	ViolationFeatures = "features_mismatch"
+	// ViolationMissingCar is a journey assigned to a car that doesn't exist
+	ViolationMissingCar = "missing_car"
+	// ViolationNotWaiting is an unassigned journey missing from the queue
+	ViolationNotWaiting = "not_waiting"
+	// ViolationStrayPending is a queued group that is assigned or has no journey
+	ViolationStrayPending = "stray_pending"
+	// ViolationDuplicatePending is a group queued more than once
+	ViolationDuplicatePending = "duplicate_pending"
+)
+
+// Violation is one broken invariant found by a consistency check
+type Violation struct {
+	Kind      string `json:"kind"`
+	CarID     *uint  `json:"carId,omitempty"`
+	JourneyID *uint  `json:"journeyId,omitempty"`
+	Detail    string `json:"detail"`
+	// Repaired tells whether a check asked to repair could fix it
+	Repaired bool `json:"repaired"`
+}
+
+// ConsistencyReport is the outcome of a consistency check
+type ConsistencyReport struct {
+	CheckedAt  time.Time   `json:"checkedAt"`
+	Cars       int         `json:"cars"`
+	Journeys   int         `json:"journeys"`
+	Pending    int         `json:"pending"`
+	Violations []Violation `json:"violations"`
+}
+
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.Violations) == 0
+}
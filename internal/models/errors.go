@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"net/http"
 )
 
@@ -34,4 +35,73 @@ var (
 	ErrInvalidSeats  = &APIError{Code: http.StatusBadRequest, Message: "Invalid number of seats"}
 	ErrInvalidInput  = &APIError{Code: http.StatusBadRequest, Message: "Invalid input provided"}
 	ErrInternalError = &APIError{Code: http.StatusInternalServerError, Message: "Internal server error"}
+	// ErrConflict is returned by Commit when another transaction changed the
+	// data in between, running the operation again usually succeeds. Version
+	// conflicts match it with errors.Is too.
+	ErrConflict = &APIError{Code: http.StatusConflict, Message: "Concurrent update, try again"}
+	// ErrTimeout and ErrCanceled answer requests whose transaction ran out of
+	// time or whose client went away, nothing they did was stored
+	ErrTimeout  = &APIError{Code: http.StatusServiceUnavailable, Message: "Request timed out"}
+	ErrCanceled = &APIError{Code: http.StatusServiceUnavailable, Message: "Request canceled"}
+	// ErrUnauthorized answers requests without valid credentials, and
+	// ErrForbidden those whose role doesn't allow the route
+	ErrUnauthorized = &APIError{Code: http.StatusUnauthorized, Message: "Authentication required"}
+	ErrForbidden    = &APIError{Code: http.StatusForbidden, Message: "Not allowed for this role"}
+	// ErrClassForbidden refuses a priority class above standard to a role
+	// that may not jump the queue
+	ErrClassForbidden = &APIError{Code: http.StatusForbidden, Message: "Priority class not allowed for this role"}
+	// ErrRateLimited answers clients calling a route faster than their limit,
+	// and ErrTooManyPending those with too many groups already waiting
+	ErrRateLimited    = &APIError{Code: http.StatusTooManyRequests, Message: "Too many requests"}
+	ErrTooManyPending = &APIError{Code: http.StatusTooManyRequests, Message: "Too many pending journeys for this client"}
+	// ErrSeatsBelowOccupancy refuses merging a fleet that gives a car fewer
+	// seats than the passengers riding it
+	ErrSeatsBelowOccupancy = &APIError{Code: http.StatusUnprocessableEntity, Message: "Car has more passengers riding than seats"}
+	// ErrFeaturesInUse refuses merging a fleet that takes features from a car
+	// while groups riding it use them
+	ErrFeaturesInUse = &APIError{Code: http.StatusUnprocessableEntity, Message: "Car has features in use it would no longer offer"}
+	// ErrNoCarMeetsNeeds refuses a journey no car in the fleet could carry
+	// even empty, for its passengers or its needs, it would wait for ever
+	ErrNoCarMeetsNeeds = &APIError{Code: http.StatusUnprocessableEntity, Message: "No car in the fleet meets the journey requirements"}
+	// ErrUnknownClass refuses a journey of a priority class that doesn't exist
+	ErrUnknownClass = &APIError{Code: http.StatusBadRequest, Message: "Unknown priority class"}
+	// ErrPickupInPast refuses moving a scheduled journey to a time already gone
+	ErrPickupInPast = &APIError{Code: http.StatusBadRequest, Message: "Pickup time is in the past"}
+	// ErrNoSeatsToReserve refuses a reservation no car has the free seats
+	// for, ErrExpiryInPast one expiring right away, ErrExpiryTooFar one
+	// holding seats longer than allowed and ErrReservationExpired confirming
+	// one past its expiry
+	ErrNoSeatsToReserve   = &APIError{Code: http.StatusConflict, Message: "No car has the seats to reserve"}
+	ErrExpiryInPast       = &APIError{Code: http.StatusBadRequest, Message: "Reservation must expire in the future"}
+	ErrExpiryTooFar       = &APIError{Code: http.StatusBadRequest, Message: "Reservation expires too far ahead"}
+	ErrReservationExpired = &APIError{Code: http.StatusGone, Message: "Reservation expired"}
+	// ErrTenantNotFound answers requests scoped to a tenant that doesn't exist
+	ErrTenantNotFound = &APIError{Code: http.StatusNotFound, Message: "Tenant not found"}
+	// ErrSeatsOutOfRange is returned when taking more seats than a car has
+	// free or freeing more than it has taken, which only an inconsistent
+	// fleet leads to
+	ErrSeatsOutOfRange = &APIError{Code: http.StatusInternalServerError, Message: "Car seats out of range"}
+	// ErrFeaturesOutOfRange is the same for the features of a car
+	ErrFeaturesOutOfRange = &APIError{Code: http.StatusInternalServerError, Message: "Car features out of range"}
 )
+
+// ConflictError is returned by the Update* storage methods when the record
+// is no longer at the version the caller read
+type ConflictError struct {
+	Entity   string
+	ID       uint
+	Expected uint64
+	Actual   uint64
+}
+
+func NewConflictError(entity string, id uint, expected, actual uint64) *ConflictError {
+	return &ConflictError{Entity: entity, ID: id, Expected: expected, Actual: actual}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d is at version %d, expected %d", e.Entity, e.ID, e.Actual, e.Expected)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,20 @@
+package models
+
+// Features are what a car offers on top of its seats, or what a group needs
+// from the car it rides. The child seats and luggage space of a car are
+// shared by the groups riding it, its wheelchair space goes to one at a time.
+type Features struct {
+	Wheelchair bool `json:"wheelchair,omitempty"`
+	ChildSeats uint `json:"childSeats,omitempty"`
+	// Luggage counts pieces of luggage
+	Luggage uint `json:"luggage,omitempty"`
+}
+
+func (f Features) IsZero() bool {
+	return f == Features{}
+}
+
+// Covers tells whether f has room for what needs asks for
+func (f Features) Covers(needs Features) bool {
+	return (f.Wheelchair || !needs.Wheelchair) && f.ChildSeats >= needs.ChildSeats && f.Luggage >= needs.Luggage
+}
@@ -1,40 +1,120 @@
 package models
 
+import (
+	"context"
+	"time"
+)
+
+// Storages keep their own copy of what they are given and only hand out
+// copies, changes reach the storage only through the New*/Update* methods.
+// Every record has a version, set by New* and changed by every update. Update*
+// fail with a *ConflictError unless the record is still at expectedVersion,
+// and on success set the new version on what they were given.
+//
+// Every method takes the context of the request it serves and fails with the
+// context error once it's done. Methods without an error to return give
+// nothing back then, and Commit fails after rolling back, so nothing decided
+// on a partial read is ever stored.
+
 type ICarStorage interface {
-	NewCar(car *Car) error
-	FindById(carId uint) (car *Car, err error)
-	UpdateCar(carId uint, newCar *Car) error
-	GetAllCars() []*Car
-	ResetMemory() error
+	NewCar(ctx context.Context, car *Car) error
+	FindById(ctx context.Context, carId uint) (car *Car, err error)
+	UpdateCar(ctx context.Context, carId uint, newCar *Car, expectedVersion uint64) error
+	GetAllCars(ctx context.Context) []*Car
+	// DeleteById removes the car, doing nothing if it doesn't exist
+	DeleteById(ctx context.Context, carId uint) error
+	// FindBestFit returns the car with the fewest available seats that can
+	// still take the given amount, lowest id first on ties, or ErrNotFound.
+	// Draining cars are never picked, here nor in CarsWithAtLeast.
+	FindBestFit(ctx context.Context, seats uint) (car *Car, err error)
+	// CarsWithAtLeast returns the cars with at least the given available seats, best fit first
+	CarsWithAtLeast(ctx context.Context, seats uint) []*Car
+	// Shapes returns the distinct shapes of the cars not draining, in no
+	// particular order, kept as cars come and go rather than read from the
+	// whole fleet on every call
+	Shapes(ctx context.Context) ([]CarShape, error)
+	ResetMemory(ctx context.Context) error
 }
 
 type IJourneyStorage interface {
-	NewJourney(journey *Journey) error
-	FindById(journeyId uint) (car *Journey, err error)
-	DeleteById(journeyId uint) error
-	UpdateJourney(journeyId uint, newJourney *Journey) error
-	ResetMemory() error
+	NewJourney(ctx context.Context, journey *Journey) error
+	FindById(ctx context.Context, journeyId uint) (car *Journey, err error)
+	DeleteById(ctx context.Context, journeyId uint) error
+	UpdateJourney(ctx context.Context, journeyId uint, newJourney *Journey, expectedVersion uint64) error
+	// GetAllJourneys returns every journey, assigned or waiting, in no particular order
+	GetAllJourneys(ctx context.Context) []*Journey
+	ResetMemory(ctx context.Context) error
 }
 
 type IPenidngStorage interface {
-	NewPending(pending *Journey) error
-	UpdatePending(pendingId uint, newPending *Journey) error
-	DeleteById(journeyId uint) error
-	GetAllPendings() []*Journey
-	ResetMemory() error
+	NewPending(ctx context.Context, pending *Journey) error
+	UpdatePending(ctx context.Context, pendingId uint, newPending *Journey, expectedVersion uint64) error
+	DeleteById(ctx context.Context, journeyId uint) error
+	// GetAllPendings returns the waiting groups in arrival order
+	GetAllPendings(ctx context.Context) []*Journey
+	// NextFitting returns the earliest arrived group of at most maxPassengers
+	// whose needs free covers, or ErrNotFound. The groups needing more are
+	// skipped where they wait, the other sizes aren't looked through for them.
+	NextFitting(ctx context.Context, maxPassengers uint, free Features) (pending *Journey, err error)
+	// NextFittingOfClass returns the earliest arrived group of at most
+	// maxPassengers whose needs free covers among those of class, or
+	// ErrNotFound. Only the classes above standard are kept apart, for
+	// standard it always returns ErrNotFound.
+	NextFittingOfClass(ctx context.Context, maxPassengers uint, free Features, class PriorityClass) (pending *Journey, err error)
+	// CountOwnedBy returns how many groups of owner are waiting, kept as they
+	// come and go rather than counted on every call
+	CountOwnedBy(ctx context.Context, owner string) (int, error)
+	ResetMemory(ctx context.Context) error
+}
+
+// IScheduledStorage keeps the journeys booked ahead until they are due, apart
+// from the journeys and the queue. Every journey it holds has a PickupAt.
+type IScheduledStorage interface {
+	NewScheduled(ctx context.Context, journey *Journey) error
+	FindById(ctx context.Context, journeyId uint) (journey *Journey, err error)
+	UpdateScheduled(ctx context.Context, journeyId uint, newJourney *Journey, expectedVersion uint64) error
+	DeleteById(ctx context.Context, journeyId uint) error
+	// Due returns the journeys to be picked up at or before until, earliest
+	// first and lowest id first on ties
+	Due(ctx context.Context, until time.Time) []*Journey
+	// GetAllScheduled returns every scheduled journey, earliest first
+	GetAllScheduled(ctx context.Context) []*Journey
+	// CountOwnedBy returns how many journeys of owner are scheduled
+	CountOwnedBy(ctx context.Context, owner string) (int, error)
+	ResetMemory(ctx context.Context) error
+}
+
+// IReservationStorage keeps who holds seats and until when. The seats are
+// taken from the car apart, in the same transaction.
+type IReservationStorage interface {
+	NewReservation(ctx context.Context, reservation *Reservation) error
+	FindById(ctx context.Context, journeyId uint) (reservation *Reservation, err error)
+	DeleteById(ctx context.Context, journeyId uint) error
+	// Expired returns the reservations expiring at or before until, earliest
+	// first and lowest id first on ties
+	Expired(ctx context.Context, until time.Time) []*Reservation
+	// GetAllReservations returns every reservation, earliest expiry first
+	GetAllReservations(ctx context.Context) []*Reservation
+	ResetMemory(ctx context.Context) error
 }
 
 type Transaction interface {
 	CarsStorage() ICarStorage
 	JourneysStorage() IJourneyStorage
 	PendingsStorage() IPenidngStorage
+	ScheduledStorage() IScheduledStorage
+	ReservationsStorage() IReservationStorage
 
-	Commit() error
+	// Commit rolls back instead when ctx is done
+	Commit(ctx context.Context) error
+	// Rollback takes no context, it must release the transaction even after
+	// the request is gone
 	Rollback() error
 
 	HasCommited() bool
 }
 
 type TransactionFactory interface {
-	Begin() (Transaction, error)
+	// Begin gives up waiting for a transaction when ctx is done
+	Begin(ctx context.Context) (Transaction, error)
 }
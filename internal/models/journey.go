@@ -1,11 +1,38 @@
 package models
 
+import "time"
+
+// Journey is a group of people travelling together. It references the car
+// carrying it by id, so a journey read from storage never aliases a stored car.
 type Journey struct {
-	Id         uint `json:"id"`
-	Passengers uint `json:"passengers"`
-	AssignedTo *Car `json:"assignedTo"`
+	Id         uint  `json:"id"`
+	Passengers uint  `json:"passengers"`
+	CarID      *uint `json:"carId,omitempty"`
+	// PickupAt is when a group booking ahead wants to be picked up, nil for
+	// a ride right away
+	PickupAt *time.Time    `json:"pickupAt,omitempty"`
+	Class    PriorityClass `json:"class,omitempty"`
+	// Features the group needs from its car, they read as part of the
+	// journey in the API
+	Features
+	// RequestedAt is when the group asked for a car, or was promoted when
+	// booked ahead. It's set by the service and kept by the storage.
+	RequestedAt time.Time `json:"-"`
+	// Version is set by the storage and changes on every update, it isn't part of the API
+	Version uint64 `json:"-"`
+	// Owner is the client that requested the journey, set by the API from who
+	// called it rather than from the request body
+	Owner string `json:"-"`
+}
+
+func (j *Journey) AssignCar(carId uint) {
+	j.CarID = &carId
+}
+
+func (j *Journey) IsAssigned() bool {
+	return j.CarID != nil
 }
 
-func (j *Journey) AssignCar(c *Car) {
-	j.AssignedTo = c
+func (j *Journey) IsScheduled() bool {
+	return j.PickupAt != nil
 }
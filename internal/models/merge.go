@@ -0,0 +1,29 @@
+package models
+
+// MergePlan is what reconciling the fleet with a new list of cars changes, or
+// would change when it's a dry run
+type MergePlan struct {
+	DryRun bool `json:"dryRun"`
+	// Added are the cars new to the fleet
+	Added []uint `json:"added"`
+	// Resized are the cars kept with a different number of seats, or
+	// different features
+	Resized []uint `json:"resized"`
+	// Restored are draining cars back in the list, taking groups again
+	Restored []uint `json:"restored"`
+	// Draining are the cars left out of the list while carrying groups
+	Draining []uint `json:"draining"`
+	// Removed are the cars left out of the list empty
+	Removed []uint `json:"removed"`
+	// Assigned are the waiting groups seated in the merged fleet
+	Assigned []Assignment `json:"assigned"`
+	// Unservable are the waiting and scheduled groups no car of the merged
+	// fleet could carry, dropped unless the service flags them
+	Unservable []uint `json:"unservable"`
+}
+
+// Assignment is a group seated in a car
+type Assignment struct {
+	JourneyID uint `json:"journeyId"`
+	CarID     uint `json:"carId"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// PriorityClass tells how soon a waiting group is served: the groups of a
+// higher class get the seats that free up first. An empty class is standard.
+type PriorityClass string
+
+const (
+	ClassStandard      PriorityClass = "standard"
+	ClassPriority      PriorityClass = "priority"
+	ClassAccessibility PriorityClass = "accessibility"
+)
+
+// PriorityClasses lists every class, highest first
+var PriorityClasses = []PriorityClass{ClassAccessibility, ClassPriority, ClassStandard}
+
+// Rank orders the classes, standard is 0 and each class above it one more.
+// Unknown classes rank -1.
+func (c PriorityClass) Rank() int {
+	switch c {
+	case "", ClassStandard:
+		return 0
+	case ClassPriority:
+		return 1
+	case ClassAccessibility:
+		return 2
+	}
+	return -1
+}
+
+func (c PriorityClass) IsValid() bool {
+	return c.Rank() >= 0
+}
+
+// Name returns the class, standard for an empty one
+func (c PriorityClass) Name() string {
+	if c == "" {
+		return string(ClassStandard)
+	}
+	return string(c)
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Reservation holds seats of a car for a group on its way. The seats count as
+// taken until the group shows up and the reservation is confirmed into an
+// assigned journey, or until it expires and they are given back.
+type Reservation struct {
+	JourneyID  uint      `json:"journeyId"`
+	CarID      uint      `json:"carId"`
+	Passengers uint      `json:"passengers"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// Class and Features are those of the journey the reservation becomes,
+	// the features are held on the car along with the seats
+	Class PriorityClass `json:"class,omitempty"`
+	Features
+	// Owner is the client that made the reservation, set by the API like the
+	// owner of a journey
+	Owner string `json:"-"`
+}
+
+func (r *Reservation) IsExpired(now time.Time) bool {
+	return !r.ExpiresAt.After(now)
+}
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// sweepInterval is how often buckets that filled up again are dropped, a
+// client coming back after that starts with a full bucket all the same
+const sweepInterval = time.Minute
+
+// Decision is the outcome of taking a token for a request
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, zero when
+	// this one was
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// Limiter keeps a token bucket per client and endpoint. Endpoints without a
+// limit, nor a default one, aren't limited.
+type Limiter struct {
+	limits   Limits
+	clock    clock.Clock
+	logger   *logger.Logger
+	metrics  *metrics.Registry
+	rejected *metrics.CounterVec
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// Option customizes a Limiter on creation
+type Option func(*Limiter)
+
+// WithClock refills the buckets by the given clock instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(l *Limiter) {
+		l.clock = c
+	}
+}
+
+// WithMetrics registers the limiter metrics in the given registry instead of a private one
+func WithMetrics(r *metrics.Registry) Option {
+	return func(l *Limiter) {
+		l.metrics = r
+	}
+}
+
+func New(limits Limits, opts ...Option) *Limiter {
+	l := &Limiter{
+		limits:  limits,
+		clock:   clock.Real{},
+		logger:  logger.New("ratelimit"),
+		metrics: metrics.NewRegistry(),
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.rejected = l.metrics.Counter("carpool_rate_limited_total", "Requests refused for going over the rate limit.", "endpoint")
+	l.swept = l.clock.Now()
+	return l
+}
+
+// Enabled tells whether any endpoint is limited
+func (l *Limiter) Enabled() bool {
+	return len(l.limits) > 0
+}
+
+// Allow takes a token from the bucket of the client for the endpoint
+func (l *Limiter) Allow(endpoint, client string) Decision {
+	limit, ok := l.limits.For(endpoint)
+	if !ok {
+		return Decision{Allowed: true}
+	}
+	return l.take(endpoint+" "+client, limit)
+}
+
+func (l *Limiter) take(key string, limit Limit) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	burst := float64(limit.Burst)
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	d := Decision{Allowed: b.tokens >= 1, Limit: limit.Burst}
+	if d.Allowed {
+		b.tokens--
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(d.Reset)
+	return d
+}
+
+// sweep drops the buckets that are full again, so idle clients don't pile up
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if !b.full.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware refuses the requests of clients going over the limit of the
+// endpoint with 429 Too Many Requests. Every answer tells the client where it
+// stands in the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers, and refusals when to try again in Retry-After.
+func (l *Limiter) Middleware(endpoint string) gin.HandlerFunc {
+	if _, ok := l.limits.For(endpoint); !ok {
+		return func(*gin.Context) {}
+	}
+	return func(ctx *gin.Context) {
+		client := auth.ClientID(ctx)
+		d := l.Allow(endpoint, client)
+		ctx.Header("RateLimit-Limit", strconv.Itoa(d.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		ctx.Header("RateLimit-Reset", headerSeconds(d.Reset))
+		if d.Allowed {
+			return
+		}
+
+		l.rejected.Inc(endpoint)
+		l.logger.Warn("Rate limit exceeded", map[string]interface{}{
+			"endpoint":   endpoint,
+			"client":     client,
+			"request_id": logger.GetRequestID(ctx.Request.Context()),
+		})
+		ctx.Header("Retry-After", headerSeconds(d.RetryAfter))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrRateLimited)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// headerSeconds rounds up, a client waiting what it was told must find a token
+func headerSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(" journey=10/s:20, locate=600/m ,default=3600/h")
+	require.NoError(t, err)
+	assert.Equal(t, Limits{
+		"journey": {Rate: 10, Burst: 20},
+		"locate":  {Rate: 10, Burst: 600},
+		"default": {Rate: 1, Burst: 3600},
+	}, limits)
+
+	limits, err = ParseLimits("")
+	require.NoError(t, err)
+	assert.Empty(t, limits)
+
+	for _, spec := range []string{
+		"journey",
+		"journey=",
+		"=10/s",
+		"journey=10",
+		"journey=0/s",
+		"journey=10/d",
+		"journey=10/s:0",
+		"journey=10/s:x",
+		"journey=10/s,journey=5/s",
+	} {
+		_, err := ParseLimits(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLimits_FallBackToDefault(t *testing.T) {
+	limits := Limits{"journey": {Rate: 1, Burst: 1}}
+	_, ok := limits.For("locate")
+	assert.False(t, ok)
+
+	limits[DefaultEndpoint] = Limit{Rate: 2, Burst: 2}
+	limit, ok := limits.For("locate")
+	assert.True(t, ok)
+	assert.Equal(t, Limit{Rate: 2, Burst: 2}, limit)
+	limit, _ = limits.For("journey")
+	assert.Equal(t, Limit{Rate: 1, Burst: 1}, limit)
+}
+
+func TestLimiter_RefillsOverTime(t *testing.T) {
+	c := clock.NewFake(start)
+	l := New(Limits{"journey": {Rate: 2, Burst: 3}}, WithClock(c))
+
+	for i := 2; i >= 0; i-- {
+		d := l.Allow("journey", "acme")
+		require.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+	}
+	d := l.Allow("journey", "acme")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, d.Reset)
+
+	c.Advance(500 * time.Millisecond)
+	d = l.Allow("journey", "acme")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// the bucket never holds more than the burst
+	c.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.True(t, l.Allow("journey", "acme").Allowed)
+	}
+	assert.False(t, l.Allow("journey", "acme").Allowed)
+}
+
+func TestLimiter_BucketPerClientAndEndpoint(t *testing.T) {
+	l := New(Limits{"journey": {Rate: 1, Burst: 1}, "dropoff": {Rate: 1, Burst: 1}}, WithClock(clock.NewFake(start)))
+
+	assert.True(t, l.Allow("journey", "acme").Allowed)
+	assert.False(t, l.Allow("journey", "acme").Allowed)
+	assert.True(t, l.Allow("journey", "globex").Allowed)
+	assert.True(t, l.Allow("dropoff", "acme").Allowed)
+	assert.True(t, l.Allow("locate", "acme").Allowed, "endpoints without a limit aren't limited")
+	assert.True(t, l.Allow("locate", "acme").Allowed)
+}
+
+func TestLimiter_SweepsFullBuckets(t *testing.T) {
+	c := clock.NewFake(start)
+	l := New(Limits{"journey": {Rate: 1, Burst: 2}}, WithClock(c))
+	l.Allow("journey", "acme")
+	l.Allow("journey", "globex")
+	l.Allow("journey", "globex")
+
+	c.Advance(sweepInterval)
+	l.Allow("journey", "initech")
+	// acme and globex filled up long ago, initech just took a token
+	assert.Len(t, l.buckets, 1)
+}
+
+func newTestEngine(l *Limiter, a *auth.Authenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(a.Middleware())
+	e.POST("/journey", l.Middleware("journey"), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	e.GET("/status", l.Middleware("status"), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	return e
+}
+
+func call(e *gin.Engine, method, path, ip, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	if key != "" {
+		req.Header.Set(auth.APIKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_RefusesWithHeaders(t *testing.T) {
+	c := clock.NewFake(start)
+	registry := metrics.NewRegistry()
+	l := New(Limits{"journey": {Rate: 0.5, Burst: 2}}, WithClock(c), WithMetrics(registry))
+	e := newTestEngine(l, auth.New())
+
+	w := call(e, http.MethodPost, "/journey", "10.0.0.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	call(e, http.MethodPost, "/journey", "10.0.0.1", "")
+	c.Advance(500 * time.Millisecond)
+	w = call(e, http.MethodPost, "/journey", "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var body models.APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, *models.ErrRateLimited, body)
+	assert.Equal(t, float64(1), registry.Counter("carpool_rate_limited_total", "", "endpoint").Value("journey"))
+
+	// another address has a bucket of its own
+	assert.Equal(t, http.StatusOK, call(e, http.MethodPost, "/journey", "10.0.0.2", "").Code)
+
+	// routes without a limit carry no headers
+	w = call(e, http.MethodGet, "/status", "10.0.0.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestMiddleware_KeysByPrincipal(t *testing.T) {
+	l := New(Limits{"journey": {Rate: 1, Burst: 1}}, WithClock(clock.NewFake(start)))
+	e := newTestEngine(l, auth.New(auth.WithKeys([]auth.Key{
+		{Name: "acme", Role: auth.RoleDispatcher, Key: "acme-key"},
+		{Name: "globex", Role: auth.RoleDispatcher, Key: "globex-key"},
+	})))
+
+	assert.Equal(t, http.StatusOK, call(e, http.MethodPost, "/journey", "10.0.0.1", "acme-key").Code)
+	// the same key from another address shares the bucket
+	assert.Equal(t, http.StatusTooManyRequests, call(e, http.MethodPost, "/journey", "10.0.0.2", "acme-key").Code)
+	// and another key from the same address doesn't
+	assert.Equal(t, http.StatusOK, call(e, http.MethodPost, "/journey", "10.0.0.1", "globex-key").Code)
+	assert.Equal(t, http.StatusOK, call(e, http.MethodPost, "/journey", "10.0.0.1", "").Code)
+}
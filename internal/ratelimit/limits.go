@@ -0,0 +1,96 @@
+// Package ratelimit limits how fast each client may call each endpoint, with
+// a token bucket per client and endpoint
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint names the limit applied to endpoints without one of their own
+const DefaultEndpoint = "default"
+
+// Limit lets a client make Burst requests in a row, and Rate more every
+// second after that
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limits are keyed by endpoint name
+type Limits map[string]Limit
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimits reads limits written as "endpoint=count/unit[:burst]" and
+// separated by commas, e.g. "journey=10/s:20,locate=600/m". The unit is one
+// of s, m or h, and the burst defaults to the count.
+func ParseLimits(spec string) (Limits, error) {
+	limits := Limits{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			name, value = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		if name == "" || value == "" {
+			return nil, fmt.Errorf("rate limit %q: want endpoint=count/unit[:burst]", entry)
+		}
+		if _, ok := limits[name]; ok {
+			return nil, fmt.Errorf("rate limit for %q given twice", name)
+		}
+		limit, err := parseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %q: %w", entry, err)
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+func parseLimit(value string) (Limit, error) {
+	rate, burst := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		rate, burst = value[:i], value[i+1:]
+	}
+
+	parts := strings.SplitN(rate, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("rate %q: want count/unit", rate)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("count %q: want a positive integer", parts[0])
+	}
+	unit, ok := units[parts[1]]
+	if !ok {
+		return Limit{}, fmt.Errorf("unit %q: want s, m or h", parts[1])
+	}
+
+	limit := Limit{Rate: float64(count) / unit.Seconds(), Burst: count}
+	if burst != "" {
+		limit.Burst, err = strconv.Atoi(burst)
+		if err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("burst %q: want a positive integer", burst)
+		}
+	}
+	return limit, nil
+}
+
+// For returns the limit of an endpoint, falling back to the default one
+func (l Limits) For(endpoint string) (Limit, bool) {
+	if limit, ok := l[endpoint]; ok {
+		return limit, true
+	}
+	limit, ok := l[DefaultEndpoint]
+	return limit, ok
+}
@@ -0,0 +1,171 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+)
+
+// Headers are the request headers kept besides Content-Type, the ones
+// choosing the tenant and the idempotency of a call. Credentials are never
+// kept, the record says who they authenticated instead.
+var Headers = []string{"X-Tenant", "Idempotency-Key"}
+
+// Kinds of credentials a call brought
+const (
+	CredentialsAPIKey = "api-key"
+	CredentialsBearer = "bearer"
+)
+
+// Redacted stands for the secrets left out of recorded bodies
+const Redacted = "[redacted]"
+
+// Record is one API call as captured by the middleware, one per JSONL line
+type Record struct {
+	Time        time.Time         `json:"time"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	ContentType string            `json:"contentType,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	// Credentials is the kind the call brought, if any, and Principal who
+	// they authenticated as, nil when they didn't
+	Credentials string          `json:"credentials,omitempty"`
+	Principal   *auth.Principal `json:"principal,omitempty"`
+	// RemoteAddr tells unauthenticated clients apart, as the limits do
+	RemoteAddr   string `json:"remoteAddr,omitempty"`
+	Body         string `json:"body,omitempty"`
+	Status       int    `json:"status"`
+	ResponseBody string `json:"responseBody,omitempty"`
+}
+
+// Middleware writes every request and its response to w as JSON lines, with
+// the secret fields of JSON bodies redacted. It goes before authentication,
+// to see who the call authenticated as once it's done. Writes are
+// serialized so w doesn't need to be safe for concurrent use.
+func Middleware(w io.Writer) gin.HandlerFunc {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+
+	return func(c *gin.Context) {
+		rec := Record{
+			Time:        time.Now(),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.RequestURI(),
+			ContentType: c.GetHeader("Content-Type"),
+			RemoteAddr:  c.Request.RemoteAddr,
+		}
+		for _, name := range Headers {
+			if value := c.GetHeader(name); value != "" {
+				if rec.Headers == nil {
+					rec.Headers = make(map[string]string)
+				}
+				rec.Headers[name] = value
+			}
+		}
+		switch {
+		case c.GetHeader(auth.APIKeyHeader) != "":
+			rec.Credentials = CredentialsAPIKey
+		case c.GetHeader("Authorization") != "":
+			rec.Credentials = CredentialsBearer
+		}
+
+		if c.Request.Body != nil {
+			body, err := ioutil.ReadAll(c.Request.Body)
+			if err == nil {
+				rec.Body = redactBody(body)
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		writer := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		rec.Principal = auth.PrincipalFrom(c.Request.Context())
+		rec.Status = c.Writer.Status()
+		rec.ResponseBody = writer.body.String()
+
+		mu.Lock()
+		encoder.Encode(rec)
+		mu.Unlock()
+	}
+}
+
+// Load reads records written by Middleware
+func Load(r io.Reader) ([]Record, error) {
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// redactBody replaces the value of every secret field of a JSON body, as the
+// one of webhook subscriptions. Other bodies are kept as they are.
+func redactBody(body []byte) string {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil || !redact(v) {
+		return string(body)
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// redact tells whether it replaced any secret in v
+func redact(v interface{}) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			if strings.EqualFold(name, "secret") {
+				v[name] = Redacted
+				found = true
+			} else if redact(value) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redact(value) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,302 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/controllers"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/ratelimit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/recorder"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/tenants"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/webhooks"
+)
+
+// Target executes a recorded request and returns the response it got
+type Target interface {
+	Do(rec recorder.Record) (status int, body string, err error)
+}
+
+// Config is what production ran with that changes the answers replayed
+// in-process. The zero value serves every fleet with defaults, without
+// authentication nor rate limits.
+type Config struct {
+	// Keys and JWTSecret authenticate the recorded callers, as the key of
+	// the same name and role or a token issued to them
+	Keys      []auth.Key
+	JWTSecret []byte
+	Limits    ratelimit.Limits
+	// Services configure every fleet, on top of the replay clock
+	Services []services.Option
+}
+
+// Server is the whole API over fresh in-memory storage, routed as the car
+// pool server does and running on a clock the replay moves
+type Server struct {
+	Engine  *gin.Engine
+	Clock   *clock.Fake
+	Tenants *tenants.Registry
+}
+
+// NewServer builds the API the way cmd/carpool does, the middleware going
+// before every route
+func NewServer(config Config, middleware ...gin.HandlerFunc) (*Server, error) {
+	gin.SetMode(gin.ReleaseMode)
+	clk := clock.NewFake(time.Now())
+	registry := metrics.NewRegistry()
+	eventStore := events.NewMemoryStore()
+
+	opts := append([]services.Option{services.WithClock(clk), services.WithMetrics(registry)}, config.Services...)
+	service := services.NewCarPool(inMemory.NewTransactionFactory(), append(opts, services.WithEventStore(eventStore))...)
+	webhookStore, err := webhooks.NewStore("")
+	if err != nil {
+		return nil, err
+	}
+	dispatcher := webhooks.NewDispatcher(webhookStore, webhooks.DefaultConfig())
+	tr, err := tenants.New(service, func(string) (models.TransactionFactory, error) {
+		return inMemory.NewTransactionFactory(), nil
+	}, tenants.WithServiceOptions(opts...), tenants.WithClock(clk), tenants.WithEventHandler(func(id string) events.Handler {
+		if id == tenants.DefaultID {
+			return dispatcher.HandleEvent
+		}
+		return dispatcher.TenantHandler(id)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	authOpts := []auth.Option{auth.WithKeys(config.Keys), auth.WithClock(clk)}
+	if len(config.JWTSecret) > 0 {
+		authOpts = append(authOpts, auth.WithJWTSecret(config.JWTSecret))
+	}
+	authn := auth.New(authOpts...)
+	auditStore := audit.NewMemoryStore()
+	auditor := audit.New(auditStore, audit.WithTenant(func(ctx context.Context) string {
+		if fleet := tenants.FleetFrom(ctx); fleet != nil {
+			return fleet.Tenant.ID
+		}
+		return ""
+	}))
+
+	engine := gin.New()
+	engine.Use(middleware...)
+	engine.Use(authn.Middleware())
+	controllers.Wire(engine, controllers.Routes{
+		Auth:        authn,
+		Limiter:     ratelimit.New(config.Limits, ratelimit.WithClock(clk), ratelimit.WithMetrics(registry)),
+		Auditor:     auditor,
+		Tenants:     tr,
+		Metrics:     registry,
+		CarPool:     controllers.NewCarPool(service),
+		Webhooks:    controllers.NewWebhooks(dispatcher),
+		Admin:       controllers.NewAdmin(service),
+		TenantAdmin: controllers.NewTenants(tr),
+		Audit:       controllers.NewAudit(auditStore),
+		Events:      controllers.NewEvents(eventStore),
+	})
+	return &Server{Engine: engine, Clock: clk, Tenants: tr}, nil
+}
+
+// Credentials authenticate a recorded caller, setting the header it takes
+// on req, or report it can't
+type Credentials func(req *http.Request, p auth.Principal) bool
+
+// HandlerTarget replays requests in-process against an http.Handler
+type HandlerTarget struct {
+	Handler http.Handler
+	// Clock, when set, is moved to the time of every record before it is
+	// replayed, and Tick then runs what periodic workers would have by then
+	Clock *clock.Fake
+	Tick  func(ctx context.Context)
+	// Credentials, when set, authenticate the recorded callers
+	Credentials Credentials
+
+	started bool
+}
+
+// NewInProcessTarget serves the car pool API from a fresh in-memory server,
+// authenticating the recorded callers with the configured keys and secret
+func NewInProcessTarget(config Config) (*HandlerTarget, error) {
+	server, err := NewServer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &HandlerTarget{
+		Handler:     server.Engine,
+		Clock:       server.Clock,
+		Tick:        server.Tenants.RunWorkers,
+		Credentials: configCredentials(config, server.Clock),
+	}, nil
+}
+
+// configCredentials sends the key of the caller's name and role, or a token
+// issued to it when there is none
+func configCredentials(config Config, clk clock.Clock) Credentials {
+	keys := make(map[auth.Principal]string)
+	for _, k := range config.Keys {
+		keys[auth.Principal{Name: k.Name, Role: k.Role}] = k.Key
+	}
+	return func(req *http.Request, p auth.Principal) bool {
+		if key, ok := keys[p]; ok {
+			req.Header.Set(auth.APIKeyHeader, key)
+			return true
+		}
+		if len(config.JWTSecret) == 0 {
+			return false
+		}
+		now := clk.Now()
+		req.Header.Set("Authorization", "Bearer "+auth.IssueToken(config.JWTSecret, p, now, now.Add(time.Hour)))
+		return true
+	}
+}
+
+func (t *HandlerTarget) Do(rec recorder.Record) (int, string, error) {
+	// records are written as calls finish, so times may go back a little
+	if t.Clock != nil && !rec.Time.IsZero() && (!t.started || rec.Time.After(t.Clock.Now())) {
+		t.Clock.Set(rec.Time)
+		t.started = true
+	}
+	if t.Tick != nil {
+		t.Tick(context.Background())
+	}
+
+	req := httptest.NewRequest(rec.Method, rec.Path, strings.NewReader(rec.Body))
+	setHeaders(req, rec, t.Credentials)
+	if rec.RemoteAddr != "" {
+		req.RemoteAddr = rec.RemoteAddr
+	}
+	w := httptest.NewRecorder()
+	t.Handler.ServeHTTP(w, req)
+	return w.Code, w.Body.String(), nil
+}
+
+// setHeaders sets the recorded headers, and credentials for the calls that
+// brought some. Those that authenticated get them from credentials, the
+// others a redacted placeholder, refused as the recorded ones were.
+func setHeaders(req *http.Request, rec recorder.Record, credentials Credentials) {
+	if rec.ContentType != "" {
+		req.Header.Set("Content-Type", rec.ContentType)
+	}
+	for name, value := range rec.Headers {
+		req.Header.Set(name, value)
+	}
+	if rec.Principal != nil && credentials != nil && credentials(req, *rec.Principal) {
+		return
+	}
+	switch rec.Credentials {
+	case recorder.CredentialsAPIKey:
+		req.Header.Set(auth.APIKeyHeader, recorder.Redacted)
+	case recorder.CredentialsBearer:
+		req.Header.Set("Authorization", "Bearer "+recorder.Redacted)
+	}
+}
+
+// HTTPTarget replays requests against a running server
+type HTTPTarget struct {
+	BaseURL string
+	Client  *http.Client
+	// APIKey is sent with the calls that authenticated when recorded, as
+	// whoever they were
+	APIKey string
+}
+
+func (t *HTTPTarget) Do(rec recorder.Record) (int, string, error) {
+	req, err := http.NewRequest(rec.Method, strings.TrimRight(t.BaseURL, "/")+rec.Path, strings.NewReader(rec.Body))
+	if err != nil {
+		return 0, "", err
+	}
+	setHeaders(req, rec, func(req *http.Request, _ auth.Principal) bool {
+		if t.APIKey == "" {
+			return false
+		}
+		req.Header.Set(auth.APIKeyHeader, t.APIKey)
+		return true
+	})
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// Diff is a replayed call whose response doesn't match the recorded one
+type Diff struct {
+	Index  int
+	Record recorder.Record
+	Status int
+	Body   string
+	Err    error
+}
+
+func (d Diff) String() string {
+	header := fmt.Sprintf("#%d %s %s", d.Index+1, d.Record.Method, d.Record.Path)
+	if d.Err != nil {
+		return fmt.Sprintf("%s: request failed: %v", header, d.Err)
+	}
+	if d.Status != d.Record.Status {
+		return fmt.Sprintf("%s: status %d, recorded %d", header, d.Status, d.Record.Status)
+	}
+	return fmt.Sprintf("%s: body %q, recorded %q", header, d.Body, d.Record.ResponseBody)
+}
+
+type Options struct {
+	// IgnoreBodies only compares status codes
+	IgnoreBodies bool
+	// StopOnDiff aborts at the first mismatch
+	StopOnDiff bool
+}
+
+// Run feeds the records to the target in order and returns the mismatches
+func Run(records []recorder.Record, target Target, opts Options) []Diff {
+	var diffs []Diff
+	for i, rec := range records {
+		status, body, err := target.Do(rec)
+
+		same := err == nil && status == rec.Status
+		if same && !opts.IgnoreBodies {
+			same = sameBody(body, rec.ResponseBody)
+		}
+		if same {
+			continue
+		}
+
+		diffs = append(diffs, Diff{Index: i, Record: rec, Status: status, Body: body, Err: err})
+		if opts.StopOnDiff {
+			break
+		}
+	}
+	return diffs
+}
+
+// sameBody compares JSON bodies structurally and anything else as trimmed text
+func sameBody(a, b string) bool {
+	var ja, jb interface{}
+	if json.Unmarshal([]byte(a), &ja) == nil && json.Unmarshal([]byte(b), &jb) == nil {
+		ca, _ := json.Marshal(ja)
+		cb, _ := json.Marshal(jb)
+		return bytes.Equal(ca, cb)
+	}
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
@@ -0,0 +1,165 @@
+package replay
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/auth"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/recorder"
+)
+
+var testConfig = Config{Keys: []auth.Key{
+	{Name: "ops", Role: auth.RoleFleetAdmin, Key: "admin-key"},
+	{Name: "viewer", Role: auth.RoleReader, Key: "read-key"},
+}}
+
+func recordSession(t *testing.T) ([]recorder.Record, string) {
+	var log bytes.Buffer
+	server, err := NewServer(testConfig, recorder.Middleware(&log))
+	require.NoError(t, err)
+
+	admin := map[string]string{"X-API-Key": "admin-key"}
+	lisbon := map[string]string{"X-API-Key": "admin-key", "X-Tenant": "lisbon"}
+	expiresAt := server.Clock.Now().Add(30 * time.Minute).UTC().Format(time.RFC3339)
+	calls := []struct {
+		method, path, contentType, body string
+		headers                         map[string]string
+	}{
+		{"PUT", "/cars", "application/json", `[{"id":1,"seats":4},{"id":2,"seats":4},{"id":3,"seats":6}]`, admin},
+		{"POST", "/journey", "application/json", `{"id":1,"passengers":4}`, admin},
+		{"POST", "/journey", "application/json", `{"id":2,"passengers":6}`, admin},
+		{"POST", "/journey", "application/json", `{"id":3,"passengers":5}`, admin},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=1", admin},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=3", admin},
+		{"POST", "/dropoff", "application/x-www-form-urlencoded", "ID=2", admin},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=3", admin},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=9", admin},
+		{"GET", "/cars", "", "", admin},
+		{"POST", "/admin/tenants", "application/json", `{"id":"lisbon"}`, admin},
+		{"PUT", "/tenants/lisbon/cars", "application/json", `[{"id":1,"seats":6}]`, admin},
+		{"POST", "/journey", "application/json", `{"id":7,"passengers":5}`, lisbon},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=7", lisbon},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=7", admin},
+		{"POST", "/reservations", "application/json", `{"journeyId":8,"passengers":1,"expiresAt":"` + expiresAt + `"}`, admin},
+		{"GET", "/reservations", "", "", admin},
+		{"POST", "/journey", "application/json", `{"id":9,"passengers":1}`, map[string]string{"X-API-Key": "read-key"}},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=1", nil},
+		{"POST", "/locate", "application/x-www-form-urlencoded", "ID=1", map[string]string{"X-API-Key": "wrong-key"}},
+		{"POST", "/webhooks", "application/json", `{"url":"https://partner.example/hook","events":["journey.assigned"],"secret":"hook-secret"}`, admin},
+	}
+	for _, call := range calls {
+		req := httptest.NewRequest(call.method, call.path, strings.NewReader(call.body))
+		if call.contentType != "" {
+			req.Header.Set("Content-Type", call.contentType)
+		}
+		for name, value := range call.headers {
+			req.Header.Set(name, value)
+		}
+		server.Engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	raw := log.String()
+	records, err := recorder.Load(&log)
+	require.NoError(t, err)
+	require.Len(t, records, len(calls))
+	// the server clock stood still while recording
+	for i := range records {
+		records[i].Time = server.Clock.Now()
+	}
+	return records, raw
+}
+
+// replayable leaves out the subscription closing the session, recorded for
+// its secret but answered with a random id
+func replayable(records []recorder.Record) []recorder.Record {
+	return records[:len(records)-1]
+}
+
+func newTarget(t *testing.T, config Config) *HandlerTarget {
+	target, err := NewInProcessTarget(config)
+	require.NoError(t, err)
+	return target
+}
+
+func TestRun_SameBehaviourHasNoDiffs(t *testing.T) {
+	records, _ := recordSession(t)
+
+	assert.Equal(t, `{"id":1,"seats":4,"availableSeats":0}`, records[4].ResponseBody)
+	assert.Equal(t, 204, records[5].Status)
+	assert.Equal(t, 404, records[8].Status)
+	assert.Equal(t, 405, records[9].Status)
+	assert.Equal(t, "lisbon", records[12].Headers["X-Tenant"])
+	assert.Equal(t, `{"id":1,"seats":6,"availableSeats":1}`, records[13].ResponseBody)
+	assert.Equal(t, 404, records[14].Status)
+	assert.Equal(t, 201, records[15].Status)
+	assert.Equal(t, 403, records[17].Status)
+	assert.Equal(t, 401, records[18].Status)
+	assert.Equal(t, 401, records[19].Status)
+	assert.Equal(t, 201, records[20].Status)
+
+	records = replayable(records)
+	assert.Empty(t, Run(records, newTarget(t, testConfig), Options{}))
+	// the callers get tokens when only the secret is known
+	assert.Empty(t, Run(records, newTarget(t, Config{JWTSecret: []byte("replay-secret")}), Options{}))
+	// without the keys production had, the recorded credentials mean nothing
+	assert.NotEmpty(t, Run(records, newTarget(t, Config{}), Options{IgnoreBodies: true}))
+}
+
+func TestRecord_KeepsNoCredentials(t *testing.T) {
+	records, raw := recordSession(t)
+
+	for _, secret := range []string{"admin-key", "read-key", "wrong-key", "hook-secret"} {
+		assert.NotContains(t, raw, secret)
+	}
+	assert.Equal(t, map[string]string{"X-Tenant": "lisbon"}, records[12].Headers)
+	assert.Equal(t, recorder.CredentialsAPIKey, records[12].Credentials)
+	assert.Equal(t, &auth.Principal{Name: "ops", Role: auth.RoleFleetAdmin}, records[12].Principal)
+	assert.Equal(t, &auth.Principal{Name: "viewer", Role: auth.RoleReader}, records[17].Principal)
+	assert.Empty(t, records[18].Credentials)
+	assert.Equal(t, recorder.CredentialsAPIKey, records[19].Credentials)
+	assert.Nil(t, records[19].Principal)
+	assert.Contains(t, records[20].Body, `"secret":"`+recorder.Redacted+`"`)
+}
+
+func TestRun_ReportsRegressions(t *testing.T) {
+	records, _ := recordSession(t)
+	records = replayable(records)
+	records[4].ResponseBody = `{"id":2,"seats":4,"availableSeats":0}`
+	records[8].Status = 200
+
+	diffs := Run(records, newTarget(t, testConfig), Options{})
+	require.Len(t, diffs, 2)
+	assert.Equal(t, 4, diffs[0].Index)
+	assert.Equal(t, 8, diffs[1].Index)
+	assert.Contains(t, diffs[1].String(), "status 404, recorded 200")
+
+	assert.Len(t, Run(records, newTarget(t, testConfig), Options{IgnoreBodies: true}), 1)
+	assert.Len(t, Run(records, newTarget(t, testConfig), Options{StopOnDiff: true}), 1)
+}
+
+func TestRun_ReplaysOnTheRecordedClock(t *testing.T) {
+	start := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, method, path, contentType, body string, status int, response string) recorder.Record {
+		return recorder.Record{Time: start.Add(d), Method: method, Path: path, ContentType: contentType, Body: body, Status: status, ResponseBody: response}
+	}
+	records := []recorder.Record{
+		at(0, "PUT", "/cars", "application/json", `[{"id":1,"seats":4}]`, 200, ""),
+		at(0, "POST", "/journey", "application/json", `{"id":1,"passengers":2,"pickupAt":"2030-01-01T13:00:00Z"}`, 202, ""),
+		at(time.Minute, "POST", "/locate", "application/x-www-form-urlencoded", "ID=1", 204, ""),
+		at(time.Minute, "POST", "/reservations", "application/json", `{"journeyId":2,"passengers":2,"expiresAt":"2030-01-01T12:30:00Z"}`, 201,
+			`{"journeyId":2,"carId":1,"passengers":2,"expiresAt":"2030-01-01T12:30:00Z"}`),
+		// the workers promoted the journey and released the reservation by then
+		at(2*time.Hour, "POST", "/locate", "application/x-www-form-urlencoded", "ID=1", 200, `{"id":1,"seats":4,"availableSeats":2}`),
+		at(2*time.Hour, "POST", "/reservations/2/confirm", "", "", 404, `{"code":404,"message":"Resource not found"}`),
+	}
+
+	diffs := Run(records, newTarget(t, Config{}), Options{})
+	for _, d := range diffs {
+		t.Error(d.String())
+	}
+}
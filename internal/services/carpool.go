@@ -2,25 +2,172 @@ package services
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"sync"
 	"time"
 
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 )
 
 type CarPool struct {
 	transactionFactory models.TransactionFactory
 	logger             *logger.Logger
+	eventStore         events.Store
+	eventBus           *events.Bus
+	commitMu           sync.Mutex
+	clock              clock.Clock
+	retryPolicy        RetryPolicy
+	txnTimeout         time.Duration
+	maxPendingPerOwner int
+	scheduleLeadTime   time.Duration
+	maxReservation     time.Duration
+	agingStep          time.Duration
+	unservablePolicy   UnservablePolicy
+	strategy           Strategy
+	minSeats, maxSeats uint
+	metrics            *metrics.Registry
+	retryMetrics       retryMetrics
+	consistencyMetrics consistencyMetrics
+	scheduleMetrics    scheduleMetrics
+	priorityMetrics    priorityMetrics
 }
 
-func NewCarPool(factory models.TransactionFactory) *CarPool {
-	return &CarPool{
+// Option customizes a CarPool on creation
+type Option func(*CarPool)
+
+// WithEventStore appends every domain event to the given log once the
+// transaction producing it has committed. Appending is best effort: a failed
+// append is only logged, and leaves the log behind the stored state.
+func WithEventStore(store events.Store) Option {
+	return func(cp *CarPool) {
+		cp.eventStore = store
+	}
+}
+
+// WithEventBus publishes committed events on the given bus instead of a private one
+func WithEventBus(bus *events.Bus) Option {
+	return func(cp *CarPool) {
+		cp.eventBus = bus
+	}
+}
+
+// WithClock timestamps events with the given clock instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(cp *CarPool) {
+		cp.clock = c
+	}
+}
+
+// WithRetryPolicy changes how operations retry on conflicts with concurrent ones
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(cp *CarPool) {
+		if p.MaxAttempts < 1 {
+			p.MaxAttempts = 1
+		}
+		cp.retryPolicy = p
+	}
+}
+
+// WithTxnTimeout gives every transaction at most d to commit, it's rolled
+// back and the request answered with 503 Service Unavailable after that
+func WithTxnTimeout(d time.Duration) Option {
+	return func(cp *CarPool) {
+		cp.txnTimeout = d
+	}
+}
+
+// WithMaxPendingPerOwner refuses journeys that would wait in the queue, and
+// journeys booked ahead, when their owner has n groups waiting or scheduled
+// already, 0 means no limit
+func WithMaxPendingPerOwner(n int) Option {
+	return func(cp *CarPool) {
+		cp.maxPendingPerOwner = n
+	}
+}
+
+// WithScheduleLeadTime promotes scheduled journeys d before their pickup
+// time, so they get a car in time. Journeys asking for a pickup within d are
+// not scheduled at all.
+func WithScheduleLeadTime(d time.Duration) Option {
+	return func(cp *CarPool) {
+		cp.scheduleLeadTime = d
+	}
+}
+
+// WithMaxReservation refuses reservations expiring more than d from now,
+// 0 means no limit
+func WithMaxReservation(d time.Duration) Option {
+	return func(cp *CarPool) {
+		cp.maxReservation = d
+	}
+}
+
+// WithStrategy changes how a car is picked for a new group, best fit by default
+func WithStrategy(s Strategy) Option {
+	return func(cp *CarPool) {
+		cp.strategy = s
+	}
+}
+
+// WithSeatLimits accepts cars with between min and max seats, instead of
+// models.MIN_SEATS and models.MAX_SEATS
+func WithSeatLimits(min, max uint) Option {
+	return func(cp *CarPool) {
+		cp.minSeats, cp.maxSeats = min, max
+	}
+}
+
+// WithMetrics registers the service metrics in the given registry instead of a private one
+func WithMetrics(r *metrics.Registry) Option {
+	return func(cp *CarPool) {
+		cp.metrics = r
+	}
+}
+
+func NewCarPool(factory models.TransactionFactory, opts ...Option) *CarPool {
+	cp := &CarPool{
 		transactionFactory: factory,
 		logger:             logger.New("carpool-service"),
+		eventBus:           events.NewBus(),
+		clock:              clock.Real{},
+		retryPolicy:        DefaultRetryPolicy(),
+		maxReservation:     DefaultMaxReservation,
+		agingStep:          DefaultAgingStep,
+		unservablePolicy:   UnservableFlag,
+		strategy:           StrategyBestFit,
+		minSeats:           models.MIN_SEATS,
+		maxSeats:           models.MAX_SEATS,
+		metrics:            metrics.NewRegistry(),
+	}
+	for _, opt := range opts {
+		opt(cp)
 	}
+	cp.retryMetrics = newRetryMetrics(cp.metrics)
+	cp.consistencyMetrics = newConsistencyMetrics(cp.metrics)
+	cp.scheduleMetrics = newScheduleMetrics(cp.metrics)
+	cp.priorityMetrics = newPriorityMetrics(cp.metrics)
+	cp.eventBus.Subscribe(cp.priorityMetrics.observeWait)
+	return cp
+}
+
+// Events returns the bus where committed domain events are published
+func (cp *CarPool) Events() *events.Bus {
+	return cp.eventBus
 }
 
 func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
+	return cp.retryOnConflict(ctx, "reset cars", func(ctx context.Context) error {
+		return cp.resetCars(ctx, cars)
+	})
+}
+
+func (cp *CarPool) resetCars(ctx context.Context, cars []*models.Car) error {
 	start := time.Now()
 	requestID := logger.GetRequestID(ctx)
 
@@ -29,7 +176,7 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 		"request_id": requestID,
 	})
 
-	txn, err := cp.transactionFactory.Begin()
+	txn, err := cp.transactionFactory.Begin(ctx)
 	if err != nil {
 		cp.logger.Error("Failed to begin transaction for car reset", map[string]interface{}{
 			"error":      err.Error(),
@@ -38,16 +185,41 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
 	}
 	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	// what the reset throws away, for the audit log
+	var replaced []*models.Car
+	var dropped []*models.Journey
+	if audit.Wanted(ctx) {
+		replaced = txn.CarsStorage().GetAllCars(ctx)
+		dropped = txn.JourneysStorage().GetAllJourneys(ctx)
+		dropped = append(dropped, txn.ScheduledStorage().GetAllScheduled(ctx)...)
+		for _, r := range txn.ReservationsStorage().GetAllReservations(ctx) {
+			dropped = append(dropped, &models.Journey{Id: r.JourneyID, Passengers: r.Passengers, Owner: r.Owner})
+		}
+	}
 
 	// Reset all storages
-	txn.CarsStorage().ResetMemory()
-	txn.JourneysStorage().ResetMemory()
-	txn.PendingsStorage().ResetMemory()
+	for _, reset := range []func(context.Context) error{
+		txn.CarsStorage().ResetMemory,
+		txn.JourneysStorage().ResetMemory,
+		txn.PendingsStorage().ResetMemory,
+		txn.ScheduledStorage().ResetMemory,
+		txn.ReservationsStorage().ResetMemory,
+	} {
+		if err := reset(ctx); err != nil {
+			cp.logger.Error("Failed to reset storage", map[string]interface{}{
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return models.NewAPIError(500, "Failed to reset storage", err.Error())
+		}
+	}
 
 	seenIDs := make(map[uint]bool)
 
 	for _, car := range cars {
-		if !car.HasValidSeats() {
+		if car.Seats < cp.minSeats || car.Seats > cp.maxSeats {
 			cp.logger.Error("Invalid car seats", map[string]interface{}{
 				"car_id":     car.ID,
 				"seats":      car.Seats,
@@ -55,6 +227,15 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 			})
 			return models.ErrInvalidSeats
 		}
+		// every child seat takes a seat
+		if car.ChildSeats > car.Seats {
+			cp.logger.Error("Car has more child seats than seats", map[string]interface{}{
+				"car_id":      car.ID,
+				"child_seats": car.ChildSeats,
+				"request_id":  requestID,
+			})
+			return models.ErrInvalidInput
+		}
 
 		if seenIDs[car.ID] {
 			cp.logger.Error("Duplicate car ID in request", map[string]interface{}{
@@ -65,7 +246,7 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 		}
 		seenIDs[car.ID] = true
 
-		_, err := txn.CarsStorage().FindById(car.ID)
+		_, err := txn.CarsStorage().FindById(ctx, car.ID)
 		if err != nil && err != models.ErrNotFound {
 			cp.logger.Error("Error checking existing car", map[string]interface{}{
 				"car_id":     car.ID,
@@ -75,7 +256,7 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 			return models.NewAPIError(500, "Failed to check existing car", err.Error())
 		}
 
-		if err := txn.CarsStorage().NewCar(car); err != nil {
+		if err := txn.CarsStorage().NewCar(ctx, car); err != nil {
 			cp.logger.Error("Failed to create car", map[string]interface{}{
 				"car_id":     car.ID,
 				"error":      err.Error(),
@@ -85,13 +266,32 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 		}
 	}
 
-	if err := txn.Commit(); err != nil {
+	fleet := make([]models.Car, 0, len(cars))
+	for _, car := range cars {
+		fleet = append(fleet, *car)
+	}
+	rec.Emit(events.FleetReset, events.FleetResetData{Cars: fleet})
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode car reset events", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
 		cp.logger.Error("Failed to commit car reset transaction", map[string]interface{}{
 			"error":      err.Error(),
 			"request_id": requestID,
 		})
 		return models.NewAPIError(500, "Failed to commit transaction", err.Error())
 	}
+	rec.Publish()
+	audit.Describe(ctx, fleetChanges(replaced, cars, dropped))
 
 	cp.logger.Info("Car reset completed successfully", map[string]interface{}{
 		"car_count":   len(cars),
@@ -102,7 +302,62 @@ func (cp *CarPool) ResetCars(ctx context.Context, cars []*models.Car) error {
 	return nil
 }
 
+// fleetChanges summarizes a reset: the cars that came and went, those whose
+// seats changed, and the journeys that were thrown away with the old fleet
+func fleetChanges(before, after []*models.Car, dropped []*models.Journey) *audit.Summary {
+	seats := make(map[uint]uint, len(before))
+	for _, car := range before {
+		seats[car.ID] = car.Seats
+	}
+	summary := &audit.Summary{}
+	for _, car := range after {
+		old, existed := seats[car.ID]
+		switch {
+		case !existed:
+			summary.CarsAdded = append(summary.CarsAdded, car.ID)
+		case old != car.Seats:
+			summary.CarsChanged = append(summary.CarsChanged, car.ID)
+		}
+		delete(seats, car.ID)
+	}
+	for id := range seats {
+		summary.CarsRemoved = append(summary.CarsRemoved, id)
+	}
+	for _, journey := range dropped {
+		summary.JourneysDropped = append(summary.JourneysDropped, journey.Id)
+	}
+	for _, ids := range [][]uint{summary.CarsAdded, summary.CarsRemoved, summary.CarsChanged, summary.JourneysDropped} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return summary
+}
+
+// NewJourney seats the group in a car or queues it. A group asking for a
+// pickup later than the lead time from now is scheduled instead, and any
+// other pickup time is dropped, so the journey is left with a PickupAt only
+// when it was scheduled.
 func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) error {
+	if !journey.Class.IsValid() {
+		return models.ErrUnknownClass
+	}
+	// every child needs a seat of its own
+	if journey.ChildSeats > journey.Passengers {
+		return models.ErrInvalidInput
+	}
+	if journey.IsScheduled() && journey.PickupAt.After(cp.clock.Now().Add(cp.scheduleLeadTime)) {
+		return cp.retryOnConflict(ctx, "schedule journey", func(ctx context.Context) error {
+			return cp.scheduleJourney(ctx, journey)
+		})
+	}
+	journey.PickupAt = nil
+	return cp.retryOnConflict(ctx, "new journey", func(ctx context.Context) error {
+		// a conflicting attempt may have assigned it already
+		journey.CarID = nil
+		return cp.newJourney(ctx, journey)
+	})
+}
+
+func (cp *CarPool) newJourney(ctx context.Context, journey *models.Journey) error {
 	start := time.Now()
 	requestID := logger.GetRequestID(ctx)
 
@@ -112,7 +367,7 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 		"request_id": requestID,
 	})
 
-	txn, err := cp.transactionFactory.Begin()
+	txn, err := cp.transactionFactory.Begin(ctx)
 	if err != nil {
 		cp.logger.Error("Failed to begin transaction for new journey", map[string]interface{}{
 			"journey_id": journey.Id,
@@ -122,8 +377,9 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
 	}
 	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
 
-	_, err = txn.JourneysStorage().FindById(journey.Id)
+	_, err = txn.JourneysStorage().FindById(ctx, journey.Id)
 	if err != nil && err != models.ErrNotFound {
 		cp.logger.Error("Error checking existing journey", map[string]interface{}{
 			"journey_id": journey.Id,
@@ -132,14 +388,124 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 		})
 		return models.NewAPIError(500, "Failed to check existing journey", err.Error())
 	}
+	if err := cp.checkHeldAhead(ctx, txn, journey.Id); err != nil {
+		return err
+	}
+
+	if err := cp.placeJourney(ctx, txn, rec, journey, true); err != nil {
+		return err
+	}
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode journey events", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to commit journey transaction", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to commit transaction", err.Error())
+	}
+	rec.Publish()
+
+	cp.logger.Info("New journey completed", map[string]interface{}{
+		"journey_id":  journey.Id,
+		"assigned":    journey.IsAssigned(),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+
+	return nil
+}
+
+// checkHeldAhead refuses a journey id that is scheduled or holds a
+// reservation, no other journey may take it over
+func (cp *CarPool) checkHeldAhead(ctx context.Context, txn models.Transaction, journeyId uint) error {
+	requestID := logger.GetRequestID(ctx)
+	_, err := txn.ScheduledStorage().FindById(ctx, journeyId)
+	if err == models.ErrNotFound {
+		_, err = txn.ReservationsStorage().FindById(ctx, journeyId)
+	}
+	switch err {
+	case models.ErrNotFound:
+		return nil
+	case nil:
+		cp.logger.Warn("Journey id is scheduled or reserved already", map[string]interface{}{
+			"journey_id": journeyId,
+			"request_id": requestID,
+		})
+		return models.ErrDuplicatedID
+	default:
+		cp.logger.Error("Error checking journeys held ahead", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to check existing journey", err.Error())
+	}
+}
+
+// placeJourney registers the group and seats it in a car, or queues it when
+// none fits. Only checked placements are held to the waiting limit of the
+// owner and to a car that could ever carry them. A promoted journey passed
+// both when it was scheduled, and has counted against the limit since.
+func (cp *CarPool) placeJourney(ctx context.Context, txn models.Transaction, rec *events.Recorder, journey *models.Journey, checked bool) error {
+	requestID := logger.GetRequestID(ctx)
+
+	journey.RequestedAt = cp.clock.Now()
+	rec.Emit(events.JourneyRequested, events.JourneyRequestedData{
+		JourneyID:  journey.Id,
+		Passengers: journey.Passengers,
+		Owner:      journey.Owner,
+		Class:      journey.Class,
+		Features:   journey.Features,
+	})
 
 	seats := journey.Passengers
-	cars := txn.CarsStorage().GetAllCars()
-	car := findCar(cars, seats)
+	car, err := cp.pickCar(ctx, txn, seats, journey.Features)
+	if err != nil && err != models.ErrNotFound {
+		cp.logger.Error("Error looking for a car", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to look for a car", err.Error())
+	}
 
 	if car != nil {
-		car.TakeSeats(seats)
-		if err := txn.CarsStorage().UpdateCar(car.ID, car); err != nil {
+		// only a read racing a concurrent commit picks a car short of seats,
+		// which the commit would have been refused for anyway
+		if err := car.TakeSeats(seats); err != nil {
+			cp.logger.Warn("Car has fewer free seats than it was picked for", map[string]interface{}{
+				"car_id":          car.ID,
+				"journey_id":      journey.Id,
+				"available_seats": car.AvailableSeats,
+				"request_id":      requestID,
+			})
+			return models.ErrConflict
+		}
+		if err := car.TakeFeatures(journey.Features); err != nil {
+			cp.logger.Warn("Car has fewer free features than it was picked for", map[string]interface{}{
+				"car_id":     car.ID,
+				"journey_id": journey.Id,
+				"request_id": requestID,
+			})
+			return models.ErrConflict
+		}
+		if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return err
+			}
 			cp.logger.Error("Failed to update car after assignment", map[string]interface{}{
 				"car_id":     car.ID,
 				"journey_id": journey.Id,
@@ -149,8 +515,8 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 			return models.NewAPIError(500, "Failed to update car", err.Error())
 		}
 
-		journey.AssignCar(car)
-		if err := txn.JourneysStorage().NewJourney(journey); err != nil {
+		journey.AssignCar(car.ID)
+		if err := txn.JourneysStorage().NewJourney(ctx, journey); err != nil {
 			cp.logger.Error("Failed to create journey record", map[string]interface{}{
 				"journey_id": journey.Id,
 				"error":      err.Error(),
@@ -158,17 +524,30 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 			})
 			return models.NewAPIError(500, "Failed to create journey", err.Error())
 		}
+		rec.Emit(events.JourneyAssigned, events.JourneyAssignedData{
+			JourneyID:  journey.Id,
+			CarID:      car.ID,
+			Passengers: journey.Passengers,
+			Class:      journey.Class,
+		})
 
 		cp.logger.Info("Journey assigned to car", map[string]interface{}{
-			"journey_id":  journey.Id,
-			"car_id":      car.ID,
-			"passengers":  journey.Passengers,
-			"duration_ms": time.Since(start).Milliseconds(),
-			"request_id":  requestID,
+			"journey_id": journey.Id,
+			"car_id":     car.ID,
+			"passengers": journey.Passengers,
+			"request_id": requestID,
 		})
 
 	} else {
-		if err := txn.JourneysStorage().NewJourney(journey); err != nil {
+		if checked {
+			if err := cp.checkServable(ctx, txn, journey); err != nil {
+				return err
+			}
+			if err := cp.checkOwnerLimit(ctx, txn, journey); err != nil {
+				return err
+			}
+		}
+		if err := txn.JourneysStorage().NewJourney(ctx, journey); err != nil {
 			cp.logger.Error("Failed to create pending journey record", map[string]interface{}{
 				"journey_id": journey.Id,
 				"error":      err.Error(),
@@ -176,7 +555,7 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 			})
 			return models.NewAPIError(500, "Failed to create journey", err.Error())
 		}
-		if err := txn.PendingsStorage().NewPending(journey); err != nil {
+		if err := txn.PendingsStorage().NewPending(ctx, journey); err != nil {
 			cp.logger.Error("Failed to add journey to pending queue", map[string]interface{}{
 				"journey_id": journey.Id,
 				"error":      err.Error(),
@@ -186,26 +565,67 @@ func (cp *CarPool) NewJourney(ctx context.Context, journey *models.Journey) erro
 		}
 
 		cp.logger.Info("Journey added to pending queue", map[string]interface{}{
-			"journey_id":  journey.Id,
-			"passengers":  journey.Passengers,
-			"duration_ms": time.Since(start).Milliseconds(),
-			"request_id":  requestID,
+			"journey_id": journey.Id,
+			"passengers": journey.Passengers,
+			"request_id": requestID,
 		})
 	}
+	return nil
+}
+
+// checkOwnerLimit refuses a group whose owner has as many groups waiting as
+// allowed already. Scheduled journeys count too, they join the queue when due.
+// Journeys without an owner aren't counted against anyone.
+func (cp *CarPool) checkOwnerLimit(ctx context.Context, txn models.Transaction, journey *models.Journey) error {
+	if cp.maxPendingPerOwner <= 0 || journey.Owner == "" {
+		return nil
+	}
+	requestID := logger.GetRequestID(ctx)
 
-	if err := txn.Commit(); err != nil {
-		cp.logger.Error("Failed to commit journey transaction", map[string]interface{}{
+	pending, err := txn.PendingsStorage().CountOwnedBy(ctx, journey.Owner)
+	if err != nil {
+		cp.logger.Error("Failed to count pending journeys of client", map[string]interface{}{
 			"journey_id": journey.Id,
+			"owner":      journey.Owner,
 			"error":      err.Error(),
 			"request_id": requestID,
 		})
-		return models.NewAPIError(500, "Failed to commit transaction", err.Error())
+		return models.NewAPIError(500, "Failed to count pending journeys", err.Error())
+	}
+	scheduled, err := txn.ScheduledStorage().CountOwnedBy(ctx, journey.Owner)
+	if err != nil {
+		cp.logger.Error("Failed to count scheduled journeys of client", map[string]interface{}{
+			"journey_id": journey.Id,
+			"owner":      journey.Owner,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to count scheduled journeys", err.Error())
+	}
+	if pending+scheduled >= cp.maxPendingPerOwner {
+		cp.logger.Warn("Client has too many pending journeys", map[string]interface{}{
+			"journey_id": journey.Id,
+			"owner":      journey.Owner,
+			"pending":    pending,
+			"scheduled":  scheduled,
+			"request_id": requestID,
+		})
+		return models.ErrTooManyPending
 	}
-
 	return nil
 }
 
+// Dropoff removes the group, returning the car it leaves when it had one. A
+// scheduled journey is canceled instead, without a car.
 func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car, err error) {
+	err = cp.retryOnConflict(ctx, "dropoff", func(ctx context.Context) error {
+		car, err = cp.dropoff(ctx, journeyId)
+		return err
+	})
+	return car, err
+}
+
+func (cp *CarPool) dropoff(ctx context.Context, journeyId uint) (car *models.Car, err error) {
 
 	start := time.Now()
 	requestID := logger.GetRequestID(ctx)
@@ -215,7 +635,7 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		"request_id": requestID,
 	})
 
-	txn, err := cp.transactionFactory.Begin()
+	txn, err := cp.transactionFactory.Begin(ctx)
 	if err != nil {
 		cp.logger.Error("Failed to begin transaction for dropoff", map[string]interface{}{
 			"journey_id": journeyId,
@@ -225,8 +645,14 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
 	}
 	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
 
-	journey, err := txn.JourneysStorage().FindById(journeyId)
+	journey, err := txn.JourneysStorage().FindById(ctx, journeyId)
+	if err == models.ErrNotFound {
+		if scheduled, err := txn.ScheduledStorage().FindById(ctx, journeyId); err == nil {
+			return nil, cp.cancelScheduled(ctx, txn, rec, scheduled)
+		}
+	}
 	if err != nil {
 		cp.logger.Error("Journey not found for dropoff", map[string]interface{}{
 			"journey_id": journeyId,
@@ -236,7 +662,7 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		return nil, err
 	}
 
-	if err := txn.JourneysStorage().DeleteById(journey.Id); err != nil {
+	if err := txn.JourneysStorage().DeleteById(ctx, journey.Id); err != nil {
 		cp.logger.Error("Failed to delete journey record", map[string]interface{}{
 			"journey_id": journeyId,
 			"error":      err.Error(),
@@ -245,10 +671,53 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		return nil, models.NewAPIError(500, "Failed to delete journey", err.Error())
 	}
 
-	car = journey.AssignedTo
-	if car != nil {
-		car.FreeUpSeats(journey.Passengers)
-		if err := txn.CarsStorage().UpdateCar(car.ID, car); err != nil {
+	if journey.IsAssigned() {
+		car, err = txn.CarsStorage().FindById(ctx, *journey.CarID)
+		if err != nil {
+			cp.logger.Error("Failed to find the car of the journey", map[string]interface{}{
+				"car_id":     *journey.CarID,
+				"journey_id": journeyId,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to find car", err.Error())
+		}
+
+		if err := car.FreeUpSeats(journey.Passengers); err != nil {
+			cp.logger.Error("Car has fewer seats taken than the journey frees", map[string]interface{}{
+				"car_id":          car.ID,
+				"journey_id":      journeyId,
+				"available_seats": car.AvailableSeats,
+				"request_id":      requestID,
+			})
+			return nil, err
+		}
+		if err := car.FreeUpFeatures(journey.Features); err != nil {
+			cp.logger.Error("Car has fewer features in use than the journey frees", map[string]interface{}{
+				"car_id":     car.ID,
+				"journey_id": journeyId,
+				"request_id": requestID,
+			})
+			return nil, err
+		}
+		if car.Draining && car.AvailableSeats == car.Seats {
+			if err := txn.CarsStorage().DeleteById(ctx, car.ID); err != nil {
+				cp.logger.Error("Failed to remove drained car", map[string]interface{}{
+					"car_id":     car.ID,
+					"journey_id": journeyId,
+					"error":      err.Error(),
+					"request_id": requestID,
+				})
+				return nil, models.NewAPIError(500, "Failed to remove car", err.Error())
+			}
+			cp.logger.Info("Drained car removed from the fleet", map[string]interface{}{
+				"car_id":     car.ID,
+				"request_id": requestID,
+			})
+		} else if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return nil, err
+			}
 			cp.logger.Error("Failed to update car after dropoff", map[string]interface{}{
 				"car_id":     car.ID,
 				"journey_id": journeyId,
@@ -265,7 +734,7 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 			"request_id":      requestID,
 		})
 	} else {
-		if err := txn.PendingsStorage().DeleteById(journey.Id); err != nil {
+		if err := txn.PendingsStorage().DeleteById(ctx, journey.Id); err != nil {
 			cp.logger.Error("Failed to remove journey from pending queue", map[string]interface{}{
 				"journey_id": journeyId,
 				"error":      err.Error(),
@@ -280,7 +749,29 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		})
 	}
 
-	if err := txn.Commit(); err != nil {
+	dropped := events.JourneyDroppedOffData{
+		JourneyID:  journey.Id,
+		Passengers: journey.Passengers,
+	}
+	if car != nil {
+		carID := car.ID
+		dropped.CarID = &carID
+	}
+	rec.Emit(events.JourneyDroppedOff, dropped)
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode dropoff events", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, err
+		}
 		cp.logger.Error("Failed to commit dropoff transaction", map[string]interface{}{
 			"journey_id": journeyId,
 			"error":      err.Error(),
@@ -288,6 +779,7 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 		})
 		return nil, models.NewAPIError(500, "Failed to commit transaction", err.Error())
 	}
+	rec.Publish()
 
 	cp.logger.Info("Journey dropoff completed", map[string]interface{}{
 		"journey_id":  journeyId,
@@ -300,6 +792,16 @@ func (cp *CarPool) Dropoff(ctx context.Context, journeyId uint) (car *models.Car
 }
 
 func (cp *CarPool) Reassign(ctx context.Context, car *models.Car) error {
+	return cp.retryOnConflict(ctx, "reassign", func(ctx context.Context) error {
+		return cp.reassign(ctx, car)
+	})
+}
+
+func (cp *CarPool) reassign(ctx context.Context, car *models.Car) error {
+	// a car drained by the dropoff is gone by now
+	if car.Draining {
+		return nil
+	}
 
 	start := time.Now()
 	requestID := logger.GetRequestID(ctx)
@@ -310,7 +812,7 @@ func (cp *CarPool) Reassign(ctx context.Context, car *models.Car) error {
 		"request_id":      requestID,
 	})
 
-	txn, err := cp.transactionFactory.Begin()
+	txn, err := cp.transactionFactory.Begin(ctx)
 	if err != nil {
 		cp.logger.Error("Failed to begin transaction for reassignment", map[string]interface{}{
 			"car_id":     car.ID,
@@ -320,59 +822,44 @@ func (cp *CarPool) Reassign(ctx context.Context, car *models.Car) error {
 		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
 	}
 	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
 
-	pending := txn.PendingsStorage().GetAllPendings()
-	cp.logger.Debug("Retrieved pending journeys for reassignment", map[string]interface{}{
-		"car_id":        car.ID,
-		"pending_count": len(pending),
-		"request_id":    requestID,
-	})
-
-	for _, p := range pending {
-		if p.Passengers <= car.AvailableSeats {
-
-			p.AssignedTo = car
-			if err := txn.PendingsStorage().UpdatePending(p.Id, p); err != nil {
-				cp.logger.Error("Failed to update pending journey", map[string]interface{}{
-					"car_id":     car.ID,
-					"journey_id": p.Id,
-					"error":      err.Error(),
-					"request_id": requestID,
-				})
-				return models.NewAPIError(500, "Failed to update pending journey", err.Error())
-			}
-
-			car.TakeSeats(p.Passengers)
-			if err := txn.CarsStorage().UpdateCar(car.ID, car); err != nil {
-				cp.logger.Error("Failed to update car after reassignment", map[string]interface{}{
-					"car_id":     car.ID,
-					"journey_id": p.Id,
-					"error":      err.Error(),
-					"request_id": requestID,
-				})
-				return models.NewAPIError(500, "Failed to update car", err.Error())
-			}
+	// the car given may have changed since it was read, work on the stored one
+	carId := car.ID
+	car, err = txn.CarsStorage().FindById(ctx, carId)
+	if err != nil {
+		cp.logger.Error("Car not found for reassignment", map[string]interface{}{
+			"car_id":     carId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return err
+	}
+	if car.Draining {
+		cp.logger.Info("Draining car takes no waiting groups", map[string]interface{}{
+			"car_id":     car.ID,
+			"request_id": requestID,
+		})
+		return nil
+	}
 
-			if err := txn.PendingsStorage().DeleteById(p.Id); err != nil {
-				cp.logger.Error("Failed to remove journey from pending queue", map[string]interface{}{
-					"car_id":     car.ID,
-					"journey_id": p.Id,
-					"error":      err.Error(),
-					"request_id": requestID,
-				})
-				return models.NewAPIError(500, "Failed to remove journey from pending queue", err.Error())
-			}
+	if err := cp.fillCar(ctx, txn, rec, car); err != nil {
+		return err
+	}
 
-			cp.logger.Info("Journey reassigned to car", map[string]interface{}{
-				"car_id":     car.ID,
-				"journey_id": p.Id,
-				"passengers": p.Passengers,
-				"request_id": requestID,
-			})
-		}
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode reassignment events", map[string]interface{}{
+			"car_id":     car.ID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to encode events", err.Error())
 	}
 
-	if err := txn.Commit(); err != nil {
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
 		cp.logger.Error("Failed to commit reassignment transaction", map[string]interface{}{
 			"car_id":     car.ID,
 			"error":      err.Error(),
@@ -380,6 +867,7 @@ func (cp *CarPool) Reassign(ctx context.Context, car *models.Car) error {
 		})
 		return models.NewAPIError(500, "Failed to commit transaction", err.Error())
 	}
+	rec.Publish()
 
 	cp.logger.Info("Car reassignment completed", map[string]interface{}{
 		"car_id":      car.ID,
@@ -390,7 +878,127 @@ func (cp *CarPool) Reassign(ctx context.Context, car *models.Car) error {
 	return nil
 }
 
-func (cp *CarPool) Locate(ctx context.Context, journeyId uint) (*models.Car, error) {
+// fillCar seats waiting groups in the free seats of car, in the order
+// nextPending serves them, until none fits in what is left
+func (cp *CarPool) fillCar(ctx context.Context, txn models.Transaction, rec *events.Recorder, car *models.Car) error {
+	requestID := logger.GetRequestID(ctx)
+	for {
+		p, err := cp.nextPending(ctx, txn, car)
+		if err == models.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			cp.logger.Error("Failed to look for a pending journey", map[string]interface{}{
+				"car_id":     car.ID,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return models.NewAPIError(500, "Failed to look for a pending journey", err.Error())
+		}
+
+		if err := cp.seatPending(ctx, txn, rec, car, p); err != nil {
+			return err
+		}
+
+		cp.logger.Info("Journey reassigned to car", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"passengers": p.Passengers,
+			"request_id": requestID,
+		})
+	}
+}
+
+// seatPending takes the waiting group p out of the queue and seats it in car,
+// whose free seats are updated in place
+func (cp *CarPool) seatPending(ctx context.Context, txn models.Transaction, rec *events.Recorder, car *models.Car, p *models.Journey) error {
+	requestID := logger.GetRequestID(ctx)
+
+	// the queue keeps its own copy, the journey has a version of its own
+	journey, err := txn.JourneysStorage().FindById(ctx, p.Id)
+	if err != nil {
+		cp.logger.Error("Failed to find pending journey", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to find journey", err.Error())
+	}
+	journey.AssignCar(car.ID)
+	if err := txn.JourneysStorage().UpdateJourney(ctx, journey.Id, journey, journey.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to update pending journey", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to update journey", err.Error())
+	}
+
+	if err := car.TakeSeats(p.Passengers); err != nil {
+		cp.logger.Warn("Car has fewer free seats than the pending journey it was picked for", map[string]interface{}{
+			"car_id":          car.ID,
+			"journey_id":      p.Id,
+			"available_seats": car.AvailableSeats,
+			"request_id":      requestID,
+		})
+		return models.ErrConflict
+	}
+	if err := car.TakeFeatures(p.Features); err != nil {
+		cp.logger.Warn("Car has fewer free features than the pending journey it was picked for", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"request_id": requestID,
+		})
+		return models.ErrConflict
+	}
+	if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to update car after seating pending journey", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to update car", err.Error())
+	}
+
+	if err := txn.PendingsStorage().DeleteById(ctx, p.Id); err != nil {
+		cp.logger.Error("Failed to remove journey from pending queue", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": p.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to remove journey from pending queue", err.Error())
+	}
+
+	rec.Emit(events.JourneyAssigned, events.JourneyAssignedData{
+		JourneyID:  p.Id,
+		CarID:      car.ID,
+		Passengers: p.Passengers,
+		Class:      journey.Class,
+		WaitMs:     cp.clock.Now().Sub(journey.RequestedAt).Milliseconds(),
+	})
+	return nil
+}
+
+// Locate returns the car of the group, or nil while it waits or is scheduled
+func (cp *CarPool) Locate(ctx context.Context, journeyId uint) (car *models.Car, err error) {
+	err = cp.attempt(ctx, "locate", func(ctx context.Context) error {
+		car, err = cp.locate(ctx, journeyId)
+		return err
+	})
+	return car, err
+}
+
+func (cp *CarPool) locate(ctx context.Context, journeyId uint) (*models.Car, error) {
 	start := time.Now()
 	requestID := logger.GetRequestID(ctx)
 
@@ -399,7 +1007,7 @@ func (cp *CarPool) Locate(ctx context.Context, journeyId uint) (*models.Car, err
 		"request_id": requestID,
 	})
 
-	txn, err := cp.transactionFactory.Begin()
+	txn, err := cp.transactionFactory.Begin(ctx)
 	if err != nil {
 		cp.logger.Error("Failed to begin transaction for locate", map[string]interface{}{
 			"journey_id": journeyId,
@@ -408,8 +1016,19 @@ func (cp *CarPool) Locate(ctx context.Context, journeyId uint) (*models.Car, err
 		})
 		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
 	}
+	defer handleTxn(txn)
 
-	journey, err := txn.JourneysStorage().FindById(journeyId)
+	journey, err := txn.JourneysStorage().FindById(ctx, journeyId)
+	if err == models.ErrNotFound {
+		if err := cp.checkHeldAhead(ctx, txn, journeyId); err == models.ErrDuplicatedID {
+			cp.logger.Info("Journey is booked ahead, not riding yet", map[string]interface{}{
+				"journey_id":  journeyId,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"request_id":  requestID,
+			})
+			return nil, nil
+		}
+	}
 	if err != nil {
 		cp.logger.Error("Journey not found for locate", map[string]interface{}{
 			"journey_id": journeyId,
@@ -419,37 +1038,59 @@ func (cp *CarPool) Locate(ctx context.Context, journeyId uint) (*models.Car, err
 		return nil, err
 	}
 
-	car := journey.AssignedTo
-	if car != nil {
-		cp.logger.Info("Journey located in car", map[string]interface{}{
-			"journey_id":  journeyId,
-			"car_id":      car.ID,
-			"duration_ms": time.Since(start).Milliseconds(),
-			"request_id":  requestID,
-		})
-	} else {
+	if !journey.IsAssigned() {
 		cp.logger.Info("Journey not yet assigned to car", map[string]interface{}{
 			"journey_id":  journeyId,
 			"duration_ms": time.Since(start).Milliseconds(),
 			"request_id":  requestID,
 		})
+		return nil, nil
+	}
+
+	car, err := txn.CarsStorage().FindById(ctx, *journey.CarID)
+	if err != nil {
+		cp.logger.Error("Failed to find the car of the journey", map[string]interface{}{
+			"car_id":     *journey.CarID,
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to find car", err.Error())
 	}
 
-	return journey.AssignedTo, nil
+	cp.logger.Info("Journey located in car", map[string]interface{}{
+		"journey_id":  journeyId,
+		"car_id":      car.ID,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+
+	return car, nil
 }
 
-func findCar(cars []*models.Car, seats uint) *models.Car {
-	var bestCar *models.Car
-	var minSeats uint = ^uint(0)
+// recorder buffers the domain events of one transaction
+func (cp *CarPool) recorder(ctx context.Context) *events.Recorder {
+	return events.NewRecorder(cp.eventStore, cp.eventBus, logger.GetRequestID(ctx), cp.clock.Now)
+}
 
-	for _, c := range cars {
-		if c.AvailableSeats >= seats && c.AvailableSeats < minSeats {
-			bestCar = c
-			minSeats = c.AvailableSeats
-		}
+// commit commits txn and only then appends its events to the log. Commits
+// with a log are taken one at a time so the log keeps the order they happened
+// in. The state is committed by then, so an append failing is only logged.
+func (cp *CarPool) commit(ctx context.Context, txn models.Transaction, rec *events.Recorder) error {
+	if cp.eventStore != nil {
+		cp.commitMu.Lock()
+		defer cp.commitMu.Unlock()
 	}
-
-	return bestCar
+	if err := txn.Commit(ctx); err != nil {
+		return err
+	}
+	if err := rec.Persist(); err != nil {
+		cp.logger.Error("Failed to persist committed events, the log misses them", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+	}
+	return nil
 }
 
 func handleTxn(txn models.Transaction) {
@@ -17,28 +17,34 @@ func TestResetCars(t *testing.T) {
 	txn := mock_models.NewMockTransaction(ctrl)
 	carsStorage := mock_models.NewMockICarStorage(ctrl)
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	scheduledStorage := mock_models.NewMockIScheduledStorage(ctrl)
+	reservationsStorage := mock_models.NewMockIReservationStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
 	// Test valid cars are loaded and storages reset and commit is called
 	cars := []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 2, Seats: 6, AvailableSeats: 6}}
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().ScheduledStorage().Return(scheduledStorage).AnyTimes()
+	txn.EXPECT().ReservationsStorage().Return(reservationsStorage).AnyTimes()
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
 
-	carsStorage.EXPECT().ResetMemory().Return(nil)
-	journeysStorage.EXPECT().ResetMemory().Return(nil)
-	pendingsStorage.EXPECT().ResetMemory().Return(nil)
+	carsStorage.EXPECT().ResetMemory(gomock.Any()).Return(nil)
+	journeysStorage.EXPECT().ResetMemory(gomock.Any()).Return(nil)
+	pendingsStorage.EXPECT().ResetMemory(gomock.Any()).Return(nil)
+	scheduledStorage.EXPECT().ResetMemory(gomock.Any()).Return(nil)
+	reservationsStorage.EXPECT().ResetMemory(gomock.Any()).Return(nil)
 
 	// For each car: check not found or found then NewCar called
-	carsStorage.EXPECT().FindById(uint(1)).Return(nil, models.ErrNotFound)
-	carsStorage.EXPECT().NewCar(cars[0]).Return(nil)
+	carsStorage.EXPECT().FindById(gomock.Any(), uint(1)).Return(nil, models.ErrNotFound)
+	carsStorage.EXPECT().NewCar(gomock.Any(), cars[0]).Return(nil)
 
-	carsStorage.EXPECT().FindById(uint(2)).Return(nil, models.ErrNotFound)
-	carsStorage.EXPECT().NewCar(cars[1]).Return(nil)
+	carsStorage.EXPECT().FindById(gomock.Any(), uint(2)).Return(nil, models.ErrNotFound)
+	carsStorage.EXPECT().NewCar(gomock.Any(), cars[1]).Return(nil)
 
-	txn.EXPECT().Commit().Return(nil)
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -55,24 +61,29 @@ func TestNewJourney_AssignsToBestCar(t *testing.T) {
 	txn := mock_models.NewMockTransaction(ctrl)
 	carsStorage := mock_models.NewMockICarStorage(ctrl)
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	scheduledStorage := mock_models.NewMockIScheduledStorage(ctrl)
+	reservationsStorage := mock_models.NewMockIReservationStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
 	journey := &models.Journey{Id: 10, Passengers: 4}
 
-	car1 := &models.Car{ID: 1, Seats: 6, AvailableSeats: 6}
-	car2 := &models.Car{ID: 2, Seats: 4, AvailableSeats: 4}
+	car2 := &models.Car{ID: 2, Seats: 4, AvailableSeats: 4, Version: 3}
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().ScheduledStorage().Return(scheduledStorage).AnyTimes()
+	txn.EXPECT().ReservationsStorage().Return(reservationsStorage).AnyTimes()
+	scheduledStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	reservationsStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
 	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
 
-	journeysStorage.EXPECT().FindById(uint(10)).Return(nil, models.ErrNotFound)
-	carsStorage.EXPECT().GetAllCars().Return([]*models.Car{car1, car2})
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(10)).Return(nil, models.ErrNotFound)
 	// best fit is car2 with exactly 4 available seats
-	carsStorage.EXPECT().UpdateCar(uint(2), gomock.Any()).Return(nil)
-	journeysStorage.EXPECT().NewJourney(gomock.Any()).Return(nil)
-	txn.EXPECT().Commit().Return(nil)
+	carsStorage.EXPECT().FindBestFit(gomock.Any(), uint(4)).Return(car2, nil)
+	carsStorage.EXPECT().UpdateCar(gomock.Any(), uint(2), gomock.Any(), uint64(3)).Return(nil)
+	journeysStorage.EXPECT().NewJourney(gomock.Any(), gomock.Any()).Return(nil)
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -80,8 +91,8 @@ func TestNewJourney_AssignsToBestCar(t *testing.T) {
 		t.Fatalf("NewJourney returned error: %v", err)
 	}
 
-	if journey.AssignedTo == nil || journey.AssignedTo.ID != 2 {
-		t.Fatalf("expected journey assigned to car 2, got %+v", journey.AssignedTo)
+	if journey.CarID == nil || *journey.CarID != 2 {
+		t.Fatalf("expected journey assigned to car 2, got %v", journey.CarID)
 	}
 }
 
@@ -93,20 +104,27 @@ func TestNewJourney_PendingWhenNoCar(t *testing.T) {
 	txn := mock_models.NewMockTransaction(ctrl)
 	carsStorage := mock_models.NewMockICarStorage(ctrl)
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	scheduledStorage := mock_models.NewMockIScheduledStorage(ctrl)
+	reservationsStorage := mock_models.NewMockIReservationStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
 	journey := &models.Journey{Id: 11, Passengers: 6}
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().ScheduledStorage().Return(scheduledStorage).AnyTimes()
+	txn.EXPECT().ReservationsStorage().Return(reservationsStorage).AnyTimes()
+	scheduledStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	reservationsStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
 	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
 
-	journeysStorage.EXPECT().FindById(uint(11)).Return(nil, models.ErrNotFound)
-	carsStorage.EXPECT().GetAllCars().Return([]*models.Car{})
-	journeysStorage.EXPECT().NewJourney(journey).Return(nil)
-	pendingsStorage.EXPECT().NewPending(journey).Return(nil)
-	txn.EXPECT().Commit().Return(nil)
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(11)).Return(nil, models.ErrNotFound)
+	carsStorage.EXPECT().FindBestFit(gomock.Any(), uint(6)).Return(nil, models.ErrNotFound)
+	carsStorage.EXPECT().Shapes(gomock.Any()).Return(nil, nil)
+	journeysStorage.EXPECT().NewJourney(gomock.Any(), journey).Return(nil)
+	pendingsStorage.EXPECT().NewPending(gomock.Any(), journey).Return(nil)
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -114,8 +132,8 @@ func TestNewJourney_PendingWhenNoCar(t *testing.T) {
 		t.Fatalf("NewJourney returned error: %v", err)
 	}
 
-	if journey.AssignedTo != nil {
-		t.Fatalf("expected journey to be pending, got assigned to car %+v", journey.AssignedTo)
+	if journey.IsAssigned() {
+		t.Fatalf("expected journey to be pending, got assigned to car %d", *journey.CarID)
 	}
 }
 
@@ -129,18 +147,20 @@ func TestDropoff_WithAssignedCar(t *testing.T) {
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
-	car := &models.Car{ID: 1, Seats: 6, AvailableSeats: 2}
-	journey := &models.Journey{Id: 20, Passengers: 4, AssignedTo: car}
+	car := &models.Car{ID: 1, Seats: 6, AvailableSeats: 2, Version: 5}
+	journey := &models.Journey{Id: 20, Passengers: 4}
+	journey.AssignCar(car.ID)
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
 	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
 
-	journeysStorage.EXPECT().FindById(uint(20)).Return(journey, nil)
-	journeysStorage.EXPECT().DeleteById(uint(20)).Return(nil)
-	carsStorage.EXPECT().UpdateCar(uint(1), gomock.Any()).Return(nil)
-	txn.EXPECT().Commit().Return(nil)
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(20)).Return(journey, nil)
+	journeysStorage.EXPECT().DeleteById(gomock.Any(), uint(20)).Return(nil)
+	carsStorage.EXPECT().FindById(gomock.Any(), uint(1)).Return(car, nil)
+	carsStorage.EXPECT().UpdateCar(gomock.Any(), uint(1), gomock.Any(), uint64(5)).Return(nil)
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -162,16 +182,16 @@ func TestDropoff_PendingGroup(t *testing.T) {
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
-	journey := &models.Journey{Id: 21, Passengers: 3, AssignedTo: nil}
+	journey := &models.Journey{Id: 21, Passengers: 3}
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
 
-	journeysStorage.EXPECT().FindById(uint(21)).Return(journey, nil)
-	journeysStorage.EXPECT().DeleteById(uint(21)).Return(nil)
-	pendingsStorage.EXPECT().DeleteById(uint(21)).Return(nil)
-	txn.EXPECT().Commit().Return(nil)
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(21)).Return(journey, nil)
+	journeysStorage.EXPECT().DeleteById(gomock.Any(), uint(21)).Return(nil)
+	pendingsStorage.EXPECT().DeleteById(gomock.Any(), uint(21)).Return(nil)
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -191,23 +211,32 @@ func TestReassign_AssignsPendingThatFits(t *testing.T) {
 	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
 	txn := mock_models.NewMockTransaction(ctrl)
 	carsStorage := mock_models.NewMockICarStorage(ctrl)
+	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
 	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
 
 	car := &models.Car{ID: 1, Seats: 6, AvailableSeats: 6}
 	p1 := &models.Journey{Id: 30, Passengers: 2}
-	p2 := &models.Journey{Id: 31, Passengers: 5}
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
+	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
 	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
 
-	// Will attempt to assign p1 (fits), skip p2 (doesn't fit after p1)
-	pendingsStorage.EXPECT().GetAllPendings().Return([]*models.Journey{p1, p2})
-	pendingsStorage.EXPECT().UpdatePending(uint(30), gomock.Any()).Return(nil)
-	carsStorage.EXPECT().UpdateCar(uint(1), gomock.Any()).Return(nil)
-	pendingsStorage.EXPECT().DeleteById(uint(30)).Return(nil)
-
-	txn.EXPECT().Commit().Return(nil)
+	// no higher class waits
+	pendingsStorage.EXPECT().NextFittingOfClass(gomock.Any(), uint(6), gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).Times(2)
+
+	// Will assign p1 (oldest that fits), then a group of 5 waiting behind doesn't fit the 4 seats left
+	gomock.InOrder(
+		carsStorage.EXPECT().FindById(gomock.Any(), uint(1)).Return(&models.Car{ID: 1, Seats: 6, AvailableSeats: 6, Version: 7}, nil),
+		pendingsStorage.EXPECT().NextFitting(gomock.Any(), uint(6), gomock.Any()).Return(p1, nil),
+		journeysStorage.EXPECT().FindById(gomock.Any(), uint(30)).Return(&models.Journey{Id: 30, Passengers: 2, Version: 2}, nil),
+		journeysStorage.EXPECT().UpdateJourney(gomock.Any(), uint(30), gomock.Any(), uint64(2)).Return(nil),
+		carsStorage.EXPECT().UpdateCar(gomock.Any(), uint(1), gomock.Any(), uint64(7)).Return(nil),
+		pendingsStorage.EXPECT().DeleteById(gomock.Any(), uint(30)).Return(nil),
+		pendingsStorage.EXPECT().NextFitting(gomock.Any(), uint(4), gomock.Any()).Return(nil, models.ErrNotFound),
+	)
+
+	txn.EXPECT().Commit(gomock.Any()).Return(nil)
 	txn.EXPECT().HasCommited().Return(true)
 
 	svc := NewCarPool(txnFactory)
@@ -222,14 +251,20 @@ func TestLocate_ReturnsAssignedCar(t *testing.T) {
 
 	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
 	txn := mock_models.NewMockTransaction(ctrl)
+	carsStorage := mock_models.NewMockICarStorage(ctrl)
 	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
 
 	car := &models.Car{ID: 2, Seats: 4, AvailableSeats: 0}
-	journey := &models.Journey{Id: 40, Passengers: 4, AssignedTo: car}
+	journey := &models.Journey{Id: 40, Passengers: 4}
+	journey.AssignCar(car.ID)
 
-	txnFactory.EXPECT().Begin().Return(txn, nil)
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
 	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
-	journeysStorage.EXPECT().FindById(uint(40)).Return(journey, nil)
+	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(40)).Return(journey, nil)
+	carsStorage.EXPECT().FindById(gomock.Any(), uint(2)).Return(car, nil)
+	txn.EXPECT().HasCommited().Return(false)
+	txn.EXPECT().Rollback().Return(nil)
 
 	svc := NewCarPool(txnFactory)
 	got, err := svc.Locate(context.Background(), 40)
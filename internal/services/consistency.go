@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type consistencyMetrics struct {
+	violations *metrics.CounterVec
+	repairs    *metrics.CounterVec
+}
+
+func newConsistencyMetrics(r *metrics.Registry) consistencyMetrics {
+	return consistencyMetrics{
+		violations: r.Counter("carpool_consistency_violations_total", "Broken invariants found by consistency checks.", "kind"),
+		repairs:    r.Counter("carpool_consistency_repairs_total", "Broken invariants fixed by consistency checks.", "kind"),
+	}
+}
+
+// finding is a broken invariant and how to fix it, repair is nil when it
+// needs someone to look at it
+type finding struct {
+	violation models.Violation
+	repair    func(ctx context.Context, txn models.Transaction) error
+}
+
+// CheckConsistency looks for broken invariants between cars, journeys and the
+// pending queue, in a single transaction. With repair set it also fixes the
+// ones it can, taking the journeys as the truth.
+func (cp *CarPool) CheckConsistency(ctx context.Context, repair bool) (report *models.ConsistencyReport, err error) {
+	check := func(ctx context.Context) error {
+		report, err = cp.checkConsistency(ctx, repair)
+		return err
+	}
+	if repair {
+		err = cp.retryOnConflict(ctx, "consistency repair", check)
+	} else {
+		err = cp.attempt(ctx, "consistency check", check)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range report.Violations {
+		cp.consistencyMetrics.violations.Inc(v.Kind)
+		if v.Repaired {
+			cp.consistencyMetrics.repairs.Inc(v.Kind)
+		}
+	}
+	return report, nil
+}
+
+func (cp *CarPool) checkConsistency(ctx context.Context, repair bool) (*models.ConsistencyReport, error) {
+	start := time.Now()
+	requestID := logger.GetRequestID(ctx)
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for consistency check", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+
+	cars := txn.CarsStorage().GetAllCars(ctx)
+	journeys := txn.JourneysStorage().GetAllJourneys(ctx)
+	pending := txn.PendingsStorage().GetAllPendings(ctx)
+	reservations := txn.ReservationsStorage().GetAllReservations(ctx)
+	// the reads above come back empty once ctx is done, which would look consistent
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	findings := findViolations(cars, journeys, pending, reservations)
+
+	if repair && len(findings) > 0 {
+		for _, f := range findings {
+			if f.repair == nil {
+				continue
+			}
+			if err := f.repair(ctx, txn); err != nil {
+				if errors.Is(err, models.ErrConflict) {
+					return nil, err
+				}
+				cp.logger.Error("Failed to repair consistency violation", map[string]interface{}{
+					"kind":       f.violation.Kind,
+					"detail":     f.violation.Detail,
+					"error":      err.Error(),
+					"request_id": requestID,
+				})
+				return nil, models.NewAPIError(500, "Failed to repair consistency violation", err.Error())
+			}
+		}
+
+		if err := txn.Commit(ctx); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return nil, err
+			}
+			cp.logger.Error("Failed to commit consistency repair transaction", map[string]interface{}{
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to commit transaction", err.Error())
+		}
+		repaired := 0
+		for i := range findings {
+			findings[i].violation.Repaired = findings[i].repair != nil
+			if findings[i].violation.Repaired {
+				repaired++
+			}
+		}
+		audit.Describe(ctx, &audit.Summary{ViolationsRepaired: repaired})
+	}
+
+	report := &models.ConsistencyReport{
+		CheckedAt:  cp.clock.Now(),
+		Cars:       len(cars),
+		Journeys:   len(journeys),
+		Pending:    len(pending),
+		Violations: make([]models.Violation, 0, len(findings)),
+	}
+	for _, f := range findings {
+		report.Violations = append(report.Violations, f.violation)
+	}
+
+	cp.logger.Info("Consistency check completed", map[string]interface{}{
+		"violations":  len(report.Violations),
+		"repair":      repair,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+
+	return report, nil
+}
+
+// findViolations compares what the cars, journeys and queue say about each
+// other, journeys first so their repairs run before those relying on them.
+// Reserved seats count as taken.
+func findViolations(cars []*models.Car, journeys []*models.Journey, pending []*models.Journey, reservations []*models.Reservation) []finding {
+	sort.Slice(cars, func(i, j int) bool { return cars[i].ID < cars[j].ID })
+	sort.Slice(journeys, func(i, j int) bool { return journeys[i].Id < journeys[j].Id })
+
+	carsByID := make(map[uint]*models.Car, len(cars))
+	for _, car := range cars {
+		carsByID[car.ID] = car
+	}
+	queued := make(map[uint]int, len(pending))
+	for _, p := range pending {
+		queued[p.Id]++
+	}
+
+	var findings []finding
+	journeysByID := make(map[uint]*models.Journey, len(journeys))
+	taken := make(map[uint]uint)
+	used := make(map[uint]models.Features)
+	// cars with more than one group needing the wheelchair space
+	overbooked := make(map[uint]bool)
+	use := func(carID uint, needs models.Features) {
+		u := used[carID]
+		overbooked[carID] = overbooked[carID] || (u.Wheelchair && needs.Wheelchair)
+		u.Wheelchair = u.Wheelchair || needs.Wheelchair
+		u.ChildSeats += needs.ChildSeats
+		u.Luggage += needs.Luggage
+		used[carID] = u
+	}
+	// reserved seats and features count as taken
+	for _, r := range reservations {
+		taken[r.CarID] += r.Passengers
+		use(r.CarID, r.Features)
+	}
+	for _, journey := range journeys {
+		journeysByID[journey.Id] = journey
+		switch {
+		case !journey.IsAssigned():
+			if queued[journey.Id] == 0 {
+				findings = append(findings, finding{
+					violation: models.Violation{
+						Kind:      models.ViolationNotWaiting,
+						JourneyID: idPtr(journey.Id),
+						Detail:    fmt.Sprintf("journey %d has no car and isn't waiting", journey.Id),
+					},
+					repair: enqueue(journey),
+				})
+			}
+		case carsByID[*journey.CarID] == nil:
+			findings = append(findings, finding{
+				violation: models.Violation{
+					Kind:      models.ViolationMissingCar,
+					JourneyID: idPtr(journey.Id),
+					CarID:     idPtr(*journey.CarID),
+					Detail:    fmt.Sprintf("journey %d rides car %d, which doesn't exist", journey.Id, *journey.CarID),
+				},
+				repair: unassign(journey, queued[journey.Id] > 0),
+			})
+		default:
+			taken[*journey.CarID] += journey.Passengers
+			use(*journey.CarID, journey.Features)
+		}
+	}
+
+	for _, car := range cars {
+		if car.AvailableSeats <= car.Seats && car.Seats-car.AvailableSeats == taken[car.ID] {
+			continue
+		}
+		f := finding{violation: models.Violation{
+			Kind:   models.ViolationSeats,
+			CarID:  idPtr(car.ID),
+			Detail: fmt.Sprintf("car %d has %d of %d seats free but carries or holds %d passengers", car.ID, car.AvailableSeats, car.Seats, taken[car.ID]),
+		}}
+		if taken[car.ID] <= car.Seats {
+			f.repair = setAvailableSeats(car, car.Seats-taken[car.ID])
+		}
+		findings = append(findings, f)
+	}
+	for _, car := range cars {
+		if car.InUse == used[car.ID] && !overbooked[car.ID] {
+			continue
+		}
+		f := finding{violation: models.Violation{
+			Kind:   models.ViolationFeatures,
+			CarID:  idPtr(car.ID),
+			Detail: fmt.Sprintf("car %d has %+v in use but carries groups needing %+v", car.ID, car.InUse, used[car.ID]),
+		}}
+		if !overbooked[car.ID] && car.Features.Covers(used[car.ID]) {
+			f.repair = setFeaturesInUse(car, used[car.ID])
+		}
+		findings = append(findings, f)
+	}
+
+	seen := make(map[uint]bool, len(pending))
+	for _, p := range pending {
+		if seen[p.Id] {
+			continue
+		}
+		seen[p.Id] = true
+
+		journey := journeysByID[p.Id]
+		if journey == nil || (journey.IsAssigned() && carsByID[*journey.CarID] != nil) {
+			findings = append(findings, finding{
+				violation: models.Violation{
+					Kind:      models.ViolationStrayPending,
+					JourneyID: idPtr(p.Id),
+					Detail:    fmt.Sprintf("journey %d is waiting but has a car or doesn't exist", p.Id),
+				},
+				repair: dequeue(p.Id),
+			})
+			continue
+		}
+		if queued[p.Id] > 1 {
+			findings = append(findings, finding{
+				violation: models.Violation{
+					Kind:      models.ViolationDuplicatePending,
+					JourneyID: idPtr(p.Id),
+					Detail:    fmt.Sprintf("journey %d is waiting %d times", p.Id, queued[p.Id]),
+				},
+				repair: requeue(journey),
+			})
+		}
+	}
+
+	return findings
+}
+
+func enqueue(journey *models.Journey) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		return txn.PendingsStorage().NewPending(ctx, journey)
+	}
+}
+
+// unassign takes a journey out of a car that is gone, it waits for another one
+func unassign(journey *models.Journey, waiting bool) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		journey.CarID = nil
+		if err := txn.JourneysStorage().UpdateJourney(ctx, journey.Id, journey, journey.Version); err != nil {
+			return err
+		}
+		if waiting {
+			return nil
+		}
+		return txn.PendingsStorage().NewPending(ctx, journey)
+	}
+}
+
+func setAvailableSeats(car *models.Car, seats uint) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		car.AvailableSeats = seats
+		return txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version)
+	}
+}
+
+func setFeaturesInUse(car *models.Car, features models.Features) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		car.InUse = features
+		return txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version)
+	}
+}
+
+func dequeue(journeyId uint) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		return txn.PendingsStorage().DeleteById(ctx, journeyId)
+	}
+}
+
+// requeue leaves a single entry for a group queued several times, at the end
+// of the queue
+func requeue(journey *models.Journey) func(context.Context, models.Transaction) error {
+	return func(ctx context.Context, txn models.Transaction) error {
+		if err := txn.PendingsStorage().DeleteById(ctx, journey.Id); err != nil {
+			return err
+		}
+		return txn.PendingsStorage().NewPending(ctx, journey)
+	}
+}
+
+func idPtr(id uint) *uint {
+	return &id
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+// corruptFleet breaks every invariant the storages let through on a fleet
+// built by seedFleet
+func corruptFleet(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	txn, err := f.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer handleTxn(txn)
+
+	cars := txn.CarsStorage()
+	car1, _ := cars.FindById(ctx, 1)
+	car1.AvailableSeats = 4
+	car2, _ := cars.FindById(ctx, 2)
+	car2.AvailableSeats = math.MaxUint64
+	lost := &models.Journey{Id: 15, Passengers: 2}
+	lost.AssignCar(9)
+	steps := []error{
+		cars.UpdateCar(ctx, 1, car1, car1.Version),
+		cars.UpdateCar(ctx, 2, car2, car2.Version),
+		txn.JourneysStorage().NewJourney(ctx, lost),
+		txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 16, Passengers: 1}),
+		txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 17, Passengers: 3}),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("corrupting step %d: %v", i, err)
+		}
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+func violationKinds(report *models.ConsistencyReport) []string {
+	kinds := []string{}
+	for _, v := range report.Violations {
+		kinds = append(kinds, v.Kind)
+	}
+	return kinds
+}
+
+func TestCheckConsistency_ReportsWithoutChanging(t *testing.T) {
+	f := inMemory.NewTransactionFactory()
+	seedFleet(t, f)
+
+	svc := NewCarPool(f)
+	report, err := svc.CheckConsistency(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CheckConsistency returned error: %v", err)
+	}
+	if !report.Consistent() || report.Cars != 2 || report.Journeys != 4 || report.Pending != 3 {
+		t.Fatalf("expected a consistent fleet of 2 cars, 4 journeys and 3 waiting, got %+v", report)
+	}
+
+	corruptFleet(t, f)
+	before := readFleet(t, f)
+	report, err = svc.CheckConsistency(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CheckConsistency returned error: %v", err)
+	}
+
+	expected := []string{
+		models.ViolationMissingCar,
+		models.ViolationNotWaiting,
+		models.ViolationSeats,
+		models.ViolationSeats,
+		models.ViolationStrayPending,
+	}
+	if !reflect.DeepEqual(violationKinds(report), expected) {
+		t.Fatalf("expected violations %v, got %+v", expected, report.Violations)
+	}
+	for _, v := range report.Violations {
+		if v.Repaired {
+			t.Fatalf("check without repair repaired %+v", v)
+		}
+	}
+	if after := readFleet(t, f); !reflect.DeepEqual(before, after) {
+		t.Fatalf("the check changed the fleet from\n%+v\nto\n%+v", before, after)
+	}
+}
+
+func TestCheckConsistency_Repairs(t *testing.T) {
+	f := inMemory.NewTransactionFactory()
+	seedFleet(t, f)
+	corruptFleet(t, f)
+
+	registry := metrics.NewRegistry()
+	svc := NewCarPool(f, WithMetrics(registry))
+	report, err := svc.CheckConsistency(context.Background(), true)
+	if err != nil {
+		t.Fatalf("CheckConsistency returned error: %v", err)
+	}
+	for _, v := range report.Violations {
+		if !v.Repaired {
+			t.Fatalf("expected every violation repaired, got %+v", v)
+		}
+	}
+
+	state := readFleet(t, f)
+	checkConsistent(t, state)
+	if !reflect.DeepEqual(state.Pending, []uint{12, 13, 14, 15, 16}) {
+		t.Fatalf("expected journeys 15 and 16 waiting after the others, got %v", state.Pending)
+	}
+
+	report, err = svc.CheckConsistency(context.Background(), false)
+	if err != nil || !report.Consistent() {
+		t.Fatalf("expected a consistent fleet after repairing, got %+v, %v", report, err)
+	}
+	if got := registry.Counter("carpool_consistency_repairs_total", "", "kind").Value(models.ViolationSeats); got != 2 {
+		t.Fatalf("expected 2 seat repairs, got %v", got)
+	}
+}
+
+func TestFindViolations_DuplicatePending(t *testing.T) {
+	journey := &models.Journey{Id: 1, Passengers: 2, Version: 1}
+	findings := findViolations(nil, []*models.Journey{journey}, []*models.Journey{journey, journey}, nil)
+	if len(findings) != 1 || findings[0].violation.Kind != models.ViolationDuplicatePending || findings[0].repair == nil {
+		t.Fatalf("expected a repairable duplicate, got %+v", findings)
+	}
+}
+
+func TestFindViolations_OverbookedCarNeedsAHuman(t *testing.T) {
+	car := &models.Car{ID: 1, Seats: 4, AvailableSeats: 0}
+	a := &models.Journey{Id: 1, Passengers: 3}
+	a.AssignCar(1)
+	b := &models.Journey{Id: 2, Passengers: 3}
+	b.AssignCar(1)
+	findings := findViolations([]*models.Car{car}, []*models.Journey{a, b}, nil, nil)
+	if len(findings) != 1 || findings[0].violation.Kind != models.ViolationSeats || findings[0].repair != nil {
+		t.Fatalf("expected an unrepairable seat mismatch, got %+v", findings)
+	}
+}
+
+func TestFindViolations_FeaturesInUse(t *testing.T) {
+	car := &models.Car{ID: 1, Seats: 6, AvailableSeats: 2, Features: models.Features{Wheelchair: true, Luggage: 4}}
+	a := &models.Journey{Id: 1, Passengers: 2, Features: models.Features{Luggage: 3}}
+	a.AssignCar(1)
+	b := &models.Journey{Id: 2, Passengers: 2, Features: models.Features{Wheelchair: true}}
+	b.AssignCar(1)
+	findings := findViolations([]*models.Car{car}, []*models.Journey{a, b}, nil, nil)
+	if len(findings) != 1 || findings[0].violation.Kind != models.ViolationFeatures || findings[0].repair == nil {
+		t.Fatalf("expected a repairable features mismatch, got %+v", findings)
+	}
+
+	// two groups can't share the wheelchair space
+	car.InUse = models.Features{Wheelchair: true, Luggage: 3}
+	b.Passengers = 1
+	c := &models.Journey{Id: 3, Passengers: 1, Features: models.Features{Wheelchair: true}}
+	c.AssignCar(1)
+	findings = findViolations([]*models.Car{car}, []*models.Journey{a, b, c}, nil, nil)
+	if len(findings) != 1 || findings[0].violation.Kind != models.ViolationFeatures || findings[0].repair != nil {
+		t.Fatalf("expected an unrepairable features mismatch, got %+v", findings)
+	}
+}
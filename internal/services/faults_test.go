@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/faulty"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/kv"
+)
+
+// faultBackends are the real storages the fault tests run against
+var faultBackends = []struct {
+	name string
+	open func(t *testing.T) models.TransactionFactory
+}{
+	{"memory", func(t *testing.T) models.TransactionFactory {
+		return inMemory.NewTransactionFactory()
+	}},
+	{"kv", func(t *testing.T) models.TransactionFactory {
+		f, err := kv.Open(filepath.Join(t.TempDir(), "carpool.db"))
+		if err != nil {
+			t.Fatalf("opening kv storage: %v", err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}},
+}
+
+// faultOperations each run one service call on a fleet built by seedFleet
+var faultOperations = []struct {
+	name string
+	run  func(ctx context.Context, svc *CarPool) error
+}{
+	{"reset cars", func(ctx context.Context, svc *CarPool) error {
+		return svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 3, Seats: 6, AvailableSeats: 6}})
+	}},
+	{"new journey assigned", func(ctx context.Context, svc *CarPool) error {
+		return svc.NewJourney(ctx, &models.Journey{Id: 20, Passengers: 1})
+	}},
+	{"new journey pending", func(ctx context.Context, svc *CarPool) error {
+		return svc.NewJourney(ctx, &models.Journey{Id: 21, Passengers: 3})
+	}},
+	{"dropoff assigned", func(ctx context.Context, svc *CarPool) error {
+		_, err := svc.Dropoff(ctx, 10)
+		return err
+	}},
+	{"dropoff pending", func(ctx context.Context, svc *CarPool) error {
+		_, err := svc.Dropoff(ctx, 12)
+		return err
+	}},
+	{"reassign", func(ctx context.Context, svc *CarPool) error {
+		return svc.Reassign(ctx, &models.Car{ID: 2})
+	}},
+	{"locate", func(ctx context.Context, svc *CarPool) error {
+		_, err := svc.Locate(ctx, 10)
+		return err
+	}},
+}
+
+// seedFleet leaves car 1 with a free seat, car 2 empty after a dropoff that
+// wasn't followed by a reassignment, and three groups waiting
+func seedFleet(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	svc := NewCarPool(f)
+	steps := []func() error{
+		func() error {
+			return svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 2, Seats: 4, AvailableSeats: 4}})
+		},
+		func() error { return svc.NewJourney(ctx, &models.Journey{Id: 10, Passengers: 3}) },
+		func() error { return svc.NewJourney(ctx, &models.Journey{Id: 11, Passengers: 4}) },
+		func() error { return svc.NewJourney(ctx, &models.Journey{Id: 12, Passengers: 2}) },
+		func() error { return svc.NewJourney(ctx, &models.Journey{Id: 13, Passengers: 5}) },
+		func() error { return svc.NewJourney(ctx, &models.Journey{Id: 14, Passengers: 2}) },
+		func() error { _, err := svc.Dropoff(ctx, 11); return err },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("seeding step %d: %v", i, err)
+		}
+	}
+}
+
+// fleetState is everything stored about the journeys the tests use
+type fleetState struct {
+	Cars     []models.Car
+	Journeys map[uint]models.Journey
+	Pending  []uint
+}
+
+func readFleet(t *testing.T, f models.TransactionFactory) fleetState {
+	t.Helper()
+	ctx := context.Background()
+	txn, err := f.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer txn.Rollback()
+
+	state := fleetState{Journeys: map[uint]models.Journey{}}
+	for _, car := range txn.CarsStorage().GetAllCars(ctx) {
+		state.Cars = append(state.Cars, *car)
+	}
+	sort.Slice(state.Cars, func(i, j int) bool { return state.Cars[i].ID < state.Cars[j].ID })
+	for id := uint(10); id < 30; id++ {
+		journey, err := txn.JourneysStorage().FindById(ctx, id)
+		if err == models.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("finding journey %d: %v", id, err)
+		}
+		state.Journeys[id] = *journey
+	}
+	for _, p := range txn.PendingsStorage().GetAllPendings(ctx) {
+		state.Pending = append(state.Pending, p.Id)
+	}
+	return state
+}
+
+// checkConsistent fails unless the seats taken in every car add up to the
+// groups riding it, and exactly the unassigned groups are waiting
+func checkConsistent(t *testing.T, state fleetState) {
+	t.Helper()
+	taken := map[uint]uint{}
+	for id, journey := range state.Journeys {
+		if journey.IsAssigned() {
+			taken[*journey.CarID] += journey.Passengers
+		} else if !containsID(state.Pending, id) {
+			t.Errorf("journey %d has no car and isn't waiting", id)
+		}
+	}
+
+	cars := map[uint]bool{}
+	for _, car := range state.Cars {
+		cars[car.ID] = true
+		if car.AvailableSeats > car.Seats || car.Seats-car.AvailableSeats != taken[car.ID] {
+			t.Errorf("car %d has %d of %d seats free but carries %d passengers", car.ID, car.AvailableSeats, car.Seats, taken[car.ID])
+		}
+	}
+	for carID := range taken {
+		if !cars[carID] {
+			t.Errorf("journeys ride car %d, which doesn't exist", carID)
+		}
+	}
+
+	seen := map[uint]bool{}
+	for _, id := range state.Pending {
+		journey, ok := state.Journeys[id]
+		if !ok || journey.IsAssigned() || seen[id] {
+			t.Errorf("journey %d shouldn't be waiting", id)
+		}
+		seen[id] = true
+	}
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Every call an operation makes to the storage fails in turn, and each time
+// the operation must fail leaving the fleet the way it found it
+func TestFaults_EveryFailureLeavesStateUntouched(t *testing.T) {
+	for _, backend := range faultBackends {
+		for _, op := range faultOperations {
+			backend, op := backend, op
+			t.Run(backend.name+"/"+op.name, func(t *testing.T) {
+				for nth := 1; ; nth++ {
+					inner := backend.open(t)
+					seedFleet(t, inner)
+					before := readFleet(t, inner)
+					checkConsistent(t, before)
+
+					f := faulty.New(inner, []faulty.Rule{{Method: "*", Nth: nth, Err: faulty.ErrInjected}})
+					err := op.run(context.Background(), NewCarPool(f))
+					after := readFleet(t, inner)
+					checkConsistent(t, after)
+
+					if f.Injected() == 0 {
+						// past the last storage call, the operation went through
+						if err != nil {
+							t.Fatalf("operation failed without faults: %v", err)
+						}
+						if nth == 1 {
+							t.Fatal("operation made no storage calls")
+						}
+						return
+					}
+					if err == nil {
+						t.Fatalf("storage call %d failed but the operation succeeded", nth)
+					}
+					if !reflect.DeepEqual(before, after) {
+						t.Fatalf("storage call %d failed and the fleet changed from\n%+v\nto\n%+v", nth, before, after)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFaults_ConflictsAreRetried(t *testing.T) {
+	for _, backend := range faultBackends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			inner := backend.open(t)
+			seedFleet(t, inner)
+
+			f := faulty.New(inner, []faulty.Rule{
+				{Method: "Cars.UpdateCar", Nth: 1, Err: models.ErrConflict},
+				{Method: "Commit", Nth: 1, Err: models.ErrConflict},
+			})
+			svc := NewCarPool(f, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+			if err := svc.Reassign(context.Background(), &models.Car{ID: 2}); err != nil {
+				t.Fatalf("Reassign returned error: %v", err)
+			}
+			if f.Injected() != 2 {
+				t.Fatalf("expected 2 injected conflicts, got %d", f.Injected())
+			}
+
+			state := readFleet(t, inner)
+			checkConsistent(t, state)
+			if !reflect.DeepEqual(state.Pending, []uint{13}) {
+				t.Fatalf("expected only journey 13 waiting, got %v", state.Pending)
+			}
+		})
+	}
+}
+
+func TestFaults_SlowStorageTimesOut(t *testing.T) {
+	for _, backend := range faultBackends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			inner := backend.open(t)
+			seedFleet(t, inner)
+			before := readFleet(t, inner)
+
+			f := faulty.New(inner, []faulty.Rule{{Method: "Pendings.DeleteById", Latency: time.Minute}})
+			svc := NewCarPool(f, WithTxnTimeout(20*time.Millisecond))
+			_, err := svc.Dropoff(context.Background(), 12)
+			if !errors.Is(err, models.ErrTimeout) {
+				t.Fatalf("expected ErrTimeout, got %v", err)
+			}
+			if after := readFleet(t, inner); !reflect.DeepEqual(before, after) {
+				t.Fatalf("the fleet changed from\n%+v\nto\n%+v", before, after)
+			}
+		})
+	}
+}
+
+func TestFaults_ConflictingCommitLeavesNoEvents(t *testing.T) {
+	ctx := context.Background()
+	inner := inMemory.NewTransactionFactory()
+	store := events.NewMemoryStore()
+	// the reset commits, the first attempt of the journey conflicts
+	f := faulty.New(inner, []faulty.Rule{{Method: "Commit", Nth: 2, Err: models.ErrConflict}})
+	svc := NewCarPool(f, WithEventStore(store), WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 10, Passengers: 2}); err != nil {
+		t.Fatalf("NewJourney returned error: %v", err)
+	}
+	if f.Injected() != 1 {
+		t.Fatalf("expected 1 injected conflict, got %d", f.Injected())
+	}
+
+	logged, err := store.Load(0)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	var types []events.Type
+	for _, e := range logged {
+		types = append(types, e.Type)
+	}
+	if want := []events.Type{events.FleetReset, events.JourneyRequested, events.JourneyAssigned}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+
+	rebuilt := inMemory.NewTransactionFactory()
+	if err := events.Rebuild(ctx, rebuilt, logged); err != nil {
+		t.Fatalf("Rebuild returned error: %v", err)
+	}
+	live, replayed := readFleet(t, inner), readFleet(t, rebuilt)
+	if len(replayed.Cars) != 1 || replayed.Cars[0].AvailableSeats != live.Cars[0].AvailableSeats {
+		t.Fatalf("the rebuilt fleet %+v differs from the live one %+v", replayed.Cars, live.Cars)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestFeatures_OnlyCompatibleCarsAreMatched(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCarPool(inMemory.NewTransactionFactory())
+	adapted := models.Features{Wheelchair: true, ChildSeats: 2, Luggage: 3}
+	if err := svc.ResetCars(ctx, []*models.Car{
+		{ID: 1, Seats: 4, AvailableSeats: 4},
+		{ID: 2, Seats: 6, AvailableSeats: 6, Features: adapted},
+	}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	request := func(id, passengers uint, needs models.Features) error {
+		return svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: passengers, Features: needs})
+	}
+	expectCar := func(id, carId uint) {
+		t.Helper()
+		car, err := svc.Locate(ctx, id)
+		if err != nil || (carId == 0) != (car == nil) || (car != nil && car.ID != carId) {
+			t.Fatalf("expected journey %d in car %d, got %v, %v", id, carId, car, err)
+		}
+	}
+
+	// no car has room for its luggage, it waits flagged
+	if err := request(9, 2, models.Features{Luggage: 4}); err != nil {
+		t.Fatalf("NewJourney(9) returned error: %v", err)
+	}
+	if unservable, err := svc.Unservable(ctx); err != nil || len(unservable) != 1 || unservable[0].Id != 9 {
+		t.Fatalf("expected journey 9 listed as unservable, got %v, %v", unservable, err)
+	}
+	if err := request(10, 2, models.Features{ChildSeats: 3}); err != models.ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput for more child seats than passengers, got %v", err)
+	}
+
+	steps := []struct {
+		id, passengers uint
+		needs          models.Features
+		car            uint
+	}{
+		// best fit alone would pick car 1
+		{1, 2, models.Features{Wheelchair: true}, 2},
+		{2, 4, models.Features{}, 1},
+		// car 2 has the seats but its wheelchair space is taken
+		{3, 2, models.Features{Wheelchair: true}, 0},
+		{4, 2, models.Features{Luggage: 1}, 2},
+		{5, 2, models.Features{}, 2},
+		{6, 2, models.Features{}, 0},
+	}
+	for _, s := range steps {
+		if err := request(s.id, s.passengers, s.needs); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", s.id, err)
+		}
+		expectCar(s.id, s.car)
+	}
+
+	release := func(id uint) {
+		t.Helper()
+		car, err := svc.Dropoff(ctx, id)
+		if err != nil {
+			t.Fatalf("Dropoff(%d) returned error: %v", id, err)
+		}
+		if err := svc.Reassign(ctx, car); err != nil {
+			t.Fatalf("Reassign returned error: %v", err)
+		}
+	}
+	// the freed seats skip the older wheelchair group the car can't take
+	release(4)
+	expectCar(6, 2)
+	expectCar(3, 0)
+	release(1)
+	expectCar(3, 2)
+
+	_, err := svc.MergeCars(ctx, []*models.Car{{ID: 1, Seats: 4}, {ID: 2, Seats: 6, Features: models.Features{ChildSeats: 2}}}, true)
+	if apiErr, ok := err.(*models.APIError); !ok || apiErr.Code != models.ErrFeaturesInUse.Code {
+		t.Fatalf("expected merging away the wheelchair space in use to be refused, got %v", err)
+	}
+	plan, err := svc.MergeCars(ctx, []*models.Car{{ID: 1, Seats: 4}, {ID: 2, Seats: 6, Features: models.Features{Wheelchair: true}}}, false)
+	if err != nil || len(plan.Resized) != 1 {
+		t.Fatalf("expected car 2 refitted, got %+v, %v", plan, err)
+	}
+	if report, err := svc.CheckConsistency(ctx, false); err != nil || !report.Consistent() {
+		t.Fatalf("expected a consistent fleet, got %+v, %v", report, err)
+	}
+
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4, Features: models.Features{ChildSeats: 5}}}); err != models.ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput for more child seats than seats, got %v", err)
+	}
+}
+
+// scanCounter counts the reads of the whole queue made in its transactions
+type scanCounter struct {
+	models.TransactionFactory
+	scans int
+}
+
+func (f *scanCounter) Begin(ctx context.Context) (models.Transaction, error) {
+	txn, err := f.TransactionFactory.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scanCountingTxn{Transaction: txn, f: f}, nil
+}
+
+type scanCountingTxn struct {
+	models.Transaction
+	f *scanCounter
+}
+
+func (txn scanCountingTxn) PendingsStorage() models.IPenidngStorage {
+	return scanCountingPendings{IPenidngStorage: txn.Transaction.PendingsStorage(), f: txn.f}
+}
+
+type scanCountingPendings struct {
+	models.IPenidngStorage
+	f *scanCounter
+}
+
+func (p scanCountingPendings) GetAllPendings(ctx context.Context) []*models.Journey {
+	p.f.scans++
+	return p.IPenidngStorage.GetAllPendings(ctx)
+}
+
+func TestFeatures_BlockedHeadDoesNotScanTheQueue(t *testing.T) {
+	ctx := context.Background()
+	factory := &scanCounter{TransactionFactory: inMemory.NewTransactionFactory()}
+	svc := NewCarPool(factory)
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 4}); err != nil {
+		t.Fatalf("NewJourney(1) returned error: %v", err)
+	}
+	// the wheelchair groups head the queue, no car of the fleet takes them
+	for id := uint(2); id <= 30; id++ {
+		if err := svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: 2, Features: models.Features{Wheelchair: true}}); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", id, err)
+		}
+	}
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 31, Passengers: 2}); err != nil {
+		t.Fatalf("NewJourney(31) returned error: %v", err)
+	}
+
+	factory.scans = 0
+	car, err := svc.Dropoff(ctx, 1)
+	if err != nil {
+		t.Fatalf("Dropoff(1) returned error: %v", err)
+	}
+	if err := svc.Reassign(ctx, car); err != nil {
+		t.Fatalf("Reassign returned error: %v", err)
+	}
+	if located, err := svc.Locate(ctx, 31); err != nil || located == nil || located.ID != 1 {
+		t.Fatalf("expected journey 31 in car 1, got %v, %v", located, err)
+	}
+	if factory.scans != 0 {
+		t.Fatalf("expected no read of the whole queue, got %d", factory.scans)
+	}
+}
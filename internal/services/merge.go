@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/audit"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// MergeCars reconciles the fleet with a new list of cars without dropping
+// any journey, in a single transaction. Cars in both keep their groups, and
+// may change seats as long as those still fit. Cars left out go draining:
+// they take no new groups and are removed once the last one drops off, right
+// away when empty. The waiting groups are then seated in the merged fleet,
+// and the ones it could never carry dropped or flagged along with the
+// scheduled ones.
+// A dry run works out the same plan and stores nothing.
+func (cp *CarPool) MergeCars(ctx context.Context, cars []*models.Car, dryRun bool) (plan *models.MergePlan, err error) {
+	err = cp.retryOnConflict(ctx, "merge cars", func(ctx context.Context) error {
+		plan, err = cp.mergeCars(ctx, cars, dryRun)
+		return err
+	})
+	return plan, err
+}
+
+func (cp *CarPool) mergeCars(ctx context.Context, cars []*models.Car, dryRun bool) (*models.MergePlan, error) {
+	start := time.Now()
+	requestID := logger.GetRequestID(ctx)
+
+	cp.logger.Info("Starting car merge", map[string]interface{}{
+		"car_count":  len(cars),
+		"dry_run":    dryRun,
+		"request_id": requestID,
+	})
+
+	seenIDs := make(map[uint]bool)
+	for _, car := range cars {
+		if car.Seats < cp.minSeats || car.Seats > cp.maxSeats {
+			cp.logger.Error("Invalid car seats", map[string]interface{}{
+				"car_id":     car.ID,
+				"seats":      car.Seats,
+				"request_id": requestID,
+			})
+			return nil, models.ErrInvalidSeats
+		}
+		// every child seat takes a seat
+		if car.ChildSeats > car.Seats {
+			cp.logger.Error("Car has more child seats than seats", map[string]interface{}{
+				"car_id":      car.ID,
+				"child_seats": car.ChildSeats,
+				"request_id":  requestID,
+			})
+			return nil, models.ErrInvalidInput
+		}
+		if seenIDs[car.ID] {
+			cp.logger.Error("Duplicate car ID in request", map[string]interface{}{
+				"car_id":     car.ID,
+				"request_id": requestID,
+			})
+			return nil, models.ErrDuplicatedID
+		}
+		seenIDs[car.ID] = true
+	}
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for car merge", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	existing := make(map[uint]*models.Car)
+	for _, car := range txn.CarsStorage().GetAllCars(ctx) {
+		existing[car.ID] = car
+	}
+	// an empty read once ctx is done would look like an empty fleet
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &models.MergePlan{
+		DryRun:   dryRun,
+		Added:    []uint{},
+		Resized:  []uint{},
+		Restored: []uint{},
+		Draining: []uint{},
+		Removed:  []uint{},
+		Assigned: []models.Assignment{},
+	}
+	var merged events.FleetMergedData
+
+	for _, car := range cars {
+		old, exists := existing[car.ID]
+		if !exists {
+			added := models.Car{ID: car.ID, Seats: car.Seats, AvailableSeats: car.Seats, Features: car.Features}
+			if err := txn.CarsStorage().NewCar(ctx, &added); err != nil {
+				cp.logger.Error("Failed to create car", map[string]interface{}{
+					"car_id":     car.ID,
+					"error":      err.Error(),
+					"request_id": requestID,
+				})
+				return nil, models.NewAPIError(500, "Failed to create car", err.Error())
+			}
+			plan.Added = append(plan.Added, car.ID)
+			merged.Cars = append(merged.Cars, added)
+			continue
+		}
+		if old.Seats == car.Seats && old.Features == car.Features && !old.Draining {
+			continue
+		}
+
+		taken := old.Seats - old.AvailableSeats
+		if taken > car.Seats {
+			cp.logger.Warn("Car has more passengers riding than its new seats", map[string]interface{}{
+				"car_id":     car.ID,
+				"seats":      car.Seats,
+				"taken":      taken,
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(models.ErrSeatsBelowOccupancy.Code, models.ErrSeatsBelowOccupancy.Message,
+				fmt.Sprintf("car %d carries %d passengers, more than %d seats", car.ID, taken, car.Seats))
+		}
+		if !car.Features.Covers(old.InUse) {
+			cp.logger.Warn("Car has features in use it would no longer offer", map[string]interface{}{
+				"car_id":     car.ID,
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(models.ErrFeaturesInUse.Code, models.ErrFeaturesInUse.Message,
+				fmt.Sprintf("car %d carries groups using %+v", car.ID, old.InUse))
+		}
+		if old.Seats != car.Seats || old.Features != car.Features {
+			plan.Resized = append(plan.Resized, car.ID)
+		}
+		if old.Draining {
+			plan.Restored = append(plan.Restored, car.ID)
+		}
+		updated := *old
+		updated.Seats, updated.AvailableSeats, updated.Draining, updated.Features = car.Seats, car.Seats-taken, false, car.Features
+		if err := txn.CarsStorage().UpdateCar(ctx, updated.ID, &updated, updated.Version); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return nil, err
+			}
+			cp.logger.Error("Failed to update merged car", map[string]interface{}{
+				"car_id":     car.ID,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to update car", err.Error())
+		}
+		merged.Cars = append(merged.Cars, updated)
+	}
+
+	for id, old := range existing {
+		if seenIDs[id] {
+			continue
+		}
+		if old.AvailableSeats == old.Seats {
+			if err := txn.CarsStorage().DeleteById(ctx, id); err != nil {
+				cp.logger.Error("Failed to remove car", map[string]interface{}{
+					"car_id":     id,
+					"error":      err.Error(),
+					"request_id": requestID,
+				})
+				return nil, models.NewAPIError(500, "Failed to remove car", err.Error())
+			}
+			plan.Removed = append(plan.Removed, id)
+			continue
+		}
+		plan.Draining = append(plan.Draining, id)
+		if old.Draining {
+			continue
+		}
+		old.Draining = true
+		if err := txn.CarsStorage().UpdateCar(ctx, id, old, old.Version); err != nil {
+			if errors.Is(err, models.ErrConflict) {
+				return nil, err
+			}
+			cp.logger.Error("Failed to drain car", map[string]interface{}{
+				"car_id":     id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to update car", err.Error())
+		}
+	}
+	for _, ids := range [][]uint{plan.Added, plan.Resized, plan.Restored, plan.Draining, plan.Removed} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	merged.Draining, merged.Removed = plan.Draining, plan.Removed
+	rec.Emit(events.FleetMerged, merged)
+
+	// the waiting groups get the merged fleet in the order cars serve them,
+	// as if they had just asked for a car
+	pending := txn.PendingsStorage().GetAllPendings(ctx)
+	cp.byPriority(pending)
+	for _, p := range pending {
+		car, err := cp.pickCar(ctx, txn, p.Passengers, p.Features)
+		if err == models.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			cp.logger.Error("Error looking for a car", map[string]interface{}{
+				"journey_id": p.Id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to look for a car", err.Error())
+		}
+		if err := cp.seatPending(ctx, txn, rec, car, p); err != nil {
+			return nil, err
+		}
+		plan.Assigned = append(plan.Assigned, models.Assignment{JourneyID: p.Id, CarID: car.ID})
+	}
+	if plan.Unservable, err = cp.sweepUnservable(ctx, txn, rec); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		cp.logger.Info("Car merge planned", map[string]interface{}{
+			"added":       len(plan.Added),
+			"draining":    len(plan.Draining),
+			"removed":     len(plan.Removed),
+			"assigned":    len(plan.Assigned),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"request_id":  requestID,
+		})
+		return plan, nil
+	}
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode car merge events", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, err
+		}
+		cp.logger.Error("Failed to commit car merge transaction", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to commit transaction", err.Error())
+	}
+	rec.Publish()
+	removed := append(append([]uint{}, plan.Draining...), plan.Removed...)
+	sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+	audit.Describe(ctx, &audit.Summary{CarsAdded: plan.Added, CarsRemoved: removed, CarsChanged: plan.Resized})
+
+	cp.logger.Info("Car merge completed successfully", map[string]interface{}{
+		"added":       len(plan.Added),
+		"draining":    len(plan.Draining),
+		"removed":     len(plan.Removed),
+		"assigned":    len(plan.Assigned),
+		"unservable":  len(plan.Unservable),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+
+	return plan, nil
+}
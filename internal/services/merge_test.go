@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestMergeCars_KeepsJourneys(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithSeatLimits(1, 6))
+	if err := svc.ResetCars(ctx, []*models.Car{
+		{ID: 1, Seats: 4, AvailableSeats: 4},
+		{ID: 2, Seats: 4, AvailableSeats: 4},
+		{ID: 3, Seats: 4, AvailableSeats: 4},
+	}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+	for id, passengers := range map[uint]uint{1: 3, 2: 4, 3: 6} {
+		if err := svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: passengers}); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", id, err)
+		}
+	}
+	car1, _ := svc.Locate(ctx, 1)
+	car2, _ := svc.Locate(ctx, 2)
+
+	// no car can shrink below its riders
+	_, err := svc.MergeCars(ctx, []*models.Car{{ID: car2.ID, Seats: 3}}, false)
+	if apiErr, ok := err.(*models.APIError); !ok || apiErr.Code != models.ErrSeatsBelowOccupancy.Code {
+		t.Fatalf("expected ErrSeatsBelowOccupancy, got %v", err)
+	}
+
+	fleet := []*models.Car{{ID: car1.ID, Seats: 5}, {ID: 4, Seats: 6}}
+	dry, err := svc.MergeCars(ctx, fleet, true)
+	if err != nil {
+		t.Fatalf("dry run returned error: %v", err)
+	}
+	if car, _ := svc.Locate(ctx, 3); car != nil {
+		t.Fatalf("a dry run seated journey 3 in car %d", car.ID)
+	}
+
+	plan, err := svc.MergeCars(ctx, fleet, false)
+	if err != nil {
+		t.Fatalf("MergeCars returned error: %v", err)
+	}
+	plan.DryRun = true
+	if !reflect.DeepEqual(dry, plan) {
+		t.Fatalf("dry run planned %+v, the merge did %+v", dry, plan)
+	}
+	empty := 6 - car1.ID - car2.ID
+	want := &models.MergePlan{
+		DryRun:     true,
+		Added:      []uint{4},
+		Resized:    []uint{car1.ID},
+		Restored:   []uint{},
+		Draining:   []uint{car2.ID},
+		Removed:    []uint{empty},
+		Assigned:   []models.Assignment{{JourneyID: 3, CarID: 4}},
+		Unservable: []uint{},
+	}
+	if !reflect.DeepEqual(want, plan) {
+		t.Fatalf("expected plan %+v, got %+v", want, plan)
+	}
+
+	if car, err := svc.Locate(ctx, 1); err != nil || car.ID != car1.ID || car.AvailableSeats != 2 {
+		t.Fatalf("journey 1 should ride car %d with 2 seats left, got %+v, %v", car1.ID, car, err)
+	}
+
+	// the draining car takes no new groups, and is gone once emptied
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 5, Passengers: 1}); err != nil {
+		t.Fatalf("NewJourney returned error: %v", err)
+	}
+	if car, _ := svc.Locate(ctx, 5); car == nil || car.ID == car2.ID {
+		t.Fatalf("journey 5 should ride a car other than the draining one, got %+v", car)
+	}
+	car, err := svc.Dropoff(ctx, 2)
+	if err != nil {
+		t.Fatalf("Dropoff returned error: %v", err)
+	}
+	if err := svc.Reassign(ctx, car); err != nil {
+		t.Fatalf("Reassign returned error: %v", err)
+	}
+	txn, _ := svc.transactionFactory.Begin(ctx)
+	defer txn.Rollback()
+	if _, err := txn.CarsStorage().FindById(ctx, car2.ID); err != models.ErrNotFound {
+		t.Fatalf("expected the drained car to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// DefaultAgingStep is how long a waiting group takes to climb one priority
+// class when no WithAging option is given
+const DefaultAgingStep = 2 * time.Minute
+
+// WithAging makes a waiting group count as one class higher for every step it
+// has waited, so standard groups are not starved by a steady flow of higher
+// ones. A step of 0 serves the classes in strict order.
+func WithAging(step time.Duration) Option {
+	return func(cp *CarPool) {
+		cp.agingStep = step
+	}
+}
+
+type priorityMetrics struct {
+	wait *metrics.HistogramVec
+}
+
+func newPriorityMetrics(r *metrics.Registry) priorityMetrics {
+	return priorityMetrics{
+		wait: r.Histogram("carpool_journey_wait_seconds", "Time groups waited in the queue before getting a car.",
+			[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}, "class"),
+	}
+}
+
+// observeWait records how long every committed assignment waited, the ones
+// seated on arrival count as no wait at all
+func (m priorityMetrics) observeWait(e events.Event) {
+	if e.Type != events.JourneyAssigned {
+		return
+	}
+	var data events.JourneyAssignedData
+	if err := e.Decode(&data); err != nil {
+		return
+	}
+	m.wait.Observe(float64(data.WaitMs)/1000, data.Class.Name())
+}
+
+// nextPending returns the waiting group car serves next, or ErrNotFound. The
+// oldest fitting group is the best standard candidate, so only the higher
+// classes need a look of their own. The storage skips the groups needing
+// what the car lacks, walking only the queues of the sizes it seats.
+func (cp *CarPool) nextPending(ctx context.Context, txn models.Transaction, car *models.Car) (*models.Journey, error) {
+	seats, free := car.AvailableSeats, car.FreeFeatures()
+	oldest, err := txn.PendingsStorage().NextFitting(ctx, seats, free)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*models.Journey{oldest}
+	for _, class := range models.PriorityClasses {
+		if class.Rank() <= 0 {
+			continue
+		}
+		p, err := txn.PendingsStorage().NextFittingOfClass(ctx, seats, free, class)
+		if err == models.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, p)
+	}
+
+	now := cp.clock.Now()
+	var best *models.Journey
+	for _, p := range candidates {
+		if best == nil || cp.servesFirst(p, best, now) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+
+	if best.Class.Rank() > 0 {
+		cp.logger.Debug("Serving a higher class first", map[string]interface{}{
+			"journey_id": best.Id,
+			"class":      best.Class.Name(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+	}
+	return best, nil
+}
+
+// byPriority orders waiting groups the way cars serve them
+func (cp *CarPool) byPriority(pending []*models.Journey) {
+	now := cp.clock.Now()
+	sort.SliceStable(pending, func(i, j int) bool {
+		return cp.servesFirst(pending[i], pending[j], now)
+	})
+}
+
+// servesFirst tells whether the waiting group p goes before other: the
+// higher class after aging, then the one who asked first
+func (cp *CarPool) servesFirst(p, other *models.Journey, now time.Time) bool {
+	if a, b := cp.priority(p, now), cp.priority(other, now); a != b {
+		return a > b
+	}
+	if !p.RequestedAt.Equal(other.RequestedAt) {
+		return p.RequestedAt.Before(other.RequestedAt)
+	}
+	return p.Id < other.Id
+}
+
+func (cp *CarPool) priority(p *models.Journey, now time.Time) int {
+	rank := p.Class.Rank()
+	if cp.agingStep > 0 && !p.RequestedAt.IsZero() && now.After(p.RequestedAt) {
+		rank += int(now.Sub(p.RequestedAt) / cp.agingStep)
+	}
+	return rank
+}
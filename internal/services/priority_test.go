@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestPriority_ServesHigherClassesFirstWithAging(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	registry := metrics.NewRegistry()
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clk), WithMetrics(registry), WithAging(2*time.Minute))
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	request := func(id, passengers uint, class models.PriorityClass) {
+		t.Helper()
+		if err := svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: passengers, Class: class}); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", id, err)
+		}
+	}
+	release := func(id uint) {
+		t.Helper()
+		car, err := svc.Dropoff(ctx, id)
+		if err != nil {
+			t.Fatalf("Dropoff(%d) returned error: %v", id, err)
+		}
+		if err := svc.Reassign(ctx, car); err != nil {
+			t.Fatalf("Reassign returned error: %v", err)
+		}
+	}
+	expectRiding := func(id uint, riding bool) {
+		t.Helper()
+		car, err := svc.Locate(ctx, id)
+		if err != nil || (car != nil) != riding {
+			t.Fatalf("expected journey %d riding=%v, got %v, %v", id, riding, car, err)
+		}
+	}
+
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 9, Passengers: 1, Class: "vip"}); err != models.ErrUnknownClass {
+		t.Fatalf("expected ErrUnknownClass, got %v", err)
+	}
+
+	request(1, 4, models.ClassStandard)
+	request(2, 2, models.ClassStandard)
+	clk.Advance(time.Minute)
+	request(3, 2, models.ClassPriority)
+	request(4, 2, models.ClassAccessibility)
+
+	// the standard group asked first but hasn't waited a whole step yet
+	clk.Advance(30 * time.Second)
+	release(1)
+	expectRiding(4, true)
+	expectRiding(3, true)
+	expectRiding(2, false)
+
+	// after five more minutes the standard group aged past the new priority one
+	request(5, 2, models.ClassPriority)
+	clk.Advance(5 * time.Minute)
+	release(4)
+	expectRiding(2, true)
+	expectRiding(5, false)
+
+	wait := registry.Histogram("carpool_journey_wait_seconds", "", nil, "class")
+	for _, tc := range []struct {
+		class string
+		count uint64
+		sum   float64
+	}{
+		{"standard", 2, 390},
+		{"priority", 1, 30},
+		{"accessibility", 1, 30},
+	} {
+		if count, sum := wait.Count(tc.class), wait.Sum(tc.class); count != tc.count || sum != tc.sum {
+			t.Fatalf("expected %d %s waits adding up to %vs, got %d adding up to %vs", tc.count, tc.class, tc.sum, count, sum)
+		}
+	}
+}
+
+func TestPriority_StrictWithoutAging(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC))
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clk), WithAging(0))
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	for _, j := range []*models.Journey{
+		{Id: 1, Passengers: 4},
+		{Id: 2, Passengers: 4},
+	} {
+		if err := svc.NewJourney(ctx, j); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", j.Id, err)
+		}
+	}
+	clk.Advance(time.Hour)
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 3, Passengers: 4, Class: models.ClassPriority}); err != nil {
+		t.Fatalf("NewJourney(3) returned error: %v", err)
+	}
+
+	car, err := svc.Dropoff(ctx, 1)
+	if err != nil {
+		t.Fatalf("Dropoff returned error: %v", err)
+	}
+	if err := svc.Reassign(ctx, car); err != nil {
+		t.Fatalf("Reassign returned error: %v", err)
+	}
+	if car, err := svc.Locate(ctx, 3); err != nil || car == nil {
+		t.Fatalf("expected the priority group seated, got %v, %v", car, err)
+	}
+	if car, err := svc.Locate(ctx, 2); err != nil || car != nil {
+		t.Fatalf("expected the standard group still waiting, got %v, %v", car, err)
+	}
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// DefaultMaxReservation is how long seats may be held at most, unless
+// configured otherwise
+const DefaultMaxReservation = time.Hour
+
+// Reserve holds seats for a group on its way until the reservation expires,
+// on the car it names or, without one, on the car the strategy picks. The
+// seats and features needed count as taken from now on, the reservation gets
+// the car it holds.
+func (cp *CarPool) Reserve(ctx context.Context, reservation *models.Reservation) error {
+	carId := reservation.CarID
+	return cp.retryOnConflict(ctx, "reserve", func(ctx context.Context) error {
+		// a conflicting attempt may have picked a car already
+		reservation.CarID = carId
+		return cp.reserve(ctx, reservation)
+	})
+}
+
+func (cp *CarPool) reserve(ctx context.Context, reservation *models.Reservation) error {
+	requestID := logger.GetRequestID(ctx)
+
+	cp.logger.Info("Reserving seats", map[string]interface{}{
+		"journey_id": reservation.JourneyID,
+		"car_id":     reservation.CarID,
+		"passengers": reservation.Passengers,
+		"expires_at": reservation.ExpiresAt,
+		"request_id": requestID,
+	})
+
+	if reservation.Passengers == 0 || reservation.ChildSeats > reservation.Passengers {
+		return models.ErrInvalidInput
+	}
+	if !reservation.Class.IsValid() {
+		return models.ErrUnknownClass
+	}
+	now := cp.clock.Now()
+	if reservation.IsExpired(now) {
+		return models.ErrExpiryInPast
+	}
+	if cp.maxReservation > 0 && reservation.ExpiresAt.After(now.Add(cp.maxReservation)) {
+		return models.ErrExpiryTooFar
+	}
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for reservation", map[string]interface{}{
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	if err := cp.checkNewId(ctx, txn, reservation.JourneyID); err != nil {
+		return err
+	}
+
+	var car *models.Car
+	if reservation.CarID != 0 {
+		car, err = txn.CarsStorage().FindById(ctx, reservation.CarID)
+		if err == nil && (car.Draining || car.AvailableSeats < reservation.Passengers || !car.FreeFeatures().Covers(reservation.Features)) {
+			err = models.ErrNoSeatsToReserve
+		}
+	} else {
+		car, err = cp.pickCar(ctx, txn, reservation.Passengers, reservation.Features)
+		if err == models.ErrNotFound {
+			err = models.ErrNoSeatsToReserve
+		}
+	}
+	if err != nil {
+		if err == models.ErrNotFound || err == models.ErrNoSeatsToReserve {
+			cp.logger.Warn("No seats to reserve", map[string]interface{}{
+				"journey_id": reservation.JourneyID,
+				"car_id":     reservation.CarID,
+				"passengers": reservation.Passengers,
+				"request_id": requestID,
+			})
+			return err
+		}
+		cp.logger.Error("Error looking for a car to reserve", map[string]interface{}{
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to look for a car", err.Error())
+	}
+
+	if err := car.TakeSeats(reservation.Passengers); err != nil {
+		return models.ErrConflict
+	}
+	if err := car.TakeFeatures(reservation.Features); err != nil {
+		return models.ErrConflict
+	}
+	if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to update car for reservation", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to update car", err.Error())
+	}
+
+	reservation.CarID = car.ID
+	if err := txn.ReservationsStorage().NewReservation(ctx, reservation); err != nil {
+		cp.logger.Error("Failed to create reservation", map[string]interface{}{
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to create reservation", err.Error())
+	}
+	rec.Emit(events.SeatsReserved, events.SeatsReservedData{
+		JourneyID:  reservation.JourneyID,
+		CarID:      car.ID,
+		Passengers: reservation.Passengers,
+		Owner:      reservation.Owner,
+		ExpiresAt:  reservation.ExpiresAt,
+		Class:      reservation.Class,
+		Features:   reservation.Features,
+	})
+
+	return cp.commitBooking(ctx, txn, rec, reservation.JourneyID)
+}
+
+// ConfirmReservation turns the reservation into a journey riding the car it
+// held, once the group shows up before it expires. The journey is requested
+// when confirmed, with the class and features reserved.
+func (cp *CarPool) ConfirmReservation(ctx context.Context, journeyId uint) (car *models.Car, err error) {
+	err = cp.retryOnConflict(ctx, "confirm reservation", func(ctx context.Context) error {
+		car, err = cp.confirmReservation(ctx, journeyId)
+		return err
+	})
+	return car, err
+}
+
+func (cp *CarPool) confirmReservation(ctx context.Context, journeyId uint) (*models.Car, error) {
+	requestID := logger.GetRequestID(ctx)
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for confirmation", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	reservation, err := txn.ReservationsStorage().FindById(ctx, journeyId)
+	if err != nil {
+		cp.logger.Error("Reservation not found", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, err
+	}
+	// the seats go back on the next release run, not in a refused request
+	if reservation.IsExpired(cp.clock.Now()) {
+		return nil, models.ErrReservationExpired
+	}
+
+	car, err := txn.CarsStorage().FindById(ctx, reservation.CarID)
+	if err != nil {
+		cp.logger.Error("Failed to find the reserved car", map[string]interface{}{
+			"car_id":     reservation.CarID,
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to find car", err.Error())
+	}
+	// the seats are taken already, writing the car back as is conflicts with
+	// a release of the same seats running alongside
+	if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, err
+		}
+		cp.logger.Error("Failed to update reserved car", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to update car", err.Error())
+	}
+
+	if err := txn.ReservationsStorage().DeleteById(ctx, journeyId); err != nil {
+		cp.logger.Error("Failed to delete confirmed reservation", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to confirm reservation", err.Error())
+	}
+	journey := &models.Journey{
+		Id:          journeyId,
+		Passengers:  reservation.Passengers,
+		Class:       reservation.Class,
+		Features:    reservation.Features,
+		RequestedAt: cp.clock.Now(),
+		Owner:       reservation.Owner,
+	}
+	journey.AssignCar(car.ID)
+	if err := txn.JourneysStorage().NewJourney(ctx, journey); err != nil {
+		cp.logger.Error("Failed to create journey from reservation", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to create journey", err.Error())
+	}
+	rec.Emit(events.ReservationConfirmed, events.ReservationConfirmedData{
+		JourneyID:  journeyId,
+		CarID:      car.ID,
+		Passengers: reservation.Passengers,
+		Class:      reservation.Class,
+	})
+
+	if err := cp.commitBooking(ctx, txn, rec, journeyId); err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// CancelReservation gives the seats held back before the reservation expires.
+// It returns the car they went back to, nil when it was draining and is gone,
+// so that waiting groups can be seated in it.
+func (cp *CarPool) CancelReservation(ctx context.Context, journeyId uint) (car *models.Car, err error) {
+	err = cp.retryOnConflict(ctx, "cancel reservation", func(ctx context.Context) error {
+		car, err = cp.cancelReservation(ctx, journeyId)
+		return err
+	})
+	return car, err
+}
+
+func (cp *CarPool) cancelReservation(ctx context.Context, journeyId uint) (*models.Car, error) {
+	requestID := logger.GetRequestID(ctx)
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for reservation cancel", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	reservation, err := txn.ReservationsStorage().FindById(ctx, journeyId)
+	if err != nil {
+		cp.logger.Error("Reservation not found", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, err
+	}
+	car, err := cp.releaseReservation(ctx, txn, rec, reservation, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cp.commitBooking(ctx, txn, rec, journeyId); err != nil {
+		return nil, err
+	}
+	return car, nil
+}
+
+// Reservations returns every reservation, earliest expiry first
+func (cp *CarPool) Reservations(ctx context.Context) (reservations []*models.Reservation, err error) {
+	err = cp.attempt(ctx, "list reservations", func(ctx context.Context) error {
+		txn, err := cp.transactionFactory.Begin(ctx)
+		if err != nil {
+			return models.NewAPIError(500, "Failed to begin transaction", err.Error())
+		}
+		defer handleTxn(txn)
+		reservations = txn.ReservationsStorage().GetAllReservations(ctx)
+		return ctx.Err()
+	})
+	return reservations, err
+}
+
+// ReleaseExpired gives back the seats of every expired reservation and seats
+// waiting groups in them, in a single transaction. It returns how many
+// reservations expired.
+func (cp *CarPool) ReleaseExpired(ctx context.Context) (released int, err error) {
+	err = cp.retryOnConflict(ctx, "release reservations", func(ctx context.Context) error {
+		released, err = cp.releaseExpired(ctx)
+		return err
+	})
+	return released, err
+}
+
+func (cp *CarPool) releaseExpired(ctx context.Context) (int, error) {
+	start := time.Now()
+	requestID := logger.GetRequestID(ctx)
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for reservation release", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	expired := txn.ReservationsStorage().Expired(ctx, cp.clock.Now())
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	// a car is filled once all its seats are back, after the last release
+	freed := make(map[uint]*models.Car)
+	var order []uint
+	for _, reservation := range expired {
+		car, err := cp.releaseReservation(ctx, txn, rec, reservation, true)
+		if err != nil {
+			return 0, err
+		}
+		if _, seen := freed[reservation.CarID]; !seen {
+			order = append(order, reservation.CarID)
+		}
+		freed[reservation.CarID] = car
+	}
+	for _, id := range order {
+		if car := freed[id]; car != nil && !car.Draining {
+			if err := cp.fillCar(ctx, txn, rec, car); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode reservation release events", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return 0, err
+		}
+		cp.logger.Error("Failed to commit reservation release transaction", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to commit transaction", err.Error())
+	}
+	rec.Publish()
+
+	cp.logger.Info("Expired reservations released", map[string]interface{}{
+		"released":    len(expired),
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+	return len(expired), nil
+}
+
+// releaseReservation deletes the reservation and gives its seats and features
+// back to the car, removing the car when it was draining and is left empty. It returns
+// the car with its seats back, nil when removed.
+func (cp *CarPool) releaseReservation(ctx context.Context, txn models.Transaction, rec *events.Recorder, reservation *models.Reservation, expired bool) (*models.Car, error) {
+	requestID := logger.GetRequestID(ctx)
+
+	if err := txn.ReservationsStorage().DeleteById(ctx, reservation.JourneyID); err != nil {
+		cp.logger.Error("Failed to delete reservation", map[string]interface{}{
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to delete reservation", err.Error())
+	}
+
+	car, err := txn.CarsStorage().FindById(ctx, reservation.CarID)
+	if err != nil {
+		cp.logger.Error("Failed to find the reserved car", map[string]interface{}{
+			"car_id":     reservation.CarID,
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to find car", err.Error())
+	}
+	if err := car.FreeUpSeats(reservation.Passengers); err != nil {
+		cp.logger.Error("Car has fewer seats taken than the reservation holds", map[string]interface{}{
+			"car_id":          car.ID,
+			"journey_id":      reservation.JourneyID,
+			"available_seats": car.AvailableSeats,
+			"request_id":      requestID,
+		})
+		return nil, err
+	}
+	if err := car.FreeUpFeatures(reservation.Features); err != nil {
+		cp.logger.Error("Car has fewer features in use than the reservation holds", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": reservation.JourneyID,
+			"request_id": requestID,
+		})
+		return nil, err
+	}
+	rec.Emit(events.ReservationReleased, events.ReservationReleasedData{
+		JourneyID:  reservation.JourneyID,
+		CarID:      car.ID,
+		Passengers: reservation.Passengers,
+		Expired:    expired,
+	})
+
+	if car.Draining && car.AvailableSeats == car.Seats {
+		if err := txn.CarsStorage().DeleteById(ctx, car.ID); err != nil {
+			cp.logger.Error("Failed to remove drained car", map[string]interface{}{
+				"car_id":     car.ID,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return nil, models.NewAPIError(500, "Failed to remove car", err.Error())
+		}
+		return nil, nil
+	}
+	if err := txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return nil, err
+		}
+		cp.logger.Error("Failed to update car after releasing seats", map[string]interface{}{
+			"car_id":     car.ID,
+			"journey_id": reservation.JourneyID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return nil, models.NewAPIError(500, "Failed to update car", err.Error())
+	}
+
+	cp.logger.Info("Reserved seats released", map[string]interface{}{
+		"car_id":     car.ID,
+		"journey_id": reservation.JourneyID,
+		"passengers": reservation.Passengers,
+		"expired":    expired,
+		"request_id": requestID,
+	})
+	return car, nil
+}
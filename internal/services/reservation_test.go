@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestReservations_HoldSeatsUntilConfirmedOrExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clk))
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 2, Seats: 6, AvailableSeats: 6}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	reserve := func(id, carId, passengers uint, ttl time.Duration) (*models.Reservation, error) {
+		r := &models.Reservation{JourneyID: id, CarID: carId, Passengers: passengers, ExpiresAt: now.Add(ttl)}
+		return r, svc.Reserve(ctx, r)
+	}
+
+	if _, err := reserve(1, 0, 2, -time.Minute); err != models.ErrExpiryInPast {
+		t.Fatalf("expected ErrExpiryInPast, got %v", err)
+	}
+	if _, err := reserve(1, 9, 2, time.Minute); err != models.ErrNotFound {
+		t.Fatalf("expected ErrNotFound for an unknown car, got %v", err)
+	}
+	if _, err := reserve(1, 1, 5, time.Minute); err != models.ErrNoSeatsToReserve {
+		t.Fatalf("expected ErrNoSeatsToReserve, got %v", err)
+	}
+	// best fit for 4 is car 1, reserving 2 of car 2 leaves it 4 seats
+	r1, err := reserve(1, 0, 4, 10*time.Minute)
+	if err != nil || r1.CarID != 1 {
+		t.Fatalf("expected journey 1 to hold car 1, got %+v, %v", r1, err)
+	}
+	if _, err := reserve(2, 2, 2, time.Minute); err != nil {
+		t.Fatalf("Reserve(2) returned error: %v", err)
+	}
+	if _, err := reserve(2, 0, 1, time.Minute); err != models.ErrDuplicatedID {
+		t.Fatalf("expected ErrDuplicatedID for a reserved id, got %v", err)
+	}
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 2, Passengers: 1}); err != models.ErrDuplicatedID {
+		t.Fatalf("expected NewJourney to refuse a reserved id, got %v", err)
+	}
+	if car, err := svc.Locate(ctx, 2); err != nil || car != nil {
+		t.Fatalf("expected reserved journey to locate as waiting, got %v, %v", car, err)
+	}
+
+	// the held seats are gone for new groups
+	waiting := &models.Journey{Id: 3, Passengers: 5}
+	if err := svc.NewJourney(ctx, waiting); err != nil || waiting.IsAssigned() {
+		t.Fatalf("expected journey 3 to wait, got %+v, %v", waiting, err)
+	}
+
+	car, err := svc.ConfirmReservation(ctx, 1)
+	if err != nil || car.ID != 1 {
+		t.Fatalf("expected journey 1 confirmed in car 1, got %v, %v", car, err)
+	}
+	if car, err := svc.Locate(ctx, 1); err != nil || car == nil || car.ID != 1 {
+		t.Fatalf("expected journey 1 riding car 1, got %v, %v", car, err)
+	}
+
+	clk.Advance(5 * time.Minute)
+	if _, err := svc.ConfirmReservation(ctx, 2); err != models.ErrReservationExpired {
+		t.Fatalf("expected ErrReservationExpired, got %v", err)
+	}
+	if n, err := svc.ReleaseExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 released, got %d, %v", n, err)
+	}
+	if car, err := svc.Locate(ctx, 3); err != nil || car == nil || car.ID != 2 {
+		t.Fatalf("expected journey 3 seated in the released car, got %v, %v", car, err)
+	}
+	if _, err := svc.ConfirmReservation(ctx, 2); err != models.ErrNotFound {
+		t.Fatalf("expected released reservation to be gone, got %v", err)
+	}
+
+	if _, err := reserve(4, 1, 0, time.Hour); err != models.ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+	if _, err := reserve(4, 2, 1, time.Hour); err != nil {
+		t.Fatalf("Reserve(4) returned error: %v", err)
+	}
+	car, err = svc.CancelReservation(ctx, 4)
+	if err != nil || car.ID != 2 || car.AvailableSeats != 1 {
+		t.Fatalf("expected the seat back in car 2, got %+v, %v", car, err)
+	}
+	if reservations, err := svc.Reservations(ctx); err != nil || len(reservations) != 0 {
+		t.Fatalf("expected no reservations left, got %v, %v", reservations, err)
+	}
+}
+
+func TestReservations_HoldTheFeaturesAndClassOfTheGroup(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	factory := inMemory.NewTransactionFactory()
+	svc := NewCarPool(factory, WithClock(clk), WithMaxReservation(30*time.Minute))
+	if err := svc.ResetCars(ctx, []*models.Car{
+		{ID: 1, Seats: 4, AvailableSeats: 4},
+		{ID: 2, Seats: 6, AvailableSeats: 6, Features: models.Features{Wheelchair: true}},
+	}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	reserve := func(id, carId uint, class models.PriorityClass, needs models.Features, ttl time.Duration) (*models.Reservation, error) {
+		r := &models.Reservation{JourneyID: id, CarID: carId, Passengers: 2, ExpiresAt: now.Add(ttl), Class: class, Features: needs}
+		return r, svc.Reserve(ctx, r)
+	}
+	wheelchair := models.Features{Wheelchair: true}
+
+	if _, err := reserve(1, 0, "", models.Features{}, time.Hour); err != models.ErrExpiryTooFar {
+		t.Fatalf("expected ErrExpiryTooFar, got %v", err)
+	}
+	if _, err := reserve(1, 0, "vip", models.Features{}, time.Minute); err != models.ErrUnknownClass {
+		t.Fatalf("expected ErrUnknownClass, got %v", err)
+	}
+	if _, err := reserve(1, 0, "", models.Features{ChildSeats: 3}, time.Minute); err != models.ErrInvalidInput {
+		t.Fatalf("expected ErrInvalidInput for more child seats than passengers, got %v", err)
+	}
+	if _, err := reserve(1, 1, "", wheelchair, time.Minute); err != models.ErrNoSeatsToReserve {
+		t.Fatalf("expected ErrNoSeatsToReserve on a car without wheelchair space, got %v", err)
+	}
+	// best fit alone would pick car 1
+	r, err := reserve(1, 0, models.ClassAccessibility, wheelchair, 10*time.Minute)
+	if err != nil || r.CarID != 2 {
+		t.Fatalf("expected journey 1 to hold car 2, got %+v, %v", r, err)
+	}
+	if _, err := reserve(2, 2, "", wheelchair, time.Minute); err != models.ErrNoSeatsToReserve {
+		t.Fatalf("expected ErrNoSeatsToReserve on held wheelchair space, got %v", err)
+	}
+	waiting := &models.Journey{Id: 3, Passengers: 2, Features: wheelchair}
+	if err := svc.NewJourney(ctx, waiting); err != nil || waiting.IsAssigned() {
+		t.Fatalf("expected journey 3 to wait for the wheelchair space, got %+v, %v", waiting, err)
+	}
+	if report, err := svc.CheckConsistency(ctx, false); err != nil || !report.Consistent() {
+		t.Fatalf("expected no violations, got %+v, %v", report, err)
+	}
+
+	clk.Advance(5 * time.Minute)
+	if _, err := svc.ConfirmReservation(ctx, 1); err != nil {
+		t.Fatalf("ConfirmReservation returned error: %v", err)
+	}
+	txn, err := factory.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin returned error: %v", err)
+	}
+	journey, err := txn.JourneysStorage().FindById(ctx, 1)
+	txn.Rollback()
+	if err != nil {
+		t.Fatalf("FindById returned error: %v", err)
+	}
+	if journey.Class != models.ClassAccessibility || !journey.Wheelchair || !journey.RequestedAt.Equal(clk.Now()) {
+		t.Fatalf("expected the journey to keep the reservation's class and features, got %+v", journey)
+	}
+
+	car, err := svc.Dropoff(ctx, 1)
+	if err != nil {
+		t.Fatalf("Dropoff returned error: %v", err)
+	}
+	if err := svc.Reassign(ctx, car); err != nil {
+		t.Fatalf("Reassign returned error: %v", err)
+	}
+	if car, err := svc.Locate(ctx, 3); err != nil || car == nil || car.ID != 2 {
+		t.Fatalf("expected journey 3 to get the wheelchair space back, got %v, %v", car, err)
+	}
+	if _, err := reserve(4, 0, "", models.Features{}, 10*time.Minute); err != nil {
+		t.Fatalf("Reserve(4) returned error: %v", err)
+	}
+	if car, err := svc.CancelReservation(ctx, 4); err != nil || car.ID != 1 || car.AvailableSeats != 4 {
+		t.Fatalf("expected the seats back in car 1, got %+v, %v", car, err)
+	}
+}
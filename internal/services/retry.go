@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// RetryPolicy bounds how many times an operation runs while it keeps
+// conflicting with concurrent ones, and how long it waits in between
+type RetryPolicy struct {
+	MaxAttempts int
+	// BaseBackoff is the longest first wait, it doubles on every attempt up to
+	// MaxBackoff and the actual wait is a random fraction of it
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseBackoff: 5 * time.Millisecond,
+		MaxBackoff:  200 * time.Millisecond,
+	}
+}
+
+// backoff returns how long to wait after the given failed attempt, with full
+// jitter so replicas that conflicted together don't retry together
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseBackoff <= 0 {
+		return 0
+	}
+	ceiling := p.MaxBackoff
+	if shift := uint(attempt - 1); shift < 32 && p.BaseBackoff<<shift < ceiling {
+		ceiling = p.BaseBackoff << shift
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+type retryMetrics struct {
+	attempts  *metrics.CounterVec
+	conflicts *metrics.CounterVec
+	exhausted *metrics.CounterVec
+}
+
+func newRetryMetrics(r *metrics.Registry) retryMetrics {
+	return retryMetrics{
+		attempts:  r.Counter("carpool_operation_attempts_total", "Times an operation ran, retries included.", "operation"),
+		conflicts: r.Counter("carpool_conflicts_total", "Attempts that failed on a concurrent update.", "operation"),
+		exhausted: r.Counter("carpool_conflicts_exhausted_total", "Operations that gave up after conflicting on every attempt.", "operation"),
+	}
+}
+
+// retryOnConflict runs fn again, in a new transaction, when it fails because
+// of a concurrent change: a stale version on a storage update, or a backend
+// with optimistic transactions rejecting the commit
+func (cp *CarPool) retryOnConflict(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; attempt <= cp.retryPolicy.MaxAttempts; attempt++ {
+		cp.retryMetrics.attempts.Inc(operation)
+		if err = cp.attempt(ctx, operation, fn); !errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.retryMetrics.conflicts.Inc(operation)
+
+		wait := cp.retryPolicy.backoff(attempt)
+		cp.logger.Warn("Operation conflicted with a concurrent one", map[string]interface{}{
+			"operation":  operation,
+			"attempt":    attempt,
+			"error":      err.Error(),
+			"backoff_ms": wait.Milliseconds(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+		if attempt == cp.retryPolicy.MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return interrupted(ctx.Err())
+		}
+	}
+
+	cp.retryMetrics.exhausted.Inc(operation)
+	return models.NewAPIError(http.StatusConflict, models.ErrConflict.Message, err.Error())
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	mock_models "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/mocks"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+func TestNewJourney_RetriesStaleVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
+	txn := mock_models.NewMockTransaction(ctrl)
+	carsStorage := mock_models.NewMockICarStorage(ctrl)
+	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	scheduledStorage := mock_models.NewMockIScheduledStorage(ctrl)
+	reservationsStorage := mock_models.NewMockIReservationStorage(ctrl)
+
+	journey := &models.Journey{Id: 10, Passengers: 2}
+
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil).Times(2)
+	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().ScheduledStorage().Return(scheduledStorage).AnyTimes()
+	txn.EXPECT().ReservationsStorage().Return(reservationsStorage).AnyTimes()
+	scheduledStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	reservationsStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(10)).Return(nil, models.ErrNotFound).Times(2)
+
+	// the first attempt read the car right before someone else took a seat
+	gomock.InOrder(
+		carsStorage.EXPECT().FindBestFit(gomock.Any(), uint(2)).Return(&models.Car{ID: 1, Seats: 4, AvailableSeats: 4, Version: 1}, nil),
+		carsStorage.EXPECT().UpdateCar(gomock.Any(), uint(1), gomock.Any(), uint64(1)).Return(models.NewConflictError("car", 1, 1, 2)),
+		txn.EXPECT().HasCommited().Return(false),
+		txn.EXPECT().Rollback().Return(nil),
+		carsStorage.EXPECT().FindBestFit(gomock.Any(), uint(2)).Return(&models.Car{ID: 1, Seats: 4, AvailableSeats: 3, Version: 2}, nil),
+		carsStorage.EXPECT().UpdateCar(gomock.Any(), uint(1), gomock.Any(), uint64(2)).Return(nil),
+		journeysStorage.EXPECT().NewJourney(gomock.Any(), journey).Return(nil),
+		txn.EXPECT().Commit(gomock.Any()).Return(nil),
+		txn.EXPECT().HasCommited().Return(true),
+	)
+
+	registry := metrics.NewRegistry()
+	svc := NewCarPool(txnFactory, WithMetrics(registry), WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	if err := svc.NewJourney(context.Background(), journey); err != nil {
+		t.Fatalf("NewJourney returned error: %v", err)
+	}
+
+	if got := registry.Counter("carpool_operation_attempts_total", "", "operation").Value("new journey"); got != 2 {
+		t.Fatalf("expected 2 attempts, got %v", got)
+	}
+	if got := registry.Counter("carpool_conflicts_total", "", "operation").Value("new journey"); got != 1 {
+		t.Fatalf("expected 1 conflict, got %v", got)
+	}
+}
+
+func TestDropoff_GivesUpAfterMaxAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
+	txn := mock_models.NewMockTransaction(ctrl)
+	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	pendingsStorage := mock_models.NewMockIPenidngStorage(ctrl)
+
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil).Times(3)
+	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().PendingsStorage().Return(pendingsStorage).AnyTimes()
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(20)).Return(&models.Journey{Id: 20, Passengers: 2}, nil).Times(3)
+	journeysStorage.EXPECT().DeleteById(gomock.Any(), uint(20)).Return(nil).Times(3)
+	pendingsStorage.EXPECT().DeleteById(gomock.Any(), uint(20)).Return(nil).Times(3)
+	txn.EXPECT().Commit(gomock.Any()).Return(models.ErrConflict).Times(3)
+	txn.EXPECT().HasCommited().Return(false).Times(3)
+	txn.EXPECT().Rollback().Return(nil).Times(3)
+
+	registry := metrics.NewRegistry()
+	svc := NewCarPool(txnFactory, WithMetrics(registry), WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	_, err := svc.Dropoff(context.Background(), 20)
+
+	apiErr, ok := err.(*models.APIError)
+	if !ok || apiErr.HTTPStatus() != http.StatusConflict {
+		t.Fatalf("expected a 409 APIError, got %v", err)
+	}
+	if got := registry.Counter("carpool_conflicts_exhausted_total", "", "operation").Value("dropoff"); got != 1 {
+		t.Fatalf("expected 1 exhausted dropoff, got %v", got)
+	}
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/metrics"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type scheduleMetrics struct {
+	promoted *metrics.CounterVec
+}
+
+func newScheduleMetrics(r *metrics.Registry) scheduleMetrics {
+	return scheduleMetrics{
+		promoted: r.Counter("carpool_scheduled_promoted_total", "Scheduled journeys moved into the pending flow.", "outcome"),
+	}
+}
+
+// scheduleJourney books the group for its pickup time, refusing ids already
+// in use and owners with as many groups waiting as allowed
+func (cp *CarPool) scheduleJourney(ctx context.Context, journey *models.Journey) error {
+	requestID := logger.GetRequestID(ctx)
+
+	cp.logger.Info("Scheduling journey", map[string]interface{}{
+		"journey_id": journey.Id,
+		"passengers": journey.Passengers,
+		"pickup_at":  journey.PickupAt,
+		"request_id": requestID,
+	})
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for scheduling", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	if err := cp.checkNewId(ctx, txn, journey.Id); err != nil {
+		return err
+	}
+	if err := cp.checkServable(ctx, txn, journey); err != nil {
+		return err
+	}
+	if err := cp.checkOwnerLimit(ctx, txn, journey); err != nil {
+		return err
+	}
+
+	if err := txn.ScheduledStorage().NewScheduled(ctx, journey); err != nil {
+		cp.logger.Error("Failed to create scheduled journey", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to schedule journey", err.Error())
+	}
+	rec.Emit(events.JourneyScheduled, events.JourneyScheduledData{
+		JourneyID:  journey.Id,
+		Passengers: journey.Passengers,
+		Owner:      journey.Owner,
+		Class:      journey.Class,
+		Features:   journey.Features,
+		PickupAt:   *journey.PickupAt,
+	})
+
+	return cp.commitBooking(ctx, txn, rec, journey.Id)
+}
+
+// checkNewId refuses a journey id riding, waiting or held ahead already, for
+// the bookings that don't replace journeys the way NewJourney does
+func (cp *CarPool) checkNewId(ctx context.Context, txn models.Transaction, journeyId uint) error {
+	_, err := txn.JourneysStorage().FindById(ctx, journeyId)
+	if err == nil {
+		cp.logger.Warn("Journey id already in use", map[string]interface{}{
+			"journey_id": journeyId,
+			"request_id": logger.GetRequestID(ctx),
+		})
+		return models.ErrDuplicatedID
+	}
+	if err != models.ErrNotFound {
+		cp.logger.Error("Error checking existing journey", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+		return models.NewAPIError(500, "Failed to check existing journey", err.Error())
+	}
+	return cp.checkHeldAhead(ctx, txn, journeyId)
+}
+
+// Reschedule moves the pickup of a scheduled journey, which must not be
+// promoted yet. A time within the lead time gets it promoted on the next run.
+func (cp *CarPool) Reschedule(ctx context.Context, journeyId uint, pickupAt time.Time) error {
+	return cp.retryOnConflict(ctx, "reschedule journey", func(ctx context.Context) error {
+		return cp.reschedule(ctx, journeyId, pickupAt)
+	})
+}
+
+func (cp *CarPool) reschedule(ctx context.Context, journeyId uint, pickupAt time.Time) error {
+	requestID := logger.GetRequestID(ctx)
+
+	if !pickupAt.After(cp.clock.Now()) {
+		cp.logger.Warn("Pickup time already gone", map[string]interface{}{
+			"journey_id": journeyId,
+			"pickup_at":  pickupAt,
+			"request_id": requestID,
+		})
+		return models.ErrPickupInPast
+	}
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for rescheduling", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	journey, err := txn.ScheduledStorage().FindById(ctx, journeyId)
+	if err != nil {
+		cp.logger.Error("Scheduled journey not found", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return err
+	}
+
+	journey.PickupAt = &pickupAt
+	if err := txn.ScheduledStorage().UpdateScheduled(ctx, journey.Id, journey, journey.Version); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to update scheduled journey", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to reschedule journey", err.Error())
+	}
+	rec.Emit(events.JourneyRescheduled, events.JourneyRescheduledData{
+		JourneyID: journey.Id,
+		PickupAt:  pickupAt,
+	})
+
+	return cp.commitBooking(ctx, txn, rec, journeyId)
+}
+
+// cancelScheduled drops a journey that was never promoted, for Dropoff
+func (cp *CarPool) cancelScheduled(ctx context.Context, txn models.Transaction, rec *events.Recorder, journey *models.Journey) error {
+	if err := txn.ScheduledStorage().DeleteById(ctx, journey.Id); err != nil {
+		cp.logger.Error("Failed to delete scheduled journey", map[string]interface{}{
+			"journey_id": journey.Id,
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+		return models.NewAPIError(500, "Failed to cancel journey", err.Error())
+	}
+	rec.Emit(events.JourneyCanceled, events.JourneyCanceledData{JourneyID: journey.Id})
+
+	return cp.commitBooking(ctx, txn, rec, journey.Id)
+}
+
+// commitBooking stores the events of a change to one journey booked ahead,
+// scheduled or reserved, and commits it
+func (cp *CarPool) commitBooking(ctx context.Context, txn models.Transaction, rec *events.Recorder, journeyId uint) error {
+	requestID := logger.GetRequestID(ctx)
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode booking events", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return err
+		}
+		cp.logger.Error("Failed to commit booking transaction", map[string]interface{}{
+			"journey_id": journeyId,
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return models.NewAPIError(500, "Failed to commit transaction", err.Error())
+	}
+	rec.Publish()
+	return nil
+}
+
+// PromoteDue moves the scheduled journeys whose pickup is within the lead
+// time into the pending flow, earliest first, seating them right away when a
+// car fits. It returns how many were promoted.
+func (cp *CarPool) PromoteDue(ctx context.Context) (promoted int, err error) {
+	err = cp.retryOnConflict(ctx, "promote scheduled", func(ctx context.Context) error {
+		promoted, err = cp.promoteDue(ctx)
+		return err
+	})
+	return promoted, err
+}
+
+func (cp *CarPool) promoteDue(ctx context.Context) (int, error) {
+	start := time.Now()
+	requestID := logger.GetRequestID(ctx)
+
+	txn, err := cp.transactionFactory.Begin(ctx)
+	if err != nil {
+		cp.logger.Error("Failed to begin transaction for promotion", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to begin transaction", err.Error())
+	}
+	defer handleTxn(txn)
+	rec := cp.recorder(ctx)
+
+	due := txn.ScheduledStorage().Due(ctx, cp.clock.Now().Add(cp.scheduleLeadTime))
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	assigned := 0
+	for _, journey := range due {
+		if err := txn.ScheduledStorage().DeleteById(ctx, journey.Id); err != nil {
+			cp.logger.Error("Failed to remove promoted journey", map[string]interface{}{
+				"journey_id": journey.Id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return 0, models.NewAPIError(500, "Failed to remove scheduled journey", err.Error())
+		}
+		journey.PickupAt = nil
+		if err := cp.placeJourney(ctx, txn, rec, journey, false); err != nil {
+			return 0, err
+		}
+		if journey.IsAssigned() {
+			assigned++
+		}
+	}
+
+	if err := rec.Err(); err != nil {
+		cp.logger.Error("Failed to encode promotion events", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to encode events", err.Error())
+	}
+
+	if err := cp.commit(ctx, txn, rec); err != nil {
+		if errors.Is(err, models.ErrConflict) {
+			return 0, err
+		}
+		cp.logger.Error("Failed to commit promotion transaction", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+		return 0, models.NewAPIError(500, "Failed to commit transaction", err.Error())
+	}
+	rec.Publish()
+
+	cp.scheduleMetrics.promoted.Add(float64(assigned), "assigned")
+	cp.scheduleMetrics.promoted.Add(float64(len(due)-assigned), "queued")
+	cp.logger.Info("Scheduled journeys promoted", map[string]interface{}{
+		"promoted":    len(due),
+		"assigned":    assigned,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"request_id":  requestID,
+	})
+	return len(due), nil
+}
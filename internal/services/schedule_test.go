@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestScheduledJourneys_PromotedAtLeadTime(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clk), WithScheduleLeadTime(5*time.Minute))
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	at := func(d time.Duration) *time.Time {
+		pickup := now.Add(d)
+		return &pickup
+	}
+	// a pickup within the lead time is a ride right away
+	soon := &models.Journey{Id: 1, Passengers: 1, PickupAt: at(time.Minute)}
+	if err := svc.NewJourney(ctx, soon); err != nil {
+		t.Fatalf("NewJourney(1) returned error: %v", err)
+	}
+	if soon.IsScheduled() || !soon.IsAssigned() {
+		t.Fatalf("expected journey 1 to ride now, got %+v", soon)
+	}
+
+	for id, d := range map[uint]time.Duration{2: time.Hour, 3: 30 * time.Minute, 4: 2 * time.Hour} {
+		journey := &models.Journey{Id: id, Passengers: 3, PickupAt: at(d)}
+		if err := svc.NewJourney(ctx, journey); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", id, err)
+		}
+		if !journey.IsScheduled() {
+			t.Fatalf("expected journey %d to be scheduled", id)
+		}
+	}
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 3, Passengers: 1}); err != models.ErrDuplicatedID {
+		t.Fatalf("expected ErrDuplicatedID for a scheduled id, got %v", err)
+	}
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 1, PickupAt: at(time.Hour)}); err != models.ErrDuplicatedID {
+		t.Fatalf("expected ErrDuplicatedID for a riding id, got %v", err)
+	}
+	if car, err := svc.Locate(ctx, 2); err != nil || car != nil {
+		t.Fatalf("expected scheduled journey to locate as waiting, got %v, %v", car, err)
+	}
+
+	if err := svc.Reschedule(ctx, 2, now.Add(-time.Minute)); err != models.ErrPickupInPast {
+		t.Fatalf("expected ErrPickupInPast, got %v", err)
+	}
+	if err := svc.Reschedule(ctx, 9, now.Add(time.Hour)); err != models.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := svc.Reschedule(ctx, 2, now.Add(20*time.Minute)); err != nil {
+		t.Fatalf("Reschedule returned error: %v", err)
+	}
+	// canceling goes through the dropoff
+	if car, err := svc.Dropoff(ctx, 4); err != nil || car != nil {
+		t.Fatalf("expected scheduled journey to be canceled, got %v, %v", car, err)
+	}
+	if _, err := svc.Locate(ctx, 4); err != models.ErrNotFound {
+		t.Fatalf("expected canceled journey to be gone, got %v", err)
+	}
+
+	if n, err := svc.PromoteDue(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing due yet, got %d, %v", n, err)
+	}
+
+	// journey 2 now goes before 3, and only one of them fits the car
+	clk.Advance(25 * time.Minute)
+	if n, err := svc.PromoteDue(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 promoted, got %d, %v", n, err)
+	}
+	if car, err := svc.Locate(ctx, 2); err != nil || car == nil || car.ID != 1 {
+		t.Fatalf("expected journey 2 in car 1, got %v, %v", car, err)
+	}
+	if car, err := svc.Locate(ctx, 3); err != nil || car != nil {
+		t.Fatalf("expected journey 3 to wait, got %v, %v", car, err)
+	}
+	if err := svc.Reschedule(ctx, 3, now.Add(3*time.Hour)); err != models.ErrNotFound {
+		t.Fatalf("expected promoted journey not to reschedule, got %v", err)
+	}
+	if got := svc.metrics.Counter("carpool_scheduled_promoted_total", "", "outcome").Value("queued"); got != 1 {
+		t.Fatalf("expected 1 queued promotion, got %v", got)
+	}
+}
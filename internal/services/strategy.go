@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// Strategy picks the car a new group rides among those with room for it
+type Strategy string
+
+const (
+	// StrategyBestFit picks the car with the fewest free seats, keeping the
+	// emptier cars for bigger groups
+	StrategyBestFit Strategy = "best-fit"
+	// StrategyFirstFit picks the car with the lowest id
+	StrategyFirstFit Strategy = "first-fit"
+	// StrategyWorstFit picks the car with the most free seats, spreading the
+	// groups over the fleet
+	StrategyWorstFit Strategy = "worst-fit"
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case StrategyBestFit, StrategyFirstFit, StrategyWorstFit:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown assignment strategy %q", s)
+}
+
+// pickCar returns the car the strategy picks for the given seats among those
+// with the needs free, lowest id first on ties, or ErrNotFound
+func (cp *CarPool) pickCar(ctx context.Context, txn models.Transaction, seats uint, needs models.Features) (*models.Car, error) {
+	if cp.strategy == StrategyBestFit && needs.IsZero() {
+		return txn.CarsStorage().FindBestFit(ctx, seats)
+	}
+
+	var picked *models.Car
+	for _, car := range txn.CarsStorage().CarsWithAtLeast(ctx, seats) {
+		if !car.FreeFeatures().Covers(needs) {
+			continue
+		}
+		if picked == nil || cp.strategy.prefers(car, picked) {
+			picked = car
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if picked == nil {
+		return nil, models.ErrNotFound
+	}
+	return picked, nil
+}
+
+func (s Strategy) prefers(car, other *models.Car) bool {
+	if s == StrategyFirstFit || car.AvailableSeats == other.AvailableSeats {
+		return car.ID < other.ID
+	}
+	if s == StrategyWorstFit {
+		return car.AvailableSeats > other.AvailableSeats
+	}
+	return car.AvailableSeats < other.AvailableSeats
+}
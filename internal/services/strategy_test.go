@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestStrategies_PickCar(t *testing.T) {
+	for strategy, want := range map[Strategy]uint{
+		StrategyBestFit:  2,
+		StrategyFirstFit: 1,
+		StrategyWorstFit: 3,
+	} {
+		strategy, want := strategy, want
+		t.Run(string(strategy), func(t *testing.T) {
+			ctx := context.Background()
+			svc := NewCarPool(inMemory.NewTransactionFactory(), WithStrategy(strategy))
+			if err := svc.ResetCars(ctx, []*models.Car{
+				{ID: 1, Seats: 5, AvailableSeats: 5},
+				{ID: 2, Seats: 4, AvailableSeats: 4},
+				{ID: 3, Seats: 6, AvailableSeats: 6},
+				{ID: 4, Seats: 6, AvailableSeats: 6},
+			}); err != nil {
+				t.Fatalf("ResetCars returned error: %v", err)
+			}
+			if err := svc.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2}); err != nil {
+				t.Fatalf("NewJourney returned error: %v", err)
+			}
+			car, err := svc.Locate(ctx, 1)
+			if err != nil {
+				t.Fatalf("Locate returned error: %v", err)
+			}
+			if car.ID != want {
+				t.Fatalf("expected car %d, got %d", want, car.ID)
+			}
+		})
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	if s, err := ParseStrategy("worst-fit"); err != nil || s != StrategyWorstFit {
+		t.Fatalf("ParseStrategy(worst-fit) = %q, %v", s, err)
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+}
+
+func TestSeatLimits(t *testing.T) {
+	ctx := context.Background()
+	vans := []*models.Car{{ID: 1, Seats: 8, AvailableSeats: 8}}
+
+	if err := NewCarPool(inMemory.NewTransactionFactory()).ResetCars(ctx, vans); err != models.ErrInvalidSeats {
+		t.Fatalf("expected ErrInvalidSeats with the default limits, got %v", err)
+	}
+	if err := NewCarPool(inMemory.NewTransactionFactory(), WithSeatLimits(2, 9)).ResetCars(ctx, vans); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// attempt runs fn with the transaction timeout. When fn fails because its
+// context is done the storages only tell it as a generic failure, so the
+// context decides the answer instead.
+func (cp *CarPool) attempt(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	if cp.txnTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cp.txnTimeout)
+		defer cancel()
+	}
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		cp.logger.Warn("Operation interrupted", map[string]interface{}{
+			"operation":  operation,
+			"error":      err.Error(),
+			"reason":     ctx.Err().Error(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+		return interrupted(ctx.Err())
+	}
+	return err
+}
+
+// interrupted returns the answer for a request whose context is done
+func interrupted(err error) *models.APIError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.ErrTimeout
+	}
+	return models.ErrCanceled
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mock_models "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/mocks"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+func TestLocate_GivesUpAfterTxnTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
+
+	// another transaction holds the storage for longer than the timeout
+	txnFactory.EXPECT().Begin(gomock.Any()).DoAndReturn(func(ctx context.Context) (models.Transaction, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	svc := NewCarPool(txnFactory, WithTxnTimeout(20*time.Millisecond))
+	if _, err := svc.Locate(context.Background(), 40); err != models.ErrTimeout {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestNewJourney_RollsBackWhenClientGoesAway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	txnFactory := mock_models.NewMockTransactionFactory(ctrl)
+	txn := mock_models.NewMockTransaction(ctrl)
+	carsStorage := mock_models.NewMockICarStorage(ctrl)
+	journeysStorage := mock_models.NewMockIJourneyStorage(ctrl)
+	scheduledStorage := mock_models.NewMockIScheduledStorage(ctrl)
+	reservationsStorage := mock_models.NewMockIReservationStorage(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	txnFactory.EXPECT().Begin(gomock.Any()).Return(txn, nil)
+	txn.EXPECT().JourneysStorage().Return(journeysStorage).AnyTimes()
+	txn.EXPECT().ScheduledStorage().Return(scheduledStorage).AnyTimes()
+	txn.EXPECT().ReservationsStorage().Return(reservationsStorage).AnyTimes()
+	scheduledStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	reservationsStorage.EXPECT().FindById(gomock.Any(), gomock.Any()).Return(nil, models.ErrNotFound).AnyTimes()
+	txn.EXPECT().CarsStorage().Return(carsStorage).AnyTimes()
+	journeysStorage.EXPECT().FindById(gomock.Any(), uint(10)).DoAndReturn(func(context.Context, uint) (*models.Journey, error) {
+		cancel()
+		return nil, models.ErrNotFound
+	})
+	carsStorage.EXPECT().FindBestFit(gomock.Any(), uint(2)).Return(nil, context.Canceled)
+	txn.EXPECT().HasCommited().Return(false)
+	txn.EXPECT().Rollback().Return(nil)
+
+	svc := NewCarPool(txnFactory)
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 10, Passengers: 2}); err != models.ErrCanceled {
+		t.Fatalf("expected ErrCanceled, got %v", err)
+	}
+}
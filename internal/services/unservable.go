@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// UnservablePolicy is what happens to groups no car of the fleet could ever
+// carry, for their passengers or their needs
+type UnservablePolicy string
+
+const (
+	// UnservableFlag lets them wait, and Unservable lists them until the
+	// fleet has a car for them
+	UnservableFlag UnservablePolicy = "flag"
+	// UnservableReject refuses them on arrival, and drops the waiting and
+	// scheduled ones a fleet change leaves without such a car
+	UnservableReject UnservablePolicy = "reject"
+)
+
+// ParseUnservablePolicy reads a policy by name
+func ParseUnservablePolicy(s string) (UnservablePolicy, error) {
+	switch policy := UnservablePolicy(s); policy {
+	case UnservableFlag, UnservableReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown unservable journeys policy %q", s)
+}
+
+// WithUnservablePolicy changes what happens to groups no car could ever
+// carry, they wait flagged by default
+func WithUnservablePolicy(p UnservablePolicy) Option {
+	return func(cp *CarPool) {
+		cp.unservablePolicy = p
+	}
+}
+
+// canEverCarry tells whether a car of some of the shapes of the fleet could
+// carry the group when empty
+func canEverCarry(shapes []models.CarShape, journey *models.Journey) bool {
+	for _, shape := range shapes {
+		if shape.CanCarry(journey.Passengers, journey.Features) {
+			return true
+		}
+	}
+	return false
+}
+
+// fleetShapes returns the shapes of the cars not draining, which the storage
+// keeps so the fleet isn't read for them
+func (cp *CarPool) fleetShapes(ctx context.Context, txn models.Transaction) ([]models.CarShape, error) {
+	shapes, err := txn.CarsStorage().Shapes(ctx)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		cp.logger.Error("Failed to read the shapes of the fleet", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": logger.GetRequestID(ctx),
+		})
+		return nil, models.NewAPIError(500, "Failed to read fleet", err.Error())
+	}
+	return shapes, nil
+}
+
+// checkServable refuses a group no car of the fleet could ever carry, or only
+// logs it when they are flagged instead
+func (cp *CarPool) checkServable(ctx context.Context, txn models.Transaction, journey *models.Journey) error {
+	shapes, err := cp.fleetShapes(ctx, txn)
+	if err != nil {
+		return err
+	}
+	if canEverCarry(shapes, journey) {
+		return nil
+	}
+
+	fields := map[string]interface{}{
+		"journey_id":  journey.Id,
+		"passengers":  journey.Passengers,
+		"wheelchair":  journey.Wheelchair,
+		"child_seats": journey.ChildSeats,
+		"luggage":     journey.Luggage,
+		"request_id":  logger.GetRequestID(ctx),
+	}
+	if cp.unservablePolicy == UnservableFlag {
+		cp.logger.Warn("No car of the fleet can ever carry the journey, it waits flagged", fields)
+		return nil
+	}
+	cp.logger.Warn("No car of the fleet can ever carry the journey", fields)
+	return models.ErrNoCarMeetsNeeds
+}
+
+// Unservable lists the waiting groups no car of the fleet could ever carry in
+// arrival order, followed by the scheduled ones earliest first
+func (cp *CarPool) Unservable(ctx context.Context) (journeys []*models.Journey, err error) {
+	err = cp.attempt(ctx, "list unservable", func(ctx context.Context) error {
+		txn, err := cp.transactionFactory.Begin(ctx)
+		if err != nil {
+			return models.NewAPIError(500, "Failed to begin transaction", err.Error())
+		}
+		defer handleTxn(txn)
+		journeys, err = cp.findUnservable(ctx, txn)
+		return err
+	})
+	return journeys, err
+}
+
+func (cp *CarPool) findUnservable(ctx context.Context, txn models.Transaction) ([]*models.Journey, error) {
+	shapes, err := cp.fleetShapes(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	waiting := append(txn.PendingsStorage().GetAllPendings(ctx), txn.ScheduledStorage().GetAllScheduled(ctx)...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	found := []*models.Journey{}
+	for _, journey := range waiting {
+		if !canEverCarry(shapes, journey) {
+			found = append(found, journey)
+		}
+	}
+	return found, nil
+}
+
+// sweepUnservable looks for the waiting and scheduled groups the fleet can no
+// longer carry after it changed, and drops them unless they are flagged. It
+// returns their ids.
+func (cp *CarPool) sweepUnservable(ctx context.Context, txn models.Transaction, rec *events.Recorder) ([]uint, error) {
+	requestID := logger.GetRequestID(ctx)
+
+	found, err := cp.findUnservable(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(found))
+	for _, journey := range found {
+		ids = append(ids, journey.Id)
+		if cp.unservablePolicy == UnservableFlag {
+			cp.logger.Warn("The fleet can no longer carry a waiting journey, it waits flagged", map[string]interface{}{
+				"journey_id": journey.Id,
+				"request_id": requestID,
+			})
+			continue
+		}
+		if err := cp.dropUnservable(ctx, txn, rec, journey); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func (cp *CarPool) dropUnservable(ctx context.Context, txn models.Transaction, rec *events.Recorder, journey *models.Journey) error {
+	requestID := logger.GetRequestID(ctx)
+
+	if journey.IsScheduled() {
+		if err := txn.ScheduledStorage().DeleteById(ctx, journey.Id); err != nil {
+			cp.logger.Error("Failed to delete unservable scheduled journey", map[string]interface{}{
+				"journey_id": journey.Id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return models.NewAPIError(500, "Failed to cancel journey", err.Error())
+		}
+		rec.Emit(events.JourneyCanceled, events.JourneyCanceledData{JourneyID: journey.Id})
+	} else {
+		if err := txn.JourneysStorage().DeleteById(ctx, journey.Id); err != nil {
+			cp.logger.Error("Failed to delete unservable journey", map[string]interface{}{
+				"journey_id": journey.Id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return models.NewAPIError(500, "Failed to delete journey", err.Error())
+		}
+		if err := txn.PendingsStorage().DeleteById(ctx, journey.Id); err != nil {
+			cp.logger.Error("Failed to remove unservable journey from pending queue", map[string]interface{}{
+				"journey_id": journey.Id,
+				"error":      err.Error(),
+				"request_id": requestID,
+			})
+			return models.NewAPIError(500, "Failed to remove journey from pending queue", err.Error())
+		}
+		rec.Emit(events.JourneyDroppedOff, events.JourneyDroppedOffData{
+			JourneyID:  journey.Id,
+			Passengers: journey.Passengers,
+		})
+	}
+
+	cp.logger.Warn("Journey dropped, the fleet can no longer carry it", map[string]interface{}{
+		"journey_id": journey.Id,
+		"request_id": requestID,
+	})
+	return nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestUnservable_RejectedOnArrival(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clock.NewFake(now)), WithUnservablePolicy(UnservableReject))
+
+	// not even an empty fleet lets a group wait
+	if err := svc.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 1}); err != models.ErrNoCarMeetsNeeds {
+		t.Fatalf("expected ErrNoCarMeetsNeeds with no cars, got %v", err)
+	}
+	if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 2, Seats: 6, AvailableSeats: 6}}); err != nil {
+		t.Fatalf("ResetCars returned error: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	for _, j := range []*models.Journey{
+		{Id: 1, Passengers: 7},
+		{Id: 2, Passengers: 7, PickupAt: &later},
+	} {
+		if err := svc.NewJourney(ctx, j); err != models.ErrNoCarMeetsNeeds {
+			t.Fatalf("expected ErrNoCarMeetsNeeds for journey %d, got %v", j.Id, err)
+		}
+	}
+	// a group waiting for seats to free up is fine
+	for _, id := range []uint{3, 4} {
+		if err := svc.NewJourney(ctx, &models.Journey{Id: id, Passengers: 6}); err != nil {
+			t.Fatalf("NewJourney(%d) returned error: %v", id, err)
+		}
+	}
+	if found, err := svc.Unservable(ctx); err != nil || len(found) != 0 {
+		t.Fatalf("expected no unservable journeys, got %v, %v", found, err)
+	}
+}
+
+func TestUnservable_AfterFleetChanges(t *testing.T) {
+	for _, policy := range []UnservablePolicy{UnservableFlag, UnservableReject} {
+		t.Run(string(policy), func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+			svc := NewCarPool(inMemory.NewTransactionFactory(), WithClock(clock.NewFake(now)), WithUnservablePolicy(policy))
+			if err := svc.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}, {ID: 2, Seats: 6, AvailableSeats: 6}}); err != nil {
+				t.Fatalf("ResetCars returned error: %v", err)
+			}
+
+			later := now.Add(time.Hour)
+			for _, j := range []*models.Journey{
+				{Id: 1, Passengers: 6},
+				{Id: 2, Passengers: 6},
+				{Id: 3, Passengers: 5, PickupAt: &later},
+				{Id: 4, Passengers: 2},
+				{Id: 5, Passengers: 3},
+			} {
+				if err := svc.NewJourney(ctx, j); err != nil {
+					t.Fatalf("NewJourney(%d) returned error: %v", j.Id, err)
+				}
+			}
+
+			// car 2 drains with journey 1, no car left takes more than 4
+			plan, err := svc.MergeCars(ctx, []*models.Car{{ID: 1, Seats: 4}, {ID: 3, Seats: 4}}, false)
+			if err != nil {
+				t.Fatalf("MergeCars returned error: %v", err)
+			}
+			if !reflect.DeepEqual(plan.Unservable, []uint{2, 3}) {
+				t.Fatalf("expected journeys 2 and 3 unservable, got %v", plan.Unservable)
+			}
+			if car, err := svc.Locate(ctx, 5); err != nil || car == nil || car.ID != 3 {
+				t.Fatalf("expected journey 5 seated in car 3, got %v, %v", car, err)
+			}
+
+			found, err := svc.Unservable(ctx)
+			if err != nil {
+				t.Fatalf("Unservable returned error: %v", err)
+			}
+			var ids []uint
+			for _, j := range found {
+				ids = append(ids, j.Id)
+			}
+			for _, id := range []uint{2, 3} {
+				_, err := svc.Locate(ctx, id)
+				if policy == UnservableReject && err != models.ErrNotFound {
+					t.Fatalf("expected journey %d dropped, got %v", id, err)
+				}
+				if policy == UnservableFlag && err != nil {
+					t.Fatalf("expected journey %d still waiting, got %v", id, err)
+				}
+			}
+			if policy == UnservableReject {
+				if len(ids) != 0 {
+					t.Fatalf("expected nothing left to list, got %v", ids)
+				}
+				return
+			}
+			if !reflect.DeepEqual(ids, []uint{2, 3}) {
+				t.Fatalf("expected journeys 2 and 3 listed, got %v", ids)
+			}
+
+			// a bigger car takes the flagged group and clears the listing
+			plan, err = svc.MergeCars(ctx, []*models.Car{{ID: 1, Seats: 4}, {ID: 3, Seats: 4}, {ID: 4, Seats: 6}}, false)
+			if err != nil || len(plan.Unservable) != 0 {
+				t.Fatalf("expected no unservable journeys left, got %+v, %v", plan, err)
+			}
+			if car, err := svc.Locate(ctx, 2); err != nil || car == nil || car.ID != 4 {
+				t.Fatalf("expected journey 2 seated in car 4, got %v, %v", car, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weighted picks integer values (seats, group sizes) with relative weights
+type Weighted struct {
+	values  []uint
+	weights []float64
+	total   float64
+}
+
+// ParseWeighted reads "value:weight" pairs separated by commas, e.g. "4:2,5:1,6:1"
+func ParseWeighted(s string) (Weighted, error) {
+	var w Weighted
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 {
+			return Weighted{}, fmt.Errorf("invalid weighted value %q, expected value:weight", part)
+		}
+		value, err := strconv.ParseUint(kv[0], 10, 64)
+		if err != nil {
+			return Weighted{}, fmt.Errorf("invalid value %q: %w", kv[0], err)
+		}
+		weight, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || weight < 0 {
+			return Weighted{}, fmt.Errorf("invalid weight %q", kv[1])
+		}
+		w.values = append(w.values, uint(value))
+		w.weights = append(w.weights, weight)
+		w.total += weight
+	}
+	if w.total <= 0 {
+		return Weighted{}, fmt.Errorf("weights of %q add up to zero", s)
+	}
+	return w, nil
+}
+
+func (w Weighted) Sample(rng *rand.Rand) uint {
+	r := rng.Float64() * w.total
+	for i, weight := range w.weights {
+		if r < weight {
+			return w.values[i]
+		}
+		r -= weight
+	}
+	return w.values[len(w.values)-1]
+}
+
+// Duration is a trip duration distribution
+type Duration struct {
+	kind     string
+	min, max time.Duration
+	mean     time.Duration
+}
+
+// ParseDuration reads "fixed:10m", "exp:15m" (exponential with that mean)
+// or "uniform:5m-30m"
+func ParseDuration(s string) (Duration, error) {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 {
+		return Duration{}, fmt.Errorf("invalid duration distribution %q", s)
+	}
+
+	switch kv[0] {
+	case "fixed", "exp":
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			return Duration{}, fmt.Errorf("invalid duration %q", kv[1])
+		}
+		return Duration{kind: kv[0], mean: d}, nil
+	case "uniform":
+		bounds := strings.SplitN(kv[1], "-", 2)
+		if len(bounds) != 2 {
+			return Duration{}, fmt.Errorf("invalid uniform range %q, expected min-max", kv[1])
+		}
+		min, err1 := time.ParseDuration(bounds[0])
+		max, err2 := time.ParseDuration(bounds[1])
+		if err1 != nil || err2 != nil || min <= 0 || max < min {
+			return Duration{}, fmt.Errorf("invalid uniform range %q", kv[1])
+		}
+		return Duration{kind: "uniform", min: min, max: max}, nil
+	default:
+		return Duration{}, fmt.Errorf("unknown distribution %q", kv[0])
+	}
+}
+
+func (d Duration) Sample(rng *rand.Rand) time.Duration {
+	switch d.kind {
+	case "exp":
+		return time.Duration(rng.ExpFloat64() * float64(d.mean))
+	case "uniform":
+		return d.min + time.Duration(rng.Int63n(int64(d.max-d.min)+1))
+	default:
+		return d.mean
+	}
+}
+
+// percentile of an ascending sorted slice, nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
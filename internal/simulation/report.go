@@ -0,0 +1,36 @@
+package simulation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes the time series, one row per sample
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"elapsed_seconds", "waiting", "travelling", "occupied_seats", "total_seats", "utilization"})
+	for _, s := range r.Samples {
+		utilization := 0.0
+		if s.TotalSeats > 0 {
+			utilization = float64(s.OccupiedSeats) / float64(s.TotalSeats)
+		}
+		out.Write([]string{
+			strconv.FormatFloat(s.ElapsedSeconds, 'f', 0, 64),
+			strconv.Itoa(s.Waiting),
+			strconv.Itoa(s.Travelling),
+			strconv.FormatUint(uint64(s.OccupiedSeats), 10),
+			strconv.FormatUint(uint64(s.TotalSeats), 10),
+			strconv.FormatFloat(utilization, 'f', 4, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
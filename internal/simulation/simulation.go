@@ -0,0 +1,302 @@
+package simulation
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+// Config describes the fleet and the demand to simulate
+type Config struct {
+	Cars  int
+	Seats Weighted
+	// ArrivalRate is the mean number of groups requesting a journey per minute
+	ArrivalRate float64
+	GroupSizes  Weighted
+	Trip        Duration
+	// Patience is how long a group waits before abandoning, zero waits forever
+	Patience time.Duration
+	// Duration of the simulated period
+	Duration       time.Duration
+	SampleInterval time.Duration
+	Seed           int64
+}
+
+// Sample is the state of the pool at a point of the simulated period
+type Sample struct {
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	Waiting        int     `json:"waiting"`
+	Travelling     int     `json:"travelling"`
+	OccupiedSeats  uint    `json:"occupiedSeats"`
+	TotalSeats     uint    `json:"totalSeats"`
+}
+
+// Summary aggregates the whole simulated period, durations are in seconds
+type Summary struct {
+	Journeys        int     `json:"journeys"`
+	Served          int     `json:"served"`
+	Abandoned       int     `json:"abandoned"`
+	StillWaiting    int     `json:"stillWaiting"`
+	AbandonmentRate float64 `json:"abandonmentRate"`
+	WaitP50         float64 `json:"waitP50Seconds"`
+	WaitP90         float64 `json:"waitP90Seconds"`
+	WaitP99         float64 `json:"waitP99Seconds"`
+	WaitMax         float64 `json:"waitMaxSeconds"`
+	SeatUtilization float64 `json:"seatUtilization"`
+	MaxWaiting      int     `json:"maxWaiting"`
+}
+
+type Report struct {
+	Summary Summary  `json:"summary"`
+	Samples []Sample `json:"samples"`
+}
+
+type eventKind int
+
+const (
+	arrival eventKind = iota
+	tripEnd
+	abandon
+	sample
+)
+
+type simEvent struct {
+	at        time.Time
+	seq       uint64
+	kind      eventKind
+	journeyID uint
+}
+
+type eventQueue []simEvent
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(simEvent)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Simulator drives a services.CarPool backed by in-memory storage with a
+// simulated clock, processing arrivals, trip ends and abandonments in time order
+type Simulator struct {
+	config  Config
+	rng     *rand.Rand
+	clock   *clock.Fake
+	service *services.CarPool
+
+	start  time.Time
+	queue  eventQueue
+	seq    uint64
+	nextID uint
+
+	totalSeats    uint
+	occupiedSeats uint
+	waiting       map[uint]time.Time
+	travelling    int
+	waits         []time.Duration
+	journeys      int
+	abandoned     int
+	maxWaiting    int
+
+	seatTime   float64
+	lastUpdate time.Time
+	samples    []Sample
+}
+
+func New(config Config) *Simulator {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Simulator{
+		config:     config,
+		rng:        rand.New(rand.NewSource(config.Seed)),
+		clock:      clock.NewFake(start),
+		start:      start,
+		lastUpdate: start,
+		waiting:    make(map[uint]time.Time),
+	}
+	s.service = services.NewCarPool(inMemory.NewTransactionFactory(), services.WithClock(s.clock))
+	s.service.Events().Subscribe(s.onEvent)
+	return s
+}
+
+func (s *Simulator) Run(ctx context.Context) (*Report, error) {
+	if s.config.ArrivalRate <= 0 {
+		return nil, fmt.Errorf("arrival rate must be positive")
+	}
+
+	cars := make([]*models.Car, 0, s.config.Cars)
+	for i := 1; i <= s.config.Cars; i++ {
+		seats := s.config.Seats.Sample(s.rng)
+		cars = append(cars, &models.Car{ID: uint(i), Seats: seats, AvailableSeats: seats})
+		s.totalSeats += seats
+	}
+	if err := s.service.ResetCars(ctx, cars); err != nil {
+		return nil, err
+	}
+
+	s.schedule(s.start.Add(s.interArrival()), arrival, 0)
+	if s.config.SampleInterval > 0 {
+		s.schedule(s.start, sample, 0)
+	}
+
+	end := s.start.Add(s.config.Duration)
+	for s.queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		e := heap.Pop(&s.queue).(simEvent)
+		if e.at.After(end) {
+			break
+		}
+		s.advance(e.at)
+
+		if err := s.handle(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+	s.advance(end)
+
+	return &Report{Summary: s.summary(), Samples: s.samples}, nil
+}
+
+func (s *Simulator) handle(ctx context.Context, e simEvent) error {
+	switch e.kind {
+	case arrival:
+		s.nextID++
+		s.journeys++
+		id := s.nextID
+		s.waiting[id] = e.at
+		if err := s.service.NewJourney(ctx, &models.Journey{Id: id, Passengers: s.config.GroupSizes.Sample(s.rng)}); err != nil {
+			return err
+		}
+		if _, still := s.waiting[id]; still && s.config.Patience > 0 {
+			s.schedule(e.at.Add(s.config.Patience), abandon, id)
+		}
+		s.schedule(e.at.Add(s.interArrival()), arrival, 0)
+
+	case tripEnd:
+		car, err := s.service.Dropoff(ctx, e.journeyID)
+		if err != nil {
+			return err
+		}
+		if car != nil {
+			return s.service.Reassign(ctx, car)
+		}
+
+	case abandon:
+		if _, still := s.waiting[e.journeyID]; !still {
+			return nil
+		}
+		if _, err := s.service.Dropoff(ctx, e.journeyID); err != nil {
+			return err
+		}
+		s.abandoned++
+
+	case sample:
+		s.samples = append(s.samples, Sample{
+			ElapsedSeconds: e.at.Sub(s.start).Seconds(),
+			Waiting:        len(s.waiting),
+			Travelling:     s.travelling,
+			OccupiedSeats:  s.occupiedSeats,
+			TotalSeats:     s.totalSeats,
+		})
+		s.schedule(e.at.Add(s.config.SampleInterval), sample, 0)
+	}
+	return nil
+}
+
+// onEvent tracks the pool from the committed domain events of the service
+func (s *Simulator) onEvent(e events.Event) {
+	switch e.Type {
+	case events.JourneyAssigned:
+		var data events.JourneyAssignedData
+		if e.Decode(&data) != nil {
+			return
+		}
+		if requested, ok := s.waiting[data.JourneyID]; ok {
+			s.waits = append(s.waits, e.Time.Sub(requested))
+			delete(s.waiting, data.JourneyID)
+		}
+		s.occupiedSeats += data.Passengers
+		s.travelling++
+		s.schedule(e.Time.Add(s.config.Trip.Sample(s.rng)), tripEnd, data.JourneyID)
+
+	case events.JourneyDroppedOff:
+		var data events.JourneyDroppedOffData
+		if e.Decode(&data) != nil {
+			return
+		}
+		if data.CarID == nil {
+			delete(s.waiting, data.JourneyID)
+			return
+		}
+		s.occupiedSeats -= data.Passengers
+		s.travelling--
+	}
+
+	if len(s.waiting) > s.maxWaiting {
+		s.maxWaiting = len(s.waiting)
+	}
+}
+
+func (s *Simulator) schedule(at time.Time, kind eventKind, journeyID uint) {
+	s.seq++
+	heap.Push(&s.queue, simEvent{at: at, seq: s.seq, kind: kind, journeyID: journeyID})
+}
+
+// advance moves the simulated clock, accumulating occupied seat time
+func (s *Simulator) advance(to time.Time) {
+	if to.After(s.lastUpdate) {
+		s.seatTime += float64(s.occupiedSeats) * to.Sub(s.lastUpdate).Seconds()
+		s.lastUpdate = to
+	}
+	s.clock.Set(to)
+}
+
+func (s *Simulator) interArrival() time.Duration {
+	return time.Duration(s.rng.ExpFloat64() / s.config.ArrivalRate * float64(time.Minute))
+}
+
+func (s *Simulator) summary() Summary {
+	sorted := append([]time.Duration(nil), s.waits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	sum := Summary{
+		Journeys:     s.journeys,
+		Served:       len(s.waits),
+		Abandoned:    s.abandoned,
+		StillWaiting: len(s.waiting),
+		WaitP50:      percentile(sorted, 50).Seconds(),
+		WaitP90:      percentile(sorted, 90).Seconds(),
+		WaitP99:      percentile(sorted, 99).Seconds(),
+		MaxWaiting:   s.maxWaiting,
+	}
+	if len(sorted) > 0 {
+		sum.WaitMax = sorted[len(sorted)-1].Seconds()
+	}
+	if s.journeys > 0 {
+		sum.AbandonmentRate = float64(s.abandoned) / float64(s.journeys)
+	}
+	if s.totalSeats > 0 && s.config.Duration > 0 {
+		sum.SeatUtilization = s.seatTime / (float64(s.totalSeats) * s.config.Duration.Seconds())
+	}
+	return sum
+}
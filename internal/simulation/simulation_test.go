@@ -0,0 +1,79 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(t *testing.T) Config {
+	seats, err := ParseWeighted("4:1,6:1")
+	require.NoError(t, err)
+	groups, err := ParseWeighted("1:1,2:1,3:1,4:1,5:1,6:1")
+	require.NoError(t, err)
+	trip, err := ParseDuration("uniform:10m-20m")
+	require.NoError(t, err)
+
+	return Config{
+		Cars:           5,
+		Seats:          seats,
+		ArrivalRate:    4,
+		GroupSizes:     groups,
+		Trip:           trip,
+		Patience:       10 * time.Minute,
+		Duration:       2 * time.Hour,
+		SampleInterval: 10 * time.Minute,
+		Seed:           42,
+	}
+}
+
+func TestSimulator_Overloaded(t *testing.T) {
+	report, err := New(testConfig(t)).Run(context.Background())
+	require.NoError(t, err)
+
+	s := report.Summary
+	assert.Equal(t, s.Journeys, s.Served+s.Abandoned+s.StillWaiting)
+	assert.True(t, s.Abandoned > 0, "a small fleet under heavy demand should lose groups")
+	assert.True(t, s.SeatUtilization > 0 && s.SeatUtilization <= 1, "utilization %v", s.SeatUtilization)
+	assert.True(t, s.WaitP50 <= s.WaitP90 && s.WaitP90 <= s.WaitP99 && s.WaitP99 <= s.WaitMax)
+	assert.True(t, s.WaitMax <= (10*time.Minute).Seconds())
+	assert.Len(t, report.Samples, 13)
+
+	for _, sample := range report.Samples {
+		assert.True(t, sample.OccupiedSeats <= sample.TotalSeats)
+	}
+}
+
+func TestSimulator_IsReproducible(t *testing.T) {
+	first, err := New(testConfig(t)).Run(context.Background())
+	require.NoError(t, err)
+	second, err := New(testConfig(t)).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	var csv bytes.Buffer
+	require.NoError(t, first.WriteCSV(&csv))
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	assert.Len(t, lines, len(first.Samples)+1)
+	assert.Equal(t, "elapsed_seconds,waiting,travelling,occupied_seats,total_seats,utilization", lines[0])
+}
+
+func TestParseDistributions(t *testing.T) {
+	_, err := ParseWeighted("4:1,x:2")
+	assert.Error(t, err)
+	_, err = ParseWeighted("4:0")
+	assert.Error(t, err)
+	_, err = ParseDuration("normal:5m")
+	assert.Error(t, err)
+	_, err = ParseDuration("uniform:30m-5m")
+	assert.Error(t, err)
+
+	d, err := ParseDuration("fixed:7m")
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Minute, d.Sample(nil))
+}
@@ -0,0 +1,71 @@
+package faulty
+
+import (
+	"context"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type carStorage struct {
+	inner models.ICarStorage
+	f     *TransactionFactory
+}
+
+func (s carStorage) NewCar(ctx context.Context, car *models.Car) error {
+	if err := s.f.fail(ctx, "Cars.NewCar", car.ID); err != nil {
+		return err
+	}
+	return s.inner.NewCar(ctx, car)
+}
+
+func (s carStorage) FindById(ctx context.Context, carId uint) (*models.Car, error) {
+	if err := s.f.fail(ctx, "Cars.FindById", carId); err != nil {
+		return nil, err
+	}
+	return s.inner.FindById(ctx, carId)
+}
+
+func (s carStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
+	if err := s.f.fail(ctx, "Cars.UpdateCar", carId); err != nil {
+		return err
+	}
+	return s.inner.UpdateCar(ctx, carId, newCar, expectedVersion)
+}
+
+func (s carStorage) DeleteById(ctx context.Context, carId uint) error {
+	if err := s.f.fail(ctx, "Cars.DeleteById", carId); err != nil {
+		return err
+	}
+	return s.inner.DeleteById(ctx, carId)
+}
+
+func (s carStorage) GetAllCars(ctx context.Context) []*models.Car {
+	s.f.delay(ctx, "Cars.GetAllCars")
+	return s.inner.GetAllCars(ctx)
+}
+
+func (s carStorage) FindBestFit(ctx context.Context, seats uint) (*models.Car, error) {
+	if err := s.f.fail(ctx, "Cars.FindBestFit"); err != nil {
+		return nil, err
+	}
+	return s.inner.FindBestFit(ctx, seats)
+}
+
+func (s carStorage) CarsWithAtLeast(ctx context.Context, seats uint) []*models.Car {
+	s.f.delay(ctx, "Cars.CarsWithAtLeast")
+	return s.inner.CarsWithAtLeast(ctx, seats)
+}
+
+func (s carStorage) Shapes(ctx context.Context) ([]models.CarShape, error) {
+	if err := s.f.fail(ctx, "Cars.Shapes"); err != nil {
+		return nil, err
+	}
+	return s.inner.Shapes(ctx)
+}
+
+func (s carStorage) ResetMemory(ctx context.Context) error {
+	if err := s.f.fail(ctx, "Cars.ResetMemory"); err != nil {
+		return err
+	}
+	return s.inner.ResetMemory(ctx)
+}
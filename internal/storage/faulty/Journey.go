@@ -0,0 +1,52 @@
+package faulty
+
+import (
+	"context"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type journeyStorage struct {
+	inner models.IJourneyStorage
+	f     *TransactionFactory
+}
+
+func (s journeyStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
+	if err := s.f.fail(ctx, "Journeys.NewJourney", journey.Id); err != nil {
+		return err
+	}
+	return s.inner.NewJourney(ctx, journey)
+}
+
+func (s journeyStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := s.f.fail(ctx, "Journeys.FindById", journeyId); err != nil {
+		return nil, err
+	}
+	return s.inner.FindById(ctx, journeyId)
+}
+
+func (s journeyStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := s.f.fail(ctx, "Journeys.DeleteById", journeyId); err != nil {
+		return err
+	}
+	return s.inner.DeleteById(ctx, journeyId)
+}
+
+func (s journeyStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := s.f.fail(ctx, "Journeys.UpdateJourney", journeyId); err != nil {
+		return err
+	}
+	return s.inner.UpdateJourney(ctx, journeyId, newJourney, expectedVersion)
+}
+
+func (s journeyStorage) GetAllJourneys(ctx context.Context) []*models.Journey {
+	s.f.delay(ctx, "Journeys.GetAllJourneys")
+	return s.inner.GetAllJourneys(ctx)
+}
+
+func (s journeyStorage) ResetMemory(ctx context.Context) error {
+	if err := s.f.fail(ctx, "Journeys.ResetMemory"); err != nil {
+		return err
+	}
+	return s.inner.ResetMemory(ctx)
+}
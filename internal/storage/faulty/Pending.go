@@ -0,0 +1,66 @@
+package faulty
+
+import (
+	"context"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type pendingStorage struct {
+	inner models.IPenidngStorage
+	f     *TransactionFactory
+}
+
+func (s pendingStorage) NewPending(ctx context.Context, pending *models.Journey) error {
+	if err := s.f.fail(ctx, "Pendings.NewPending", pending.Id); err != nil {
+		return err
+	}
+	return s.inner.NewPending(ctx, pending)
+}
+
+func (s pendingStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
+	if err := s.f.fail(ctx, "Pendings.UpdatePending", pendingId); err != nil {
+		return err
+	}
+	return s.inner.UpdatePending(ctx, pendingId, newPending, expectedVersion)
+}
+
+func (s pendingStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := s.f.fail(ctx, "Pendings.DeleteById", journeyId); err != nil {
+		return err
+	}
+	return s.inner.DeleteById(ctx, journeyId)
+}
+
+func (s pendingStorage) GetAllPendings(ctx context.Context) []*models.Journey {
+	s.f.delay(ctx, "Pendings.GetAllPendings")
+	return s.inner.GetAllPendings(ctx)
+}
+
+func (s pendingStorage) NextFitting(ctx context.Context, maxPassengers uint, free models.Features) (*models.Journey, error) {
+	if err := s.f.fail(ctx, "Pendings.NextFitting"); err != nil {
+		return nil, err
+	}
+	return s.inner.NextFitting(ctx, maxPassengers, free)
+}
+
+func (s pendingStorage) NextFittingOfClass(ctx context.Context, maxPassengers uint, free models.Features, class models.PriorityClass) (*models.Journey, error) {
+	if err := s.f.fail(ctx, "Pendings.NextFittingOfClass"); err != nil {
+		return nil, err
+	}
+	return s.inner.NextFittingOfClass(ctx, maxPassengers, free, class)
+}
+
+func (s pendingStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := s.f.fail(ctx, "Pendings.CountOwnedBy"); err != nil {
+		return 0, err
+	}
+	return s.inner.CountOwnedBy(ctx, owner)
+}
+
+func (s pendingStorage) ResetMemory(ctx context.Context) error {
+	if err := s.f.fail(ctx, "Pendings.ResetMemory"); err != nil {
+		return err
+	}
+	return s.inner.ResetMemory(ctx)
+}
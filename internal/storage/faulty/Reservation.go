@@ -0,0 +1,51 @@
+package faulty
+
+import (
+	"context"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type reservationStorage struct {
+	inner models.IReservationStorage
+	f     *TransactionFactory
+}
+
+func (s reservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	if err := s.f.fail(ctx, "Reservations.NewReservation", reservation.JourneyID); err != nil {
+		return err
+	}
+	return s.inner.NewReservation(ctx, reservation)
+}
+
+func (s reservationStorage) FindById(ctx context.Context, journeyId uint) (*models.Reservation, error) {
+	if err := s.f.fail(ctx, "Reservations.FindById", journeyId); err != nil {
+		return nil, err
+	}
+	return s.inner.FindById(ctx, journeyId)
+}
+
+func (s reservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := s.f.fail(ctx, "Reservations.DeleteById", journeyId); err != nil {
+		return err
+	}
+	return s.inner.DeleteById(ctx, journeyId)
+}
+
+func (s reservationStorage) Expired(ctx context.Context, until time.Time) []*models.Reservation {
+	s.f.delay(ctx, "Reservations.Expired")
+	return s.inner.Expired(ctx, until)
+}
+
+func (s reservationStorage) GetAllReservations(ctx context.Context) []*models.Reservation {
+	s.f.delay(ctx, "Reservations.GetAllReservations")
+	return s.inner.GetAllReservations(ctx)
+}
+
+func (s reservationStorage) ResetMemory(ctx context.Context) error {
+	if err := s.f.fail(ctx, "Reservations.ResetMemory"); err != nil {
+		return err
+	}
+	return s.inner.ResetMemory(ctx)
+}
@@ -0,0 +1,65 @@
+package faulty
+
+import (
+	"context"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type scheduledStorage struct {
+	inner models.IScheduledStorage
+	f     *TransactionFactory
+}
+
+func (s scheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	if err := s.f.fail(ctx, "Scheduled.NewScheduled", journey.Id); err != nil {
+		return err
+	}
+	return s.inner.NewScheduled(ctx, journey)
+}
+
+func (s scheduledStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := s.f.fail(ctx, "Scheduled.FindById", journeyId); err != nil {
+		return nil, err
+	}
+	return s.inner.FindById(ctx, journeyId)
+}
+
+func (s scheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := s.f.fail(ctx, "Scheduled.UpdateScheduled", journeyId); err != nil {
+		return err
+	}
+	return s.inner.UpdateScheduled(ctx, journeyId, newJourney, expectedVersion)
+}
+
+func (s scheduledStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := s.f.fail(ctx, "Scheduled.CountOwnedBy"); err != nil {
+		return 0, err
+	}
+	return s.inner.CountOwnedBy(ctx, owner)
+}
+
+func (s scheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := s.f.fail(ctx, "Scheduled.DeleteById", journeyId); err != nil {
+		return err
+	}
+	return s.inner.DeleteById(ctx, journeyId)
+}
+
+func (s scheduledStorage) Due(ctx context.Context, until time.Time) []*models.Journey {
+	s.f.delay(ctx, "Scheduled.Due")
+	return s.inner.Due(ctx, until)
+}
+
+func (s scheduledStorage) GetAllScheduled(ctx context.Context) []*models.Journey {
+	s.f.delay(ctx, "Scheduled.GetAllScheduled")
+	return s.inner.GetAllScheduled(ctx)
+}
+
+func (s scheduledStorage) ResetMemory(ctx context.Context) error {
+	if err := s.f.fail(ctx, "Scheduled.ResetMemory"); err != nil {
+		return err
+	}
+	return s.inner.ResetMemory(ctx)
+}
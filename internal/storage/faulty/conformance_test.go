@@ -0,0 +1,20 @@
+package faulty_test
+
+import (
+	"testing"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/faulty"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/storagetest"
+)
+
+// rules that only slow calls down must leave the backend behaving the same
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) models.TransactionFactory {
+		return faulty.New(inMemory.NewTransactionFactory(), []faulty.Rule{
+			{Method: "Cars.*", Probability: 0.2, Latency: time.Millisecond},
+		})
+	})
+}
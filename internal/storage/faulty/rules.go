@@ -0,0 +1,140 @@
+// Package faulty wraps a storage backend to make it fail or slow down on
+// purpose, so the error paths of the services can run against real state.
+// It's meant for development and tests, never for a production fleet.
+package faulty
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// ErrInjected is what a failing rule returns unless told otherwise
+var ErrInjected = errors.New("injected storage fault")
+
+// Rule decides which calls fail or slow down. Methods are named after the
+// transaction part they belong to, as in Begin, Commit, Cars.UpdateCar,
+// Journeys.NewJourney or Pendings.NextFitting, and Method is matched against
+// them as a path.Match pattern, so Cars.* or * work too.
+//
+// A call triggers the rule when it matches Method and IDs, is the Nth
+// matching one and wins the Probability draw, any of them left zero always
+// passes. A triggered call waits Latency and then fails with Err, when set.
+// Methods without an error to return only ever get the latency.
+type Rule struct {
+	Method string
+	// IDs limits the rule to calls about one of these cars or journeys
+	IDs         []uint
+	Nth         int
+	Probability float64
+	Latency     time.Duration
+	Err         error
+}
+
+func (r Rule) matches(method string, canFail bool, ids []uint) bool {
+	if r.Err != nil && !canFail {
+		return false
+	}
+	if ok, _ := path.Match(r.Method, method); !ok {
+		return false
+	}
+	if len(r.IDs) == 0 {
+		return true
+	}
+	for _, want := range r.IDs {
+		for _, id := range ids {
+			if id == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseRules reads rules written as in STORAGE_FAULTS, separated by
+// semicolons, each one a method pattern followed by colon separated settings:
+//
+//	Cars.UpdateCar:p=0.1;Commit:nth=3;Journeys.*:ids=4,7:latency=20ms:err=conflict
+//
+// err is injected, the default, conflict or none. A rule with a latency and
+// no err only slows calls down.
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, text := range strings.Split(spec, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		rule, err := parseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("fault rule %q: %w", text, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(text string) (Rule, error) {
+	parts := strings.Split(text, ":")
+	rule := Rule{Method: parts[0]}
+	if _, err := path.Match(rule.Method, ""); err != nil {
+		return rule, err
+	}
+
+	errName := ""
+	for _, setting := range parts[1:] {
+		kv := strings.SplitN(setting, "=", 2)
+		if len(kv) != 2 {
+			return rule, fmt.Errorf("setting %q is not key=value", setting)
+		}
+		key, value := kv[0], kv[1]
+
+		var err error
+		switch key {
+		case "p":
+			rule.Probability, err = strconv.ParseFloat(value, 64)
+			if err == nil && (rule.Probability < 0 || rule.Probability > 1) {
+				err = fmt.Errorf("probability %v is not between 0 and 1", rule.Probability)
+			}
+		case "nth":
+			rule.Nth, err = strconv.Atoi(value)
+		case "ids":
+			for _, idText := range strings.Split(value, ",") {
+				var id uint64
+				if id, err = strconv.ParseUint(idText, 10, 0); err != nil {
+					break
+				}
+				rule.IDs = append(rule.IDs, uint(id))
+			}
+		case "latency":
+			rule.Latency, err = time.ParseDuration(value)
+		case "err":
+			errName = value
+		default:
+			err = fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+
+	switch errName {
+	case "":
+		if rule.Latency == 0 {
+			rule.Err = ErrInjected
+		}
+	case "injected":
+		rule.Err = ErrInjected
+	case "conflict":
+		rule.Err = models.ErrConflict
+	case "none":
+	default:
+		return rule, fmt.Errorf("unknown err %q", errName)
+	}
+	return rule, nil
+}
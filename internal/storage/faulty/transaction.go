@@ -0,0 +1,68 @@
+package faulty
+
+import (
+	"context"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type Transaction struct {
+	inner models.Transaction
+	f     *TransactionFactory
+
+	carStorage       carStorage
+	journeyStorage   journeyStorage
+	pendingStorage   pendingStorage
+	scheduledStorage scheduledStorage
+	reservations     reservationStorage
+}
+
+func newTransaction(f *TransactionFactory, inner models.Transaction) *Transaction {
+	return &Transaction{
+		inner:            inner,
+		f:                f,
+		carStorage:       carStorage{inner: inner.CarsStorage(), f: f},
+		journeyStorage:   journeyStorage{inner: inner.JourneysStorage(), f: f},
+		pendingStorage:   pendingStorage{inner: inner.PendingsStorage(), f: f},
+		scheduledStorage: scheduledStorage{inner: inner.ScheduledStorage(), f: f},
+		reservations:     reservationStorage{inner: inner.ReservationsStorage(), f: f},
+	}
+}
+
+func (t *Transaction) CarsStorage() models.ICarStorage {
+	return t.carStorage
+}
+
+func (t *Transaction) JourneysStorage() models.IJourneyStorage {
+	return t.journeyStorage
+}
+
+func (t *Transaction) PendingsStorage() models.IPenidngStorage {
+	return t.pendingStorage
+}
+
+func (t *Transaction) ScheduledStorage() models.IScheduledStorage {
+	return t.scheduledStorage
+}
+
+func (t *Transaction) ReservationsStorage() models.IReservationStorage {
+	return t.reservations
+}
+
+// Commit rolls the wrapped transaction back when it fails on purpose, as a
+// backend refusing the commit would
+func (t *Transaction) Commit(ctx context.Context) error {
+	if err := t.f.fail(ctx, "Commit"); err != nil {
+		t.inner.Rollback()
+		return err
+	}
+	return t.inner.Commit(ctx)
+}
+
+func (t *Transaction) Rollback() error {
+	return t.inner.Rollback()
+}
+
+func (t *Transaction) HasCommited() bool {
+	return t.inner.HasCommited()
+}
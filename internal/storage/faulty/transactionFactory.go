@@ -0,0 +1,133 @@
+package faulty
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// TransactionFactory hands out the transactions of the wrapped backend with
+// the rules applied to every call made through them
+type TransactionFactory struct {
+	inner models.TransactionFactory
+
+	mu       sync.Mutex
+	rules    []Rule
+	calls    []int
+	rand     *rand.Rand
+	injected int
+}
+
+// Option customizes a TransactionFactory on creation
+type Option func(*TransactionFactory)
+
+// WithSeed makes the probability draws repeat from one run to the next
+func WithSeed(seed int64) Option {
+	return func(f *TransactionFactory) {
+		f.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+func New(inner models.TransactionFactory, rules []Rule, opts ...Option) *TransactionFactory {
+	f := &TransactionFactory{
+		inner: inner,
+		rules: rules,
+		calls: make([]int, len(rules)),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *TransactionFactory) Begin(ctx context.Context) (models.Transaction, error) {
+	if err := f.fail(ctx, "Begin"); err != nil {
+		return nil, err
+	}
+	txn, err := f.inner.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newTransaction(f, txn), nil
+}
+
+// Injected tells how many calls failed on purpose so far
+func (f *TransactionFactory) Injected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected
+}
+
+// Close closes the wrapped backend when it holds resources
+func (f *TransactionFactory) Close() error {
+	if closer, ok := f.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// fail applies the rules to a call that can return an error, and gives the
+// error it must fail with, if any
+func (f *TransactionFactory) fail(ctx context.Context, method string, ids ...uint) error {
+	latency, err := f.trigger(method, true, ids)
+	if err := wait(ctx, latency); err != nil {
+		return err
+	}
+	return err
+}
+
+// delay applies the rules to a call without an error to return
+func (f *TransactionFactory) delay(ctx context.Context, method string, ids ...uint) {
+	latency, _ := f.trigger(method, false, ids)
+	wait(ctx, latency)
+}
+
+// trigger counts the call against every rule it matches and returns the
+// latency and error of the first one it triggers
+func (f *TransactionFactory) trigger(method string, canFail bool, ids []uint) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var (
+		latency   time.Duration
+		err       error
+		triggered bool
+	)
+	for i, rule := range f.rules {
+		if !rule.matches(method, canFail, ids) {
+			continue
+		}
+		f.calls[i]++
+		if triggered || (rule.Nth > 0 && f.calls[i] != rule.Nth) {
+			continue
+		}
+		if rule.Probability > 0 && f.rand.Float64() >= rule.Probability {
+			continue
+		}
+		triggered = true
+		latency, err = rule.Latency, rule.Err
+	}
+	if err != nil {
+		f.injected++
+	}
+	return latency, err
+}
+
+func wait(ctx context.Context, latency time.Duration) error {
+	if latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+package faulty_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/faulty"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := faulty.ParseRules("Cars.UpdateCar:p=0.5; Commit:nth=3;Journeys.*:ids=4,7:latency=20ms;Begin:err=conflict")
+	require.NoError(t, err)
+	assert.Equal(t, []faulty.Rule{
+		{Method: "Cars.UpdateCar", Probability: 0.5, Err: faulty.ErrInjected},
+		{Method: "Commit", Nth: 3, Err: faulty.ErrInjected},
+		{Method: "Journeys.*", IDs: []uint{4, 7}, Latency: 20 * time.Millisecond},
+		{Method: "Begin", Err: models.ErrConflict},
+	}, rules)
+
+	for _, spec := range []string{"Commit:p=2", "Commit:nth", "Commit:ids=a", "Commit:err=boom", "Commit:when=now", "[:p=1"} {
+		_, err := faulty.ParseRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRulesPickTheirCalls(t *testing.T) {
+	ctx := context.Background()
+	f := faulty.New(inMemory.NewTransactionFactory(), []faulty.Rule{
+		{Method: "Cars.NewCar", IDs: []uint{2}, Err: faulty.ErrInjected},
+		{Method: "Journeys.*", Nth: 2, Err: faulty.ErrInjected},
+	})
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+
+	assert.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+	assert.Equal(t, faulty.ErrInjected, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 2, Seats: 4, AvailableSeats: 4}))
+
+	assert.NoError(t, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2}))
+	assert.Equal(t, faulty.ErrInjected, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 2, Passengers: 2}))
+	assert.NoError(t, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 3, Passengers: 2}))
+
+	assert.Equal(t, 2, f.Injected())
+}
+
+func TestFailedCommitRollsBack(t *testing.T) {
+	ctx := context.Background()
+	backend := inMemory.NewTransactionFactory()
+	f := faulty.New(backend, []faulty.Rule{{Method: "Commit", Nth: 1, Err: faulty.ErrInjected}})
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+	assert.Equal(t, faulty.ErrInjected, txn.Commit(ctx))
+	assert.False(t, txn.HasCommited())
+
+	txn, err = backend.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	_, err = txn.CarsStorage().FindById(ctx, 1)
+	assert.Equal(t, models.ErrNotFound, err)
+}
+
+func TestLatencyGivesUpWithContext(t *testing.T) {
+	f := faulty.New(inMemory.NewTransactionFactory(), []faulty.Rule{{Method: "Begin", Latency: time.Minute}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := f.Begin(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -1,48 +1,105 @@
 package inMemory
 
 import (
+	"context"
 	"sync"
 
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 )
 
 // CarStorage struct that handles inmemory car storage
-// decided to be map since is faster for searching and updating than slice
+// decided to be map since is faster for searching and updating than slice,
+// plus an index by available seats so finding a car for a group doesn't scan the fleet,
+// and the count of cars of every shape so telling what the fleet could ever carry doesn't either
 type CarStorage struct {
-	cars map[uint]*models.Car
-	mu   sync.RWMutex
+	cars   map[uint]*models.Car
+	index  *seatIndex
+	shapes *shapeIndex
+	mu     sync.RWMutex
 }
 
 func NewCarStorage() *CarStorage {
 	return &CarStorage{
-		cars: make(map[uint]*models.Car, 0),
+		cars:   make(map[uint]*models.Car, 0),
+		index:  newSeatIndex(),
+		shapes: newShapeIndex(),
 	}
 }
 
-func (cp *CarStorage) FindById(carId uint) (car *models.Car, err error) {
+func (cp *CarStorage) FindById(ctx context.Context, carId uint) (car *models.Car, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	cp.mu.RLock()
 	car, exists := cp.cars[carId]
 	cp.mu.RUnlock()
 	if !exists {
 		return nil, models.ErrNotFound
 	}
-	return car, nil
+	copied := *car
+	return &copied, nil
 }
 
-func (cp *CarStorage) GetAllCars() []*models.Car {
+func (cp *CarStorage) GetAllCars(ctx context.Context) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
 	cp.mu.RLock()
 	defer cp.mu.RUnlock()
 
 	var cars []*models.Car
 
 	for _, c := range cp.cars {
-		cars = append(cars, c)
+		copied := *c
+		cars = append(cars, &copied)
 	}
 
 	return cars
 }
 
-func (cp *CarStorage) UpdateCar(carId uint, newCar *models.Car) error {
+func (cp *CarStorage) FindBestFit(ctx context.Context, seats uint) (*models.Car, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	carId, found := cp.index.bestFit(seats)
+	if !found {
+		return nil, models.ErrNotFound
+	}
+	copied := *cp.cars[carId]
+	return &copied, nil
+}
+
+func (cp *CarStorage) CarsWithAtLeast(ctx context.Context, seats uint) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	var cars []*models.Car
+	for _, carId := range cp.index.atLeast(seats) {
+		copied := *cp.cars[carId]
+		cars = append(cars, &copied)
+	}
+	return cars
+}
+
+func (cp *CarStorage) Shapes(ctx context.Context) ([]models.CarShape, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.shapes.all(), nil
+}
+
+func (cp *CarStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 
@@ -50,21 +107,118 @@ func (cp *CarStorage) UpdateCar(carId uint, newCar *models.Car) error {
 	if !exists {
 		return models.ErrNotFound
 	}
+	if car.Version != expectedVersion {
+		return models.NewConflictError("car", carId, expectedVersion, car.Version)
+	}
 
+	newCar.Version = car.Version + 1
 	*car = *newCar
+	cp.indexCar(car)
 	return nil
 }
 
-func (cp *CarStorage) NewCar(car *models.Car) error {
+func (cp *CarStorage) DeleteById(ctx context.Context, carId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	delete(cp.cars, carId)
+	cp.unindexCar(carId)
+	cp.mu.Unlock()
+	return nil
+}
+
+func (cp *CarStorage) NewCar(ctx context.Context, car *models.Car) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
-	cp.cars[car.ID] = car
+	car.Version = 1
+	if old, exists := cp.cars[car.ID]; exists {
+		car.Version = old.Version + 1
+	}
+	copied := *car
+	cp.cars[car.ID] = &copied
+	cp.indexCar(&copied)
+	return nil
+}
+
+func (cp *CarStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.restore(make(map[uint]*models.Car, 0))
 	return nil
 }
 
-func (cp *CarStorage) ResetMemory() error {
+// restore replaces all cars, rebuilding the indexes
+func (cp *CarStorage) restore(cars map[uint]*models.Car) {
+	index, shapes := newSeatIndex(), newShapeIndex()
+	for _, c := range cars {
+		indexCar(index, shapes, c)
+	}
+
 	cp.mu.Lock()
-	cp.cars = make(map[uint]*models.Car, 0)
+	cp.cars = cars
+	cp.index, cp.shapes = index, shapes
 	cp.mu.Unlock()
-	return nil
+}
+
+// undoCar returns a func putting the car back as it is now, or removing it
+// if it doesn't exist yet
+func (cp *CarStorage) undoCar(carId uint) func() {
+	cp.mu.RLock()
+	car, exists := cp.cars[carId]
+	cp.mu.RUnlock()
+	if !exists {
+		return func() {
+			cp.mu.Lock()
+			delete(cp.cars, carId)
+			cp.unindexCar(carId)
+			cp.mu.Unlock()
+		}
+	}
+	copied := *car
+	return func() {
+		cp.mu.Lock()
+		cp.cars[carId] = &copied
+		cp.indexCar(&copied)
+		cp.mu.Unlock()
+	}
+}
+
+// undoAll returns a func putting back the whole fleet as it is now. It's taken
+// right before a reset, which swaps in a new map and index and leaves these
+// untouched, so there is no need to copy them.
+func (cp *CarStorage) undoAll() func() {
+	cp.mu.RLock()
+	cars, index, shapes := cp.cars, cp.index, cp.shapes
+	cp.mu.RUnlock()
+	return func() {
+		cp.mu.Lock()
+		cp.cars, cp.index, cp.shapes = cars, index, shapes
+		cp.mu.Unlock()
+	}
+}
+
+func (cp *CarStorage) indexCar(car *models.Car) {
+	indexCar(cp.index, cp.shapes, car)
+}
+
+func (cp *CarStorage) unindexCar(carId uint) {
+	cp.index.remove(carId)
+	cp.shapes.remove(carId)
+}
+
+// indexCar files the car under its available seats and its shape, or leaves
+// it out of the indexes while it's draining so no group is ever given it
+func indexCar(index *seatIndex, shapes *shapeIndex, car *models.Car) {
+	if car.Draining {
+		index.remove(car.ID)
+		shapes.remove(car.ID)
+		return
+	}
+	index.put(car.ID, car.AvailableSeats)
+	shapes.put(car.ID, car.Shape())
 }
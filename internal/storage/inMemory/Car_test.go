@@ -0,0 +1,107 @@
+package inMemory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+func TestCarStorage_FindBestFit(t *testing.T) {
+	ctx := context.Background()
+	s := NewCarStorage()
+	s.NewCar(ctx, &models.Car{ID: 3, Seats: 6, AvailableSeats: 6})
+	s.NewCar(ctx, &models.Car{ID: 2, Seats: 5, AvailableSeats: 5})
+	s.NewCar(ctx, &models.Car{ID: 1, Seats: 5, AvailableSeats: 5})
+
+	expectFit := func(seats uint, want uint) {
+		t.Helper()
+		car, err := s.FindBestFit(ctx, seats)
+		if err != nil || car.ID != want {
+			t.Fatalf("FindBestFit(%d) = %+v, %v, want car %d", seats, car, err, want)
+		}
+	}
+
+	expectFit(4, 1)
+	expectFit(6, 3)
+
+	// cars handed out are copies, only UpdateCar changes the stored one
+	car, _ := s.FindById(ctx, 1)
+	car.TakeSeats(4)
+	expectFit(5, 1)
+	s.UpdateCar(ctx, 1, car, car.Version)
+	expectFit(1, 1)
+	expectFit(2, 2)
+
+	if _, err := s.FindBestFit(ctx, 7); err != models.ErrNotFound {
+		t.Fatalf("expected ErrNotFound for 7 seats, got %v", err)
+	}
+
+	var ids []uint
+	for _, c := range s.CarsWithAtLeast(ctx, 5) {
+		ids = append(ids, c.ID)
+	}
+	if fmt.Sprint(ids) != "[2 3]" {
+		t.Fatalf("CarsWithAtLeast(5) = %v, want [2 3]", ids)
+	}
+
+	s.restore(map[uint]*models.Car{9: {ID: 9, Seats: 4, AvailableSeats: 4}})
+	expectFit(1, 9)
+}
+
+func newFleet(size int) *CarStorage {
+	ctx := context.Background()
+	s := NewCarStorage()
+	for i := 1; i <= size; i++ {
+		seats := uint(models.MIN_SEATS + i%(models.MAX_SEATS-models.MIN_SEATS+1))
+		// most of the fleet is busy, as it is when lookups get expensive
+		available := uint(i % int(seats+1))
+		s.NewCar(ctx, &models.Car{ID: uint(i), Seats: seats, AvailableSeats: available})
+	}
+	return s
+}
+
+func BenchmarkFindBestFit(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{10000, 100000} {
+		s := newFleet(size)
+		b.Run(fmt.Sprintf("index/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.FindBestFit(ctx, uint(i%6)+1)
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearBestFit(s.GetAllCars(ctx), uint(i%6)+1)
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateCar(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{10000, 100000} {
+		s := newFleet(size)
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				id := uint(i%size) + 1
+				car, _ := s.FindById(ctx, id)
+				updated := *car
+				updated.AvailableSeats = uint(i) % (car.Seats + 1)
+				s.UpdateCar(ctx, id, &updated, car.Version)
+			}
+		})
+	}
+}
+
+// linearBestFit is the lookup the index replaced, kept as a baseline
+func linearBestFit(cars []*models.Car, seats uint) *models.Car {
+	var best *models.Car
+	for _, c := range cars {
+		if c.AvailableSeats >= seats && (best == nil || c.AvailableSeats < best.AvailableSeats) {
+			best = c
+		}
+	}
+	return best
+}
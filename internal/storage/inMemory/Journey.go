@@ -1,6 +1,7 @@
 package inMemory
 
 import (
+	"context"
 	"sync"
 
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
@@ -19,24 +20,33 @@ func NewJourneysStorage() *JourneysStorage {
 	}
 }
 
-func (cp *JourneysStorage) FindById(journeyId uint) (journey *models.Journey, err error) {
+func (cp *JourneysStorage) FindById(ctx context.Context, journeyId uint) (journey *models.Journey, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	cp.mu.RLock()
 	journey, exists := cp.journeys[journeyId]
 	cp.mu.RUnlock()
 	if !exists {
 		return nil, models.ErrNotFound
 	}
-	return journey, nil
+	return cloneJourney(journey), nil
 }
 
-func (cp *JourneysStorage) DeleteById(journeyId uint) error {
+func (cp *JourneysStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	delete(cp.journeys, journeyId)
 	cp.mu.Unlock()
 	return nil
 }
 
-func (cp *JourneysStorage) UpdateJourney(journeyId uint, newJourney *models.Journey) error {
+func (cp *JourneysStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 
@@ -44,21 +54,83 @@ func (cp *JourneysStorage) UpdateJourney(journeyId uint, newJourney *models.Jour
 	if !exists {
 		return models.ErrNotFound
 	}
+	if journey.Version != expectedVersion {
+		return models.NewConflictError("journey", journeyId, expectedVersion, journey.Version)
+	}
 
-	*journey = *newJourney
+	newJourney.Version = journey.Version + 1
+	*journey = *cloneJourney(newJourney)
 	return nil
 }
 
-func (cp *JourneysStorage) NewJourney(journey *models.Journey) error {
+func (cp *JourneysStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
-	cp.journeys[journey.Id] = journey
+	journey.Version = 1
+	if old, exists := cp.journeys[journey.Id]; exists {
+		journey.Version = old.Version + 1
+	}
+	cp.journeys[journey.Id] = cloneJourney(journey)
 	cp.mu.Unlock()
 	return nil
 }
 
-func (cp *JourneysStorage) ResetMemory() error {
+func (cp *JourneysStorage) GetAllJourneys(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	journeys := make([]*models.Journey, 0, len(cp.journeys))
+	for _, j := range cp.journeys {
+		journeys = append(journeys, cloneJourney(j))
+	}
+	return journeys
+}
+
+func (cp *JourneysStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	cp.journeys = make(map[uint]*models.Journey, 0)
 	cp.mu.Unlock()
 	return nil
 }
+
+// undoJourney returns a func putting the journey back as it is now, or
+// removing it if it doesn't exist yet
+func (cp *JourneysStorage) undoJourney(journeyId uint) func() {
+	cp.mu.RLock()
+	journey, exists := cp.journeys[journeyId]
+	cp.mu.RUnlock()
+	if !exists {
+		return func() {
+			cp.mu.Lock()
+			delete(cp.journeys, journeyId)
+			cp.mu.Unlock()
+		}
+	}
+	copied := cloneJourney(journey)
+	return func() {
+		cp.mu.Lock()
+		cp.journeys[journeyId] = copied
+		cp.mu.Unlock()
+	}
+}
+
+// undoAll returns a func putting back all journeys as they are now, it's
+// taken right before a reset which leaves the current map untouched
+func (cp *JourneysStorage) undoAll() func() {
+	cp.mu.RLock()
+	journeys := cp.journeys
+	cp.mu.RUnlock()
+	return func() {
+		cp.mu.Lock()
+		cp.journeys = journeys
+		cp.mu.Unlock()
+	}
+}
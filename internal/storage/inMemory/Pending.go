@@ -1,78 +1,339 @@
 package inMemory
 
 import (
+	"container/list"
+	"context"
+	"sort"
 	"sync"
 
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 )
 
+type pendingEntry struct {
+	journey   *models.Journey
+	seq       uint64
+	size      uint
+	elem      *list.Element
+	rank      int
+	classElem *list.Element
+}
+
+// classQueue names the list of the groups of one size and class
+type classQueue struct {
+	rank int
+	size uint
+}
+
 // PendingStorage struct that handles inmemory pending storage
-// decided to be a slice since it's important to keep the arriving order
+// it's important to keep the arriving order, so every group gets a sequence
+// number and waits in a FIFO list of groups of its size. Finding the oldest
+// group that fits some seats only looks at the heads of the eligible lists,
+// and the id map makes removal O(1). The groups of the classes above standard
+// wait in a list of their size and class too, and the groups of every owner
+// are counted.
 type PendingStorage struct {
-	pending []*models.Journey
+	bySize  map[uint]*list.List
+	byClass map[classQueue]*list.List
+	byId    map[uint]*pendingEntry
+	byOwner map[string]int
+	nextSeq uint64
+	maxSize uint
 	mu      sync.RWMutex
 }
 
 func NewPendingStorage() *PendingStorage {
 	return &PendingStorage{
-		pending: make([]*models.Journey, 0),
+		bySize:  make(map[uint]*list.List),
+		byClass: make(map[classQueue]*list.List),
+		byId:    make(map[uint]*pendingEntry),
+		byOwner: make(map[string]int),
 	}
 }
 
-func (cp *PendingStorage) GetAllPendings() []*models.Journey {
+// GetAllPendings returns the waiting groups in arrival order
+func (cp *PendingStorage) GetAllPendings(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
 	cp.mu.RLock()
 	defer cp.mu.RUnlock()
-	return cp.pending
+	return cp.ordered()
 }
 
-func (cp *PendingStorage) FindByID(pendingId uint) (journey *models.Journey, err error) {
+func (cp *PendingStorage) FindByID(ctx context.Context, pendingId uint) (journey *models.Journey, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	cp.mu.RLock()
 	defer cp.mu.RUnlock()
 
-	for _, pending := range cp.pending {
-		if pending.Id == pendingId {
-			return pending, nil
+	entry, exists := cp.byId[pendingId]
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+	return cloneJourney(entry.journey), nil
+}
+
+// NextFitting returns the earliest arrived group of at most maxPassengers
+// whose needs free covers
+func (cp *PendingStorage) NextFitting(ctx context.Context, maxPassengers uint, free models.Features) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	var best *pendingEntry
+	for size := uint(0); size <= maxPassengers && size <= cp.maxSize; size++ {
+		best = firstCovered(cp.bySize[size], free, best)
+	}
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	return cloneJourney(best.journey), nil
+}
+
+// NextFittingOfClass returns the earliest arrived group of at most
+// maxPassengers whose needs free covers among those of class, standard ones
+// aren't kept apart
+func (cp *PendingStorage) NextFittingOfClass(ctx context.Context, maxPassengers uint, free models.Features, class models.PriorityClass) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	var best *pendingEntry
+	for size := uint(0); class.Rank() > 0 && size <= maxPassengers && size <= cp.maxSize; size++ {
+		best = firstCovered(cp.byClass[classQueue{rank: class.Rank(), size: size}], free, best)
+	}
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	return cloneJourney(best.journey), nil
+}
+
+// firstCovered returns the oldest group of l whose needs free covers when it
+// arrived before best, or best. It stops walking l at the groups behind best.
+func firstCovered(l *list.List, free models.Features, best *pendingEntry) *pendingEntry {
+	if l == nil {
+		return best
+	}
+	for e := l.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*pendingEntry)
+		if best != nil && entry.seq > best.seq {
+			break
+		}
+		if free.Covers(entry.journey.Features) {
+			return entry
 		}
 	}
+	return best
+}
 
-	return nil, models.ErrNotFound
+// CountOwnedBy returns how many groups of owner are waiting
+func (cp *PendingStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.byOwner[owner], nil
 }
 
-func (cp *PendingStorage) UpdatePending(pendingId uint, newPending *models.Journey) error {
+func (cp *PendingStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 
-	for _, pending := range cp.pending {
-		if pending.Id == pendingId {
-			*pending = *newPending
-			return nil
-		}
+	entry, exists := cp.byId[pendingId]
+	if !exists {
+		return models.ErrNotFound
+	}
+	if entry.journey.Version != expectedVersion {
+		return models.NewConflictError("pending journey", pendingId, expectedVersion, entry.journey.Version)
 	}
-	return models.ErrNotFound
+	newPending.Version = entry.journey.Version + 1
+
+	relink := entry.size != newPending.Passengers || entry.rank != newPending.Class.Rank() || entry.journey.Owner != newPending.Owner
+	if relink {
+		cp.unlink(entry)
+	}
+	*entry.journey = *cloneJourney(newPending)
+	if relink {
+		cp.link(entry)
+	}
+	return nil
 }
 
-func (cp *PendingStorage) DeleteById(journeyId uint) error {
+func (cp *PendingStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
-	for i, p := range cp.pending {
-		if p.Id == journeyId {
-			cp.pending = append(cp.pending[:i], cp.pending[i+1:]...)
-			return nil
-		}
+
+	entry, exists := cp.byId[journeyId]
+	if !exists {
+		return nil
 	}
+	cp.unlink(entry)
+	delete(cp.byId, journeyId)
 	return nil
 }
 
-func (cp *PendingStorage) NewPending(pending *models.Journey) error {
+func (cp *PendingStorage) NewPending(ctx context.Context, pending *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cp.mu.Lock()
-	cp.pending = append(cp.pending, pending)
-	cp.mu.Unlock()
+	defer cp.mu.Unlock()
+	pending.Version = 1
+	if old, exists := cp.byId[pending.Id]; exists {
+		pending.Version = old.journey.Version + 1
+	}
+	cp.push(pending)
 	return nil
 }
 
-func (cp *PendingStorage) ResetMemory() error {
-	cp.mu.Lock()
-	cp.pending = make([]*models.Journey, 0)
-	cp.mu.Unlock()
+func (cp *PendingStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.restore(nil)
 	return nil
 }
+
+// restore replaces the queue with the given groups, in arrival order
+func (cp *PendingStorage) restore(pending []*models.Journey) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.bySize = make(map[uint]*list.List)
+	cp.byClass = make(map[classQueue]*list.List)
+	cp.byId = make(map[uint]*pendingEntry)
+	cp.byOwner = make(map[string]int)
+	cp.maxSize = 0
+	for _, p := range pending {
+		cp.push(p)
+	}
+}
+
+func (cp *PendingStorage) push(pending *models.Journey) {
+	if old, exists := cp.byId[pending.Id]; exists {
+		cp.unlink(old)
+	}
+	cp.nextSeq++
+	entry := &pendingEntry{journey: cloneJourney(pending), seq: cp.nextSeq}
+	cp.byId[pending.Id] = entry
+	cp.link(entry)
+}
+
+// link inserts the entry in the list of its size, and of its class above
+// standard, keeping the lists sorted by sequence, and counts it for its owner.
+// New groups always go to the back so this is O(1) but for resizes.
+func (cp *PendingStorage) link(entry *pendingEntry) {
+	size := entry.journey.Passengers
+	entry.size = size
+	entry.rank = entry.journey.Class.Rank()
+	l, exists := cp.bySize[size]
+	if !exists {
+		l = list.New()
+		cp.bySize[size] = l
+	}
+	if size > cp.maxSize {
+		cp.maxSize = size
+	}
+	entry.elem = insertBySeq(l, entry)
+	if owner := entry.journey.Owner; owner != "" {
+		cp.byOwner[owner]++
+	}
+
+	if entry.rank > 0 {
+		queue := classQueue{rank: entry.rank, size: size}
+		l, exists := cp.byClass[queue]
+		if !exists {
+			l = list.New()
+			cp.byClass[queue] = l
+		}
+		entry.classElem = insertBySeq(l, entry)
+	}
+}
+
+func insertBySeq(l *list.List, entry *pendingEntry) *list.Element {
+	for e := l.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*pendingEntry).seq < entry.seq {
+			return l.InsertAfter(entry, e)
+		}
+	}
+	return l.PushFront(entry)
+}
+
+func (cp *PendingStorage) unlink(entry *pendingEntry) {
+	if l, exists := cp.bySize[entry.size]; exists && entry.elem != nil {
+		l.Remove(entry.elem)
+		if owner := entry.journey.Owner; owner != "" {
+			if cp.byOwner[owner]--; cp.byOwner[owner] <= 0 {
+				delete(cp.byOwner, owner)
+			}
+		}
+	}
+	if l, exists := cp.byClass[classQueue{rank: entry.rank, size: entry.size}]; exists && entry.classElem != nil {
+		l.Remove(entry.classElem)
+	}
+	entry.elem, entry.classElem = nil, nil
+}
+
+func (cp *PendingStorage) ordered() []*models.Journey {
+	entries := make([]*pendingEntry, 0, len(cp.byId))
+	for _, entry := range cp.byId {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	pending := make([]*models.Journey, 0, len(entries))
+	for _, entry := range entries {
+		pending = append(pending, cloneJourney(entry.journey))
+	}
+	return pending
+}
+
+// undoPending returns a func putting the group back as it is now, in its
+// original place in the queue, or removing it if it isn't waiting yet
+func (cp *PendingStorage) undoPending(pendingId uint) func() {
+	cp.mu.RLock()
+	var saved *pendingEntry
+	if entry, exists := cp.byId[pendingId]; exists {
+		saved = &pendingEntry{journey: cloneJourney(entry.journey), seq: entry.seq}
+	}
+	cp.mu.RUnlock()
+
+	return func() {
+		cp.mu.Lock()
+		defer cp.mu.Unlock()
+
+		if current, exists := cp.byId[pendingId]; exists {
+			cp.unlink(current)
+			delete(cp.byId, pendingId)
+		}
+		if saved != nil {
+			cp.byId[pendingId] = saved
+			cp.link(saved)
+		}
+	}
+}
+
+// undoAll returns a func putting back the whole queue as it is now, it's
+// taken right before a reset which leaves the current lists untouched
+func (cp *PendingStorage) undoAll() func() {
+	cp.mu.RLock()
+	bySize, byClass, byId, byOwner, maxSize := cp.bySize, cp.byClass, cp.byId, cp.byOwner, cp.maxSize
+	cp.mu.RUnlock()
+	return func() {
+		cp.mu.Lock()
+		cp.bySize, cp.byClass, cp.byId, cp.byOwner, cp.maxSize = bySize, byClass, byId, byOwner, maxSize
+		cp.mu.Unlock()
+	}
+}
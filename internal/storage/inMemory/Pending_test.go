@@ -0,0 +1,77 @@
+package inMemory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+func pendingIds(s *PendingStorage) string {
+	ctx := context.Background()
+	var ids []uint
+	for _, p := range s.GetAllPendings(ctx) {
+		ids = append(ids, p.Id)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestPendingStorage_KeepsArrivalOrder(t *testing.T) {
+	ctx := context.Background()
+	s := NewPendingStorage()
+	for id, passengers := range []uint{6, 2, 4, 2, 1} {
+		s.NewPending(ctx, &models.Journey{Id: uint(id + 1), Passengers: passengers})
+	}
+
+	expectNext := func(seats uint, want uint) {
+		t.Helper()
+		p, err := s.NextFitting(ctx, seats, models.Features{})
+		if err != nil || p.Id != want {
+			t.Fatalf("NextFitting(%d) = %+v, %v, want journey %d", seats, p, err, want)
+		}
+	}
+
+	expectNext(6, 1)
+	expectNext(5, 2)
+	expectNext(1, 5)
+	if _, err := s.NextFitting(ctx, 0, models.Features{}); err != models.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	s.DeleteById(ctx, 2)
+	expectNext(5, 3)
+	expectNext(3, 4)
+
+	// resizing a group keeps its place in the arrival order
+	s.UpdatePending(ctx, 3, &models.Journey{Id: 3, Passengers: 1}, 1)
+	expectNext(1, 3)
+
+	if got := pendingIds(s); got != "[1 3 4 5]" {
+		t.Fatalf("GetAllPendings = %s, want [1 3 4 5]", got)
+	}
+
+	s.restore(clonePending(s.GetAllPendings(ctx)))
+	if got := pendingIds(s); got != "[1 3 4 5]" {
+		t.Fatalf("GetAllPendings after restore = %s, want [1 3 4 5]", got)
+	}
+	expectNext(2, 3)
+}
+
+func BenchmarkPendingDeleteById(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{10000, 100000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			s := NewPendingStorage()
+			for i := 0; i < size; i++ {
+				s.NewPending(ctx, &models.Journey{Id: uint(i), Passengers: uint(i%6) + 1})
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := uint(i % size)
+				s.DeleteById(ctx, id)
+				s.NewPending(ctx, &models.Journey{Id: id, Passengers: uint(i%6) + 1})
+			}
+		})
+	}
+}
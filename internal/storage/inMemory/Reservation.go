@@ -0,0 +1,134 @@
+package inMemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// ReservationStorage keeps the reservations in a map by journey id, scanned
+// for the expired ones like the scheduled journeys
+type ReservationStorage struct {
+	reservations map[uint]*models.Reservation
+	mu           sync.RWMutex
+}
+
+func NewReservationStorage() *ReservationStorage {
+	return &ReservationStorage{
+		reservations: make(map[uint]*models.Reservation),
+	}
+}
+
+func (cp *ReservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	copied := *reservation
+	cp.mu.Lock()
+	cp.reservations[reservation.JourneyID] = &copied
+	cp.mu.Unlock()
+	return nil
+}
+
+func (cp *ReservationStorage) FindById(ctx context.Context, journeyId uint) (*models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	reservation, exists := cp.reservations[journeyId]
+	cp.mu.RUnlock()
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+	copied := *reservation
+	return &copied, nil
+}
+
+func (cp *ReservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	delete(cp.reservations, journeyId)
+	cp.mu.Unlock()
+	return nil
+}
+
+func (cp *ReservationStorage) Expired(ctx context.Context, until time.Time) []*models.Reservation {
+	var expired []*models.Reservation
+	for _, reservation := range cp.GetAllReservations(ctx) {
+		if reservation.ExpiresAt.After(until) {
+			break
+		}
+		expired = append(expired, reservation)
+	}
+	return expired
+}
+
+func (cp *ReservationStorage) GetAllReservations(ctx context.Context) []*models.Reservation {
+	if ctx.Err() != nil {
+		return nil
+	}
+	cp.mu.RLock()
+	reservations := make([]*models.Reservation, 0, len(cp.reservations))
+	for _, reservation := range cp.reservations {
+		copied := *reservation
+		reservations = append(reservations, &copied)
+	}
+	cp.mu.RUnlock()
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].ExpiresAt.Equal(reservations[j].ExpiresAt) {
+			return reservations[i].ExpiresAt.Before(reservations[j].ExpiresAt)
+		}
+		return reservations[i].JourneyID < reservations[j].JourneyID
+	})
+	return reservations
+}
+
+func (cp *ReservationStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	cp.reservations = make(map[uint]*models.Reservation)
+	cp.mu.Unlock()
+	return nil
+}
+
+// undoReservation returns a func putting the reservation back as it is now,
+// or removing it if there is none yet
+func (cp *ReservationStorage) undoReservation(journeyId uint) func() {
+	cp.mu.RLock()
+	reservation, exists := cp.reservations[journeyId]
+	cp.mu.RUnlock()
+	if !exists {
+		return func() {
+			cp.mu.Lock()
+			delete(cp.reservations, journeyId)
+			cp.mu.Unlock()
+		}
+	}
+	copied := *reservation
+	return func() {
+		cp.mu.Lock()
+		cp.reservations[journeyId] = &copied
+		cp.mu.Unlock()
+	}
+}
+
+// undoAll returns a func putting back every reservation as it is now, taken
+// right before a reset which leaves the current map untouched
+func (cp *ReservationStorage) undoAll() func() {
+	cp.mu.RLock()
+	reservations := cp.reservations
+	cp.mu.RUnlock()
+	return func() {
+		cp.mu.Lock()
+		cp.reservations = reservations
+		cp.mu.Unlock()
+	}
+}
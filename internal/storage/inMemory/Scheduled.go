@@ -0,0 +1,175 @@
+package inMemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// ScheduledStorage keeps the journeys booked ahead in a map by id. There are
+// few of them compared to the journeys riding, so finding the due ones scans
+// the map rather than keeping it sorted.
+type ScheduledStorage struct {
+	scheduled map[uint]*models.Journey
+	mu        sync.RWMutex
+}
+
+func NewScheduledStorage() *ScheduledStorage {
+	return &ScheduledStorage{
+		scheduled: make(map[uint]*models.Journey),
+	}
+}
+
+func (cp *ScheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	journey.Version = 1
+	if old, exists := cp.scheduled[journey.Id]; exists {
+		journey.Version = old.Version + 1
+	}
+	cp.scheduled[journey.Id] = cloneJourney(journey)
+	cp.mu.Unlock()
+	return nil
+}
+
+func (cp *ScheduledStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cp.mu.RLock()
+	journey, exists := cp.scheduled[journeyId]
+	cp.mu.RUnlock()
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+	return cloneJourney(journey), nil
+}
+
+func (cp *ScheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	journey, exists := cp.scheduled[journeyId]
+	if !exists {
+		return models.ErrNotFound
+	}
+	if journey.Version != expectedVersion {
+		return models.NewConflictError("scheduled journey", journeyId, expectedVersion, journey.Version)
+	}
+	newJourney.Version = journey.Version + 1
+	cp.scheduled[journeyId] = cloneJourney(newJourney)
+	return nil
+}
+
+func (cp *ScheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	delete(cp.scheduled, journeyId)
+	cp.mu.Unlock()
+	return nil
+}
+
+func (cp *ScheduledStorage) Due(ctx context.Context, until time.Time) []*models.Journey {
+	var due []*models.Journey
+	for _, journey := range cp.GetAllScheduled(ctx) {
+		if journey.PickupAt.After(until) {
+			break
+		}
+		due = append(due, journey)
+	}
+	return due
+}
+
+func (cp *ScheduledStorage) GetAllScheduled(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	cp.mu.RLock()
+	journeys := make([]*models.Journey, 0, len(cp.scheduled))
+	for _, journey := range cp.scheduled {
+		journeys = append(journeys, cloneJourney(journey))
+	}
+	cp.mu.RUnlock()
+
+	sort.Slice(journeys, func(i, j int) bool {
+		if !journeys[i].PickupAt.Equal(*journeys[j].PickupAt) {
+			return journeys[i].PickupAt.Before(*journeys[j].PickupAt)
+		}
+		return journeys[i].Id < journeys[j].Id
+	})
+	return journeys
+}
+
+// CountOwnedBy returns how many journeys of owner are scheduled, scanning the
+// map like Due does. Journeys without an owner aren't counted.
+func (cp *ScheduledStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if owner == "" {
+		return 0, nil
+	}
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	count := 0
+	for _, journey := range cp.scheduled {
+		if journey.Owner == owner {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (cp *ScheduledStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	cp.scheduled = make(map[uint]*models.Journey)
+	cp.mu.Unlock()
+	return nil
+}
+
+// undoScheduled returns a func putting the journey back as it is now, or
+// removing it if it isn't scheduled yet
+func (cp *ScheduledStorage) undoScheduled(journeyId uint) func() {
+	cp.mu.RLock()
+	journey, exists := cp.scheduled[journeyId]
+	cp.mu.RUnlock()
+	if !exists {
+		return func() {
+			cp.mu.Lock()
+			delete(cp.scheduled, journeyId)
+			cp.mu.Unlock()
+		}
+	}
+	copied := cloneJourney(journey)
+	return func() {
+		cp.mu.Lock()
+		cp.scheduled[journeyId] = copied
+		cp.mu.Unlock()
+	}
+}
+
+// undoAll returns a func putting back every scheduled journey as it is now,
+// it's taken right before a reset which leaves the current map untouched
+func (cp *ScheduledStorage) undoAll() func() {
+	cp.mu.RLock()
+	scheduled := cp.scheduled
+	cp.mu.RUnlock()
+	return func() {
+		cp.mu.Lock()
+		cp.scheduled = scheduled
+		cp.mu.Unlock()
+	}
+}
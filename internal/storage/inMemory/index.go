@@ -0,0 +1,143 @@
+package inMemory
+
+import (
+	"container/heap"
+	"sort"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// seatIndex buckets car ids by available seats. Every bucket is a min-heap on
+// the car id so the best fit is found in O(seats) and ties always go to the
+// lowest id, while moving a car between buckets is O(log n).
+type seatIndex struct {
+	buckets  map[uint]*idHeap
+	bucketOf map[uint]uint
+	maxSeats uint
+}
+
+func newSeatIndex() *seatIndex {
+	return &seatIndex{
+		buckets:  make(map[uint]*idHeap),
+		bucketOf: make(map[uint]uint),
+	}
+}
+
+func (x *seatIndex) put(carId, availableSeats uint) {
+	x.remove(carId)
+
+	b, exists := x.buckets[availableSeats]
+	if !exists {
+		b = &idHeap{pos: make(map[uint]int)}
+		x.buckets[availableSeats] = b
+	}
+	heap.Push(b, carId)
+	x.bucketOf[carId] = availableSeats
+	if availableSeats > x.maxSeats {
+		x.maxSeats = availableSeats
+	}
+}
+
+func (x *seatIndex) remove(carId uint) {
+	seats, exists := x.bucketOf[carId]
+	if !exists {
+		return
+	}
+	b := x.buckets[seats]
+	heap.Remove(b, b.pos[carId])
+	delete(x.bucketOf, carId)
+}
+
+// bestFit returns the car with the fewest available seats that still has at
+// least the requested ones
+func (x *seatIndex) bestFit(seats uint) (uint, bool) {
+	for s := seats; s <= x.maxSeats; s++ {
+		if b, exists := x.buckets[s]; exists && b.Len() > 0 {
+			return b.ids[0], true
+		}
+	}
+	return 0, false
+}
+
+// atLeast returns the ids of cars with at least the requested available seats,
+// best fit first
+func (x *seatIndex) atLeast(seats uint) []uint {
+	var ids []uint
+	for s := seats; s <= x.maxSeats; s++ {
+		b, exists := x.buckets[s]
+		if !exists || b.Len() == 0 {
+			continue
+		}
+		sorted := append([]uint(nil), b.ids...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		ids = append(ids, sorted...)
+	}
+	return ids
+}
+
+// shapeIndex counts the cars of every shape, so the shapes of the fleet are
+// known without going over its cars
+type shapeIndex struct {
+	counts  map[models.CarShape]int
+	shapeOf map[uint]models.CarShape
+}
+
+func newShapeIndex() *shapeIndex {
+	return &shapeIndex{
+		counts:  make(map[models.CarShape]int),
+		shapeOf: make(map[uint]models.CarShape),
+	}
+}
+
+func (x *shapeIndex) put(carId uint, shape models.CarShape) {
+	x.remove(carId)
+	x.counts[shape]++
+	x.shapeOf[carId] = shape
+}
+
+func (x *shapeIndex) remove(carId uint) {
+	shape, exists := x.shapeOf[carId]
+	if !exists {
+		return
+	}
+	if x.counts[shape]--; x.counts[shape] == 0 {
+		delete(x.counts, shape)
+	}
+	delete(x.shapeOf, carId)
+}
+
+func (x *shapeIndex) all() []models.CarShape {
+	shapes := make([]models.CarShape, 0, len(x.counts))
+	for shape := range x.counts {
+		shapes = append(shapes, shape)
+	}
+	return shapes
+}
+
+// idHeap is a min-heap of car ids that tracks positions for O(log n) removal
+type idHeap struct {
+	ids []uint
+	pos map[uint]int
+}
+
+func (h idHeap) Len() int           { return len(h.ids) }
+func (h idHeap) Less(i, j int) bool { return h.ids[i] < h.ids[j] }
+func (h idHeap) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+	h.pos[h.ids[i]] = i
+	h.pos[h.ids[j]] = j
+}
+
+func (h *idHeap) Push(x interface{}) {
+	id := x.(uint)
+	h.pos[id] = len(h.ids)
+	h.ids = append(h.ids, id)
+}
+
+func (h *idHeap) Pop() interface{} {
+	last := len(h.ids) - 1
+	id := h.ids[last]
+	h.ids = h.ids[:last]
+	delete(h.pos, id)
+	return id
+}
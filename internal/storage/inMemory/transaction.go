@@ -1,17 +1,39 @@
 package inMemory
 
-import "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+import (
+	"context"
+	"errors"
 
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+var errTxnFinished = errors.New("transaction already finished")
+
+// Transaction holds the storages exclusively from Begin until it commits or
+// rolls back. Instead of copying everything up front, every write records how
+// to undo it, and a rollback replays those in reverse.
 type Transaction struct {
-	carStorage     *CarStorage
-	journeyStorage *JourneysStorage
-	pendingStorage *PendingStorage
+	carStorage       txnCarStorage
+	journeyStorage   txnJourneysStorage
+	pendingStorage   txnPendingStorage
+	scheduledStorage txnScheduledStorage
+	reservations     txnReservationStorage
 
-	carBackup     map[uint]*models.Car
-	journeyBackup map[uint]*models.Journey
-	pendingBackup []*models.Journey
+	undo    []func()
+	release func()
 
 	committed bool
+	finished  bool
+}
+
+func newTransaction(f *TransactionFactory) *Transaction {
+	u := &Transaction{release: func() { <-f.turn }}
+	u.carStorage = txnCarStorage{CarStorage: f.carStorage, txn: u}
+	u.journeyStorage = txnJourneysStorage{JourneysStorage: f.journeyStorage, txn: u}
+	u.pendingStorage = txnPendingStorage{PendingStorage: f.pendingStorage, txn: u}
+	u.scheduledStorage = txnScheduledStorage{ScheduledStorage: f.scheduledStorage, txn: u}
+	u.reservations = txnReservationStorage{ReservationStorage: f.reservations, txn: u}
+	return u
 }
 
 func (u *Transaction) CarsStorage() models.ICarStorage {
@@ -26,12 +48,25 @@ func (u *Transaction) PendingsStorage() models.IPenidngStorage {
 	return u.pendingStorage
 }
 
-func (u *Transaction) Commit() error {
-	u.carBackup = nil
-	u.journeyBackup = nil
-	u.pendingBackup = nil
+func (u *Transaction) ScheduledStorage() models.IScheduledStorage {
+	return u.scheduledStorage
+}
+
+func (u *Transaction) ReservationsStorage() models.IReservationStorage {
+	return u.reservations
+}
 
+func (u *Transaction) Commit(ctx context.Context) error {
+	if u.finished {
+		return errTxnFinished
+	}
+	if err := ctx.Err(); err != nil {
+		u.Rollback()
+		return err
+	}
+	u.undo = nil
 	u.committed = true
+	u.finish()
 	return nil
 }
 
@@ -40,8 +75,148 @@ func (u *Transaction) HasCommited() bool {
 }
 
 func (u *Transaction) Rollback() error {
-	u.carStorage.cars = cloneCars(u.carBackup)
-	u.journeyStorage.journeys = cloneJourneys(u.journeyBackup)
-	u.pendingStorage.pending = clonePending(u.pendingBackup)
+	if u.finished {
+		return nil
+	}
+	for i := len(u.undo) - 1; i >= 0; i-- {
+		u.undo[i]()
+	}
+	u.undo = nil
+	u.finish()
 	return nil
 }
+
+func (u *Transaction) record(undo func()) {
+	u.undo = append(u.undo, undo)
+}
+
+func (u *Transaction) finish() {
+	u.finished = true
+	u.release()
+}
+
+// txnCarStorage records in the transaction how to undo every car write
+type txnCarStorage struct {
+	*CarStorage
+	txn *Transaction
+}
+
+func (s txnCarStorage) NewCar(ctx context.Context, car *models.Car) error {
+	s.txn.record(s.undoCar(car.ID))
+	return s.CarStorage.NewCar(ctx, car)
+}
+
+func (s txnCarStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
+	s.txn.record(s.undoCar(carId))
+	return s.CarStorage.UpdateCar(ctx, carId, newCar, expectedVersion)
+}
+
+func (s txnCarStorage) DeleteById(ctx context.Context, carId uint) error {
+	s.txn.record(s.undoCar(carId))
+	return s.CarStorage.DeleteById(ctx, carId)
+}
+
+func (s txnCarStorage) ResetMemory(ctx context.Context) error {
+	s.txn.record(s.CarStorage.undoAll())
+	return s.CarStorage.ResetMemory(ctx)
+}
+
+// txnJourneysStorage records in the transaction how to undo every journey write
+type txnJourneysStorage struct {
+	*JourneysStorage
+	txn *Transaction
+}
+
+func (s txnJourneysStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
+	s.txn.record(s.undoJourney(journey.Id))
+	return s.JourneysStorage.NewJourney(ctx, journey)
+}
+
+func (s txnJourneysStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	s.txn.record(s.undoJourney(journeyId))
+	return s.JourneysStorage.UpdateJourney(ctx, journeyId, newJourney, expectedVersion)
+}
+
+func (s txnJourneysStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	s.txn.record(s.undoJourney(journeyId))
+	return s.JourneysStorage.DeleteById(ctx, journeyId)
+}
+
+func (s txnJourneysStorage) ResetMemory(ctx context.Context) error {
+	s.txn.record(s.JourneysStorage.undoAll())
+	return s.JourneysStorage.ResetMemory(ctx)
+}
+
+// txnPendingStorage records in the transaction how to undo every queue write
+type txnPendingStorage struct {
+	*PendingStorage
+	txn *Transaction
+}
+
+func (s txnPendingStorage) NewPending(ctx context.Context, pending *models.Journey) error {
+	s.txn.record(s.undoPending(pending.Id))
+	return s.PendingStorage.NewPending(ctx, pending)
+}
+
+func (s txnPendingStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
+	s.txn.record(s.undoPending(pendingId))
+	return s.PendingStorage.UpdatePending(ctx, pendingId, newPending, expectedVersion)
+}
+
+func (s txnPendingStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	s.txn.record(s.undoPending(journeyId))
+	return s.PendingStorage.DeleteById(ctx, journeyId)
+}
+
+func (s txnPendingStorage) ResetMemory(ctx context.Context) error {
+	s.txn.record(s.PendingStorage.undoAll())
+	return s.PendingStorage.ResetMemory(ctx)
+}
+
+// txnScheduledStorage records in the transaction how to undo every booking write
+type txnScheduledStorage struct {
+	*ScheduledStorage
+	txn *Transaction
+}
+
+func (s txnScheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	s.txn.record(s.undoScheduled(journey.Id))
+	return s.ScheduledStorage.NewScheduled(ctx, journey)
+}
+
+func (s txnScheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	s.txn.record(s.undoScheduled(journeyId))
+	return s.ScheduledStorage.UpdateScheduled(ctx, journeyId, newJourney, expectedVersion)
+}
+
+func (s txnScheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	s.txn.record(s.undoScheduled(journeyId))
+	return s.ScheduledStorage.DeleteById(ctx, journeyId)
+}
+
+func (s txnScheduledStorage) ResetMemory(ctx context.Context) error {
+	s.txn.record(s.ScheduledStorage.undoAll())
+	return s.ScheduledStorage.ResetMemory(ctx)
+}
+
+// txnReservationStorage records in the transaction how to undo every
+// reservation write
+type txnReservationStorage struct {
+	*ReservationStorage
+	txn *Transaction
+}
+
+func (s txnReservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	s.txn.record(s.undoReservation(reservation.JourneyID))
+	return s.ReservationStorage.NewReservation(ctx, reservation)
+}
+
+func (s txnReservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	s.txn.record(s.undoReservation(journeyId))
+	return s.ReservationStorage.DeleteById(ctx, journeyId)
+}
+
+func (s txnReservationStorage) ResetMemory(ctx context.Context) error {
+	s.txn.record(s.ReservationStorage.undoAll())
+	return s.ReservationStorage.ResetMemory(ctx)
+}
@@ -1,33 +1,45 @@
 package inMemory
 
-import "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+import (
+	"context"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
 
 type TransactionFactory struct {
-	carStorage     *CarStorage
-	journeyStorage *JourneysStorage
-	pendingStorage *PendingStorage
+	carStorage       *CarStorage
+	journeyStorage   *JourneysStorage
+	pendingStorage   *PendingStorage
+	scheduledStorage *ScheduledStorage
+	reservations     *ReservationStorage
+
+	// transactions run one at a time, each one holds the only slot of turn
+	// until it ends. A channel, unlike a mutex, lets Begin give up waiting.
+	turn chan struct{}
 }
 
 func NewTransactionFactory() *TransactionFactory {
 	return &TransactionFactory{
-		carStorage:     NewCarStorage(),
-		journeyStorage: NewJourneysStorage(),
-		pendingStorage: NewPendingStorage(),
+		carStorage:       NewCarStorage(),
+		journeyStorage:   NewJourneysStorage(),
+		pendingStorage:   NewPendingStorage(),
+		scheduledStorage: NewScheduledStorage(),
+		reservations:     NewReservationStorage(),
+		turn:             make(chan struct{}, 1),
 	}
 }
 
-func (f *TransactionFactory) Begin() (models.Transaction, error) {
-	carBackup := cloneCars(f.carStorage.cars)
-	journeyBackup := cloneJourneys(f.journeyStorage.journeys)
-	pendingBackup := clonePending(f.pendingStorage.pending)
-
-	return &Transaction{
-		carStorage:     f.carStorage,
-		journeyStorage: f.journeyStorage,
-		pendingStorage: f.pendingStorage,
-		carBackup:      carBackup,
-		journeyBackup:  journeyBackup,
-		pendingBackup:  pendingBackup,
-		committed:      false,
-	}, nil
+// Begin waits for the running transaction, if any, to commit or roll back,
+// or for ctx to be done
+func (f *TransactionFactory) Begin(ctx context.Context) (models.Transaction, error) {
+	// select picks at random when both are ready, a done ctx must always lose
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case f.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return newTransaction(f), nil
 }
@@ -0,0 +1,135 @@
+package inMemory
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+func TestTransaction_RollbackUndoesWrites(t *testing.T) {
+	ctx := context.Background()
+	f := NewTransactionFactory()
+
+	txn, _ := f.Begin(ctx)
+	txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4})
+	for id, passengers := range []uint{2, 3, 2} {
+		j := &models.Journey{Id: uint(id + 1), Passengers: passengers}
+		txn.JourneysStorage().NewJourney(ctx, j)
+		txn.PendingsStorage().NewPending(ctx, j)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	txn, _ = f.Begin(ctx)
+	car, _ := txn.CarsStorage().FindById(ctx, 1)
+	car.TakeSeats(2)
+	txn.CarsStorage().UpdateCar(ctx, 1, car, car.Version)
+	txn.CarsStorage().NewCar(ctx, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6})
+	j, _ := txn.JourneysStorage().FindById(ctx, 1)
+	j.AssignCar(1)
+	txn.JourneysStorage().UpdateJourney(ctx, 1, j, j.Version)
+	txn.JourneysStorage().DeleteById(ctx, 2)
+	txn.PendingsStorage().DeleteById(ctx, 1)
+	txn.PendingsStorage().UpdatePending(ctx, 3, &models.Journey{Id: 3, Passengers: 1}, 1)
+	txn.PendingsStorage().ResetMemory(ctx)
+	txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 9, Passengers: 1})
+	txn.Rollback()
+
+	txn, _ = f.Begin(ctx)
+	defer txn.Rollback()
+
+	if car, _ := txn.CarsStorage().FindById(ctx, 1); car.AvailableSeats != 4 {
+		t.Fatalf("car 1 has %d available seats after rollback, want 4", car.AvailableSeats)
+	}
+	if _, err := txn.CarsStorage().FindById(ctx, 2); err != models.ErrNotFound {
+		t.Fatalf("car 2 should be gone after rollback, got %v", err)
+	}
+	if car, _ := txn.CarsStorage().FindBestFit(ctx, 4); car == nil || car.ID != 1 {
+		t.Fatalf("seat index not restored, best fit for 4 is %+v", car)
+	}
+	if j, _ := txn.JourneysStorage().FindById(ctx, 1); j.IsAssigned() {
+		t.Fatalf("journey 1 still assigned after rollback")
+	}
+	if _, err := txn.JourneysStorage().FindById(ctx, 2); err != nil {
+		t.Fatalf("journey 2 should be back after rollback, got %v", err)
+	}
+	if got := pendingIds(f.pendingStorage); got != "[1 2 3]" {
+		t.Fatalf("pending after rollback = %s, want [1 2 3]", got)
+	}
+	if p, _ := txn.PendingsStorage().NextFitting(ctx, 3, models.Features{}); p.Id != 1 {
+		t.Fatalf("NextFitting(3) = %d after rollback, want 1", p.Id)
+	}
+}
+
+func TestTransaction_HandsOutCopies(t *testing.T) {
+	ctx := context.Background()
+	f := NewTransactionFactory()
+	txn, _ := f.Begin(ctx)
+	defer txn.Rollback()
+
+	car := &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}
+	journey := &models.Journey{Id: 1, Passengers: 2}
+	txn.CarsStorage().NewCar(ctx, car)
+	txn.JourneysStorage().NewJourney(ctx, journey)
+	txn.PendingsStorage().NewPending(ctx, journey)
+
+	car.TakeSeats(4)
+	journey.AssignCar(1)
+	for _, c := range txn.CarsStorage().GetAllCars(ctx) {
+		c.TakeSeats(1)
+	}
+	for _, p := range txn.PendingsStorage().GetAllPendings(ctx) {
+		p.Passengers = 6
+	}
+
+	if stored, _ := txn.CarsStorage().FindById(ctx, 1); stored.AvailableSeats != 4 {
+		t.Fatalf("stored car changed from outside, %d available seats", stored.AvailableSeats)
+	}
+	if stored, _ := txn.JourneysStorage().FindById(ctx, 1); stored.IsAssigned() {
+		t.Fatalf("stored journey changed from outside")
+	}
+	if p, err := txn.PendingsStorage().NextFitting(ctx, 2, models.Features{}); err != nil || p.Passengers != 2 {
+		t.Fatalf("stored pending changed from outside, got %+v, %v", p, err)
+	}
+}
+
+func TestTransaction_RunOneAtATime(t *testing.T) {
+	ctx := context.Background()
+	f := NewTransactionFactory()
+	txn, _ := f.Begin(ctx)
+	txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 6, AvailableSeats: 6})
+	txn.Commit(ctx)
+
+	// every transaction takes a seat and half of them give it back by rolling back,
+	// without isolation the read-modify-write races and rollbacks lose updates
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			txn, _ := f.Begin(ctx)
+			car, _ := txn.CarsStorage().FindById(ctx, 1)
+			car.TakeSeats(1)
+			txn.CarsStorage().UpdateCar(ctx, 1, car, car.Version)
+			car.FreeUpSeats(1)
+			txn.CarsStorage().UpdateCar(ctx, 1, car, car.Version)
+			if i%2 == 0 {
+				car.TakeSeats(1)
+				txn.CarsStorage().UpdateCar(ctx, 1, car, car.Version)
+				txn.Rollback()
+				return
+			}
+			txn.Commit(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	txn, _ = f.Begin(ctx)
+	defer txn.Rollback()
+	if car, _ := txn.CarsStorage().FindById(ctx, 1); car.AvailableSeats != 6 {
+		t.Fatalf("car has %d available seats, want 6", car.AvailableSeats)
+	}
+}
@@ -2,29 +2,24 @@ package inMemory
 
 import "gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
 
-func cloneCars(src map[uint]*models.Car) map[uint]*models.Car {
-	dst := make(map[uint]*models.Car)
-	for k, v := range src {
-		copied := *v
-		dst[k] = &copied
+// cloneJourney copies a journey including the car id and time it points to, so
+// callers can't reach stored data through it
+func cloneJourney(src *models.Journey) *models.Journey {
+	copied := *src
+	if src.CarID != nil {
+		copied.AssignCar(*src.CarID)
 	}
-	return dst
-}
-
-func cloneJourneys(src map[uint]*models.Journey) map[uint]*models.Journey {
-	dst := make(map[uint]*models.Journey)
-	for k, v := range src {
-		copied := *v
-		dst[k] = &copied
+	if src.PickupAt != nil {
+		pickupAt := *src.PickupAt
+		copied.PickupAt = &pickupAt
 	}
-	return dst
+	return &copied
 }
 
 func clonePending(src []*models.Journey) []*models.Journey {
 	dst := []*models.Journey{}
 	for _, v := range src {
-		copied := *v
-		dst = append(dst, &copied)
+		dst = append(dst, cloneJourney(v))
 	}
 
 	return dst
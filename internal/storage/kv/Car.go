@@ -0,0 +1,198 @@
+package kv
+
+import (
+	"context"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// CarStorage keeps cars by id in one bucket and, in another, an empty entry
+// per car keyed by available seats and id. Seeking that bucket finds the best
+// fit for a group without reading the fleet. A third counts the cars of every
+// shape. Draining cars have no entry in either.
+type CarStorage struct {
+	tx *bolt.Tx
+}
+
+func (cp *CarStorage) FindById(ctx context.Context, carId uint) (*models.Car, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data := cp.tx.Bucket(carsBucket).Get(key(uint64(carId)))
+	if data == nil {
+		return nil, models.ErrNotFound
+	}
+	return decodeCar(data)
+}
+
+func (cp *CarStorage) GetAllCars(ctx context.Context) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var cars []*models.Car
+	cp.tx.Bucket(carsBucket).ForEach(func(_, data []byte) error {
+		car, err := decodeCar(data)
+		if err != nil {
+			return err
+		}
+		cars = append(cars, car)
+		return nil
+	})
+	return cars
+}
+
+func (cp *CarStorage) FindBestFit(ctx context.Context, seats uint) (*models.Car, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	k, _ := cp.tx.Bucket(carsBySeatsBucket).Cursor().Seek(pairKey(uint64(seats), 0))
+	if k == nil {
+		return nil, models.ErrNotFound
+	}
+	_, carId := decodePairKey(k)
+	return cp.FindById(ctx, uint(carId))
+}
+
+func (cp *CarStorage) CarsWithAtLeast(ctx context.Context, seats uint) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var cars []*models.Car
+	c := cp.tx.Bucket(carsBySeatsBucket).Cursor()
+	for k, _ := c.Seek(pairKey(uint64(seats), 0)); k != nil; k, _ = c.Next() {
+		_, carId := decodePairKey(k)
+		car, err := cp.FindById(ctx, uint(carId))
+		if err != nil {
+			continue
+		}
+		cars = append(cars, car)
+	}
+	return cars
+}
+
+func (cp *CarStorage) Shapes(ctx context.Context) ([]models.CarShape, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	shapes := []models.CarShape{}
+	err := cp.tx.Bucket(carShapesBucket).ForEach(func(k, _ []byte) error {
+		var shape models.CarShape
+		if err := decode(k, &shape); err != nil {
+			return err
+		}
+		shapes = append(shapes, shape)
+		return nil
+	})
+	return shapes, err
+}
+
+func (cp *CarStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, carId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("car", carId, expectedVersion, old.Version)
+	}
+	return cp.put(old, newCar)
+}
+
+func (cp *CarStorage) NewCar(ctx context.Context, car *models.Car) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, car.ID)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	return cp.put(old, car)
+}
+
+func (cp *CarStorage) DeleteById(ctx context.Context, carId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, carId)
+	if err == models.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(carsBySeatsBucket).Delete(pairKey(uint64(old.AvailableSeats), uint64(carId))); err != nil {
+		return err
+	}
+	if err := countShape(cp.tx, old, -1); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(carsBucket).Delete(key(uint64(carId)))
+}
+
+func (cp *CarStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return resetBuckets(cp.tx, carsBucket, carsBySeatsBucket, carShapesBucket)
+}
+
+// put stores car with the version following old's, moving its seats index
+// entry from where old had it and counting it under its shape instead of old's
+func (cp *CarStorage) put(old, car *models.Car) error {
+	version := uint64(1)
+	if old != nil {
+		version = old.Version + 1
+	}
+	stored := *car
+	stored.Version = version
+	data, err := encodeCar(&stored)
+	if err != nil {
+		return err
+	}
+
+	bySeats := cp.tx.Bucket(carsBySeatsBucket)
+	if old != nil {
+		if err := bySeats.Delete(pairKey(uint64(old.AvailableSeats), uint64(old.ID))); err != nil {
+			return err
+		}
+		if err := countShape(cp.tx, old, -1); err != nil {
+			return err
+		}
+	}
+	if err := countShape(cp.tx, car, 1); err != nil {
+		return err
+	}
+	if !car.Draining {
+		if err := bySeats.Put(pairKey(uint64(car.AvailableSeats), uint64(car.ID)), nil); err != nil {
+			return err
+		}
+	}
+	if err := cp.tx.Bucket(carsBucket).Put(key(uint64(car.ID)), data); err != nil {
+		return err
+	}
+	car.Version = version
+	return nil
+}
+
+// countShape adds delta to the cars of the shape of car, draining cars aren't
+// counted
+func countShape(tx *bolt.Tx, car *models.Car, delta int) error {
+	if car.Draining {
+		return nil
+	}
+	k, err := encode(car.Shape())
+	if err != nil {
+		return err
+	}
+	counts := tx.Bucket(carShapesBucket)
+	count := int64(delta)
+	if stored := counts.Get(k); stored != nil {
+		count += int64(decodeKey(stored))
+	}
+	if count <= 0 {
+		return counts.Delete(k)
+	}
+	return counts.Put(k, key(uint64(count)))
+}
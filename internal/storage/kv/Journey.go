@@ -0,0 +1,96 @@
+package kv
+
+import (
+	"context"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// JourneysStorage keeps journeys by id
+type JourneysStorage struct {
+	tx *bolt.Tx
+}
+
+func (cp *JourneysStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data := cp.tx.Bucket(journeysBucket).Get(key(uint64(journeyId)))
+	if data == nil {
+		return nil, models.ErrNotFound
+	}
+	return decodeJourney(data)
+}
+
+func (cp *JourneysStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(journeysBucket).Delete(key(uint64(journeyId)))
+}
+
+func (cp *JourneysStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("journey", journeyId, expectedVersion, old.Version)
+	}
+	return cp.put(journeyId, newJourney, old.Version+1)
+}
+
+func (cp *JourneysStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journey.Id)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	version := uint64(1)
+	if old != nil {
+		version = old.Version + 1
+	}
+	return cp.put(journey.Id, journey, version)
+}
+
+func (cp *JourneysStorage) GetAllJourneys(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var journeys []*models.Journey
+	cp.tx.Bucket(journeysBucket).ForEach(func(_, data []byte) error {
+		journey, err := decodeJourney(data)
+		if err != nil {
+			return err
+		}
+		journeys = append(journeys, journey)
+		return nil
+	})
+	return journeys
+}
+
+func (cp *JourneysStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return resetBuckets(cp.tx, journeysBucket)
+}
+
+func (cp *JourneysStorage) put(journeyId uint, journey *models.Journey, version uint64) error {
+	stored := *journey
+	stored.Version = version
+	data, err := encodeJourney(&stored)
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(journeysBucket).Put(key(uint64(journeyId)), data); err != nil {
+		return err
+	}
+	journey.Version = version
+	return nil
+}
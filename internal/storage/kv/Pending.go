@@ -0,0 +1,290 @@
+package kv
+
+import (
+	"context"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// PendingStorage keeps the waiting groups in arrival order: every group gets
+// the next sequence of the pending bucket, which holds the groups by
+// sequence. Two more buckets map ids to sequences, for removal, and group
+// size plus sequence to ids, so the oldest group of each size is one seek away.
+// The groups of the classes above standard are indexed by class, size and
+// sequence in one more, and the last one counts the groups of every owner.
+type PendingStorage struct {
+	tx *bolt.Tx
+}
+
+// GetAllPendings returns the waiting groups in arrival order
+func (cp *PendingStorage) GetAllPendings(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	pending := []*models.Journey{}
+	cp.tx.Bucket(pendingBucket).ForEach(func(_, data []byte) error {
+		journey, err := decodeJourney(data)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, journey)
+		return nil
+	})
+	return pending
+}
+
+// NextFitting returns the earliest arrived group of at most maxPassengers
+// whose needs free covers
+func (cp *PendingStorage) NextFitting(ctx context.Context, maxPassengers uint, free models.Features) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var best *models.Journey
+	var bestSeq uint64
+
+	c := cp.tx.Bucket(pendingBySizeBucket).Cursor()
+	for k, _ := c.First(); k != nil; {
+		size, _ := decodePairKey(k)
+		if size > uint64(maxPassengers) {
+			break
+		}
+		for ; k != nil; k, _ = c.Next() {
+			s, seq := decodePairKey(k)
+			if s != size || (best != nil && seq > bestSeq) {
+				break
+			}
+			journey, err := cp.bySeq(seq)
+			if err != nil {
+				return nil, err
+			}
+			if free.Covers(journey.Features) {
+				best, bestSeq = journey, seq
+				break
+			}
+		}
+		// jump to the oldest group of the next size
+		k, _ = c.Seek(pairKey(size+1, 0))
+	}
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	return best, nil
+}
+
+// NextFittingOfClass returns the earliest arrived group of at most
+// maxPassengers whose needs free covers among those of class, standard ones
+// aren't indexed apart
+func (cp *PendingStorage) NextFittingOfClass(ctx context.Context, maxPassengers uint, free models.Features, class models.PriorityClass) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if class.Rank() <= 0 {
+		return nil, models.ErrNotFound
+	}
+	rank := uint64(class.Rank())
+	var best *models.Journey
+	var bestSeq uint64
+
+	c := cp.tx.Bucket(pendingByClassBucket).Cursor()
+	for k, _ := c.Seek(classKey(rank, 0, 0)); k != nil && decodeKey(k) == rank; {
+		size, _ := decodePairKey(k[8:])
+		if size > uint64(maxPassengers) {
+			break
+		}
+		for ; k != nil && decodeKey(k) == rank; k, _ = c.Next() {
+			s, seq := decodePairKey(k[8:])
+			if s != size || (best != nil && seq > bestSeq) {
+				break
+			}
+			journey, err := cp.bySeq(seq)
+			if err != nil {
+				return nil, err
+			}
+			if free.Covers(journey.Features) {
+				best, bestSeq = journey, seq
+				break
+			}
+		}
+		k, _ = c.Seek(classKey(rank, size+1, 0))
+	}
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	return best, nil
+}
+
+// CountOwnedBy returns how many groups of owner are waiting
+func (cp *PendingStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	count := cp.tx.Bucket(pendingByOwnerBucket).Get([]byte(owner))
+	if count == nil {
+		return 0, nil
+	}
+	return int(decodeKey(count)), nil
+}
+
+func (cp *PendingStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	seq, old, err := cp.find(pendingId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("pending journey", pendingId, expectedVersion, old.Version)
+	}
+
+	if old.Passengers != newPending.Passengers || old.Class.Rank() != newPending.Class.Rank() || old.Owner != newPending.Owner {
+		if err := cp.unindex(seq, old); err != nil {
+			return err
+		}
+		if err := cp.index(seq, newPending); err != nil {
+			return err
+		}
+	}
+
+	stored := *newPending
+	stored.Version = old.Version + 1
+	data, err := encodeJourney(&stored)
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(pendingBucket).Put(key(seq), data); err != nil {
+		return err
+	}
+	newPending.Version = stored.Version
+	return nil
+}
+
+func (cp *PendingStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	seq, old, err := cp.find(journeyId)
+	if err == models.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := cp.unindex(seq, old); err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(pendingIdsBucket).Delete(key(uint64(journeyId))); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(pendingBucket).Delete(key(seq))
+}
+
+func (cp *PendingStorage) NewPending(ctx context.Context, pending *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// a group asking again goes to the back of the queue
+	version := uint64(1)
+	if _, old, err := cp.find(pending.Id); err == nil {
+		version = old.Version + 1
+	}
+	if err := cp.DeleteById(ctx, pending.Id); err != nil {
+		return err
+	}
+
+	queue := cp.tx.Bucket(pendingBucket)
+	seq, err := queue.NextSequence()
+	if err != nil {
+		return err
+	}
+	stored := *pending
+	stored.Version = version
+	data, err := encodeJourney(&stored)
+	if err != nil {
+		return err
+	}
+
+	if err := queue.Put(key(seq), data); err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(pendingIdsBucket).Put(key(uint64(pending.Id)), key(seq)); err != nil {
+		return err
+	}
+	if err := cp.index(seq, pending); err != nil {
+		return err
+	}
+	pending.Version = version
+	return nil
+}
+
+func (cp *PendingStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return resetBuckets(cp.tx, pendingBucket, pendingIdsBucket, pendingBySizeBucket, pendingByClassBucket, pendingByOwnerBucket)
+}
+
+// index adds the group to the size index, and to the class one above
+// standard, and counts it for its owner
+func (cp *PendingStorage) index(seq uint64, pending *models.Journey) error {
+	id := key(uint64(pending.Id))
+	if err := cp.tx.Bucket(pendingBySizeBucket).Put(pairKey(uint64(pending.Passengers), seq), id); err != nil {
+		return err
+	}
+	if err := countOwned(cp.tx, pending.Owner, 1); err != nil {
+		return err
+	}
+	if rank := pending.Class.Rank(); rank > 0 {
+		return cp.tx.Bucket(pendingByClassBucket).Put(classKey(uint64(rank), uint64(pending.Passengers), seq), id)
+	}
+	return nil
+}
+
+func (cp *PendingStorage) unindex(seq uint64, pending *models.Journey) error {
+	if err := cp.tx.Bucket(pendingBySizeBucket).Delete(pairKey(uint64(pending.Passengers), seq)); err != nil {
+		return err
+	}
+	if err := countOwned(cp.tx, pending.Owner, -1); err != nil {
+		return err
+	}
+	if rank := pending.Class.Rank(); rank > 0 {
+		return cp.tx.Bucket(pendingByClassBucket).Delete(classKey(uint64(rank), uint64(pending.Passengers), seq))
+	}
+	return nil
+}
+
+func (cp *PendingStorage) find(pendingId uint) (uint64, *models.Journey, error) {
+	seqKey := cp.tx.Bucket(pendingIdsBucket).Get(key(uint64(pendingId)))
+	if seqKey == nil {
+		return 0, nil, models.ErrNotFound
+	}
+	seq := decodeKey(seqKey)
+	journey, err := cp.bySeq(seq)
+	return seq, journey, err
+}
+
+func (cp *PendingStorage) bySeq(seq uint64) (*models.Journey, error) {
+	data := cp.tx.Bucket(pendingBucket).Get(key(seq))
+	if data == nil {
+		return nil, models.ErrNotFound
+	}
+	return decodeJourney(data)
+}
+
+// countOwned adds delta to the groups waiting for owner, groups without an
+// owner aren't counted
+func countOwned(tx *bolt.Tx, owner string, delta int) error {
+	if owner == "" {
+		return nil
+	}
+	counts := tx.Bucket(pendingByOwnerBucket)
+	count := int64(delta)
+	if stored := counts.Get([]byte(owner)); stored != nil {
+		count += int64(decodeKey(stored))
+	}
+	if count <= 0 {
+		return counts.Delete([]byte(owner))
+	}
+	return counts.Put([]byte(owner), key(uint64(count)))
+}
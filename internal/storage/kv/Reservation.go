@@ -0,0 +1,97 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ReservationStorage keeps the reservations by journey id, with an expiry
+// index walked in order like the one of the scheduled journeys
+type ReservationStorage struct {
+	tx *bolt.Tx
+}
+
+func (cp *ReservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	if err := cp.DeleteById(ctx, reservation.JourneyID); err != nil {
+		return err
+	}
+	data, err := encodeReservation(reservation)
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(reservationsByExpiry).Put(expiryKey(reservation), nil); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(reservationsBucket).Put(key(uint64(reservation.JourneyID)), data)
+}
+
+func (cp *ReservationStorage) FindById(ctx context.Context, journeyId uint) (*models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data := cp.tx.Bucket(reservationsBucket).Get(key(uint64(journeyId)))
+	if data == nil {
+		return nil, models.ErrNotFound
+	}
+	return decodeReservation(data)
+}
+
+func (cp *ReservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	old, err := cp.FindById(ctx, journeyId)
+	if err == models.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(reservationsByExpiry).Delete(expiryKey(old)); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(reservationsBucket).Delete(key(uint64(journeyId)))
+}
+
+func (cp *ReservationStorage) Expired(ctx context.Context, until time.Time) []*models.Reservation {
+	return cp.walk(ctx, func(expiresAt uint64) bool {
+		return int64(expiresAt) <= until.UnixNano()
+	})
+}
+
+func (cp *ReservationStorage) GetAllReservations(ctx context.Context) []*models.Reservation {
+	return cp.walk(ctx, func(uint64) bool { return true })
+}
+
+func (cp *ReservationStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return resetBuckets(cp.tx, reservationsBucket, reservationsByExpiry)
+}
+
+// walk returns the reservations in expiry order while more holds for their
+// expiry
+func (cp *ReservationStorage) walk(ctx context.Context, more func(expiresAt uint64) bool) []*models.Reservation {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var reservations []*models.Reservation
+	c := cp.tx.Bucket(reservationsByExpiry).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		expiresAt, journeyId := decodePairKey(k)
+		if !more(expiresAt) {
+			break
+		}
+		reservation, err := cp.FindById(ctx, uint(journeyId))
+		if err != nil {
+			continue
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations
+}
+
+func expiryKey(reservation *models.Reservation) []byte {
+	return pairKey(uint64(reservation.ExpiresAt.UnixNano()), uint64(reservation.JourneyID))
+}
@@ -0,0 +1,172 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ScheduledStorage keeps the journeys booked ahead by id in one bucket and, in
+// another, an empty entry per journey keyed by pickup time and id, which a
+// cursor walks in order to find the due ones
+type ScheduledStorage struct {
+	tx *bolt.Tx
+}
+
+func (cp *ScheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journey.Id)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	return cp.put(old, journey)
+}
+
+func (cp *ScheduledStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data := cp.tx.Bucket(scheduledBucket).Get(key(uint64(journeyId)))
+	if data == nil {
+		return nil, models.ErrNotFound
+	}
+	return decodeJourney(data)
+}
+
+func (cp *ScheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("scheduled journey", journeyId, expectedVersion, old.Version)
+	}
+	return cp.put(old, newJourney)
+}
+
+func (cp *ScheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journeyId)
+	if err == models.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(scheduledByTimeBucket).Delete(timeKey(old)); err != nil {
+		return err
+	}
+	return cp.tx.Bucket(scheduledBucket).Delete(key(uint64(journeyId)))
+}
+
+func (cp *ScheduledStorage) Due(ctx context.Context, until time.Time) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var due []*models.Journey
+	c := cp.tx.Bucket(scheduledByTimeBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		at, journeyId := decodePairKey(k)
+		if int64(at) > until.UnixNano() {
+			break
+		}
+		journey, err := cp.FindById(ctx, uint(journeyId))
+		if err != nil {
+			continue
+		}
+		due = append(due, journey)
+	}
+	return due
+}
+
+func (cp *ScheduledStorage) GetAllScheduled(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var scheduled []*models.Journey
+	c := cp.tx.Bucket(scheduledByTimeBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		_, journeyId := decodePairKey(k)
+		journey, err := cp.FindById(ctx, uint(journeyId))
+		if err != nil {
+			continue
+		}
+		scheduled = append(scheduled, journey)
+	}
+	return scheduled
+}
+
+// CountOwnedBy returns how many journeys of owner are scheduled, decoding
+// every one of them
+func (cp *ScheduledStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if owner == "" {
+		return 0, nil
+	}
+	count := 0
+	err := cp.tx.Bucket(scheduledBucket).ForEach(func(_, data []byte) error {
+		journey, err := decodeJourney(data)
+		if err != nil {
+			return err
+		}
+		if journey.Owner == owner {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (cp *ScheduledStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return resetBuckets(cp.tx, scheduledBucket, scheduledByTimeBucket)
+}
+
+// put stores journey with the version following old's, moving its time
+// index entry from where old had it
+func (cp *ScheduledStorage) put(old, journey *models.Journey) error {
+	version := uint64(1)
+	if old != nil {
+		version = old.Version + 1
+	}
+	stored := *journey
+	stored.Version = version
+	data, err := encodeJourney(&stored)
+	if err != nil {
+		return err
+	}
+
+	byTime := cp.tx.Bucket(scheduledByTimeBucket)
+	if old != nil {
+		if err := byTime.Delete(timeKey(old)); err != nil {
+			return err
+		}
+	}
+	if err := byTime.Put(timeKey(journey), nil); err != nil {
+		return err
+	}
+	if err := cp.tx.Bucket(scheduledBucket).Put(key(uint64(journey.Id)), data); err != nil {
+		return err
+	}
+	journey.Version = version
+	return nil
+}
+
+// timeKey sorts scheduled journeys by pickup time, then id. Times before 1970
+// don't sort right, nobody books a ride in the past.
+func timeKey(journey *models.Journey) []byte {
+	return pairKey(uint64(journey.PickupAt.UnixNano()), uint64(journey.Id))
+}
@@ -0,0 +1,20 @@
+package kv_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/kv"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) models.TransactionFactory {
+		f, err := kv.Open(filepath.Join(t.TempDir(), "carpool.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	})
+}
@@ -0,0 +1,126 @@
+package kv
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+var (
+	carsBucket            = []byte("cars")
+	carsBySeatsBucket     = []byte("carsBySeats")
+	carShapesBucket       = []byte("carShapes")
+	journeysBucket        = []byte("journeys")
+	pendingBucket         = []byte("pending")
+	pendingIdsBucket      = []byte("pendingIds")
+	pendingBySizeBucket   = []byte("pendingBySize")
+	pendingByClassBucket  = []byte("pendingByClass")
+	pendingByOwnerBucket  = []byte("pendingByOwner")
+	scheduledBucket       = []byte("scheduled")
+	scheduledByTimeBucket = []byte("scheduledByTime")
+	reservationsBucket    = []byte("reservations")
+	reservationsByExpiry  = []byte("reservationsByExpiry")
+
+	allBuckets = [][]byte{carsBucket, carsBySeatsBucket, carShapesBucket, journeysBucket, pendingBucket, pendingIdsBucket, pendingBySizeBucket, pendingByClassBucket, pendingByOwnerBucket, scheduledBucket, scheduledByTimeBucket, reservationsBucket, reservationsByExpiry}
+)
+
+// Keys are big endian so bbolt's byte order sorts them numerically
+
+func key(v uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, v)
+	return k
+}
+
+func pairKey(a, b uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, a)
+	binary.BigEndian.PutUint64(k[8:], b)
+	return k
+}
+
+// classKey sorts the waiting groups of a class by size, then sequence
+func classKey(rank, size, seq uint64) []byte {
+	return append(key(rank), pairKey(size, seq)...)
+}
+
+func decodeKey(k []byte) uint64 {
+	return binary.BigEndian.Uint64(k)
+}
+
+func decodePairKey(k []byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(k), binary.BigEndian.Uint64(k[8:])
+}
+
+func encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Records wrap the models to store their version and owner, which the models
+// leave out of their JSON since they aren't part of the API
+
+type carRecord struct {
+	*models.Car
+	Version uint64          `json:"version"`
+	InUse   models.Features `json:"inUse"`
+}
+
+type journeyRecord struct {
+	*models.Journey
+	Version     uint64    `json:"version"`
+	Owner       string    `json:"owner,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+func encodeCar(car *models.Car) ([]byte, error) {
+	return encode(carRecord{Car: car, Version: car.Version, InUse: car.InUse})
+}
+
+func decodeCar(data []byte) (*models.Car, error) {
+	rec := carRecord{Car: &models.Car{}}
+	if err := decode(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Car.Version = rec.Version
+	rec.Car.InUse = rec.InUse
+	return rec.Car, nil
+}
+
+func encodeJourney(journey *models.Journey) ([]byte, error) {
+	return encode(journeyRecord{Journey: journey, Version: journey.Version, Owner: journey.Owner, RequestedAt: journey.RequestedAt})
+}
+
+func decodeJourney(data []byte) (*models.Journey, error) {
+	rec := journeyRecord{Journey: &models.Journey{}}
+	if err := decode(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Journey.Version = rec.Version
+	rec.Journey.Owner = rec.Owner
+	rec.Journey.RequestedAt = rec.RequestedAt
+	return rec.Journey, nil
+}
+
+type reservationRecord struct {
+	*models.Reservation
+	Owner string `json:"owner,omitempty"`
+}
+
+func encodeReservation(reservation *models.Reservation) ([]byte, error) {
+	return encode(reservationRecord{Reservation: reservation, Owner: reservation.Owner})
+}
+
+func decodeReservation(data []byte) (*models.Reservation, error) {
+	rec := reservationRecord{Reservation: &models.Reservation{}}
+	if err := decode(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Reservation.Owner = rec.Owner
+	return rec.Reservation, nil
+}
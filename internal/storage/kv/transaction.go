@@ -0,0 +1,81 @@
+package kv
+
+import (
+	"context"
+	"errors"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var errTxnFinished = errors.New("transaction already finished")
+
+// Transaction maps straight onto a bbolt transaction, nothing is written to
+// the file until Commit
+type Transaction struct {
+	tx *bolt.Tx
+
+	committed bool
+	finished  bool
+}
+
+func (u *Transaction) CarsStorage() models.ICarStorage {
+	return &CarStorage{tx: u.tx}
+}
+
+func (u *Transaction) JourneysStorage() models.IJourneyStorage {
+	return &JourneysStorage{tx: u.tx}
+}
+
+func (u *Transaction) PendingsStorage() models.IPenidngStorage {
+	return &PendingStorage{tx: u.tx}
+}
+
+func (u *Transaction) ScheduledStorage() models.IScheduledStorage {
+	return &ScheduledStorage{tx: u.tx}
+}
+
+func (u *Transaction) ReservationsStorage() models.IReservationStorage {
+	return &ReservationStorage{tx: u.tx}
+}
+
+func (u *Transaction) Commit(ctx context.Context) error {
+	if u.finished {
+		return errTxnFinished
+	}
+	if err := ctx.Err(); err != nil {
+		u.Rollback()
+		return err
+	}
+	u.finished = true
+	if err := u.tx.Commit(); err != nil {
+		return err
+	}
+	u.committed = true
+	return nil
+}
+
+func (u *Transaction) HasCommited() bool {
+	return u.committed
+}
+
+func (u *Transaction) Rollback() error {
+	if u.finished {
+		return nil
+	}
+	u.finished = true
+	return u.tx.Rollback()
+}
+
+// resetBuckets empties the given buckets by dropping and recreating them
+func resetBuckets(tx *bolt.Tx, names ...[]byte) error {
+	for _, name := range names {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
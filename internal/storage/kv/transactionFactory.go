@@ -0,0 +1,138 @@
+// Package kv stores cars, journeys, the pending queue, scheduled journeys and
+// seat reservations in an embedded bbolt file, for single node deployments
+// that need to survive restarts without running a database
+package kv
+
+import (
+	"context"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout bounds the wait for the file lock held by another process
+const openTimeout = time.Second
+
+type TransactionFactory struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database file at path
+func Open(path string) (*TransactionFactory, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// files written before the owners or the car shapes were counted
+		// count them once
+		countOwners := tx.Bucket(pendingByOwnerBucket) == nil
+		countShapes := tx.Bucket(carShapesBucket) == nil
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if countOwners {
+			err := tx.Bucket(pendingBucket).ForEach(func(_, data []byte) error {
+				journey, err := decodeJourney(data)
+				if err != nil {
+					return err
+				}
+				return countOwned(tx, journey.Owner, 1)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !countShapes {
+			return nil
+		}
+		return tx.Bucket(carsBucket).ForEach(func(_, data []byte) error {
+			car, err := decodeCar(data)
+			if err != nil {
+				return err
+			}
+			return countShape(tx, car, 1)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &TransactionFactory{db: db}, nil
+}
+
+// Begin starts a read-write bbolt transaction. bbolt allows a single writer,
+// so Begin waits for the running transaction, if any, to commit or roll back,
+// or for ctx to be done.
+func (f *TransactionFactory) Begin(ctx context.Context) (models.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// bbolt can't stop waiting for the writer lock, so wait for it aside
+	type begun struct {
+		tx  *bolt.Tx
+		err error
+	}
+	ch := make(chan begun, 1)
+	go func() {
+		tx, err := f.db.Begin(true)
+		ch <- begun{tx, err}
+	}()
+
+	select {
+	case b := <-ch:
+		if b.err != nil {
+			return nil, b.err
+		}
+		return &Transaction{tx: b.tx}, nil
+	case <-ctx.Done():
+		// hand the lock back as soon as it's ours
+		go func() {
+			if b := <-ch; b.err == nil {
+				b.tx.Rollback()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (f *TransactionFactory) Close() error {
+	return f.db.Close()
+}
+
+// Backup copies the database file at src to dst, it waits for src to be
+// released by the server for at most a second
+func Backup(src, dst string) error {
+	db, err := bolt.Open(src, 0o600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(dst, 0o600)
+	})
+}
+
+// Compact writes a copy of the database file at src to dst leaving out the
+// pages freed by deletes, so dst is usually much smaller
+func Compact(src, dst string) error {
+	from, err := bolt.Open(src, 0o600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	to, err := bolt.Open(dst, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+
+	return bolt.Compact(to, from, 64<<20)
+}
@@ -0,0 +1,163 @@
+package kv_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/kv"
+	bolt "go.etcd.io/bbolt"
+)
+
+func fill(t *testing.T, path string) {
+	ctx := context.Background()
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+	for id := uint(1); id <= 500; id++ {
+		j := &models.Journey{Id: id, Passengers: id%6 + 1}
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, j))
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, j))
+	}
+	require.NoError(t, txn.Commit(ctx))
+
+	// leave free pages behind for compaction to drop
+	txn, err = f.Begin(ctx)
+	require.NoError(t, err)
+	for id := uint(1); id < 500; id++ {
+		require.NoError(t, txn.JourneysStorage().DeleteById(ctx, id))
+		require.NoError(t, txn.PendingsStorage().DeleteById(ctx, id))
+	}
+	require.NoError(t, txn.Commit(ctx))
+}
+
+func expectFilled(t *testing.T, path string) {
+	ctx := context.Background()
+	t.Helper()
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+
+	car, err := txn.CarsStorage().FindBestFit(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), car.ID)
+	_, err = txn.JourneysStorage().FindById(ctx, 500)
+	assert.NoError(t, err)
+	p, err := txn.PendingsStorage().NextFitting(ctx, 6, models.Features{})
+	require.NoError(t, err)
+	assert.Equal(t, uint(500), p.Id)
+}
+
+func TestOpen_KeepsCommittedState(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "carpool.db")
+	fill(t, path)
+
+	// a rolled back transaction leaves nothing behind once reopened
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().ResetMemory(ctx))
+	require.NoError(t, txn.Rollback())
+	require.NoError(t, f.Close())
+
+	expectFilled(t, path)
+}
+
+func TestBackupAndCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "carpool.db")
+	fill(t, path)
+
+	backup := filepath.Join(dir, "backup.db")
+	require.NoError(t, kv.Backup(path, backup))
+	expectFilled(t, backup)
+
+	compacted := filepath.Join(dir, "compacted.db")
+	require.NoError(t, kv.Compact(path, compacted))
+	expectFilled(t, compacted)
+}
+
+func TestOpen_FailsWhileAnotherProcessHoldsTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "carpool.db")
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.Error(t, kv.Backup(path, filepath.Join(t.TempDir(), "backup.db")))
+}
+
+func TestOpen_CountsOwnersOfOlderFiles(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "carpool.db")
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	for id := uint(1); id <= 3; id++ {
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: id, Passengers: 2, Owner: "acme"}))
+	}
+	require.NoError(t, txn.Commit(ctx))
+	require.NoError(t, f.Close())
+
+	// as written before the owners were counted
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("pendingByOwner"))
+	}))
+	require.NoError(t, db.Close())
+
+	f, err = kv.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	txn, err = f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	owned, err := txn.PendingsStorage().CountOwnedBy(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, 3, owned)
+}
+
+func TestOpen_CountsCarShapesOfOlderFiles(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "carpool.db")
+	f, err := kv.Open(path)
+	require.NoError(t, err)
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6, Draining: true}))
+	require.NoError(t, txn.Commit(ctx))
+	require.NoError(t, f.Close())
+
+	// as written before the shapes were counted
+	db, err := bolt.Open(path, 0o600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("carShapes"))
+	}))
+	require.NoError(t, db.Close())
+
+	f, err = kv.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	txn, err = f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	shapes, err := txn.CarsStorage().Shapes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.CarShape{{Seats: 4}}, shapes)
+}
@@ -0,0 +1,297 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// CarStorage keeps cars as JSON in a hash by id, and the ids in a sorted set
+// scored by available seats, so the best fit is the first member from the
+// seats needed on. Another hash counts the cars by shape. Draining cars are
+// kept out of the sorted set and the counts.
+type CarStorage struct {
+	txn *Transaction
+}
+
+func (cp *CarStorage) FindById(ctx context.Context, carId uint) (*models.Car, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if car, dirty := cp.txn.dirtyCars[carId]; dirty {
+		if car == nil {
+			return nil, models.ErrNotFound
+		}
+		copied := *car
+		return &copied, nil
+	}
+	if cp.txn.carsReset {
+		return nil, models.ErrNotFound
+	}
+
+	data, err := cp.txn.conn.HGet(ctx, cp.txn.keys.cars(), field(carId)).Bytes()
+	if err == goredis.Nil {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCar(data)
+}
+
+func (cp *CarStorage) GetAllCars(ctx context.Context) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var cars []*models.Car
+	if !cp.txn.carsReset {
+		stored, err := cp.txn.conn.HGetAll(ctx, cp.txn.keys.cars()).Result()
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for f, data := range stored {
+			id, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if _, dirty := cp.txn.dirtyCars[uint(id)]; dirty {
+				continue
+			}
+			car, err := decodeCar([]byte(data))
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			cars = append(cars, car)
+		}
+	}
+	for _, car := range cp.txn.dirtyCars {
+		if car == nil {
+			continue
+		}
+		copied := *car
+		cars = append(cars, &copied)
+	}
+	return cars
+}
+
+func (cp *CarStorage) FindBestFit(ctx context.Context, seats uint) (*models.Car, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var best *models.Car
+	for _, car := range cp.txn.dirtyCars {
+		if pickable(car, seats) && (best == nil || fitsBetter(car, best)) {
+			best = car
+		}
+	}
+
+	if !cp.txn.carsReset {
+		// skipping the cars changed in this transaction, the first stored one left is the best
+		ids, err := cp.storedWithAtLeast(ctx, seats, int64(len(cp.txn.dirtyCars)+1))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if _, dirty := cp.txn.dirtyCars[id]; dirty {
+				continue
+			}
+			car, err := cp.FindById(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if best == nil || fitsBetter(car, best) {
+				best = car
+			}
+			break
+		}
+	}
+
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	copied := *best
+	return &copied, nil
+}
+
+func (cp *CarStorage) CarsWithAtLeast(ctx context.Context, seats uint) []*models.Car {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var cars []*models.Car
+	if !cp.txn.carsReset {
+		ids, err := cp.storedWithAtLeast(ctx, seats, 0)
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for _, id := range ids {
+			if _, dirty := cp.txn.dirtyCars[id]; dirty {
+				continue
+			}
+			car, err := cp.FindById(ctx, id)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			cars = append(cars, car)
+		}
+	}
+	for _, car := range cp.txn.dirtyCars {
+		if pickable(car, seats) {
+			copied := *car
+			cars = append(cars, &copied)
+		}
+	}
+
+	sort.Slice(cars, func(i, j int) bool { return fitsBetter(cars[i], cars[j]) })
+	return cars
+}
+
+// Shapes returns the shapes of the cars not draining, the stored counts
+// corrected by the cars changed in this transaction
+func (cp *CarStorage) Shapes(ctx context.Context) ([]models.CarShape, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	if !cp.txn.carsReset {
+		stored, err := cp.txn.conn.HGetAll(ctx, cp.txn.keys.carShapes()).Result()
+		if err != nil {
+			return nil, err
+		}
+		for shape, n := range stored {
+			if counts[shape], err = strconv.ParseInt(n, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		old, err := cp.txn.storedShapes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, shape := range old {
+			counts[shape]--
+		}
+	}
+	for _, car := range cp.txn.dirtyCars {
+		if car == nil || car.Draining {
+			continue
+		}
+		shape, err := shapeField(car)
+		if err != nil {
+			return nil, err
+		}
+		counts[shape]++
+	}
+
+	shapes := []models.CarShape{}
+	for f, n := range counts {
+		if n <= 0 {
+			continue
+		}
+		var shape models.CarShape
+		if err := json.Unmarshal([]byte(f), &shape); err != nil {
+			return nil, err
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes, nil
+}
+
+func (cp *CarStorage) UpdateCar(ctx context.Context, carId uint, newCar *models.Car, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, carId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("car", carId, expectedVersion, old.Version)
+	}
+	newCar.Version = old.Version + 1
+	copied := *newCar
+	cp.txn.dirtyCars[carId] = &copied
+	return nil
+}
+
+func (cp *CarStorage) NewCar(ctx context.Context, car *models.Car) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, car.ID)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	car.Version = 1
+	if old != nil {
+		car.Version = old.Version + 1
+	}
+	copied := *car
+	cp.txn.dirtyCars[car.ID] = &copied
+	return nil
+}
+
+func (cp *CarStorage) DeleteById(ctx context.Context, carId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.dirtyCars[carId] = nil
+	return nil
+}
+
+func (cp *CarStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.carsReset = true
+	cp.txn.dirtyCars = make(map[uint]*models.Car)
+	return nil
+}
+
+// storedWithAtLeast returns the ids of the stored cars with at least the
+// given available seats, best fit first, at most limit of them unless it's 0
+func (cp *CarStorage) storedWithAtLeast(ctx context.Context, seats uint, limit int64) ([]uint, error) {
+	members, err := cp.txn.conn.ZRangeByScore(ctx, cp.txn.keys.carsBySeats(), &goredis.ZRangeBy{
+		Min:   strconv.FormatUint(uint64(seats), 10),
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		id, err := parseMember(m)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// shapeField is the field counting the cars of the shape of car
+func shapeField(car *models.Car) (string, error) {
+	data, err := json.Marshal(car.Shape())
+	return string(data), err
+}
+
+// pickable tells if a car changed in the transaction can take a group of the
+// given size, it's nil when deleted
+func pickable(car *models.Car, seats uint) bool {
+	return car != nil && !car.Draining && car.AvailableSeats >= seats
+}
+
+// fitsBetter tells if a leaves fewer seats empty than b, the lowest id first on ties
+func fitsBetter(a, b *models.Car) bool {
+	if a.AvailableSeats != b.AvailableSeats {
+		return a.AvailableSeats < b.AvailableSeats
+	}
+	return a.ID < b.ID
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// JourneysStorage keeps journeys as JSON in a hash by id
+type JourneysStorage struct {
+	txn *Transaction
+}
+
+func (cp *JourneysStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if journey, dirty := cp.txn.dirtyJourneys[journeyId]; dirty {
+		if journey == nil {
+			return nil, models.ErrNotFound
+		}
+		return cloneJourney(journey), nil
+	}
+	if cp.txn.journeysReset {
+		return nil, models.ErrNotFound
+	}
+
+	data, err := cp.txn.conn.HGet(ctx, cp.txn.keys.journeys(), field(journeyId)).Bytes()
+	if err == goredis.Nil {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeJourney(data)
+}
+
+func (cp *JourneysStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.dirtyJourneys[journeyId] = nil
+	return nil
+}
+
+func (cp *JourneysStorage) UpdateJourney(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("journey", journeyId, expectedVersion, old.Version)
+	}
+	newJourney.Version = old.Version + 1
+	cp.txn.dirtyJourneys[journeyId] = cloneJourney(newJourney)
+	return nil
+}
+
+func (cp *JourneysStorage) NewJourney(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journey.Id)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	journey.Version = 1
+	if old != nil {
+		journey.Version = old.Version + 1
+	}
+	cp.txn.dirtyJourneys[journey.Id] = cloneJourney(journey)
+	return nil
+}
+
+func (cp *JourneysStorage) GetAllJourneys(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var journeys []*models.Journey
+	if !cp.txn.journeysReset {
+		stored, err := cp.txn.conn.HGetAll(ctx, cp.txn.keys.journeys()).Result()
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for f, data := range stored {
+			id, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if _, dirty := cp.txn.dirtyJourneys[uint(id)]; dirty {
+				continue
+			}
+			journey, err := decodeJourney([]byte(data))
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			journeys = append(journeys, journey)
+		}
+	}
+	for _, journey := range cp.txn.dirtyJourneys {
+		if journey != nil {
+			journeys = append(journeys, cloneJourney(journey))
+		}
+	}
+	return journeys
+}
+
+func (cp *JourneysStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.journeysReset = true
+	cp.txn.dirtyJourneys = make(map[uint]*models.Journey)
+	return nil
+}
+
+// cloneJourney copies a journey including the car id it points to
+func cloneJourney(src *models.Journey) *models.Journey {
+	copied := *src
+	if src.CarID != nil {
+		copied.AssignCar(*src.CarID)
+	}
+	if src.PickupAt != nil {
+		pickupAt := *src.PickupAt
+		copied.PickupAt = &pickupAt
+	}
+	return &copied
+}
@@ -0,0 +1,289 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// PendingStorage keeps the waiting groups as JSON in a hash by id, along
+// with the sequence number they got on arrival. Every group size has a sorted
+// set of ids scored by sequence, and a set holds the sizes seen, so the oldest
+// group that fits some seats is at the head of one of a few sets. The groups
+// of the classes above standard have a sorted set per class and size too, and
+// a hash counts the groups of every owner.
+type PendingStorage struct {
+	txn *Transaction
+}
+
+// GetAllPendings returns the waiting groups in arrival order
+func (cp *PendingStorage) GetAllPendings(ctx context.Context) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var entries []*pendingEntry
+	if !cp.txn.pendingReset {
+		stored, err := cp.txn.conn.HGetAll(ctx, cp.txn.keys.pending()).Result()
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for f, data := range stored {
+			id, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if _, dirty := cp.txn.dirtyPending[uint(id)]; dirty {
+				continue
+			}
+			entry, err := decodePending([]byte(data))
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	for _, entry := range cp.txn.dirtyPending {
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	pending := make([]*models.Journey, 0, len(entries))
+	for _, entry := range entries {
+		pending = append(pending, cloneJourney(&entry.Journey))
+	}
+	return pending
+}
+
+func (cp *PendingStorage) FindByID(ctx context.Context, pendingId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, err := cp.find(ctx, pendingId)
+	if err != nil {
+		return nil, err
+	}
+	return cloneJourney(&entry.Journey), nil
+}
+
+// NextFitting returns the earliest arrived group of at most maxPassengers
+// whose needs free covers
+func (cp *PendingStorage) NextFitting(ctx context.Context, maxPassengers uint, free models.Features) (*models.Journey, error) {
+	return cp.next(ctx, maxPassengers, free, cp.txn.keys.pendingBySize, func(*pendingEntry) bool { return true })
+}
+
+// NextFittingOfClass returns the earliest arrived group of at most
+// maxPassengers whose needs free covers among those of class, standard ones
+// aren't indexed apart
+func (cp *PendingStorage) NextFittingOfClass(ctx context.Context, maxPassengers uint, free models.Features, class models.PriorityClass) (*models.Journey, error) {
+	if class.Rank() <= 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrNotFound
+	}
+	byClass := func(size uint) string { return cp.txn.keys.pendingByClass(class, size) }
+	return cp.next(ctx, maxPassengers, free, byClass, func(entry *pendingEntry) bool {
+		return entry.Journey.Class.Rank() == class.Rank()
+	})
+}
+
+// nextPage is how many ids next reads from a sorted set at a time, past the
+// groups changed in the transaction
+const nextPage = 16
+
+// next looks for the oldest group fitting maxPassengers and free in the
+// sorted sets named by setOf for every size seen, and among the groups
+// changed in this transaction that are in. A set is read page by page until
+// a group free covers, or one that arrived after the best so far.
+func (cp *PendingStorage) next(ctx context.Context, maxPassengers uint, free models.Features, setOf func(size uint) string, in func(*pendingEntry) bool) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fits := func(entry *pendingEntry) bool {
+		return entry.Journey.Passengers <= maxPassengers && free.Covers(entry.Journey.Features)
+	}
+	var best *pendingEntry
+	for _, entry := range cp.txn.dirtyPending {
+		if entry != nil && in(entry) && fits(entry) && (best == nil || entry.Seq < best.Seq) {
+			best = entry
+		}
+	}
+
+	if !cp.txn.pendingReset {
+		sizes, err := cp.txn.conn.SMembers(ctx, cp.txn.keys.pendingSizes()).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sizes {
+			size, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if uint(size) > maxPassengers {
+				continue
+			}
+			if best, err = cp.firstCovered(ctx, setOf(uint(size)), free, best); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, models.ErrNotFound
+	}
+	return cloneJourney(&best.Journey), nil
+}
+
+// firstCovered returns the oldest stored group of the sorted set whose needs
+// free covers when it arrived before best, or best. The groups changed in
+// this transaction are skipped, next has them looked at already.
+func (cp *PendingStorage) firstCovered(ctx context.Context, set string, free models.Features, best *pendingEntry) (*pendingEntry, error) {
+	page := int64(len(cp.txn.dirtyPending) + nextPage)
+	for start := int64(0); ; start += page {
+		heads, err := cp.txn.conn.ZRangeWithScores(ctx, set, start, start+page-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, head := range heads {
+			if best != nil && int64(head.Score) > best.Seq {
+				return best, nil
+			}
+			id, err := parseMember(head.Member.(string))
+			if err != nil {
+				return nil, err
+			}
+			if _, dirty := cp.txn.dirtyPending[id]; dirty {
+				continue
+			}
+			entry, err := cp.find(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if free.Covers(entry.Journey.Features) {
+				return entry, nil
+			}
+		}
+		if int64(len(heads)) < page {
+			return best, nil
+		}
+	}
+}
+
+// CountOwnedBy returns how many groups of owner are waiting, the stored count
+// corrected by the groups changed in this transaction
+func (cp *PendingStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	count := 0
+	if owner == "" {
+		return count, nil
+	}
+	if !cp.txn.pendingReset {
+		n, err := cp.txn.conn.HGet(ctx, cp.txn.keys.pendingOwners(), owner).Int()
+		if err != nil && err != goredis.Nil {
+			return 0, err
+		}
+		stored, err := cp.txn.storedOwners(ctx)
+		if err != nil {
+			return 0, err
+		}
+		count = n
+		for _, o := range stored {
+			if o == owner {
+				count--
+			}
+		}
+	}
+	for _, entry := range cp.txn.dirtyPending {
+		if entry != nil && entry.Journey.Owner == owner {
+			count++
+		}
+	}
+	if count < 0 {
+		count = 0
+	}
+	return count, nil
+}
+
+func (cp *PendingStorage) UpdatePending(ctx context.Context, pendingId uint, newPending *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entry, err := cp.find(ctx, pendingId)
+	if err != nil {
+		return err
+	}
+	if entry.Journey.Version != expectedVersion {
+		return models.NewConflictError("pending journey", pendingId, expectedVersion, entry.Journey.Version)
+	}
+	newPending.Version = entry.Journey.Version + 1
+	cp.txn.dirtyPending[pendingId] = &pendingEntry{Journey: *cloneJourney(newPending), Seq: entry.Seq}
+	return nil
+}
+
+func (cp *PendingStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.dirtyPending[journeyId] = nil
+	return nil
+}
+
+func (cp *PendingStorage) NewPending(ctx context.Context, pending *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// sequences are taken right away, a rolled back transaction only leaves a gap
+	old, err := cp.find(ctx, pending.Id)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	seq, err := cp.txn.conn.Incr(ctx, cp.txn.keys.pendingSeq()).Result()
+	if err != nil {
+		return err
+	}
+	pending.Version = 1
+	if old != nil {
+		pending.Version = old.Journey.Version + 1
+	}
+	cp.txn.dirtyPending[pending.Id] = &pendingEntry{Journey: *cloneJourney(pending), Seq: seq}
+	return nil
+}
+
+func (cp *PendingStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.pendingReset = true
+	cp.txn.dirtyPending = make(map[uint]*pendingEntry)
+	return nil
+}
+
+func (cp *PendingStorage) find(ctx context.Context, pendingId uint) (*pendingEntry, error) {
+	if entry, dirty := cp.txn.dirtyPending[pendingId]; dirty {
+		if entry == nil {
+			return nil, models.ErrNotFound
+		}
+		return entry, nil
+	}
+	if cp.txn.pendingReset {
+		return nil, models.ErrNotFound
+	}
+
+	data, err := cp.txn.conn.HGet(ctx, cp.txn.keys.pending(), field(pendingId)).Bytes()
+	if err == goredis.Nil {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePending(data)
+}
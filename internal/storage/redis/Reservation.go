@@ -0,0 +1,149 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// ReservationStorage keeps the reservations as JSON in a hash by journey id,
+// and the ids in a sorted set scored by expiry in milliseconds, read like the
+// scheduled journeys
+type ReservationStorage struct {
+	txn *Transaction
+}
+
+// reservationRecord keeps the owner the model leaves out of its JSON
+type reservationRecord struct {
+	*models.Reservation
+	Owner string `json:"owner,omitempty"`
+}
+
+func encodeReservation(reservation *models.Reservation) ([]byte, error) {
+	return json.Marshal(reservationRecord{Reservation: reservation, Owner: reservation.Owner})
+}
+
+func decodeReservation(data []byte) (*models.Reservation, error) {
+	rec := reservationRecord{Reservation: &models.Reservation{}}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Reservation.Owner = rec.Owner
+	return rec.Reservation, nil
+}
+
+func (cp *ReservationStorage) NewReservation(ctx context.Context, reservation *models.Reservation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	copied := *reservation
+	cp.txn.dirtyReservations[reservation.JourneyID] = &copied
+	return nil
+}
+
+func (cp *ReservationStorage) FindById(ctx context.Context, journeyId uint) (*models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if reservation, dirty := cp.txn.dirtyReservations[journeyId]; dirty {
+		if reservation == nil {
+			return nil, models.ErrNotFound
+		}
+		copied := *reservation
+		return &copied, nil
+	}
+	if cp.txn.reservationsReset {
+		return nil, models.ErrNotFound
+	}
+
+	data, err := cp.txn.conn.HGet(ctx, cp.txn.keys.reservations(), field(journeyId)).Bytes()
+	if err == goredis.Nil {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeReservation(data)
+}
+
+func (cp *ReservationStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.dirtyReservations[journeyId] = nil
+	return nil
+}
+
+func (cp *ReservationStorage) Expired(ctx context.Context, until time.Time) []*models.Reservation {
+	return cp.reservationsUntil(ctx, strconv.FormatInt(millis(until), 10), func(r *models.Reservation) bool {
+		return !r.ExpiresAt.After(until)
+	})
+}
+
+func (cp *ReservationStorage) GetAllReservations(ctx context.Context) []*models.Reservation {
+	return cp.reservationsUntil(ctx, "+inf", func(*models.Reservation) bool { return true })
+}
+
+func (cp *ReservationStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.reservationsReset = true
+	cp.txn.dirtyReservations = make(map[uint]*models.Reservation)
+	return nil
+}
+
+// reservationsUntil returns the reservations scored up to max that keep says
+// so, the ones changed in the transaction included, earliest expiry first
+func (cp *ReservationStorage) reservationsUntil(ctx context.Context, max string, keep func(*models.Reservation) bool) []*models.Reservation {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var reservations []*models.Reservation
+	if !cp.txn.reservationsReset {
+		members, err := cp.txn.conn.ZRangeByScore(ctx, cp.txn.keys.reservationsByExpiry(), &goredis.ZRangeBy{
+			Min: "-inf",
+			Max: max,
+		}).Result()
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for _, m := range members {
+			id, err := parseMember(m)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if _, dirty := cp.txn.dirtyReservations[id]; dirty {
+				continue
+			}
+			reservation, err := cp.FindById(ctx, id)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if keep(reservation) {
+				reservations = append(reservations, reservation)
+			}
+		}
+	}
+	for _, reservation := range cp.txn.dirtyReservations {
+		if reservation != nil && keep(reservation) {
+			copied := *reservation
+			reservations = append(reservations, &copied)
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].ExpiresAt.Equal(reservations[j].ExpiresAt) {
+			return reservations[i].ExpiresAt.Before(reservations[j].ExpiresAt)
+		}
+		return reservations[i].JourneyID < reservations[j].JourneyID
+	})
+	return reservations
+}
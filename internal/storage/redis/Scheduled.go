@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// ScheduledStorage keeps the journeys booked ahead as JSON in a hash by id,
+// and the ids in a sorted set scored by pickup time in milliseconds. The
+// score only narrows the lookup down, the due ones are told by the stored time.
+type ScheduledStorage struct {
+	txn *Transaction
+}
+
+func (cp *ScheduledStorage) NewScheduled(ctx context.Context, journey *models.Journey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journey.Id)
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	journey.Version = 1
+	if old != nil {
+		journey.Version = old.Version + 1
+	}
+	cp.txn.dirtyScheduled[journey.Id] = cloneJourney(journey)
+	return nil
+}
+
+func (cp *ScheduledStorage) FindById(ctx context.Context, journeyId uint) (*models.Journey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if journey, dirty := cp.txn.dirtyScheduled[journeyId]; dirty {
+		if journey == nil {
+			return nil, models.ErrNotFound
+		}
+		return cloneJourney(journey), nil
+	}
+	if cp.txn.scheduledReset {
+		return nil, models.ErrNotFound
+	}
+
+	data, err := cp.txn.conn.HGet(ctx, cp.txn.keys.scheduled(), field(journeyId)).Bytes()
+	if err == goredis.Nil {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeJourney(data)
+}
+
+func (cp *ScheduledStorage) UpdateScheduled(ctx context.Context, journeyId uint, newJourney *models.Journey, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	old, err := cp.FindById(ctx, journeyId)
+	if err != nil {
+		return err
+	}
+	if old.Version != expectedVersion {
+		return models.NewConflictError("scheduled journey", journeyId, expectedVersion, old.Version)
+	}
+	newJourney.Version = old.Version + 1
+	cp.txn.dirtyScheduled[journeyId] = cloneJourney(newJourney)
+	return nil
+}
+
+func (cp *ScheduledStorage) DeleteById(ctx context.Context, journeyId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.dirtyScheduled[journeyId] = nil
+	return nil
+}
+
+func (cp *ScheduledStorage) Due(ctx context.Context, until time.Time) []*models.Journey {
+	return cp.scheduledUntil(ctx, strconv.FormatInt(millis(until), 10), func(j *models.Journey) bool {
+		return !j.PickupAt.After(until)
+	})
+}
+
+func (cp *ScheduledStorage) GetAllScheduled(ctx context.Context) []*models.Journey {
+	return cp.scheduledUntil(ctx, "+inf", func(*models.Journey) bool { return true })
+}
+
+// CountOwnedBy returns how many journeys of owner are scheduled, the ones
+// changed in the transaction included
+func (cp *ScheduledStorage) CountOwnedBy(ctx context.Context, owner string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if owner == "" {
+		return 0, nil
+	}
+	count := 0
+	if !cp.txn.scheduledReset {
+		values, err := cp.txn.conn.HGetAll(ctx, cp.txn.keys.scheduled()).Result()
+		if err != nil {
+			return 0, err
+		}
+		for f, data := range values {
+			id, err := parseMember(f)
+			if err != nil {
+				return 0, err
+			}
+			if _, dirty := cp.txn.dirtyScheduled[id]; dirty {
+				continue
+			}
+			journey, err := decodeJourney([]byte(data))
+			if err != nil {
+				return 0, err
+			}
+			if journey.Owner == owner {
+				count++
+			}
+		}
+	}
+	for _, journey := range cp.txn.dirtyScheduled {
+		if journey != nil && journey.Owner == owner {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (cp *ScheduledStorage) ResetMemory(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cp.txn.scheduledReset = true
+	cp.txn.dirtyScheduled = make(map[uint]*models.Journey)
+	return nil
+}
+
+// scheduledUntil returns the journeys scored up to max that keep says so,
+// the ones changed in the transaction included, earliest first
+func (cp *ScheduledStorage) scheduledUntil(ctx context.Context, max string, keep func(*models.Journey) bool) []*models.Journey {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var journeys []*models.Journey
+	if !cp.txn.scheduledReset {
+		members, err := cp.txn.conn.ZRangeByScore(ctx, cp.txn.keys.scheduledByTime(), &goredis.ZRangeBy{
+			Min: "-inf",
+			Max: max,
+		}).Result()
+		if err != nil {
+			cp.txn.fail(err)
+		}
+		for _, m := range members {
+			id, err := parseMember(m)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if _, dirty := cp.txn.dirtyScheduled[id]; dirty {
+				continue
+			}
+			journey, err := cp.FindById(ctx, id)
+			if err != nil {
+				cp.txn.fail(err)
+				continue
+			}
+			if keep(journey) {
+				journeys = append(journeys, journey)
+			}
+		}
+	}
+	for _, journey := range cp.txn.dirtyScheduled {
+		if journey != nil && keep(journey) {
+			journeys = append(journeys, cloneJourney(journey))
+		}
+	}
+
+	sort.Slice(journeys, func(i, j int) bool {
+		if !journeys[i].PickupAt.Equal(*journeys[j].PickupAt) {
+			return journeys[i].PickupAt.Before(*journeys[j].PickupAt)
+		}
+		return journeys[i].Id < journeys[j].Id
+	})
+	return journeys
+}
+
+// millis is the sorted set score of a pickup time
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
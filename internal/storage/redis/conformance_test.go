@@ -0,0 +1,91 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/redis"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/storagetest"
+)
+
+func newFactory(t *testing.T, server *miniredis.Miniredis) *redis.TransactionFactory {
+	f := redis.New(goredis.NewClient(&goredis.Options{Addr: server.Addr()}), "carpool:")
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) models.TransactionFactory {
+		return newFactory(t, miniredis.RunT(t))
+	})
+}
+
+func TestCommit_ConflictsWithConcurrentCommit(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	replicaA, replicaB := newFactory(t, server), newFactory(t, server)
+
+	first, err := replicaA.Begin(ctx)
+	require.NoError(t, err)
+	second, err := replicaB.Begin(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, first.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+	require.NoError(t, second.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 6, AvailableSeats: 6}))
+	require.NoError(t, first.Commit(ctx))
+	assert.Equal(t, models.ErrConflict, second.Commit(ctx))
+	assert.False(t, second.HasCommited())
+
+	txn, err := replicaB.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	car, err := txn.CarsStorage().FindById(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint(4), car.Seats)
+}
+
+func TestReplicas_ShareTheFleet(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	replicas := []*services.CarPool{
+		services.NewCarPool(newFactory(t, server)),
+		services.NewCarPool(newFactory(t, server)),
+	}
+	require.NoError(t, replicas[0].ResetCars(ctx, []*models.Car{
+		{ID: 1, Seats: 4, AvailableSeats: 4},
+		{ID: 2, Seats: 6, AvailableSeats: 6},
+	}))
+
+	// groups racing on both replicas fill the 10 seats exactly. A commit only
+	// conflicts when another one went through, so none of the 5 runs out of attempts.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, replicas[i%2].NewJourney(ctx, &models.Journey{Id: uint(i + 1), Passengers: 2}))
+		}(i)
+	}
+	wg.Wait()
+
+	txn, err := newFactory(t, server).Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	for _, car := range txn.CarsStorage().GetAllCars(ctx) {
+		assert.Equal(t, uint(0), car.AvailableSeats, "car %d", car.ID)
+	}
+	assert.Empty(t, txn.PendingsStorage().GetAllPendings(ctx))
+	for id := uint(1); id <= 5; id++ {
+		journey, err := txn.JourneysStorage().FindById(ctx, id)
+		if assert.NoError(t, err) {
+			assert.True(t, journey.IsAssigned(), "journey %d", id)
+		}
+	}
+}
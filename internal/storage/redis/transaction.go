@@ -0,0 +1,453 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+var errTxnFinished = errors.New("transaction already finished")
+
+type pendingEntry struct {
+	Journey     models.Journey `json:"journey"`
+	Seq         int64          `json:"seq"`
+	Version     uint64         `json:"version"`
+	Owner       string         `json:"owner,omitempty"`
+	RequestedAt time.Time      `json:"requestedAt"`
+}
+
+// Records wrap the models to store their version and owner, which the models
+// leave out of their JSON since they aren't part of the API
+
+type carRecord struct {
+	*models.Car
+	Version uint64          `json:"version"`
+	InUse   models.Features `json:"inUse"`
+}
+
+type journeyRecord struct {
+	*models.Journey
+	Version     uint64    `json:"version"`
+	Owner       string    `json:"owner,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+func encodeCar(car *models.Car) ([]byte, error) {
+	return json.Marshal(carRecord{Car: car, Version: car.Version, InUse: car.InUse})
+}
+
+func decodeCar(data []byte) (*models.Car, error) {
+	rec := carRecord{Car: &models.Car{}}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Car.Version = rec.Version
+	rec.Car.InUse = rec.InUse
+	return rec.Car, nil
+}
+
+func encodeJourney(journey *models.Journey) ([]byte, error) {
+	return json.Marshal(journeyRecord{Journey: journey, Version: journey.Version, Owner: journey.Owner, RequestedAt: journey.RequestedAt})
+}
+
+func decodeJourney(data []byte) (*models.Journey, error) {
+	rec := journeyRecord{Journey: &models.Journey{}}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	rec.Journey.Version = rec.Version
+	rec.Journey.Owner = rec.Owner
+	rec.Journey.RequestedAt = rec.RequestedAt
+	return rec.Journey, nil
+}
+
+func encodePending(entry *pendingEntry) ([]byte, error) {
+	entry.Version = entry.Journey.Version
+	entry.Owner = entry.Journey.Owner
+	entry.RequestedAt = entry.Journey.RequestedAt
+	return json.Marshal(entry)
+}
+
+func decodePending(data []byte) (*pendingEntry, error) {
+	var entry pendingEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	entry.Journey.Version = entry.Version
+	entry.Journey.Owner = entry.Owner
+	entry.Journey.RequestedAt = entry.RequestedAt
+	return &entry, nil
+}
+
+// Transaction reads through its own buffered writes: a storage that was reset
+// ignores what the server holds, and an id in a dirty map shadows the server
+// copy, a nil value meaning deleted
+type Transaction struct {
+	conn *goredis.Conn
+	keys keys
+
+	carsReset     bool
+	dirtyCars     map[uint]*models.Car
+	journeysReset bool
+	dirtyJourneys map[uint]*models.Journey
+	pendingReset  bool
+	dirtyPending  map[uint]*pendingEntry
+	// scheduledReset and dirtyScheduled buffer the journeys booked ahead
+	scheduledReset bool
+	dirtyScheduled map[uint]*models.Journey
+	// reservationsReset and dirtyReservations buffer the seats held
+	reservationsReset bool
+	dirtyReservations map[uint]*models.Reservation
+
+	// err is the first failure of a read that couldn't report it, the
+	// transaction can't commit after it
+	err error
+
+	committed bool
+	finished  bool
+}
+
+func newTransaction(conn *goredis.Conn, keys keys) *Transaction {
+	return &Transaction{
+		conn:              conn,
+		keys:              keys,
+		dirtyCars:         make(map[uint]*models.Car),
+		dirtyJourneys:     make(map[uint]*models.Journey),
+		dirtyPending:      make(map[uint]*pendingEntry),
+		dirtyScheduled:    make(map[uint]*models.Journey),
+		dirtyReservations: make(map[uint]*models.Reservation),
+	}
+}
+
+func (u *Transaction) CarsStorage() models.ICarStorage {
+	return &CarStorage{txn: u}
+}
+
+func (u *Transaction) JourneysStorage() models.IJourneyStorage {
+	return &JourneysStorage{txn: u}
+}
+
+func (u *Transaction) PendingsStorage() models.IPenidngStorage {
+	return &PendingStorage{txn: u}
+}
+
+func (u *Transaction) ScheduledStorage() models.IScheduledStorage {
+	return &ScheduledStorage{txn: u}
+}
+
+func (u *Transaction) ReservationsStorage() models.IReservationStorage {
+	return &ReservationStorage{txn: u}
+}
+
+func (u *Transaction) Commit(ctx context.Context) error {
+	if u.finished {
+		return errTxnFinished
+	}
+	if err := ctx.Err(); err != nil {
+		u.Rollback()
+		return err
+	}
+	u.finished = true
+	defer u.conn.Close()
+
+	if u.err != nil {
+		u.unwatch()
+		return u.err
+	}
+
+	shapes, err := u.storedShapes(ctx)
+	if err != nil {
+		u.unwatch()
+		return err
+	}
+	var sizes []string
+	var owners map[uint]string
+	if u.pendingReset || len(u.dirtyPending) > 0 {
+		var err error
+		if sizes, err = u.conn.SMembers(ctx, u.keys.pendingSizes()).Result(); err != nil {
+			u.unwatch()
+			return err
+		}
+		if owners, err = u.storedOwners(ctx); err != nil {
+			u.unwatch()
+			return err
+		}
+	}
+
+	_, err = u.conn.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		if err := u.writeCars(ctx, pipe, shapes); err != nil {
+			return err
+		}
+		if err := u.writeJourneys(ctx, pipe); err != nil {
+			return err
+		}
+		if err := u.writePending(ctx, pipe, sizes, owners); err != nil {
+			return err
+		}
+		if err := u.writeScheduled(ctx, pipe); err != nil {
+			return err
+		}
+		if err := u.writeReservations(ctx, pipe); err != nil {
+			return err
+		}
+		pipe.Incr(ctx, u.keys.version())
+		return nil
+	})
+	if err == goredis.TxFailedErr {
+		return models.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	u.committed = true
+	return nil
+}
+
+func (u *Transaction) HasCommited() bool {
+	return u.committed
+}
+
+func (u *Transaction) Rollback() error {
+	if u.finished {
+		return nil
+	}
+	u.finished = true
+	defer u.conn.Close()
+	return u.unwatch()
+}
+
+// unwatch runs even when the request is gone, the connection goes back to the pool
+func (u *Transaction) unwatch() error {
+	ctx := context.Background()
+	return u.conn.Process(ctx, goredis.NewStatusCmd(ctx, "unwatch"))
+}
+
+// fail keeps the first error of a read that can't return it
+func (u *Transaction) fail(err error) {
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+// storedShapes returns the shapes the server counts the cars changed in this
+// transaction under, draining ones are left out
+func (u *Transaction) storedShapes(ctx context.Context) (map[uint]string, error) {
+	shapes := make(map[uint]string)
+	if u.carsReset || len(u.dirtyCars) == 0 {
+		return shapes, nil
+	}
+	ids := make([]uint, 0, len(u.dirtyCars))
+	fields := make([]string, 0, len(u.dirtyCars))
+	for id := range u.dirtyCars {
+		ids = append(ids, id)
+		fields = append(fields, field(id))
+	}
+	stored, err := u.conn.HMGet(ctx, u.keys.cars(), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, data := range stored {
+		s, ok := data.(string)
+		if !ok {
+			continue
+		}
+		car, err := decodeCar([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		if car.Draining {
+			continue
+		}
+		if shapes[ids[i]], err = shapeField(car); err != nil {
+			return nil, err
+		}
+	}
+	return shapes, nil
+}
+
+// writeCars takes the shapes the changed cars were counted under, to move
+// their counts
+func (u *Transaction) writeCars(ctx context.Context, pipe goredis.Pipeliner, shapes map[uint]string) error {
+	if u.carsReset {
+		pipe.Del(ctx, u.keys.cars(), u.keys.carsBySeats(), u.keys.carShapes())
+	}
+	for id, car := range u.dirtyCars {
+		if shape, stored := shapes[id]; stored {
+			pipe.HIncrBy(ctx, u.keys.carShapes(), shape, -1)
+		}
+		if car != nil && !car.Draining {
+			shape, err := shapeField(car)
+			if err != nil {
+				return err
+			}
+			pipe.HIncrBy(ctx, u.keys.carShapes(), shape, 1)
+		}
+		if car == nil {
+			pipe.HDel(ctx, u.keys.cars(), field(id))
+			pipe.ZRem(ctx, u.keys.carsBySeats(), member(id))
+			continue
+		}
+		data, err := encodeCar(car)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, u.keys.cars(), field(id), data)
+		if car.Draining {
+			pipe.ZRem(ctx, u.keys.carsBySeats(), member(id))
+			continue
+		}
+		pipe.ZAdd(ctx, u.keys.carsBySeats(), &goredis.Z{Score: float64(car.AvailableSeats), Member: member(id)})
+	}
+	return nil
+}
+
+func (u *Transaction) writeJourneys(ctx context.Context, pipe goredis.Pipeliner) error {
+	if u.journeysReset {
+		pipe.Del(ctx, u.keys.journeys())
+	}
+	for id, journey := range u.dirtyJourneys {
+		if journey == nil {
+			pipe.HDel(ctx, u.keys.journeys(), field(id))
+			continue
+		}
+		data, err := encodeJourney(journey)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, u.keys.journeys(), field(id), data)
+	}
+	return nil
+}
+
+// storedOwners returns the owners the server has for the groups changed in
+// this transaction, those it holds without one are left out
+func (u *Transaction) storedOwners(ctx context.Context) (map[uint]string, error) {
+	owners := make(map[uint]string)
+	if u.pendingReset || len(u.dirtyPending) == 0 {
+		return owners, nil
+	}
+	ids := make([]uint, 0, len(u.dirtyPending))
+	fields := make([]string, 0, len(u.dirtyPending))
+	for id := range u.dirtyPending {
+		ids = append(ids, id)
+		fields = append(fields, field(id))
+	}
+	stored, err := u.conn.HMGet(ctx, u.keys.pending(), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, data := range stored {
+		s, ok := data.(string)
+		if !ok {
+			continue
+		}
+		entry, err := decodePending([]byte(s))
+		if err != nil {
+			return nil, err
+		}
+		if entry.Journey.Owner != "" {
+			owners[ids[i]] = entry.Journey.Owner
+		}
+	}
+	return owners, nil
+}
+
+// writePending takes the sizes queued on the server, to clear the group ids
+// from all of them, and the owners the changed groups had, to move their counts
+func (u *Transaction) writePending(ctx context.Context, pipe goredis.Pipeliner, sizes []string, owners map[uint]string) error {
+	sizeKeys := make([]string, 0, len(sizes))
+	for _, s := range sizes {
+		size, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		sizeKeys = append(sizeKeys, u.keys.pendingBySize(uint(size)))
+		for _, class := range models.PriorityClasses {
+			if class.Rank() > 0 {
+				sizeKeys = append(sizeKeys, u.keys.pendingByClass(class, uint(size)))
+			}
+		}
+	}
+
+	if u.pendingReset {
+		pipe.Del(ctx, append([]string{u.keys.pending(), u.keys.pendingSizes(), u.keys.pendingOwners()}, sizeKeys...)...)
+	}
+	for id, entry := range u.dirtyPending {
+		if owner, stored := owners[id]; stored {
+			pipe.HIncrBy(ctx, u.keys.pendingOwners(), owner, -1)
+		}
+		if entry != nil && entry.Journey.Owner != "" {
+			pipe.HIncrBy(ctx, u.keys.pendingOwners(), entry.Journey.Owner, 1)
+		}
+		// the group may be queued under its old size or class, there are only a
+		// few of them
+		if !u.pendingReset {
+			for _, key := range sizeKeys {
+				pipe.ZRem(ctx, key, member(id))
+			}
+		}
+		if entry == nil {
+			pipe.HDel(ctx, u.keys.pending(), field(id))
+			continue
+		}
+
+		data, err := encodePending(entry)
+		if err != nil {
+			return err
+		}
+		size := entry.Journey.Passengers
+		pipe.HSet(ctx, u.keys.pending(), field(id), data)
+		pipe.ZAdd(ctx, u.keys.pendingBySize(size), &goredis.Z{Score: float64(entry.Seq), Member: member(id)})
+		pipe.SAdd(ctx, u.keys.pendingSizes(), strconv.FormatUint(uint64(size), 10))
+		if entry.Journey.Class.Rank() > 0 {
+			pipe.ZAdd(ctx, u.keys.pendingByClass(entry.Journey.Class, size), &goredis.Z{Score: float64(entry.Seq), Member: member(id)})
+		}
+	}
+	return nil
+}
+
+func (u *Transaction) writeScheduled(ctx context.Context, pipe goredis.Pipeliner) error {
+	if u.scheduledReset {
+		pipe.Del(ctx, u.keys.scheduled(), u.keys.scheduledByTime())
+	}
+	for id, journey := range u.dirtyScheduled {
+		if journey == nil {
+			pipe.HDel(ctx, u.keys.scheduled(), field(id))
+			pipe.ZRem(ctx, u.keys.scheduledByTime(), member(id))
+			continue
+		}
+		data, err := encodeJourney(journey)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, u.keys.scheduled(), field(id), data)
+		pipe.ZAdd(ctx, u.keys.scheduledByTime(), &goredis.Z{Score: float64(millis(*journey.PickupAt)), Member: member(id)})
+	}
+	return nil
+}
+
+func (u *Transaction) writeReservations(ctx context.Context, pipe goredis.Pipeliner) error {
+	if u.reservationsReset {
+		pipe.Del(ctx, u.keys.reservations(), u.keys.reservationsByExpiry())
+	}
+	for id, reservation := range u.dirtyReservations {
+		if reservation == nil {
+			pipe.HDel(ctx, u.keys.reservations(), field(id))
+			pipe.ZRem(ctx, u.keys.reservationsByExpiry(), member(id))
+			continue
+		}
+		data, err := encodeReservation(reservation)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, u.keys.reservations(), field(id), data)
+		pipe.ZAdd(ctx, u.keys.reservationsByExpiry(), &goredis.Z{Score: float64(millis(reservation.ExpiresAt)), Member: member(id)})
+	}
+	return nil
+}
@@ -0,0 +1,1170 @@
+// Package storagetest checks that a storage backend behaves the way the
+// services expect. A backend wires it up from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) models.TransactionFactory {
+//			return NewTransactionFactory()
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// NewFactory returns a factory over empty storages, one per subtest
+type NewFactory func(t *testing.T) models.TransactionFactory
+
+// Run runs the whole suite against the backend built by newFactory
+func Run(t *testing.T, newFactory NewFactory) {
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, f models.TransactionFactory)
+	}{
+		{"Cars", testCars},
+		{"CarSeatLookups", testCarSeatLookups},
+		{"DrainingCars", testDrainingCars},
+		{"Journeys", testJourneys},
+		{"PendingOrder", testPendingOrder},
+		{"PendingClasses", testPendingClasses},
+		{"PendingNeeds", testPendingNeeds},
+		{"Scheduled", testScheduled},
+		{"Reservations", testReservations},
+		{"Reset", testReset},
+		{"Versions", testVersions},
+		{"Owners", testOwners},
+		{"OwnerCounts", testOwnerCounts},
+		{"ScheduledOwnerCounts", testScheduledOwnerCounts},
+		{"Features", testFeatures},
+		{"CarShapes", testCarShapes},
+		{"HandsOutCopies", testHandsOutCopies},
+		{"CommitIsVisible", testCommitIsVisible},
+		{"RollbackRestoresState", testRollbackRestoresState},
+		{"RolledBackWritesAreNeverSeen", testRolledBackWritesAreNeverSeen},
+		{"ConcurrentTransactions", testConcurrentTransactions},
+		{"CanceledContext", testCanceledContext},
+		{"BeginGivesUpWaiting", testBeginGivesUpWaiting},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newFactory(t))
+		})
+	}
+}
+
+// inTxn runs fn in a transaction and commits it
+func inTxn(t *testing.T, f models.TransactionFactory, fn func(txn models.Transaction)) {
+	t.Helper()
+	ctx := context.Background()
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	fn(txn)
+	require.NoError(t, txn.Commit(ctx))
+}
+
+// read runs fn in a transaction that is rolled back afterwards
+func read(t *testing.T, f models.TransactionFactory, fn func(txn models.Transaction)) {
+	t.Helper()
+	ctx := context.Background()
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	fn(txn)
+}
+
+func carIds(cars []*models.Car) []uint {
+	ids := []uint{}
+	for _, c := range cars {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func journeyIds(journeys []*models.Journey) []uint {
+	ids := []uint{}
+	for _, j := range journeys {
+		ids = append(ids, j.Id)
+	}
+	return ids
+}
+
+func testCars(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		_, err := cars.FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.Equal(t, models.ErrNotFound, cars.UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}, 0))
+
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6}))
+		require.NoError(t, cars.UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 1}, 1))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		car, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, models.Car{ID: 1, Seats: 4, AvailableSeats: 1, Version: 2}, *car)
+
+		all := txn.CarsStorage().GetAllCars(ctx)
+		sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+		require.Len(t, all, 2)
+		assert.Equal(t, models.Car{ID: 2, Seats: 6, AvailableSeats: 6, Version: 1}, *all[1])
+	})
+}
+
+func testCarSeatLookups(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		for _, c := range []models.Car{
+			{ID: 4, Seats: 6, AvailableSeats: 6},
+			{ID: 3, Seats: 5, AvailableSeats: 3},
+			{ID: 2, Seats: 5, AvailableSeats: 5},
+			{ID: 1, Seats: 5, AvailableSeats: 5},
+		} {
+			c := c
+			require.NoError(t, txn.CarsStorage().NewCar(ctx, &c))
+		}
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		for seats, want := range map[uint]uint{1: 3, 3: 3, 4: 1, 5: 1, 6: 4} {
+			car, err := cars.FindBestFit(ctx, seats)
+			if assert.NoError(t, err, "FindBestFit(%d)", seats) {
+				assert.Equal(t, want, car.ID, "FindBestFit(%d)", seats)
+			}
+		}
+		_, err := cars.FindBestFit(ctx, 7)
+		assert.Equal(t, models.ErrNotFound, err)
+
+		assert.Equal(t, []uint{1, 2, 4}, carIds(cars.CarsWithAtLeast(ctx, 4)))
+		assert.Empty(t, cars.CarsWithAtLeast(ctx, 7))
+	})
+
+	// lookups follow seat changes
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 3, &models.Car{ID: 3, Seats: 5, AvailableSeats: 0}, 1))
+	})
+	read(t, f, func(txn models.Transaction) {
+		car, err := txn.CarsStorage().FindBestFit(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), car.ID)
+	})
+}
+
+func testDrainingCars(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 2}))
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6}))
+		require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 2, Draining: true}, 1))
+
+		// the transaction itself no longer picks the draining car
+		car, err := txn.CarsStorage().FindBestFit(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), car.ID)
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		car, err := cars.FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, car.Draining)
+		assert.Equal(t, []uint{2}, carIds(cars.CarsWithAtLeast(ctx, 1)))
+		_, err = cars.FindBestFit(ctx, 5)
+		assert.NoError(t, err)
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().DeleteById(ctx, 1))
+		require.NoError(t, txn.CarsStorage().DeleteById(ctx, 3))
+		_, err := txn.CarsStorage().FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		require.NoError(t, txn.CarsStorage().DeleteById(ctx, 2))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Empty(t, txn.CarsStorage().GetAllCars(ctx))
+		_, err := txn.CarsStorage().FindBestFit(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
+
+func testJourneys(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		journeys := txn.JourneysStorage()
+		_, err := journeys.FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.Equal(t, models.ErrNotFound, journeys.UpdateJourney(ctx, 1, &models.Journey{Id: 1, Passengers: 2}, 0))
+		assert.NoError(t, journeys.DeleteById(ctx, 1), "deleting a missing journey is not an error")
+
+		require.NoError(t, journeys.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2}))
+		require.NoError(t, journeys.NewJourney(ctx, &models.Journey{Id: 2, Passengers: 3}))
+		assigned := &models.Journey{Id: 1, Passengers: 2}
+		assigned.AssignCar(7)
+		require.NoError(t, journeys.UpdateJourney(ctx, 1, assigned, 1))
+		require.NoError(t, journeys.DeleteById(ctx, 2))
+		require.NoError(t, journeys.NewJourney(ctx, &models.Journey{Id: 3, Passengers: 1}))
+		assert.ElementsMatch(t, []uint{1, 3}, journeyIds(journeys.GetAllJourneys(ctx)))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		journey, err := txn.JourneysStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), journey.Passengers)
+		if assert.True(t, journey.IsAssigned()) {
+			assert.Equal(t, uint(7), *journey.CarID)
+		}
+
+		_, err = txn.JourneysStorage().FindById(ctx, 2)
+		assert.Equal(t, models.ErrNotFound, err)
+
+		all := txn.JourneysStorage().GetAllJourneys(ctx)
+		assert.ElementsMatch(t, []uint{1, 3}, journeyIds(all))
+		for _, j := range all {
+			assert.Equal(t, j.Id == 1, j.IsAssigned(), "journey %d", j.Id)
+		}
+	})
+}
+
+func testPendingOrder(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		_, err := pending.NextFitting(ctx, 6, models.Features{})
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.Equal(t, models.ErrNotFound, pending.UpdatePending(ctx, 1, &models.Journey{Id: 1, Passengers: 1}, 0))
+		assert.NoError(t, pending.DeleteById(ctx, 1), "deleting a missing group is not an error")
+
+		for id, passengers := range []uint{6, 2, 4, 2, 1} {
+			require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: uint(id + 1), Passengers: passengers}))
+		}
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		assert.Equal(t, []uint{1, 2, 3, 4, 5}, journeyIds(pending.GetAllPendings(ctx)))
+
+		for seats, want := range map[uint]uint{6: 1, 5: 2, 2: 2, 1: 5} {
+			p, err := pending.NextFitting(ctx, seats, models.Features{})
+			if assert.NoError(t, err, "NextFitting(%d)", seats) {
+				assert.Equal(t, want, p.Id, "NextFitting(%d)", seats)
+			}
+		}
+		_, err := pending.NextFitting(ctx, 0, models.Features{})
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.PendingsStorage().DeleteById(ctx, 2))
+		// a group changing size keeps its place in the queue
+		require.NoError(t, txn.PendingsStorage().UpdatePending(ctx, 3, &models.Journey{Id: 3, Passengers: 1}, 1))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		assert.Equal(t, []uint{1, 3, 4, 5}, journeyIds(pending.GetAllPendings(ctx)))
+		p, err := pending.NextFitting(ctx, 2, models.Features{})
+		require.NoError(t, err)
+		assert.Equal(t, uint(3), p.Id)
+		assert.Equal(t, uint(1), p.Passengers)
+	})
+}
+
+func testPendingClasses(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	requested := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	groups := []*models.Journey{
+		{Id: 1, Passengers: 2, Class: models.ClassPriority},
+		{Id: 2, Passengers: 4},
+		{Id: 3, Passengers: 3, Class: models.ClassAccessibility},
+		{Id: 4, Passengers: 1, Class: models.ClassPriority, RequestedAt: requested},
+		{Id: 5, Passengers: 2, Class: models.ClassStandard},
+	}
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		for _, p := range groups {
+			require.NoError(t, pending.NewPending(ctx, p))
+		}
+		// the transaction sees its own writes
+		p, err := pending.NextFittingOfClass(ctx, 6, models.Features{}, models.ClassAccessibility)
+		require.NoError(t, err)
+		assert.Equal(t, uint(3), p.Id)
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		for _, tc := range []struct {
+			class models.PriorityClass
+			seats uint
+			want  uint
+		}{
+			{models.ClassPriority, 6, 1},
+			{models.ClassPriority, 1, 4},
+			{models.ClassAccessibility, 3, 3},
+			{models.ClassAccessibility, 2, 0},
+			{models.ClassStandard, 6, 0},
+		} {
+			p, err := pending.NextFittingOfClass(ctx, tc.seats, models.Features{}, tc.class)
+			if tc.want == 0 {
+				assert.Equal(t, models.ErrNotFound, err, "NextFittingOfClass(%d, %s)", tc.seats, tc.class)
+				continue
+			}
+			if assert.NoError(t, err, "NextFittingOfClass(%d, %s)", tc.seats, tc.class) {
+				assert.Equal(t, tc.want, p.Id, "NextFittingOfClass(%d, %s)", tc.seats, tc.class)
+				assert.Equal(t, tc.class, p.Class)
+			}
+		}
+		p, err := pending.NextFittingOfClass(ctx, 1, models.Features{}, models.ClassPriority)
+		require.NoError(t, err)
+		assert.True(t, requested.Equal(p.RequestedAt), "RequestedAt = %v", p.RequestedAt)
+
+		// the classes leave the arrival order alone
+		assert.Equal(t, []uint{1, 2, 3, 4, 5}, journeyIds(pending.GetAllPendings(ctx)))
+		p, err = pending.NextFitting(ctx, 2, models.Features{})
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), p.Id)
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		require.NoError(t, pending.DeleteById(ctx, 1))
+		// a group changing class keeps its place in the queue
+		require.NoError(t, pending.UpdatePending(ctx, 2, &models.Journey{Id: 2, Passengers: 4, Class: models.ClassPriority}, 1))
+		require.NoError(t, pending.UpdatePending(ctx, 3, &models.Journey{Id: 3, Passengers: 3}, 1))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		p, err := pending.NextFittingOfClass(ctx, 6, models.Features{}, models.ClassPriority)
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), p.Id)
+		_, err = pending.NextFittingOfClass(ctx, 6, models.Features{}, models.ClassAccessibility)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.PendingsStorage().ResetMemory(ctx))
+	})
+	read(t, f, func(txn models.Transaction) {
+		_, err := txn.PendingsStorage().NextFittingOfClass(ctx, 6, models.Features{}, models.ClassPriority)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
+
+func scheduledAt(id, passengers uint, at time.Time) *models.Journey {
+	return &models.Journey{Id: id, Passengers: passengers, PickupAt: &at}
+}
+
+func testPendingNeeds(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	wheelchair := models.Features{Wheelchair: true}
+	next := func(pending models.IPenidngStorage, seats uint, free models.Features) uint {
+		p, err := pending.NextFitting(ctx, seats, free)
+		if err == models.ErrNotFound {
+			return 0
+		}
+		require.NoError(t, err)
+		return p.Id
+	}
+	nextOfClass := func(pending models.IPenidngStorage, seats uint, free models.Features) uint {
+		p, err := pending.NextFittingOfClass(ctx, seats, free, models.ClassAccessibility)
+		if err == models.ErrNotFound {
+			return 0
+		}
+		require.NoError(t, err)
+		return p.Id
+	}
+
+	// more groups needing a wheelchair than a read takes at once wait ahead
+	// of the ones any car serves
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		for id := uint(1); id <= 40; id++ {
+			require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: id, Passengers: 2, Features: wheelchair}))
+		}
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 41, Passengers: 2}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 42, Passengers: 3}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 43, Passengers: 2, Features: wheelchair, Class: models.ClassAccessibility}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 44, Passengers: 2, Class: models.ClassAccessibility}))
+		// the transaction sees its own writes
+		assert.Equal(t, uint(41), next(pending, 4, models.Features{}))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		assert.Equal(t, uint(41), next(pending, 4, models.Features{}))
+		assert.Equal(t, uint(1), next(pending, 4, wheelchair))
+		assert.Equal(t, uint(0), next(pending, 1, wheelchair))
+		assert.Equal(t, uint(44), nextOfClass(pending, 4, models.Features{}))
+		assert.Equal(t, uint(43), nextOfClass(pending, 4, wheelchair))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		require.NoError(t, pending.DeleteById(ctx, 41))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 45, Passengers: 1}))
+		assert.Equal(t, uint(42), next(pending, 4, models.Features{}))
+		assert.Equal(t, uint(45), next(pending, 1, models.Features{}))
+	})
+}
+
+func testScheduled(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	base := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	inTxn(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		_, err := scheduled.FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.Equal(t, models.ErrNotFound, scheduled.UpdateScheduled(ctx, 1, scheduledAt(1, 2, base), 0))
+		assert.NoError(t, scheduled.DeleteById(ctx, 1), "deleting a missing journey is not an error")
+
+		require.NoError(t, scheduled.NewScheduled(ctx, scheduledAt(1, 2, base.Add(time.Hour))))
+		require.NoError(t, scheduled.NewScheduled(ctx, scheduledAt(2, 3, base)))
+		require.NoError(t, scheduled.NewScheduled(ctx, scheduledAt(3, 1, base.Add(time.Hour))))
+		require.NoError(t, scheduled.NewScheduled(ctx, scheduledAt(4, 4, base.Add(2*time.Hour))))
+
+		// the transaction sees its own writes
+		assert.Equal(t, []uint{2, 1, 3}, journeyIds(scheduled.Due(ctx, base.Add(time.Hour))))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		journey, err := scheduled.FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), journey.Passengers)
+		assert.Equal(t, uint64(1), journey.Version)
+		if assert.True(t, journey.IsScheduled()) {
+			assert.True(t, base.Add(time.Hour).Equal(*journey.PickupAt))
+		}
+
+		assert.Empty(t, scheduled.Due(ctx, base.Add(-time.Nanosecond)))
+		assert.Equal(t, []uint{2}, journeyIds(scheduled.Due(ctx, base)))
+		assert.Equal(t, []uint{2, 1, 3}, journeyIds(scheduled.Due(ctx, base.Add(time.Hour))))
+		assert.Equal(t, []uint{2, 1, 3, 4}, journeyIds(scheduled.GetAllScheduled(ctx)))
+
+		// scheduled journeys are neither riding nor queued
+		assert.Empty(t, txn.JourneysStorage().GetAllJourneys(ctx))
+		_, err = txn.PendingsStorage().NextFitting(ctx, 6, models.Features{})
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		err := scheduled.UpdateScheduled(ctx, 2, scheduledAt(2, 3, base.Add(3*time.Hour)), 7)
+		assert.True(t, errors.Is(err, models.ErrConflict), "UpdateScheduled: %v", err)
+
+		moved := scheduledAt(2, 3, base.Add(3*time.Hour))
+		require.NoError(t, scheduled.UpdateScheduled(ctx, 2, moved, 1))
+		assert.Equal(t, uint64(2), moved.Version)
+		require.NoError(t, scheduled.DeleteById(ctx, 3))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		assert.Equal(t, []uint{1}, journeyIds(scheduled.Due(ctx, base.Add(time.Hour))))
+		assert.Equal(t, []uint{1, 4, 2}, journeyIds(scheduled.GetAllScheduled(ctx)))
+		_, err := scheduled.FindById(ctx, 3)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+
+	// a rolled back reschedule leaves the old time in place
+	read(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.ScheduledStorage().UpdateScheduled(ctx, 1, scheduledAt(1, 2, base.Add(5*time.Hour)), 1))
+		require.NoError(t, txn.ScheduledStorage().DeleteById(ctx, 4))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, []uint{1, 4, 2}, journeyIds(txn.ScheduledStorage().GetAllScheduled(ctx)))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.ScheduledStorage().ResetMemory(ctx))
+		assert.Empty(t, txn.ScheduledStorage().GetAllScheduled(ctx))
+		require.NoError(t, txn.ScheduledStorage().NewScheduled(ctx, scheduledAt(5, 2, base)))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, []uint{5}, journeyIds(txn.ScheduledStorage().GetAllScheduled(ctx)))
+		assert.Empty(t, txn.JourneysStorage().GetAllJourneys(ctx))
+	})
+}
+
+func reservationIds(reservations []*models.Reservation) []uint {
+	ids := []uint{}
+	for _, r := range reservations {
+		ids = append(ids, r.JourneyID)
+	}
+	return ids
+}
+
+func testReservations(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	base := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	inTxn(t, f, func(txn models.Transaction) {
+		reservations := txn.ReservationsStorage()
+		_, err := reservations.FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.NoError(t, reservations.DeleteById(ctx, 1), "deleting a missing reservation is not an error")
+
+		require.NoError(t, reservations.NewReservation(ctx, &models.Reservation{JourneyID: 1, CarID: 7, Passengers: 2, ExpiresAt: base.Add(time.Minute), Owner: "acme"}))
+		require.NoError(t, reservations.NewReservation(ctx, &models.Reservation{JourneyID: 2, CarID: 7, Passengers: 1, ExpiresAt: base}))
+		require.NoError(t, reservations.NewReservation(ctx, &models.Reservation{JourneyID: 3, CarID: 8, Passengers: 4, ExpiresAt: base.Add(time.Minute)}))
+		assert.Equal(t, []uint{2, 1, 3}, reservationIds(reservations.Expired(ctx, base.Add(time.Minute))))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		reservations := txn.ReservationsStorage()
+		reservation, err := reservations.FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(7), reservation.CarID)
+		assert.Equal(t, uint(2), reservation.Passengers)
+		assert.Equal(t, "acme", reservation.Owner)
+		assert.True(t, base.Add(time.Minute).Equal(reservation.ExpiresAt))
+
+		assert.Empty(t, reservations.Expired(ctx, base.Add(-time.Nanosecond)))
+		assert.Equal(t, []uint{2}, reservationIds(reservations.Expired(ctx, base)))
+		assert.Equal(t, []uint{2, 1, 3}, reservationIds(reservations.GetAllReservations(ctx)))
+	})
+
+	// a rolled back delete keeps the reservation
+	read(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.ReservationsStorage().DeleteById(ctx, 2))
+		assert.Equal(t, []uint{1, 3}, reservationIds(txn.ReservationsStorage().GetAllReservations(ctx)))
+	})
+	inTxn(t, f, func(txn models.Transaction) {
+		assert.Equal(t, []uint{2, 1, 3}, reservationIds(txn.ReservationsStorage().GetAllReservations(ctx)))
+		require.NoError(t, txn.ReservationsStorage().DeleteById(ctx, 1))
+		// reserving again moves the expiry
+		require.NoError(t, txn.ReservationsStorage().NewReservation(ctx, &models.Reservation{JourneyID: 2, CarID: 7, Passengers: 1, ExpiresAt: base.Add(time.Hour)}))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, []uint{3, 2}, reservationIds(txn.ReservationsStorage().GetAllReservations(ctx)))
+		assert.Equal(t, []uint{3}, reservationIds(txn.ReservationsStorage().Expired(ctx, base.Add(time.Minute))))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.ReservationsStorage().ResetMemory(ctx))
+		assert.Empty(t, txn.ReservationsStorage().GetAllReservations(ctx))
+	})
+	read(t, f, func(txn models.Transaction) {
+		_, err := txn.ReservationsStorage().FindById(ctx, 3)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
+
+func testReset(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	seed(t, f)
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().ResetMemory(ctx))
+		require.NoError(t, txn.JourneysStorage().ResetMemory(ctx))
+		require.NoError(t, txn.PendingsStorage().ResetMemory(ctx))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Empty(t, txn.CarsStorage().GetAllCars(ctx))
+		_, err := txn.JourneysStorage().FindById(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+		assert.Empty(t, txn.JourneysStorage().GetAllJourneys(ctx))
+		assert.Empty(t, txn.PendingsStorage().GetAllPendings(ctx))
+		_, err = txn.CarsStorage().FindBestFit(ctx, 1)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
+
+func testVersions(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	car := &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}
+	journey := &models.Journey{Id: 1, Passengers: 2}
+	pending := &models.Journey{Id: 1, Passengers: 2}
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, car))
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, journey))
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, pending))
+	})
+	assert.Equal(t, uint64(1), car.Version)
+	assert.Equal(t, uint64(1), journey.Version)
+	assert.Equal(t, uint64(1), pending.Version)
+
+	inTxn(t, f, func(txn models.Transaction) {
+		car.TakeSeats(1)
+		require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, car, 1))
+		journey.AssignCar(1)
+		require.NoError(t, txn.JourneysStorage().UpdateJourney(ctx, 1, journey, 1))
+		pending.Passengers = 1
+		require.NoError(t, txn.PendingsStorage().UpdatePending(ctx, 1, pending, 1))
+	})
+	assert.Equal(t, uint64(2), car.Version)
+	assert.Equal(t, uint64(2), journey.Version)
+	assert.Equal(t, uint64(2), pending.Version)
+
+	// writing over a version that was already replaced fails and changes nothing
+	read(t, f, func(txn models.Transaction) {
+		err := txn.CarsStorage().UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4}, 1)
+		assert.True(t, errors.Is(err, models.ErrConflict), "UpdateCar: %v", err)
+		var conflict *models.ConflictError
+		if assert.True(t, errors.As(err, &conflict)) {
+			assert.Equal(t, uint(1), conflict.ID)
+			assert.Equal(t, uint64(1), conflict.Expected)
+			assert.Equal(t, uint64(2), conflict.Actual)
+		}
+		err = txn.JourneysStorage().UpdateJourney(ctx, 1, &models.Journey{Id: 1, Passengers: 2}, 1)
+		assert.True(t, errors.Is(err, models.ErrConflict), "UpdateJourney: %v", err)
+		err = txn.PendingsStorage().UpdatePending(ctx, 1, &models.Journey{Id: 1, Passengers: 2}, 3)
+		assert.True(t, errors.Is(err, models.ErrConflict), "UpdatePending: %v", err)
+
+		stored, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, models.Car{ID: 1, Seats: 4, AvailableSeats: 3, Version: 2}, *stored)
+	})
+
+	// a rollback takes the version back too
+	read(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, car, 2))
+	})
+	read(t, f, func(txn models.Transaction) {
+		stored, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), stored.Version)
+		storedJourney, err := txn.JourneysStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), storedJourney.Version)
+		p, err := txn.PendingsStorage().NextFitting(ctx, 1, models.Features{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), p.Version)
+	})
+
+	// replacing a record keeps counting instead of starting over
+	inTxn(t, f, func(txn models.Transaction) {
+		replaced := &models.Car{ID: 1, Seats: 6, AvailableSeats: 6}
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, replaced))
+		assert.Equal(t, uint64(3), replaced.Version)
+	})
+}
+
+func testOwners(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2, Owner: "acme"}))
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 1, Passengers: 2, Owner: "acme"}))
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 2, Passengers: 3}))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		journey, err := txn.JourneysStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "acme", journey.Owner)
+		journey, err = txn.JourneysStorage().FindById(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, journey.Owner)
+
+		pending := txn.PendingsStorage().GetAllPendings(ctx)
+		if assert.Len(t, pending, 1) {
+			assert.Equal(t, "acme", pending[0].Owner)
+		}
+		next, err := txn.PendingsStorage().NextFitting(ctx, 4, models.Features{})
+		require.NoError(t, err)
+		assert.Equal(t, "acme", next.Owner)
+	})
+}
+
+func testOwnerCounts(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	counts := func(pending models.IPenidngStorage) map[string]int {
+		got := make(map[string]int)
+		for _, owner := range []string{"acme", "globex", ""} {
+			n, err := pending.CountOwnedBy(ctx, owner)
+			require.NoError(t, err)
+			got[owner] = n
+		}
+		return got
+	}
+
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 1, Passengers: 2, Owner: "acme"}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 2, Passengers: 3, Owner: "acme"}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 3, Passengers: 1, Owner: "globex"}))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 4, Passengers: 1}))
+		// the transaction sees its own writes
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 1, "": 0}, counts(pending))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		require.NoError(t, pending.DeleteById(ctx, 1))
+		// asking again doesn't count twice
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 2, Passengers: 3, Owner: "acme"}))
+		require.NoError(t, pending.UpdatePending(ctx, 3, &models.Journey{Id: 3, Passengers: 4, Owner: "acme"}, 1))
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 0, "": 0}, counts(pending))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 0, "": 0}, counts(txn.PendingsStorage()))
+	})
+
+	// rolled back writes leave the counts alone
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 5, Passengers: 1, Owner: "globex"}))
+	require.NoError(t, txn.PendingsStorage().DeleteById(ctx, 2))
+	require.NoError(t, txn.Rollback())
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 0, "": 0}, counts(txn.PendingsStorage()))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		pending := txn.PendingsStorage()
+		require.NoError(t, pending.ResetMemory(ctx))
+		require.NoError(t, pending.NewPending(ctx, &models.Journey{Id: 6, Passengers: 1, Owner: "globex"}))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, map[string]int{"acme": 0, "globex": 1, "": 0}, counts(txn.PendingsStorage()))
+	})
+}
+
+func testScheduledOwnerCounts(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	base := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	owned := func(owner string, id uint) *models.Journey {
+		journey := scheduledAt(id, 2, base)
+		journey.Owner = owner
+		return journey
+	}
+	counts := func(scheduled models.IScheduledStorage) map[string]int {
+		got := make(map[string]int)
+		for _, owner := range []string{"acme", "globex", ""} {
+			n, err := scheduled.CountOwnedBy(ctx, owner)
+			require.NoError(t, err)
+			got[owner] = n
+		}
+		return got
+	}
+
+	inTxn(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		require.NoError(t, scheduled.NewScheduled(ctx, owned("acme", 1)))
+		require.NoError(t, scheduled.NewScheduled(ctx, owned("acme", 2)))
+		require.NoError(t, scheduled.NewScheduled(ctx, owned("globex", 3)))
+		require.NoError(t, scheduled.NewScheduled(ctx, owned("", 4)))
+		// the transaction sees its own writes
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 1, "": 0}, counts(scheduled))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		require.NoError(t, scheduled.DeleteById(ctx, 1))
+		require.NoError(t, scheduled.UpdateScheduled(ctx, 3, owned("acme", 3), 1))
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 0, "": 0}, counts(scheduled))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.Equal(t, map[string]int{"acme": 2, "globex": 0, "": 0}, counts(txn.ScheduledStorage()))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		scheduled := txn.ScheduledStorage()
+		require.NoError(t, scheduled.ResetMemory(ctx))
+		require.NoError(t, scheduled.NewScheduled(ctx, owned("globex", 5)))
+		assert.Equal(t, map[string]int{"acme": 0, "globex": 1, "": 0}, counts(scheduled))
+	})
+}
+
+func testCarShapes(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	small := models.CarShape{Seats: 4}
+	large := models.CarShape{Seats: 6}
+	adapted := models.CarShape{Seats: 6, Features: models.Features{Wheelchair: true, Luggage: 2}}
+	shapes := func(cars models.ICarStorage) []models.CarShape {
+		got, err := cars.Shapes(ctx)
+		require.NoError(t, err)
+		return got
+	}
+
+	inTxn(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}))
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 2, Seats: 4, AvailableSeats: 4}))
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 3, Seats: 6, AvailableSeats: 6, Features: adapted.Features}))
+		// the transaction sees its own writes
+		assert.ElementsMatch(t, []models.CarShape{small, adapted}, shapes(cars))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		// taking seats leaves the shape as it is, refitting and draining don't
+		require.NoError(t, cars.UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 1}, 1))
+		require.NoError(t, cars.UpdateCar(ctx, 2, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6}, 1))
+		require.NoError(t, cars.UpdateCar(ctx, 3, &models.Car{ID: 3, Seats: 6, AvailableSeats: 6, Features: adapted.Features, Draining: true}, 1))
+		assert.ElementsMatch(t, []models.CarShape{small, large}, shapes(cars))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.ElementsMatch(t, []models.CarShape{small, large}, shapes(txn.CarsStorage()))
+	})
+
+	// rolled back writes leave the shapes alone
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().DeleteById(ctx, 1))
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 4, Seats: 5, AvailableSeats: 5}))
+	require.NoError(t, txn.Rollback())
+	read(t, f, func(txn models.Transaction) {
+		assert.ElementsMatch(t, []models.CarShape{small, large}, shapes(txn.CarsStorage()))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().DeleteById(ctx, 1))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.ElementsMatch(t, []models.CarShape{large}, shapes(txn.CarsStorage()))
+	})
+
+	inTxn(t, f, func(txn models.Transaction) {
+		cars := txn.CarsStorage()
+		require.NoError(t, cars.ResetMemory(ctx))
+		require.NoError(t, cars.NewCar(ctx, &models.Car{ID: 5, Seats: 6, AvailableSeats: 6, Features: adapted.Features}))
+	})
+	read(t, f, func(txn models.Transaction) {
+		assert.ElementsMatch(t, []models.CarShape{adapted}, shapes(txn.CarsStorage()))
+	})
+}
+
+func testFeatures(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	offers := models.Features{Wheelchair: true, ChildSeats: 2, Luggage: 4}
+	needs := models.Features{ChildSeats: 1, Luggage: 2}
+	inTxn(t, f, func(txn models.Transaction) {
+		car := &models.Car{ID: 1, Seats: 6, AvailableSeats: 6, Features: offers}
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, car))
+		car.InUse = needs
+		require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, car, car.Version))
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2, Features: needs}))
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 1, Passengers: 2, Features: needs}))
+		pickup := time.Now().Add(time.Hour)
+		require.NoError(t, txn.ScheduledStorage().NewScheduled(ctx, &models.Journey{Id: 2, Passengers: 1, Features: needs, PickupAt: &pickup}))
+	})
+
+	read(t, f, func(txn models.Transaction) {
+		car, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, offers, car.Features)
+		assert.Equal(t, needs, car.InUse)
+		if best, err := txn.CarsStorage().FindBestFit(ctx, 1); assert.NoError(t, err) {
+			assert.Equal(t, needs, best.InUse)
+		}
+
+		journey, err := txn.JourneysStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, needs, journey.Features)
+		next, err := txn.PendingsStorage().NextFitting(ctx, 6, offers)
+		require.NoError(t, err)
+		assert.Equal(t, needs, next.Features)
+		scheduled, err := txn.ScheduledStorage().FindById(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, needs, scheduled.Features)
+	})
+}
+
+func testHandsOutCopies(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	car := &models.Car{ID: 1, Seats: 4, AvailableSeats: 4}
+	journey := &models.Journey{Id: 1, Passengers: 2}
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, car))
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, journey))
+		require.NoError(t, txn.PendingsStorage().NewPending(ctx, journey))
+	})
+
+	car.TakeSeats(4)
+	journey.AssignCar(1)
+	read(t, f, func(txn models.Transaction) {
+		stored, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		stored.TakeSeats(1)
+		for _, c := range txn.CarsStorage().GetAllCars(ctx) {
+			c.TakeSeats(1)
+		}
+		for _, p := range txn.PendingsStorage().GetAllPendings(ctx) {
+			p.Passengers = 6
+		}
+
+		stored, err = txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(4), stored.AvailableSeats)
+		storedJourney, err := txn.JourneysStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.False(t, storedJourney.IsAssigned())
+		p, err := txn.PendingsStorage().NextFitting(ctx, 2, models.Features{})
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), p.Passengers)
+	})
+}
+
+func testCommitIsVisible(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	seed(t, f)
+	read(t, f, func(txn models.Transaction) {
+		assert.Len(t, txn.CarsStorage().GetAllCars(ctx), 2)
+		_, err := txn.JourneysStorage().FindById(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{2, 3}, journeyIds(txn.PendingsStorage().GetAllPendings(ctx)))
+	})
+}
+
+func testRollbackRestoresState(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	seed(t, f)
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 0}, 1))
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 9, Seats: 6, AvailableSeats: 6}))
+	assigned := &models.Journey{Id: 2, Passengers: 3}
+	assigned.AssignCar(9)
+	require.NoError(t, txn.JourneysStorage().UpdateJourney(ctx, 2, assigned, 1))
+	require.NoError(t, txn.JourneysStorage().DeleteById(ctx, 1))
+	require.NoError(t, txn.PendingsStorage().DeleteById(ctx, 2))
+	require.NoError(t, txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 4, Passengers: 1}))
+	require.NoError(t, txn.JourneysStorage().ResetMemory(ctx))
+	require.NoError(t, txn.Rollback())
+
+	read(t, f, func(txn models.Transaction) {
+		expectSeeded(t, txn)
+	})
+
+	// a reset is undone as a whole too
+	txn, err = f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().ResetMemory(ctx))
+	require.NoError(t, txn.JourneysStorage().ResetMemory(ctx))
+	require.NoError(t, txn.PendingsStorage().ResetMemory(ctx))
+	require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 9, Seats: 6, AvailableSeats: 6}))
+	require.NoError(t, txn.Rollback())
+
+	read(t, f, func(txn models.Transaction) {
+		expectSeeded(t, txn)
+	})
+}
+
+func testRolledBackWritesAreNeverSeen(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	seed(t, f)
+
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 0}, 1))
+
+	// whether the backend makes the reader wait or gives it a snapshot, it
+	// must never see a write that ends up rolled back
+	seen := make(chan uint)
+	go func() {
+		reader, err := f.Begin(ctx)
+		if err != nil {
+			close(seen)
+			return
+		}
+		defer reader.Rollback()
+		car, err := reader.CarsStorage().FindById(ctx, 1)
+		if err != nil {
+			close(seen)
+			return
+		}
+		seen <- car.AvailableSeats
+	}()
+
+	require.NoError(t, txn.Rollback())
+	available, ok := <-seen
+	require.True(t, ok, "reader failed")
+	assert.Equal(t, uint(2), available)
+}
+
+func testConcurrentTransactions(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 100, AvailableSeats: 100}))
+	})
+
+	// every worker takes one seat and books a journey, half of them then
+	// change their mind and roll back. A backend may reject a stale update or
+	// a conflicting commit, the worker retries then, but it must never lose
+	// an update.
+	const workers = 40
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- takeSeat(f, uint(i+1), i%2 == 0)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	read(t, f, func(txn models.Transaction) {
+		car, err := txn.CarsStorage().FindById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint(100-workers/2), car.AvailableSeats)
+		for i := 1; i <= workers; i++ {
+			_, err := txn.JourneysStorage().FindById(ctx, uint(i))
+			if i%2 == 0 {
+				assert.NoError(t, err, "journey %d was committed", i)
+			} else {
+				assert.Equal(t, models.ErrNotFound, err, "journey %d was rolled back", i)
+			}
+		}
+	})
+}
+
+func testCanceledContext(t *testing.T, f models.TransactionFactory) {
+	seed(t, f)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.Begin(canceled)
+	assert.True(t, errors.Is(err, context.Canceled), "Begin: %v", err)
+
+	// the request goes away halfway through the transaction
+	ctx, cancel := context.WithCancel(context.Background())
+	txn, err := f.Begin(ctx)
+	require.NoError(t, err)
+	defer txn.Rollback()
+	require.NoError(t, txn.CarsStorage().UpdateCar(ctx, 1, &models.Car{ID: 1, Seats: 4, AvailableSeats: 0}, 1))
+	require.NoError(t, txn.JourneysStorage().DeleteById(ctx, 1))
+	cancel()
+
+	_, err = txn.CarsStorage().FindById(ctx, 2)
+	assert.True(t, errors.Is(err, context.Canceled), "FindById: %v", err)
+	err = txn.PendingsStorage().NewPending(ctx, &models.Journey{Id: 4, Passengers: 1})
+	assert.True(t, errors.Is(err, context.Canceled), "NewPending: %v", err)
+	assert.Empty(t, txn.CarsStorage().GetAllCars(ctx))
+	err = txn.Commit(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), "Commit: %v", err)
+	assert.False(t, txn.HasCommited())
+
+	read(t, f, func(txn models.Transaction) {
+		expectSeeded(t, txn)
+	})
+}
+
+func testBeginGivesUpWaiting(t *testing.T, f models.TransactionFactory) {
+	seed(t, f)
+	txn, err := f.Begin(context.Background())
+	require.NoError(t, err)
+	defer txn.Rollback()
+
+	// a backend running transactions one at a time makes Begin wait for txn,
+	// it must stop waiting when the deadline passes
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		other, err := f.Begin(ctx)
+		if err == nil {
+			other.Rollback()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			assert.True(t, errors.Is(err, context.DeadlineExceeded), "Begin: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Begin kept waiting after its deadline")
+	}
+}
+
+func takeSeat(f models.TransactionFactory, journeyId uint, rollback bool) error {
+	ctx := context.Background()
+	var lastErr error
+	for attempt := 0; attempt < 100; attempt++ {
+		txn, err := f.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		car, err := txn.CarsStorage().FindById(ctx, 1)
+		if err != nil {
+			txn.Rollback()
+			return err
+		}
+		car.TakeSeats(1)
+		journey := &models.Journey{Id: journeyId, Passengers: 1}
+		journey.AssignCar(car.ID)
+		if lastErr = txn.CarsStorage().UpdateCar(ctx, car.ID, car, car.Version); lastErr != nil {
+			txn.Rollback()
+			// someone else took a seat since it was read
+			if errors.Is(lastErr, models.ErrConflict) {
+				continue
+			}
+			return lastErr
+		}
+		if err := txn.JourneysStorage().NewJourney(ctx, journey); err != nil {
+			txn.Rollback()
+			return err
+		}
+		if rollback {
+			return txn.Rollback()
+		}
+		if lastErr = txn.Commit(ctx); lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("journey %d never committed: %w", journeyId, lastErr)
+}
+
+// seed commits two cars, three journeys, the first one assigned to car 1,
+// and the other two waiting
+func seed(t *testing.T, f models.TransactionFactory) {
+	ctx := context.Background()
+	inTxn(t, f, func(txn models.Transaction) {
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 1, Seats: 4, AvailableSeats: 2}))
+		require.NoError(t, txn.CarsStorage().NewCar(ctx, &models.Car{ID: 2, Seats: 6, AvailableSeats: 6}))
+
+		assigned := &models.Journey{Id: 1, Passengers: 2}
+		assigned.AssignCar(1)
+		require.NoError(t, txn.JourneysStorage().NewJourney(ctx, assigned))
+		for _, j := range []*models.Journey{{Id: 2, Passengers: 3}, {Id: 3, Passengers: 6}} {
+			require.NoError(t, txn.JourneysStorage().NewJourney(ctx, j))
+			require.NoError(t, txn.PendingsStorage().NewPending(ctx, j))
+		}
+	})
+}
+
+func expectSeeded(t *testing.T, txn models.Transaction) {
+	t.Helper()
+	ctx := context.Background()
+
+	cars := txn.CarsStorage().GetAllCars(ctx)
+	sort.Slice(cars, func(i, j int) bool { return cars[i].ID < cars[j].ID })
+	require.Len(t, cars, 2)
+	assert.Equal(t, models.Car{ID: 1, Seats: 4, AvailableSeats: 2, Version: 1}, *cars[0])
+	assert.Equal(t, models.Car{ID: 2, Seats: 6, AvailableSeats: 6, Version: 1}, *cars[1])
+	car, err := txn.CarsStorage().FindBestFit(ctx, 6)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(2), car.ID)
+	}
+
+	for id, carId := range map[uint]*uint{1: &cars[0].ID, 2: nil, 3: nil} {
+		journey, err := txn.JourneysStorage().FindById(ctx, id)
+		if assert.NoError(t, err, "journey %d", id) {
+			assert.Equal(t, carId, journey.CarID, "journey %d", id)
+		}
+	}
+	assert.Equal(t, []uint{2, 3}, journeyIds(txn.PendingsStorage().GetAllPendings(ctx)))
+	p, err := txn.PendingsStorage().NextFitting(ctx, 6, models.Features{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(2), p.Id)
+	}
+}
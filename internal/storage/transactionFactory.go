@@ -1,21 +1,74 @@
 package storage
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/faulty"
 	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/kv"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/redis"
 )
 
-func NewTransactionFactory(storageType string) models.TransactionFactory {
+// Config selects the storage backend and holds the settings of each one
+type Config struct {
+	Type string
+	// KVPath is the database file of the kv backend
+	KVPath string
+	// RedisURL is the server of the redis backend, as in redis://host:6379/0
+	RedisURL string
+	// RedisPrefix starts every key of the redis backend, so replicas of
+	// different fleets can share a server
+	RedisPrefix string
+	// Faults are rules, as parsed by faulty.ParseRules, making the backend
+	// fail or slow down on purpose. Development only.
+	Faults string
+}
+
+// ForTenant returns the config of the storage keeping the fleet of a tenant
+// apart from the default one: a fresh memory storage, a kv file next to the
+// default one, or redis keys under their own prefix
+func (c Config) ForTenant(id string) Config {
+	tenant := c
+	ext := filepath.Ext(c.KVPath)
+	tenant.KVPath = strings.TrimSuffix(c.KVPath, ext) + "-" + id + ext
+	tenant.RedisPrefix = c.RedisPrefix + "tenants:" + id + ":"
+	return tenant
+}
+
+// NewTransactionFactory builds the configured backend. Backends holding
+// resources, like open files, also implement io.Closer.
+func NewTransactionFactory(config Config) (models.TransactionFactory, error) {
+	faults, err := faulty.ParseRules(config.Faults)
+	if err != nil {
+		return nil, err
+	}
+
 	var factory models.TransactionFactory
-	switch storageType {
-	case "sql":
-		// db := connectToSQL() // db connection
-		// factory = &SQLUnitOfWorkFactory{DB: db}
+	switch config.Type {
 	case "memory":
 		factory = inMemory.NewTransactionFactory()
+	case "kv":
+		kvFactory, err := kv.Open(config.KVPath)
+		if err != nil {
+			return nil, fmt.Errorf("opening kv storage %s: %w", config.KVPath, err)
+		}
+		factory = kvFactory
+	case "redis":
+		redisFactory, err := redis.Open(config.RedisURL, config.RedisPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to redis storage %s: %w", config.RedisURL, err)
+		}
+		factory = redisFactory
 	default:
-		panic("unknown storage backend")
+		return nil, fmt.Errorf("unknown storage backend %q", config.Type)
+	}
+
+	if len(faults) > 0 {
+		factory = faulty.New(factory, faults)
 	}
 
-	return factory
+	return factory, nil
 }
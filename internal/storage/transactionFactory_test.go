@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestNewTransactionFactory_UnknownBackend(t *testing.T) {
+	factory, err := NewTransactionFactory(Config{Type: "cassandra"})
+	if err == nil || err.Error() != `unknown storage backend "cassandra"` {
+		t.Fatalf("expected an unknown backend error, got %v", err)
+	}
+	if factory != nil {
+		t.Fatalf("expected no factory, got %v", factory)
+	}
+}
+
+func TestNewTransactionFactory_SQLIsNotImplemented(t *testing.T) {
+	factory, err := NewTransactionFactory(Config{Type: "sql"})
+	if err == nil || err.Error() != `unknown storage backend "sql"` {
+		t.Fatalf("expected an unknown backend error, got %v", err)
+	}
+	if factory != nil {
+		t.Fatalf("expected no factory, got %v", factory)
+	}
+}
@@ -0,0 +1,50 @@
+package tenants
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// TenantHeader names the tenant of a request made outside the /tenants/:tenant routes
+const TenantHeader = "X-Tenant"
+
+type fleetKey struct{}
+
+func WithFleet(ctx context.Context, f *Fleet) context.Context {
+	return context.WithValue(ctx, fleetKey{}, f)
+}
+
+// FleetFrom returns the fleet the request is for, nil outside Middleware
+func FleetFrom(ctx context.Context) *Fleet {
+	f, _ := ctx.Value(fleetKey{}).(*Fleet)
+	return f
+}
+
+// Middleware puts the fleet a request is for in its context: the tenant in
+// the :tenant path parameter, else the one in the X-Tenant header, else the
+// default one. Requests for unknown tenants get 404 Not Found.
+func (r *Registry) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.Param("tenant")
+		if id == "" {
+			id = ctx.GetHeader(TenantHeader)
+		}
+		if id == "" {
+			id = DefaultID
+		}
+		fleet, err := r.Get(id)
+		if err != nil {
+			r.logger.Warn("Request for an unknown tenant", map[string]interface{}{
+				"tenant":     id,
+				"path":       ctx.Request.URL.Path,
+				"request_id": logger.GetRequestID(ctx.Request.Context()),
+			})
+			ctx.AbortWithStatusJSON(models.ErrTenantNotFound.HTTPStatus(), models.ErrTenantNotFound)
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(WithFleet(ctx.Request.Context(), fleet))
+	}
+}
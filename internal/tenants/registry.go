@@ -0,0 +1,317 @@
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+)
+
+// FactoryFunc opens the storage of a tenant fleet, apart from every other one
+type FactoryFunc func(tenantID string) (models.TransactionFactory, error)
+
+// Fleet is a tenant and the service running its fleet
+type Fleet struct {
+	Tenant  Tenant
+	Service *services.CarPool
+	factory models.TransactionFactory
+}
+
+func (f *Fleet) close() error {
+	if closer, ok := f.factory.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Registry keeps the fleet of every tenant. When created with a state file
+// the tenants are flushed to it on every change, so they survive restarts.
+type Registry struct {
+	path       string
+	newFactory FactoryFunc
+	options    []services.Option
+	handler    func(tenantID string) events.Handler
+	clock      clock.Clock
+	logger     *logger.Logger
+
+	mu     sync.RWMutex
+	fleets map[string]*Fleet
+	// deleting holds the tenants whose fleet is being emptied, their ids
+	// can't be taken again until it's done
+	deleting map[string]bool
+}
+
+// Option customizes a Registry on creation
+type Option func(*Registry)
+
+// WithStateFile keeps the tenants in the given file
+func WithStateFile(path string) Option {
+	return func(r *Registry) {
+		r.path = path
+	}
+}
+
+// WithServiceOptions builds the service of every tenant with the given
+// options, before the seat limits and strategy of the tenant
+func WithServiceOptions(opts ...services.Option) Option {
+	return func(r *Registry) {
+		r.options = opts
+	}
+}
+
+// WithEventHandler subscribes the handler made for every fleet, the default
+// one included, to the events of its service
+func WithEventHandler(handler func(tenantID string) events.Handler) Option {
+	return func(r *Registry) {
+		r.handler = handler
+	}
+}
+
+// WithClock timestamps new tenants with the given clock instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(r *Registry) {
+		r.clock = c
+	}
+}
+
+// New serves the default fleet with the given service, and opens the storage
+// of the other tenants with newFactory
+func New(defaultService *services.CarPool, newFactory FactoryFunc, opts ...Option) (*Registry, error) {
+	r := &Registry{
+		newFactory: newFactory,
+		clock:      clock.Real{},
+		logger:     logger.New("tenants"),
+		fleets:     make(map[string]*Fleet),
+		deleting:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.fleets[DefaultID] = &Fleet{
+		Tenant: Tenant{
+			ID:        DefaultID,
+			MinSeats:  models.MIN_SEATS,
+			MaxSeats:  models.MAX_SEATS,
+			Strategy:  services.StrategyBestFit,
+			CreatedAt: r.clock.Now(),
+		},
+		Service: defaultService,
+	}
+	r.subscribe(r.fleets[DefaultID])
+	if r.path == "" {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []Tenant
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for _, t := range stored {
+		fleet, err := r.open(t)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.fleets[t.ID] = fleet
+	}
+	return r, nil
+}
+
+func (r *Registry) open(t Tenant) (*Fleet, error) {
+	factory, err := r.newFactory(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	opts := append(append([]services.Option{}, r.options...), t.options()...)
+	fleet := &Fleet{Tenant: t, Service: services.NewCarPool(factory, opts...), factory: factory}
+	r.subscribe(fleet)
+	return fleet, nil
+}
+
+func (r *Registry) subscribe(fleet *Fleet) {
+	if r.handler != nil {
+		fleet.Service.Events().Subscribe(r.handler(fleet.Tenant.ID))
+	}
+}
+
+// Create opens an empty fleet for a new tenant
+func (r *Registry) Create(t *Tenant) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.fleets[t.ID]; exists {
+		return models.NewAPIError(409, "Tenant already exists", t.ID)
+	}
+	if r.deleting[t.ID] {
+		return models.NewAPIError(409, "Tenant is being deleted", t.ID)
+	}
+	t.CreatedAt = r.clock.Now()
+	fleet, err := r.open(*t)
+	if err != nil {
+		return models.NewAPIError(500, "Failed to open tenant storage", err.Error())
+	}
+	r.fleets[t.ID] = fleet
+	if err := r.flush(); err != nil {
+		delete(r.fleets, t.ID)
+		fleet.close()
+		return models.NewAPIError(500, "Failed to store tenant", err.Error())
+	}
+
+	r.logger.Info("Tenant created", map[string]interface{}{
+		"tenant":    t.ID,
+		"min_seats": t.MinSeats,
+		"max_seats": t.MaxSeats,
+		"strategy":  t.Strategy,
+	})
+	return nil
+}
+
+// Delete forgets a tenant and empties its fleet, a tenant created again with
+// the same id starts from scratch. The fleet is emptied once forgotten, the
+// other tenants don't wait for it.
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	if id == DefaultID {
+		return models.NewAPIError(400, "The default tenant can't be deleted", "")
+	}
+
+	r.mu.Lock()
+	fleet, exists := r.fleets[id]
+	if !exists {
+		r.mu.Unlock()
+		return models.ErrTenantNotFound
+	}
+	delete(r.fleets, id)
+	if err := r.flush(); err != nil {
+		r.fleets[id] = fleet
+		r.mu.Unlock()
+		return models.NewAPIError(500, "Failed to store tenant", err.Error())
+	}
+	r.deleting[id] = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.deleting, id)
+		r.mu.Unlock()
+	}()
+	resetErr := fleet.Service.ResetCars(ctx, nil)
+	if err := fleet.close(); err != nil {
+		r.logger.Warn("Failed to close tenant storage", map[string]interface{}{
+			"tenant": id,
+			"error":  err.Error(),
+		})
+	}
+	if resetErr != nil {
+		r.logger.Error("Failed to empty the fleet of a deleted tenant", map[string]interface{}{
+			"tenant": id,
+			"error":  resetErr.Error(),
+		})
+		return resetErr
+	}
+
+	r.logger.Info("Tenant deleted", map[string]interface{}{
+		"tenant": id,
+	})
+	return nil
+}
+
+// Get returns the fleet of a tenant, or ErrTenantNotFound
+func (r *Registry) Get(id string) (*Fleet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fleet, exists := r.fleets[id]
+	if !exists {
+		return nil, models.ErrTenantNotFound
+	}
+	return fleet, nil
+}
+
+// Tenants returns every tenant, the default one first and the rest by
+// creation time
+func (r *Registry) Tenants() []Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenants := make([]Tenant, 0, len(r.fleets))
+	for _, fleet := range r.fleets {
+		tenants = append(tenants, fleet.Tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if (tenants[i].ID == DefaultID) != (tenants[j].ID == DefaultID) {
+			return tenants[i].ID == DefaultID
+		}
+		if tenants[i].CreatedAt.Equal(tenants[j].CreatedAt) {
+			return tenants[i].ID < tenants[j].ID
+		}
+		return tenants[i].CreatedAt.Before(tenants[j].CreatedAt)
+	})
+	return tenants
+}
+
+// Close closes the storage of every tenant but the default one, which
+// belongs to whoever gave its service
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var firstErr error
+	for id, fleet := range r.fleets {
+		if id == DefaultID {
+			continue
+		}
+		if err := fleet.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *Registry) flush() error {
+	if r.path == "" {
+		return nil
+	}
+
+	stored := make([]Tenant, 0, len(r.fleets))
+	for id, fleet := range r.fleets {
+		if id != DefaultID {
+			stored = append(stored, fleet.Tenant)
+		}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
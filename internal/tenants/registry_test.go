@@ -0,0 +1,230 @@
+package tenants
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/clock"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/faulty"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/storage/inMemory"
+)
+
+var now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// memoryFactories opens a memory storage per tenant and remembers them, so a
+// registry loaded again finds the fleets it left
+func memoryFactories() FactoryFunc {
+	opened := map[string]models.TransactionFactory{}
+	return func(id string) (models.TransactionFactory, error) {
+		if opened[id] == nil {
+			opened[id] = inMemory.NewTransactionFactory()
+		}
+		return opened[id], nil
+	}
+}
+
+func newRegistry(t *testing.T, factories FactoryFunc, opts ...Option) *Registry {
+	t.Helper()
+	opts = append([]Option{WithClock(clock.NewFake(now))}, opts...)
+	r, err := New(services.NewCarPool(inMemory.NewTransactionFactory()), factories, opts...)
+	require.NoError(t, err)
+	return r
+}
+
+func TestTenant_Validate(t *testing.T) {
+	tenant := Tenant{ID: "acme"}
+	require.NoError(t, tenant.Validate())
+	assert.Equal(t, Tenant{ID: "acme", MinSeats: models.MIN_SEATS, MaxSeats: models.MAX_SEATS, Strategy: services.StrategyBestFit}, tenant)
+
+	for _, invalid := range []Tenant{
+		{ID: ""},
+		{ID: "Acme"},
+		{ID: "-acme"},
+		{ID: "acme/../x"},
+		{ID: "acme", MinSeats: 7},
+		{ID: "acme", MinSeats: 5, MaxSeats: 4},
+		{ID: "acme", Strategy: "random"},
+	} {
+		err := invalid.Validate()
+		if assert.Error(t, err, "%+v", invalid) {
+			assert.Equal(t, 400, err.(*models.APIError).Code)
+		}
+	}
+}
+
+func TestRegistry_CreateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	r := newRegistry(t, memoryFactories())
+
+	acme := &Tenant{ID: "acme", MaxSeats: 9, Strategy: services.StrategyWorstFit}
+	require.NoError(t, r.Create(acme))
+	assert.Equal(t, now, acme.CreatedAt)
+	err := r.Create(&Tenant{ID: "acme"})
+	assert.Equal(t, 409, err.(*models.APIError).Code)
+	err = r.Create(&Tenant{ID: DefaultID})
+	assert.Equal(t, 409, err.(*models.APIError).Code)
+
+	assert.Equal(t, []string{DefaultID, "acme"}, tenantIDs(r.Tenants()))
+
+	fleet, err := r.Get("acme")
+	require.NoError(t, err)
+	require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 9, AvailableSeats: 9}}))
+	require.NoError(t, fleet.Service.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 8}))
+
+	require.NoError(t, r.Delete(ctx, "acme"))
+	_, err = r.Get("acme")
+	assert.Equal(t, models.ErrTenantNotFound, err)
+	assert.Equal(t, models.ErrTenantNotFound, r.Delete(ctx, "acme"))
+	assert.Equal(t, 400, r.Delete(ctx, DefaultID).(*models.APIError).Code)
+
+	// a tenant created again with the same id starts empty
+	require.NoError(t, r.Create(&Tenant{ID: "acme"}))
+	fleet, err = r.Get("acme")
+	require.NoError(t, err)
+	_, err = fleet.Service.Locate(ctx, 1)
+	assert.Equal(t, models.ErrNotFound, err)
+}
+
+func TestRegistry_DeleteEmptiesTheFleetOutsideTheLock(t *testing.T) {
+	ctx := context.Background()
+	slow := func(id string) (models.TransactionFactory, error) {
+		return faulty.New(inMemory.NewTransactionFactory(), []faulty.Rule{{Method: "Cars.ResetMemory", Latency: 200 * time.Millisecond}}), nil
+	}
+	r := newRegistry(t, slow)
+	require.NoError(t, r.Create(&Tenant{ID: "acme"}))
+	require.NoError(t, r.Create(&Tenant{ID: "globex"}))
+
+	deleted := make(chan error)
+	go func() { deleted <- r.Delete(ctx, "acme") }()
+	assert.Eventually(t, func() bool {
+		_, err := r.Get("acme")
+		return err == models.ErrTenantNotFound
+	}, time.Second, time.Millisecond)
+
+	// the other tenants are served meanwhile, and the id isn't taken again
+	// until the fleet is empty
+	_, err := r.Get("globex")
+	assert.NoError(t, err)
+	err = r.Create(&Tenant{ID: "acme"})
+	if assert.Error(t, err) {
+		assert.Equal(t, 409, err.(*models.APIError).Code)
+	}
+	require.NoError(t, <-deleted)
+	assert.NoError(t, r.Create(&Tenant{ID: "acme"}))
+}
+
+func TestRegistry_StateFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	factories := memoryFactories()
+
+	r := newRegistry(t, factories, WithStateFile(path))
+	require.NoError(t, r.Create(&Tenant{ID: "acme", MinSeats: 2, MaxSeats: 9}))
+	require.NoError(t, r.Create(&Tenant{ID: "globex"}))
+	require.NoError(t, r.Delete(ctx, "globex"))
+	fleet, _ := r.Get("acme")
+	require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 2, AvailableSeats: 2}}))
+
+	reloaded := newRegistry(t, factories, WithStateFile(path))
+	assert.Equal(t, r.Tenants(), reloaded.Tenants())
+	fleet, err := reloaded.Get("acme")
+	require.NoError(t, err)
+	// the seat limits come back with the tenant
+	require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 9, AvailableSeats: 9}}))
+	assert.Equal(t, models.ErrInvalidSeats, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 10, AvailableSeats: 10}}))
+}
+
+func TestRegistry_EventHandlers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	factories := memoryFactories()
+	var mu sync.Mutex
+	seen := []string{}
+	handler := WithEventHandler(func(id string) events.Handler {
+		return func(e events.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, id+":"+string(e.Type))
+		}
+	})
+
+	r := newRegistry(t, factories, WithStateFile(path), handler)
+	require.NoError(t, r.Create(&Tenant{ID: "acme"}))
+	for _, id := range []string{DefaultID, "acme"} {
+		fleet, err := r.Get(id)
+		require.NoError(t, err)
+		require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}))
+	}
+	assert.Equal(t, []string{"default:FleetReset", "acme:FleetReset"}, seen)
+
+	// the fleets loaded from the state file are subscribed too
+	seen = seen[:0]
+	reloaded := newRegistry(t, factories, WithStateFile(path), handler)
+	fleet, err := reloaded.Get("acme")
+	require.NoError(t, err)
+	require.NoError(t, fleet.Service.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2}))
+	assert.Contains(t, seen, "acme:JourneyAssigned")
+}
+
+func tenantIDs(tenants []Tenant) []string {
+	ids := []string{}
+	for _, t := range tenants {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestRegistry_WatchSchedules(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(now)
+	r := newRegistry(t, memoryFactories(), WithServiceOptions(services.WithClock(clk)))
+	defer r.Close()
+	require.NoError(t, r.Create(&Tenant{ID: "acme"}))
+	fleet, err := r.Get("acme")
+	require.NoError(t, err)
+
+	require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}))
+	pickup := now.Add(time.Hour)
+	require.NoError(t, fleet.Service.NewJourney(ctx, &models.Journey{Id: 1, Passengers: 2, PickupAt: &pickup}))
+
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go r.WatchSchedules(watchCtx, time.Millisecond)
+
+	clk.Advance(time.Hour)
+	assert.Eventually(t, func() bool {
+		car, err := fleet.Service.Locate(ctx, 1)
+		return err == nil && car != nil && car.ID == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRegistry_WatchReservations(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(now)
+	r := newRegistry(t, memoryFactories(), WithServiceOptions(services.WithClock(clk)))
+	defer r.Close()
+	require.NoError(t, r.Create(&Tenant{ID: "acme"}))
+	fleet, err := r.Get("acme")
+	require.NoError(t, err)
+
+	require.NoError(t, fleet.Service.ResetCars(ctx, []*models.Car{{ID: 1, Seats: 4, AvailableSeats: 4}}))
+	require.NoError(t, fleet.Service.Reserve(ctx, &models.Reservation{JourneyID: 1, Passengers: 4, ExpiresAt: now.Add(time.Minute)}))
+
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go r.WatchReservations(watchCtx, time.Millisecond)
+
+	clk.Advance(time.Minute)
+	assert.Eventually(t, func() bool {
+		reservations, err := fleet.Service.Reservations(ctx)
+		return err == nil && len(reservations) == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,57 @@
+// Package tenants runs several fleets in one process, each with its own cars,
+// journeys and pending queue in storage of its own
+package tenants
+
+import (
+	"regexp"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/services"
+)
+
+// DefaultID is the fleet requests naming no tenant are for, it always exists
+const DefaultID = "default"
+
+// ids end up in file names and storage keys
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a fleet with its own seat limits and assignment strategy
+type Tenant struct {
+	ID        string            `json:"id"`
+	MinSeats  uint              `json:"minSeats"`
+	MaxSeats  uint              `json:"maxSeats"`
+	Strategy  services.Strategy `json:"strategy"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Validate fills in the defaults of the settings left out and checks the rest
+func (t *Tenant) Validate() error {
+	if !validID.MatchString(t.ID) {
+		return models.NewAPIError(400, "Invalid tenant id", "lowercase letters, digits and dashes, starting with a letter or digit")
+	}
+	if t.MinSeats == 0 {
+		t.MinSeats = models.MIN_SEATS
+	}
+	if t.MaxSeats == 0 {
+		t.MaxSeats = models.MAX_SEATS
+	}
+	if t.MinSeats > t.MaxSeats {
+		return models.NewAPIError(400, "Invalid seat limits", "minSeats is over maxSeats")
+	}
+	if t.Strategy == "" {
+		t.Strategy = services.StrategyBestFit
+	}
+	if _, err := services.ParseStrategy(string(t.Strategy)); err != nil {
+		return models.NewAPIError(400, "Invalid assignment strategy", err.Error())
+	}
+	return nil
+}
+
+// options configure the service of the tenant fleet
+func (t *Tenant) options() []services.Option {
+	return []services.Option{
+		services.WithSeatLimits(t.MinSeats, t.MaxSeats),
+		services.WithStrategy(t.Strategy),
+	}
+}
@@ -0,0 +1,94 @@
+package tenants
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	promoteFailure     = "Failed to promote scheduled journeys"
+	releaseFailure     = "Failed to release expired reservations"
+	consistencyFailure = "Periodic consistency check failed"
+)
+
+// WatchSchedules promotes the scheduled journeys due in every fleet each
+// interval, until ctx is done
+func (r *Registry) WatchSchedules(ctx context.Context, interval time.Duration) {
+	r.watch(ctx, interval, promoteFailure, promoteDue)
+}
+
+// WatchReservations gives back the seats of the expired reservations in every
+// fleet each interval, until ctx is done
+func (r *Registry) WatchReservations(ctx context.Context, interval time.Duration) {
+	r.watch(ctx, interval, releaseFailure, releaseExpired)
+}
+
+// WatchConsistency checks every fleet each interval until ctx is done,
+// repairing what it finds when asked to, and logs every violation
+func (r *Registry) WatchConsistency(ctx context.Context, interval time.Duration, repair bool) {
+	r.watch(ctx, interval, consistencyFailure, func(ctx context.Context, fleet *Fleet) error {
+		report, err := fleet.Service.CheckConsistency(ctx, repair)
+		if err != nil {
+			return err
+		}
+		for _, v := range report.Violations {
+			r.logger.Warn("Consistency violation found", map[string]interface{}{
+				"tenant":   fleet.Tenant.ID,
+				"kind":     v.Kind,
+				"detail":   v.Detail,
+				"repaired": v.Repaired,
+			})
+		}
+		return nil
+	})
+}
+
+// RunWorkers makes one pass of what WatchSchedules and WatchReservations do
+// periodically, for callers driving time themselves
+func (r *Registry) RunWorkers(ctx context.Context) {
+	r.each(ctx, promoteFailure, promoteDue)
+	r.each(ctx, releaseFailure, releaseExpired)
+}
+
+func promoteDue(ctx context.Context, fleet *Fleet) error {
+	_, err := fleet.Service.PromoteDue(ctx)
+	return err
+}
+
+func releaseExpired(ctx context.Context, fleet *Fleet) error {
+	_, err := fleet.Service.ReleaseExpired(ctx)
+	return err
+}
+
+// watch runs job on every fleet each interval until ctx is done
+func (r *Registry) watch(ctx context.Context, interval time.Duration, failure string, job func(context.Context, *Fleet) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.each(ctx, failure, job)
+	}
+}
+
+// each runs job on every fleet, a fleet failing doesn't hold back the others
+func (r *Registry) each(ctx context.Context, failure string, job func(context.Context, *Fleet) error) {
+	r.mu.RLock()
+	fleets := make([]*Fleet, 0, len(r.fleets))
+	for _, fleet := range r.fleets {
+		fleets = append(fleets, fleet)
+	}
+	r.mu.RUnlock()
+
+	for _, fleet := range fleets {
+		if err := job(ctx, fleet); err != nil && ctx.Err() == nil {
+			r.logger.Error(failure, map[string]interface{}{
+				"tenant": fleet.Tenant.ID,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/logger"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// Config tunes the delivery worker
+type Config struct {
+	// MaxAttempts is the number of tries before a delivery is dead-lettered
+	MaxAttempts int
+	// BaseBackoff is the wait after the first failure, doubled on each retry up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds every single HTTP attempt
+	Timeout time.Duration
+	// PollInterval is how often the worker looks for due deliveries
+	PollInterval time.Duration
+	// Workers bounds how many subscriptions are sent to at once, each one
+	// gets its deliveries in order so a slow endpoint only delays its own
+	Workers int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  8,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   10 * time.Minute,
+		Timeout:      5 * time.Second,
+		PollInterval: time.Second,
+		Workers:      8,
+	}
+}
+
+// Envelope is the JSON body posted to subscribers
+type Envelope struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// JourneyPayload is the data of journey lifecycle events
+type JourneyPayload struct {
+	JourneyID  uint  `json:"journeyId"`
+	Passengers uint  `json:"passengers"`
+	CarID      *uint `json:"carId,omitempty"`
+	// Tenant is the fleet of the journey, empty for the default one
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Dispatcher turns journey notifications into signed deliveries and sends them
+// with exponential backoff, dead-lettering the ones that keep failing.
+type Dispatcher struct {
+	store  *Store
+	config Config
+	client *http.Client
+	logger *logger.Logger
+	slots  chan struct{}
+
+	// busy holds the subscriptions being sent to
+	busy map[string]bool
+	mu   sync.Mutex
+
+	now func() time.Time
+}
+
+func NewDispatcher(store *Store, config Config) *Dispatcher {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return &Dispatcher{
+		store:  store,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		logger: logger.New("webhooks"),
+		slots:  make(chan struct{}, config.Workers),
+		busy:   make(map[string]bool),
+		now:    time.Now,
+	}
+}
+
+func (d *Dispatcher) Store() *Store {
+	return d.store
+}
+
+// Subscribe validates and registers a new subscription
+func (d *Dispatcher) Subscribe(sub *Subscription) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = d.now()
+	if err := d.store.AddSubscription(sub); err != nil {
+		return models.NewAPIError(500, "Failed to store subscription", err.Error())
+	}
+	return nil
+}
+
+func (d *Dispatcher) Unsubscribe(id string) error {
+	return d.store.DeleteSubscription(id)
+}
+
+// HandleEvent maps committed domain events to webhook events, it is meant to be
+// subscribed to the event bus of the default fleet
+func (d *Dispatcher) HandleEvent(e events.Event) {
+	d.handle("", e)
+}
+
+// TenantHandler is HandleEvent for the fleet of a tenant, its notifications
+// name the tenant
+func (d *Dispatcher) TenantHandler(tenant string) events.Handler {
+	return func(e events.Event) {
+		d.handle(tenant, e)
+	}
+}
+
+func (d *Dispatcher) handle(tenant string, e events.Event) {
+	switch e.Type {
+	case events.JourneyAssigned:
+		var data events.JourneyAssignedData
+		if err := e.Decode(&data); err != nil {
+			d.logDecodeError(e, err)
+			return
+		}
+		carID := data.CarID
+		d.Publish(EventJourneyAssigned, JourneyPayload{
+			JourneyID:  data.JourneyID,
+			Passengers: data.Passengers,
+			CarID:      &carID,
+			Tenant:     tenant,
+		})
+
+	case events.ReservationConfirmed:
+		// a confirmed group rides the car it held, like any assigned one
+		var data events.ReservationConfirmedData
+		if err := e.Decode(&data); err != nil {
+			d.logDecodeError(e, err)
+			return
+		}
+		carID := data.CarID
+		d.Publish(EventJourneyAssigned, JourneyPayload{
+			JourneyID:  data.JourneyID,
+			Passengers: data.Passengers,
+			CarID:      &carID,
+			Tenant:     tenant,
+		})
+
+	case events.JourneyDroppedOff:
+		var data events.JourneyDroppedOffData
+		if err := e.Decode(&data); err != nil {
+			d.logDecodeError(e, err)
+			return
+		}
+		d.Publish(EventJourneyCompleted, JourneyPayload{
+			JourneyID:  data.JourneyID,
+			Passengers: data.Passengers,
+			CarID:      data.CarID,
+			Tenant:     tenant,
+		})
+	}
+}
+
+func (d *Dispatcher) logDecodeError(e events.Event, err error) {
+	d.logger.Error("Failed to decode domain event", map[string]interface{}{
+		"seq":   e.Seq,
+		"type":  e.Type,
+		"error": err.Error(),
+	})
+}
+
+// Publish queues one delivery per subscription interested in the event.
+// Sending happens asynchronously in Run.
+func (d *Dispatcher) Publish(event string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		d.logger.Error("Failed to encode webhook payload", map[string]interface{}{
+			"event": event,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	now := d.now()
+	var deliveries []*Delivery
+	for _, sub := range d.store.Subscriptions() {
+		if !sub.Wants(event) {
+			continue
+		}
+		id := uuid.New().String()
+		payload, _ := json.Marshal(Envelope{ID: id, Event: event, CreatedAt: now, Data: raw})
+		deliveries = append(deliveries, &Delivery{
+			ID:             id,
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Payload:        payload,
+			Status:         StatusPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.store.Enqueue(deliveries...); err != nil {
+		d.logger.Error("Failed to enqueue webhook deliveries", map[string]interface{}{
+			"event": event,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Run sends due deliveries until the context is cancelled. A tick doesn't
+// wait for the previous one, subscriptions still being sent to are skipped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.startDue(ctx)
+		}
+	}
+}
+
+// ProcessDue makes one attempt for every delivery that is due, waits for
+// them and returns how many were started
+func (d *Dispatcher) ProcessDue(ctx context.Context) int {
+	started, wg := d.startDue(ctx)
+	wg.Wait()
+	return started
+}
+
+// startDue sends the due deliveries of every idle subscription in a worker of
+// its own, and returns how many it started
+func (d *Dispatcher) startDue(ctx context.Context) (int, *sync.WaitGroup) {
+	var order []string
+	bySubscription := make(map[string][]Delivery)
+	for _, delivery := range d.store.Due(d.now()) {
+		if _, seen := bySubscription[delivery.SubscriptionID]; !seen {
+			order = append(order, delivery.SubscriptionID)
+		}
+		bySubscription[delivery.SubscriptionID] = append(bySubscription[delivery.SubscriptionID], delivery)
+	}
+
+	started := 0
+	var wg sync.WaitGroup
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range order {
+		if d.busy[id] {
+			continue
+		}
+		d.busy[id] = true
+		deliveries := bySubscription[id]
+		started += len(deliveries)
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer d.release(id)
+			select {
+			case d.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-d.slots }()
+			for i := range deliveries {
+				if ctx.Err() != nil {
+					return
+				}
+				d.attempt(ctx, &deliveries[i])
+			}
+		}(id)
+	}
+	return started, &wg
+}
+
+func (d *Dispatcher) release(subscriptionID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.busy, subscriptionID)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	delivery.Attempts++
+
+	sub, err := d.store.FindSubscription(delivery.SubscriptionID)
+	if err != nil {
+		d.deadLetter(delivery, "subscription no longer exists")
+		return
+	}
+
+	statusCode, err := d.send(ctx, sub, delivery)
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		now := d.now()
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		d.save(delivery)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.config.MaxAttempts {
+		d.deadLetter(delivery, err.Error())
+		return
+	}
+
+	delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+	d.logger.Warn("Webhook delivery failed, will retry", map[string]interface{}{
+		"delivery_id":     delivery.ID,
+		"subscription_id": delivery.SubscriptionID,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"error":           err.Error(),
+	})
+	d.save(delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, d.now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the next try after the given number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.config.MaxBackoff {
+			return d.config.MaxBackoff
+		}
+	}
+	return wait
+}
+
+func (d *Dispatcher) deadLetter(delivery *Delivery, reason string) {
+	delivery.Status = StatusDead
+	delivery.LastError = reason
+	d.logger.Error("Webhook delivery dead-lettered", map[string]interface{}{
+		"delivery_id":     delivery.ID,
+		"subscription_id": delivery.SubscriptionID,
+		"attempts":        delivery.Attempts,
+		"error":           reason,
+	})
+	d.save(delivery)
+}
+
+func (d *Dispatcher) save(delivery *Delivery) {
+	if err := d.store.UpdateDelivery(delivery); err != nil {
+		d.logger.Error("Failed to store webhook delivery state", map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"error":       err.Error(),
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/events"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func event(t *testing.T, typ events.Type, data interface{}) events.Event {
+	payload, err := json.Marshal(data)
+	require.NoError(t, err)
+	return events.Event{Type: typ, Payload: payload}
+}
+
+func newTestDispatcher(t *testing.T, path string) (*Dispatcher, *time.Time) {
+	store, err := NewStore(path)
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.MaxAttempts = 3
+	d := NewDispatcher(store, config)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	rcv := &receiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d, now := newTestDispatcher(t, "")
+	sub := &Subscription{URL: server.URL, Events: []string{EventJourneyAssigned}, Secret: "s3cr3t"}
+	require.NoError(t, d.Subscribe(sub))
+
+	d.HandleEvent(event(t, events.JourneyAssigned, events.JourneyAssignedData{JourneyID: 7, CarID: 2, Passengers: 3}))
+	// not subscribed to completions
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 7, Passengers: 3}))
+
+	assert.Equal(t, 1, d.ProcessDue(context.Background()))
+	require.Len(t, rcv.bodies, 1)
+
+	header := rcv.headers[0]
+	assert.Equal(t, EventJourneyAssigned, header.Get(EventHeader))
+	assert.NoError(t, Verify("s3cr3t", header.Get(SignatureHeader), rcv.bodies[0], *now, time.Minute))
+	assert.Equal(t, ErrInvalidSignature, Verify("other", header.Get(SignatureHeader), rcv.bodies[0], *now, time.Minute))
+
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(rcv.bodies[0], &envelope))
+	assert.Equal(t, header.Get(DeliveryHeader), envelope.ID)
+	assert.JSONEq(t, `{"journeyId":7,"passengers":3,"carId":2}`, string(envelope.Data))
+
+	delivered := d.Store().Deliveries(StatusDelivered, "")
+	require.Len(t, delivered, 1)
+	assert.Equal(t, 1, delivered[0].Attempts)
+}
+
+func TestDispatcher_TenantHandlerNamesTheTenant(t *testing.T) {
+	d, _ := newTestDispatcher(t, "")
+	require.NoError(t, d.Subscribe(&Subscription{URL: "http://example.com", Events: []string{EventJourneyAssigned, EventJourneyCompleted}, Secret: "s3cr3t"}))
+
+	d.TenantHandler("acme")(event(t, events.JourneyAssigned, events.JourneyAssignedData{JourneyID: 7, CarID: 2, Passengers: 3}))
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 7, Passengers: 3}))
+
+	pending := d.Store().Deliveries(StatusPending, "")
+	require.Len(t, pending, 2)
+	data := map[string]string{}
+	for _, delivery := range pending {
+		var envelope Envelope
+		require.NoError(t, json.Unmarshal(delivery.Payload, &envelope))
+		data[envelope.Event] = string(envelope.Data)
+	}
+	assert.JSONEq(t, `{"journeyId":7,"passengers":3,"carId":2,"tenant":"acme"}`, data[EventJourneyAssigned])
+	// the default fleet names no tenant
+	assert.JSONEq(t, `{"journeyId":7,"passengers":3}`, data[EventJourneyCompleted])
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	rcv := &receiver{failures: 2}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d, now := newTestDispatcher(t, "")
+	require.NoError(t, d.Subscribe(&Subscription{URL: server.URL, Events: []string{EventJourneyCompleted}, Secret: "k"}))
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 1, Passengers: 2}))
+
+	assert.Equal(t, 1, d.ProcessDue(context.Background()))
+	pending := d.Store().Deliveries(StatusPending, "")
+	require.Len(t, pending, 1)
+	assert.Equal(t, now.Add(time.Second), pending[0].NextAttemptAt)
+	assert.Equal(t, http.StatusServiceUnavailable, pending[0].LastStatusCode)
+
+	// nothing is due before the backoff expires
+	assert.Equal(t, 0, d.ProcessDue(context.Background()))
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, 1, d.ProcessDue(context.Background()))
+	pending = d.Store().Deliveries(StatusPending, "")
+	require.Len(t, pending, 1)
+	assert.Equal(t, now.Add(2*time.Second), pending[0].NextAttemptAt)
+
+	*now = now.Add(2 * time.Second)
+	assert.Equal(t, 1, d.ProcessDue(context.Background()))
+	assert.Len(t, d.Store().Deliveries(StatusDelivered, ""), 1)
+	assert.Len(t, rcv.bodies, 3)
+}
+
+func TestDispatcher_DeadLettersAfterMaxAttempts(t *testing.T) {
+	rcv := &receiver{failures: 10}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d, now := newTestDispatcher(t, "")
+	require.NoError(t, d.Subscribe(&Subscription{URL: server.URL, Events: []string{EventJourneyCompleted}, Secret: "k"}))
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 1, Passengers: 2}))
+
+	for i := 0; i < 5; i++ {
+		d.ProcessDue(context.Background())
+		*now = now.Add(time.Hour)
+	}
+
+	dead := d.Store().Deliveries(StatusDead, "")
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Len(t, rcv.bodies, 3)
+}
+
+func TestStore_PersistsQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+
+	d, _ := newTestDispatcher(t, path)
+	sub := &Subscription{URL: "http://127.0.0.1:1/hook", Events: []string{EventJourneyAssigned}, Secret: "k"}
+	require.NoError(t, d.Subscribe(sub))
+	d.HandleEvent(event(t, events.JourneyAssigned, events.JourneyAssignedData{JourneyID: 3, CarID: 1, Passengers: 1}))
+
+	reloaded, err := NewStore(path)
+	require.NoError(t, err)
+	require.Len(t, reloaded.Subscriptions(), 1)
+	assert.Equal(t, "k", reloaded.Subscriptions()[0].Secret)
+	pending := reloaded.Deliveries(StatusPending, sub.ID)
+	require.Len(t, pending, 1)
+	assert.Equal(t, EventJourneyAssigned, pending[0].Event)
+}
+
+func TestDispatcher_SlowSubscriberDelaysOnlyItself(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	defer close(release)
+	rcv := &receiver{}
+	fast := httptest.NewServer(rcv)
+	defer fast.Close()
+
+	d, _ := newTestDispatcher(t, "")
+	require.NoError(t, d.Subscribe(&Subscription{URL: slow.URL, Events: []string{EventJourneyCompleted}, Secret: "k"}))
+	require.NoError(t, d.Subscribe(&Subscription{URL: fast.URL, Events: []string{EventJourneyCompleted}, Secret: "k"}))
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 1, Passengers: 2}))
+	d.HandleEvent(event(t, events.JourneyDroppedOff, events.JourneyDroppedOffData{JourneyID: 2, Passengers: 2}))
+
+	started, wg := d.startDue(context.Background())
+	assert.Equal(t, 4, started)
+	assert.Eventually(t, func() bool {
+		return len(d.Store().Deliveries(StatusDelivered, "")) == 2
+	}, time.Second, 10*time.Millisecond)
+	// the slow subscription is still being sent to, the next tick skips it
+	started, _ = d.startDue(context.Background())
+	assert.Equal(t, 0, started)
+
+	release <- struct{}{}
+	release <- struct{}{}
+	wg.Wait()
+	assert.Len(t, d.Store().Deliveries(StatusDelivered, ""), 4)
+}
+
+func TestStore_AppendsAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.AddSubscription(&Subscription{ID: "a", URL: "http://x", Events: []string{EventJourneyAssigned}, Secret: "k"}))
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	total := maxKept[StatusDead] + compactSlack
+	for i := 0; i < total; i++ {
+		d := &Delivery{ID: fmt.Sprint(i), SubscriptionID: "a", Payload: json.RawMessage(`{}`), Status: StatusPending, CreatedAt: now}
+		require.NoError(t, store.Enqueue(d))
+		d.Status, d.Attempts = StatusDead, 3
+		require.NoError(t, store.UpdateDelivery(d))
+	}
+	// dead deliveries are capped like delivered ones
+	assert.Len(t, store.Deliveries(StatusDead, ""), maxKept[StatusDead])
+	// the file was compacted along the way rather than holding every record
+	assert.Less(t, store.logged, 2*total)
+
+	reloaded, err := NewStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, store.Deliveries("", ""), reloaded.Deliveries("", ""))
+	assert.Len(t, reloaded.Subscriptions(), 1)
+}
+
+func TestSubscription_Validate(t *testing.T) {
+	assert.Error(t, (&Subscription{URL: "ftp://x", Events: []string{EventJourneyAssigned}, Secret: "k"}).Validate())
+	assert.Error(t, (&Subscription{URL: "http://x", Events: []string{"car.crashed"}, Secret: "k"}).Validate())
+	assert.Error(t, (&Subscription{URL: "http://x", Events: []string{EventJourneyAssigned}}).Validate())
+	assert.NoError(t, (&Subscription{URL: "https://x", Events: []string{EventJourneyAssigned}, Secret: "k"}).Validate())
+}
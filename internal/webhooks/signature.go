@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent along with every delivery
+const (
+	SignatureHeader = "X-Carpool-Signature"
+	EventHeader     = "X-Carpool-Event"
+	DeliveryHeader  = "X-Carpool-Delivery"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign computes the signature header value for a payload sent at the given time.
+// The format is "t=<unix seconds>,v1=<hex hmac-sha256(secret, t + "." + body)>",
+// so receivers can reject replayed payloads by checking the timestamp.
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, computeMAC(secret, ts, body))
+}
+
+// Verify checks a signature header produced by Sign. A zero tolerance skips the
+// timestamp freshness check.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, mac string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			mac = kv[1]
+		}
+	}
+	if ts == "" || mac == "" {
+		return ErrInvalidSignature
+	}
+
+	expected := computeMAC(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(mac)) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+func computeMAC(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
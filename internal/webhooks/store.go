@@ -0,0 +1,341 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+type DeliveryStatus string
+
+const (
+	StatusPending   DeliveryStatus = "pending"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusDead      DeliveryStatus = "dead"
+)
+
+// maxKept bounds how many deliveries of each status stay in the log, the
+// oldest go first. Pending ones are only dropped when a subscriber has been
+// failing for so long that this many piled up behind it.
+var maxKept = map[DeliveryStatus]int{
+	StatusPending:   10000,
+	StatusDelivered: 1000,
+	StatusDead:      1000,
+}
+
+// compactSlack is how many records the state file may hold over twice the
+// live state before it is rewritten from scratch
+const compactSlack = 1000
+
+// Delivery is one event to be sent to one subscription, together with its
+// retry state. The delivery log endpoint exposes these as they are.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+}
+
+// record is one line of the state file. Changes are appended as they happen
+// and the latest record of a delivery wins when the file is read back.
+type record struct {
+	Subscription *Subscription `json:"subscription,omitempty"`
+	Unsubscribed string        `json:"unsubscribed,omitempty"`
+	Delivery     *Delivery     `json:"delivery,omitempty"`
+}
+
+// state is the whole file the store wrote before changes were appended,
+// still read so existing files keep working
+type state struct {
+	Subscriptions []*Subscription `json:"subscriptions"`
+	Deliveries    []*Delivery     `json:"deliveries"`
+}
+
+// Store keeps subscriptions and the delivery queue. When created with a path
+// every change is appended to that file so queued deliveries survive
+// restarts, and the file is compacted once it is mostly superseded records.
+type Store struct {
+	path string
+	// logged counts the records in the file
+	logged int
+
+	subscriptions map[string]*Subscription
+	deliveries    []*Delivery
+	mu            sync.Mutex
+}
+
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:          path,
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make([]*Delivery, 0),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	index := make(map[string]int)
+	put := func(d *Delivery) {
+		if i, ok := index[d.ID]; ok {
+			s.deliveries[i] = d
+			return
+		}
+		index[d.ID] = len(s.deliveries)
+		s.deliveries = append(s.deliveries, d)
+	}
+	dec := json.NewDecoder(f)
+	for {
+		var line struct {
+			record
+			state
+		}
+		err := dec.Decode(&line)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a write cut short by a crash only loses its own record
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.logged++
+		for _, sub := range append(line.Subscriptions, line.Subscription) {
+			if sub != nil {
+				s.subscriptions[sub.ID] = sub
+			}
+		}
+		if line.Unsubscribed != "" {
+			delete(s.subscriptions, line.Unsubscribed)
+		}
+		for _, d := range append(line.Deliveries, line.Delivery) {
+			if d != nil {
+				put(d)
+			}
+		}
+	}
+	s.trim()
+	return s, nil
+}
+
+func (s *Store) AddSubscription(sub *Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *sub
+	s.subscriptions[sub.ID] = &copied
+	return s.append(record{Subscription: &copied})
+}
+
+func (s *Store) DeleteSubscription(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subscriptions[id]; !exists {
+		return models.ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	return s.append(record{Unsubscribed: id})
+}
+
+func (s *Store) FindSubscription(id string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, exists := s.subscriptions[id]
+	if !exists {
+		return nil, models.ErrNotFound
+	}
+	copied := *sub
+	return &copied, nil
+}
+
+// Subscriptions returns all subscriptions ordered by creation time
+func (s *Store) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].ID < subs[j].ID
+		}
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+func (s *Store) Enqueue(deliveries ...*Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]record, 0, len(deliveries))
+	for _, d := range deliveries {
+		copied := *d
+		s.deliveries = append(s.deliveries, &copied)
+		records = append(records, record{Delivery: &copied})
+	}
+	s.trim()
+	return s.append(records...)
+}
+
+// Due returns the pending deliveries whose next attempt is not after now
+func (s *Store) Due(now time.Time) []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Delivery
+	for _, d := range s.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, *d)
+		}
+	}
+	return due
+}
+
+// UpdateDelivery stores the new retry state of a delivery
+func (s *Store) UpdateDelivery(d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.deliveries {
+		if existing.ID == d.ID {
+			*existing = *d
+			s.trim()
+			copied := *existing
+			return s.append(record{Delivery: &copied})
+		}
+	}
+	return models.ErrNotFound
+}
+
+// Deliveries returns the delivery log, newest first, optionally filtered
+func (s *Store) Deliveries(status DeliveryStatus, subscriptionID string) []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Delivery, 0)
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		d := s.deliveries[i]
+		if status != "" && d.Status != status {
+			continue
+		}
+		if subscriptionID != "" && d.SubscriptionID != subscriptionID {
+			continue
+		}
+		result = append(result, *d)
+	}
+	return result
+}
+
+// trim drops the oldest deliveries of every status over its bound
+func (s *Store) trim() {
+	counts := make(map[DeliveryStatus]int)
+	for _, d := range s.deliveries {
+		counts[d.Status]++
+	}
+	over := false
+	for status, count := range counts {
+		if count > maxKept[status] {
+			over = true
+		}
+	}
+	if !over {
+		return
+	}
+
+	kept := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if counts[d.Status] > maxKept[d.Status] {
+			counts[d.Status]--
+			continue
+		}
+		kept = append(kept, d)
+	}
+	s.deliveries = kept
+}
+
+// append writes the records at the end of the state file, and compacts it
+// when most of it no longer matters. Callers must hold the lock.
+func (s *Store) append(records ...record) error {
+	if s.path == "" {
+		return nil
+	}
+	if s.logged+len(records) > 2*(len(s.subscriptions)+len(s.deliveries))+compactSlack {
+		return s.compact()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.logged += len(records)
+	return nil
+}
+
+// compact rewrites the state file atomically with one record per
+// subscription and delivery, callers must hold the lock
+func (s *Store) compact() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, sub := range s.subscriptions {
+		if err := enc.Encode(record{Subscription: sub}); err != nil {
+			return err
+		}
+	}
+	for _, d := range s.deliveries {
+		if err := enc.Encode(record{Delivery: d}); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.logged = len(s.subscriptions) + len(s.deliveries)
+	return nil
+}
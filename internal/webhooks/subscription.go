@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"net/url"
+	"time"
+
+	"gitlab-hiring.cabify.tech/cabify/interviewing/car-pooling-challenge-go/internal/models"
+)
+
+// Event types partners can subscribe to
+const (
+	EventJourneyAssigned  = "journey.assigned"
+	EventJourneyCompleted = "journey.completed"
+)
+
+var knownEvents = map[string]bool{
+	EventJourneyAssigned:  true,
+	EventJourneyCompleted: true,
+}
+
+// Subscription is a partner endpoint registered to receive some event types.
+// The secret is used to sign every payload and is never returned by the API.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.NewAPIError(400, "Invalid webhook url", s.URL)
+	}
+	if len(s.Events) == 0 {
+		return models.NewAPIError(400, "At least one event type is required", "")
+	}
+	for _, e := range s.Events {
+		if !knownEvents[e] {
+			return models.NewAPIError(400, "Unknown event type", e)
+		}
+	}
+	if s.Secret == "" {
+		return models.NewAPIError(400, "Webhook secret is required", "")
+	}
+	return nil
+}
+
+func (s *Subscription) Wants(event string) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Public returns a copy of the subscription safe to expose through the API
+func (s Subscription) Public() Subscription {
+	s.Secret = ""
+	return s
+}